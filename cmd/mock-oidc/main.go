@@ -0,0 +1,44 @@
+// Package main runs an OpenID provider for local development that signs everyone in as the configured user,
+// point an oidc provider of config.yaml at it to try the login flow without an external account
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/pkg/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "address to listen on")
+	clientID := flag.String("client-id", "marketplace", "accepted client ID")
+	clientSecret := flag.String("client-secret", "secret", "accepted client secret")
+	subject := flag.String("subject", "mock-user", "subject of the signed in user")
+	email := flag.String("email", "mock-user@example.com", "email of the signed in user")
+	username := flag.String("username", "mockuser", "preferred username of the signed in user")
+	flag.Parse()
+
+	issuer := "http://" + *addr
+	if strings.HasPrefix(*addr, ":") {
+		issuer = "http://localhost" + *addr
+	}
+
+	provider, err := oidctest.NewProvider(issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("failed to create provider: %v", err)
+	}
+	provider.SetUser(oidctest.User{Subject: *subject, Email: *email, PreferredUsername: *username})
+
+	srv := &http.Server{
+		Handler:      provider,
+		Addr:         *addr,
+		ReadTimeout:  constants.ServerTimeout,
+		WriteTimeout: constants.ServerTimeout,
+	}
+
+	log.Printf("mock OpenID provider running at %s", issuer)
+	log.Fatal(srv.ListenAndServe())
+}
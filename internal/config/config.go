@@ -3,13 +3,16 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-// ServerConfig holds server-related settings
+// ServerConfig holds server-related settings, with TrustProxy the client address is taken from
+// the last X-Forwarded-For entry, which is only safe behind a proxy that sets the header
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port       int  `yaml:"port"`
+	TrustProxy bool `yaml:"trust_proxy"`
 }
 
 // LoggingConfig holds logging-related settings
@@ -22,9 +25,125 @@ type DatabaseConfig struct {
 	Connection string `yaml:"connection"`
 }
 
-// JWTConfig holds jwt-related settings
+// JWTKeyConfig holds a token key loaded from PEM files, keys with a private key file can sign
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// JWTConfig holds jwt-related settings, zero token lifetimes and leeway use the defaults from constants.
+// Tokens are signed with the key SigningKey of Keys, the HS256 Secret is only used when no keys are configured.
+// Issuer and Audience are set on issued tokens and required from verified ones. PurposeSecret signs the tokens
+// of a two-step login and is random for every start when empty
 type JWTConfig struct {
-	Secret string `yaml:"secret"`
+	Secret        string         `yaml:"secret"`
+	PurposeSecret string         `yaml:"purpose_secret"`
+	SigningKey    string         `yaml:"signing_key"`
+	Keys          []JWTKeyConfig `yaml:"keys"`
+	Issuer        string         `yaml:"issuer"`
+	Audience      string         `yaml:"audience"`
+	Leeway        time.Duration  `yaml:"leeway"`
+	AccessTTL     time.Duration  `yaml:"access_ttl"`
+	RefreshTTL    time.Duration  `yaml:"refresh_ttl"`
+}
+
+// AdminConfig holds admin-related settings, Logins are granted the admin role at startup
+type AdminConfig struct {
+	Logins []string `yaml:"logins"`
+}
+
+// CurrencyConfig holds currency-related settings
+type CurrencyConfig struct {
+	Base string `yaml:"base"`
+}
+
+// S3Config holds settings of an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// StorageConfig holds uploaded file storage settings, driver is local or s3
+type StorageConfig struct {
+	Driver       string   `yaml:"driver"`
+	LocalPath    string   `yaml:"local_path"`
+	MaxImageSize int64    `yaml:"max_image_size"`
+	S3           S3Config `yaml:"s3"`
+}
+
+// MailConfig holds settings of the mailer, driver is stdout or file, the file driver appends messages to Path
+type MailConfig struct {
+	Driver string `yaml:"driver"`
+	Path   string `yaml:"path"`
+}
+
+// PasswordHashConfig holds the Argon2id cost parameters of new password hashes, Memory is in KiB.
+// Zero values use the defaults from constants, stored hashes with other parameters are replaced at the next login
+type PasswordHashConfig struct {
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+}
+
+// PasswordPolicyConfig holds the rules of new passwords, a zero MinLength uses the default from constants.
+// CharacterClasses is how many of lowercase letters, uppercase letters, digits and symbols a password mixes,
+// MaxRepeated limits runs of one character and RejectLogin refuses passwords similar to the login, zero values
+// turn the rules off. BreachedDir holds the range files of a breached password list, passwords listed there are refused
+type PasswordPolicyConfig struct {
+	MinLength        int    `yaml:"min_length"`
+	CharacterClasses int    `yaml:"character_classes"`
+	MaxRepeated      int    `yaml:"max_repeated"`
+	RejectLogin      bool   `yaml:"reject_login"`
+	BreachedDir      string `yaml:"breached_dir"`
+}
+
+// PasswordConfig holds password settings, a zero ResetTTL uses the default from constants.
+// ResetURL is the page of the web client the token is appended to in reset emails
+type PasswordConfig struct {
+	ResetURL string               `yaml:"reset_url"`
+	ResetTTL time.Duration        `yaml:"reset_ttl"`
+	Hash     PasswordHashConfig   `yaml:"hash"`
+	Policy   PasswordPolicyConfig `yaml:"policy"`
+}
+
+// LoginConfig holds brute-force protection settings, zero values use the defaults from constants.
+// A login or an address is locked out after MaxAttempts or MaxAttemptsPerIP failed logins, every further
+// lockout lasts twice as long as the previous one up to MaxLockout
+type LoginConfig struct {
+	MaxAttempts      int           `yaml:"max_attempts"`
+	MaxAttemptsPerIP int           `yaml:"max_attempts_per_ip"`
+	Lockout          time.Duration `yaml:"lockout"`
+	MaxLockout       time.Duration `yaml:"max_lockout"`
+}
+
+// MFAConfig holds two-factor authentication settings, Issuer names the service in authenticator apps
+// and PendingTTL limits the time between the password step and the code step of a login,
+// zero values use the defaults from constants
+type MFAConfig struct {
+	Issuer     string        `yaml:"issuer"`
+	PendingTTL time.Duration `yaml:"pending_ttl"`
+}
+
+// OIDCProviderConfig holds an OpenID provider users sign in with, Name identifies it in URLs and linked identities
+// and must not change once users linked identities. Scopes default to openid, profile and email
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// OIDCConfig holds OpenID Connect login settings, RedirectURL is the page of the web client providers redirect
+// back to and must be registered at every provider. A zero StateTTL uses the default from constants
+type OIDCConfig struct {
+	RedirectURL string               `yaml:"redirect_url"`
+	StateTTL    time.Duration        `yaml:"state_ttl"`
+	Providers   []OIDCProviderConfig `yaml:"providers"`
 }
 
 // Config aggregates all service configurations
@@ -33,6 +152,14 @@ type Config struct {
 	Logging  LoggingConfig  `yaml:"logging"`
 	Database DatabaseConfig `yaml:"database"`
 	JWT      JWTConfig      `yaml:"jwt"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Currency CurrencyConfig `yaml:"currency"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Mail     MailConfig     `yaml:"mail"`
+	Password PasswordConfig `yaml:"password"`
+	Login    LoginConfig    `yaml:"login"`
+	MFA      MFAConfig      `yaml:"mfa"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
 }
 
 // LoadConfig loads the configuration from the given YAML file path
@@ -16,12 +16,79 @@ const (
 	// MaxLenLogin defines the maximum allowed login length
 	MaxLenLogin = 50
 
-	// OneDayTimeout is used for cache/session expiration
-	OneDayTimeout = 24 * time.Hour
+	// AccessTokenTTL is the default lifetime of an access token
+	AccessTokenTTL = 15 * time.Minute
+
+	// RefreshTokenTTL is the default lifetime of a refresh token
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// PasswordResetTTL is the default lifetime of a password reset token
+	PasswordResetTTL = time.Hour
+
+	// MaxLenEmail is the longest email address accepted
+	MaxLenEmail = 254
+
+	// PasswordHashMemory is the default memory of Argon2id password hashing in KiB
+	PasswordHashMemory = 64 * 1024
+
+	// PasswordHashIterations is the default number of Argon2id passes over the memory
+	PasswordHashIterations = 3
+
+	// PasswordHashParallelism is the default number of Argon2id lanes
+	PasswordHashParallelism = 4
+
+	// LoginMaxAttempts is the default number of failed logins of an account before it is locked out
+	LoginMaxAttempts = 5
+
+	// LoginMaxAttemptsPerIP is the default number of failed logins from an address before it is locked out
+	LoginMaxAttemptsPerIP = 20
+
+	// LoginLockout is the default duration of the first lockout
+	LoginLockout = time.Minute
+
+	// LoginMaxLockout is the default longest lockout, failures are forgotten once it passes after the last lockout
+	LoginMaxLockout = time.Hour
+
+	// MFAPendingTTL is the default lifetime of the token that connects the password step and the code step of a login
+	MFAPendingTTL = 5 * time.Minute
+
+	// MFAIssuer is the default name of the service shown by authenticator apps
+	MFAIssuer = "Marketplace"
+
+	// RecoveryCodes is the number of recovery codes generated when TOTP is enabled
+	RecoveryCodes = 10
+
+	// MaxAPIKeys is the number of active API keys a user may have
+	MaxAPIKeys = 20
+
+	// MaxLenAPIKeyName defines the maximum allowed API key name length
+	MaxLenAPIKeyName = 100
+
+	// OIDCStateTTL is the default time a user has to sign in at an OpenID provider
+	OIDCStateTTL = 10 * time.Minute
+
+	// OIDCTimeout limits a request to an OpenID provider
+	OIDCTimeout = 10 * time.Second
+
+	// SessionCacheTTL is how long the state of a session is cached in memory, sessions ended on another
+	// instance are noticed after it passes
+	SessionCacheTTL = time.Minute
+
+	// SessionSeenFlushInterval is how often the recorded last uses of sessions are written to the database
+	SessionSeenFlushInterval = 30 * time.Second
+
+	// MaxLenUserAgent is the longest user agent stored with a session, longer ones are cut
+	MaxLenUserAgent = 512
+
+	// TokenLeeway is the default clock skew tolerated when checking token times
+	TokenLeeway = 30 * time.Second
 
 	// ServerTimeout is read and write timeout of server config
 	ServerTimeout = 15 * time.Second
 
+	// ImageProxyTimeout limits fetching an external image through the image proxy
+	ImageProxyTimeout = 10 * time.Second
+
 	// DirPerm - Directory permission
 	DirPerm = 0o750
 
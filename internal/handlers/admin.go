@@ -0,0 +1,149 @@
+// Package handlers contains HTTP handlers for user and content moderation
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// AdminService is an interface that contains admin service methods
+type AdminService interface {
+	ListUsers(ctx context.Context, actorID, page, limit int) (*models.UserPage, error)
+	SetUserRole(ctx context.Context, actorID, userID int, role models.Role) (*models.User, error)
+	SetUserDisabled(ctx context.Context, actorID, userID int, disabled bool) (*models.User, error)
+	RemoveItem(ctx context.Context, actorID, itemID int) error
+}
+
+// AdminHandler handles user management and moderation HTTP requests
+type AdminHandler struct {
+	Svc    AdminService
+	logger *logging.Logger
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(svc AdminService, logger *logging.Logger) *AdminHandler {
+	return &AdminHandler{Svc: svc, logger: logger}
+}
+
+// ListUsers handles GET /admin/users — lists users with pagination
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	out, err := h.Svc.ListUsers(r.Context(), middleware.GetUserID(r), page, limit)
+	if err != nil {
+		h.writeAdminError(w, err, "failed to list users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// SetUserRole handles PUT /admin/users/{id}/role — changes the role of a user to the role of the request body
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := userIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid user id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request body:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Svc.SetUserRole(r.Context(), middleware.GetUserID(r), id, req.Role)
+	if err != nil {
+		h.writeAdminError(w, err, "failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// SetUserDisabled returns a handler of POST /admin/users/{id}/disable and /enable,
+// disabling a user blocks their logins and ends their sessions
+func (h *AdminHandler) SetUserDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := userIDFromRequest(r)
+		if err != nil {
+			http.Error(w, `{"error":"invalid user id"}`, http.StatusBadRequest)
+			return
+		}
+
+		user, err := h.Svc.SetUserDisabled(r.Context(), middleware.GetUserID(r), id, disabled)
+		if err != nil {
+			h.writeAdminError(w, err, "failed to update user")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(user)
+	}
+}
+
+// RemoveItem handles DELETE /moderation/items/{id} — removes an item of any author
+func (h *AdminHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Svc.RemoveItem(r.Context(), middleware.GetUserID(r), id); err != nil {
+		h.writeAdminError(w, err, "failed to remove item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminError logs err and responds with its status, internal errors are replaced by fallback
+func (h *AdminHandler) writeAdminError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	status := adminErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		http.Error(w, `{"error":"`+fallback+`"}`, status)
+		return
+	}
+	http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+}
+
+// userIDFromRequest reads the {id} path variable of a user route
+func userIDFromRequest(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid user id")
+	}
+	return id, nil
+}
+
+// adminErrorStatus maps admin service errors to HTTP status codes
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrRoleNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrOwnAccount):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAdminService struct {
+	mock.Mock
+}
+
+func (m *MockAdminService) ListUsers(ctx context.Context, actorID, page, limit int) (*models.UserPage, error) {
+	args := m.Called(ctx, actorID, page, limit)
+	out, _ := args.Get(0).(*models.UserPage)
+	return out, args.Error(1)
+}
+
+func (m *MockAdminService) SetUserRole(ctx context.Context, actorID, userID int, role models.Role) (*models.User, error) {
+	args := m.Called(ctx, actorID, userID, role)
+	user, _ := args.Get(0).(*models.User)
+	return user, args.Error(1)
+}
+
+func (m *MockAdminService) SetUserDisabled(ctx context.Context, actorID, userID int, disabled bool) (*models.User, error) {
+	args := m.Called(ctx, actorID, userID, disabled)
+	user, _ := args.Get(0).(*models.User)
+	return user, args.Error(1)
+}
+
+func (m *MockAdminService) RemoveItem(ctx context.Context, actorID, itemID int) error {
+	args := m.Called(ctx, actorID, itemID)
+	return args.Error(0)
+}
+
+func TestAdminHandler_ListUsers(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockAdminService)
+	handler := NewAdminHandler(mockSvc, logger)
+
+	mockSvc.On("ListUsers", mock.Anything, 1, 2, 5).Return(&models.UserPage{
+		Users: []*models.User{{ID: 3, Login: "moder", Role: models.RoleModerator}},
+		Page:  2, Limit: 5, Total: 6, TotalPages: 2,
+	}, nil).Once()
+
+	req := setUserContext(httptest.NewRequest(http.MethodGet, "/admin/users?page=2&limit=5", http.NoBody), 1, "admin")
+	w := httptest.NewRecorder()
+	handler.ListUsers(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	body := new(bytes.Buffer)
+	_, _ = body.ReadFrom(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body.String(), `"role":"moderator"`)
+	assert.Contains(t, body.String(), `"total_pages":2`)
+	assert.NotContains(t, body.String(), "hash")
+
+	mockSvc.On("ListUsers", mock.Anything, 1, 2, 5).Return(nil, errors.New("db error")).Once()
+	w = httptest.NewRecorder()
+	handler.ListUsers(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), "failed to list users")
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestAdminHandler_SetUserRole(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockAdminService)
+	handler := NewAdminHandler(mockSvc, logger)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name: "successful role change",
+			id:   "3",
+			body: `{"role":"moderator"}`,
+			setupMock: func() {
+				mockSvc.On("SetUserRole", mock.Anything, 1, 3, models.RoleModerator).
+					Return(&models.User{ID: 3, Login: "moder", Role: models.RoleModerator}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"role":"moderator"`,
+		},
+		{
+			name:           "invalid user id",
+			id:             "x",
+			body:           `{"role":"moderator"}`,
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid user id",
+		},
+		{
+			name:           "invalid json body",
+			id:             "3",
+			body:           `{"role":`,
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid request format",
+		},
+		{
+			name: "unknown role",
+			id:   "3",
+			body: `{"role":"owner"}`,
+			setupMock: func() {
+				mockSvc.On("SetUserRole", mock.Anything, 1, 3, models.Role("owner")).
+					Return(nil, service.ErrInvalidRole).Once()
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "unknown role",
+		},
+		{
+			name: "user not found",
+			id:   "3",
+			body: `{"role":"admin"}`,
+			setupMock: func() {
+				mockSvc.On("SetUserRole", mock.Anything, 1, 3, models.RoleAdmin).
+					Return(nil, service.ErrUserNotFound).Once()
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantContains:   "user not found",
+		},
+		{
+			name: "actor lost the admin role",
+			id:   "3",
+			body: `{"role":"admin"}`,
+			setupMock: func() {
+				mockSvc.On("SetUserRole", mock.Anything, 1, 3, models.RoleAdmin).
+					Return(nil, fmt.Errorf("%w: admin role required", service.ErrRoleNotAllowed)).Once()
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantContains:   "admin role required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/users/"+tt.id+"/role", strings.NewReader(tt.body))
+			req = mux.SetURLVars(setUserContext(req, 1, "admin"), map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+
+			handler.SetUserRole(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(resp.Body)
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			assert.Contains(t, body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_SetUserDisabledAndRemoveItem(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockAdminService)
+	handler := NewAdminHandler(mockSvc, logger)
+
+	mockSvc.On("SetUserDisabled", mock.Anything, 1, 3, true).Return(&models.User{ID: 3, Login: "spammer"}, nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/3/disable", http.NoBody)
+	req = mux.SetURLVars(setUserContext(req, 1, "admin"), map[string]string{"id": "3"})
+	w := httptest.NewRecorder()
+	handler.SetUserDisabled(true)(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	mockSvc.On("SetUserDisabled", mock.Anything, 1, 3, false).Return(nil, service.ErrOwnAccount).Once()
+
+	w = httptest.NewRecorder()
+	handler.SetUserDisabled(false)(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockSvc.On("RemoveItem", mock.Anything, 1, 5).Return(nil).Once()
+
+	req = httptest.NewRequest(http.MethodDelete, "/moderation/items/5", http.NoBody)
+	req = mux.SetURLVars(setUserContext(req, 1, "admin"), map[string]string{"id": "5"})
+	w = httptest.NewRecorder()
+	handler.RemoveItem(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	mockSvc.On("RemoveItem", mock.Anything, 1, 5).Return(service.ErrItemNotFound).Once()
+
+	w = httptest.NewRecorder()
+	handler.RemoveItem(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	mockSvc.AssertExpectations(t)
+}
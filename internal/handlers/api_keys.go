@@ -0,0 +1,88 @@
+// Package handlers contains HTTP handlers for personal API keys
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// CreateAPIKey handles POST /auth/api-keys — creates an API key of the current user, the key itself is in the
+// response only once
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string               `json:"name"`
+		Scopes    []models.APIKeyScope `json:"scopes"`
+		ExpiresAt *time.Time           `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	key, secret, err := h.AuthService.CreateAPIKey(r.Context(), middleware.GetUserID(r), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		h.writeAPIKeyError(w, err, "failed to create api key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{APIKey: key, Key: secret})
+}
+
+// ListAPIKeys handles GET /auth/api-keys — lists the API keys of the current user that were not revoked
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.AuthService.ListAPIKeys(r.Context(), middleware.GetUserID(r))
+	if err != nil {
+		h.writeAPIKeyError(w, err, "failed to list api keys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"api_keys": keys})
+}
+
+// RevokeAPIKey handles DELETE /auth/api-keys/{id} — revokes an API key of the current user
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid api key id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.RevokeAPIKey(r.Context(), middleware.GetUserID(r), id); err != nil {
+		h.writeAPIKeyError(w, err, "failed to revoke api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAPIKeyError logs err and responds with its status, errors the user can fix are reported as they are
+// and other errors are replaced by fallback
+func (h *AuthHandler) writeAPIKeyError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKeyRequest), errors.Is(err, service.ErrTooManyAPIKeys):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, service.ErrAccountDisabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+	default:
+		http.Error(w, `{"error":"`+fallback+`"}`, http.StatusInternalServerError)
+	}
+}
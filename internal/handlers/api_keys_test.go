@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthHandler_CreateAPIKey(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(m *MockAuthService)
+		wantStatusCode int
+		wantContains   []string
+	}{
+		{
+			name: "key created",
+			body: `{"name":"sync","scopes":["items:write"],"expires_at":"2030-01-01T00:00:00Z"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("CreateAPIKey", mock.Anything, 1, "sync", []models.APIKeyScope{models.ScopeItemsWrite}, &expiresAt).
+					Return(&models.APIKey{ID: 3, UserID: 1, Name: "sync", Prefix: "mk_abcdefgh", KeyHash: "hash",
+						Scopes: []models.APIKeyScope{models.ScopeItemsWrite}, ExpiresAt: &expiresAt}, "mk_abcdefgh-secret", nil)
+			},
+			wantStatusCode: http.StatusCreated,
+			wantContains:   []string{`"key":"mk_abcdefgh-secret"`, `"prefix":"mk_abcdefgh"`, `"scopes":["items:write"]`},
+		},
+		{
+			name:           "invalid json body",
+			body:           `{"name":`,
+			setupMock:      func(_ *MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"invalid request format"},
+		},
+		{
+			name: "unknown scope",
+			body: `{"name":"sync","scopes":["users:write"]}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("CreateAPIKey", mock.Anything, 1, "sync", []models.APIKeyScope{"users:write"}, (*time.Time)(nil)).
+					Return(nil, "", fmt.Errorf("%w: unknown scope %q", service.ErrInvalidAPIKeyRequest, "users:write"))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"unknown scope"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := new(MockAuthService)
+			tt.setupMock(mockAuth)
+
+			handler := NewAuthHandler(mockAuth, logger)
+			req := setUserContext(httptest.NewRequest(http.MethodPost, "/auth/api-keys", strings.NewReader(tt.body)), 1, "seller")
+			w := httptest.NewRecorder()
+
+			handler.CreateAPIKey(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Result().StatusCode)
+			for _, want := range tt.wantContains {
+				assert.Contains(t, w.Body.String(), want)
+			}
+			assert.NotContains(t, w.Body.String(), "hash")
+			mockAuth.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_ListAndRevokeAPIKeys(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockAuth := new(MockAuthService)
+	handler := NewAuthHandler(mockAuth, logger)
+
+	mockAuth.On("ListAPIKeys", mock.Anything, 1).
+		Return([]*models.APIKey{{ID: 3, Name: "sync", Prefix: "mk_abcdefgh", KeyHash: "hash"}}, nil).Once()
+	req := setUserContext(httptest.NewRequest(http.MethodGet, "/auth/api-keys", http.NoBody), 1, "seller")
+	w := httptest.NewRecorder()
+	handler.ListAPIKeys(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `"prefix":"mk_abcdefgh"`)
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	mockAuth.On("RevokeAPIKey", mock.Anything, 1, 3).Return(nil).Once()
+	req = httptest.NewRequest(http.MethodDelete, "/auth/api-keys/3", http.NoBody)
+	req = mux.SetURLVars(setUserContext(req, 1, "seller"), map[string]string{"id": "3"})
+	w = httptest.NewRecorder()
+	handler.RevokeAPIKey(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	mockAuth.On("RevokeAPIKey", mock.Anything, 1, 3).Return(service.ErrAPIKeyNotFound).Once()
+	w = httptest.NewRecorder()
+	handler.RevokeAPIKey(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	req = mux.SetURLVars(req, map[string]string{"id": "x"})
+	w = httptest.NewRecorder()
+	handler.RevokeAPIKey(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockAuth.AssertExpectations(t)
+}
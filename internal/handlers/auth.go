@@ -3,17 +3,38 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/middleware"
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
 )
 
 // AuthService is an interface that contains auth service methods
 type AuthService interface {
-	Register(ctx context.Context, login, password string) (*models.User, string, error)
-	Login(ctx context.Context, login, password string) (*models.User, string, error)
+	Register(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error)
+	Login(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error)
+	Refresh(ctx context.Context, refreshToken string) (*models.User, *models.AuthTokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	ChangePassword(ctx context.Context, userID int, current, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error)
+	ChangeEmail(ctx context.Context, userID int, current, email string) error
+	RequestPasswordReset(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string, client models.ClientInfo) (*models.User, *models.AuthTokens, error)
+	SetupTOTP(ctx context.Context, userID int) (*models.TOTPSetup, error)
+	ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int, password, code string) error
+	CreateAPIKey(ctx context.Context, userID int, name string, scopes []models.APIKeyScope, expiresAt *time.Time) (*models.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id int) error
+	ListSessions(ctx context.Context, userID, currentID int) ([]*models.Session, error)
+	RevokeSession(ctx context.Context, userID, id int) error
 }
 
 // AuthHandler handles authentication-related endpoints like login and register
@@ -48,21 +69,23 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := h.AuthService.Register(r.Context(), req.Login, req.Password)
+	user, tokens, err := h.AuthService.Register(r.Context(), req.Login, req.Password, clientInfo(r))
 	if err != nil {
 		h.logger.Error.Println("error:", err)
+		var policy *service.PasswordPolicyError
+		if errors.As(err, &policy) {
+			writePasswordViolations(w, policy)
+			return
+		}
 		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"user":  user,
-		"token": token,
-	})
+	writeAuthResponse(w, user, tokens)
 }
 
-// Login handles POST /auth/login — user authentication
+// Login handles POST /auth/login — user authentication. Users with two-factor authentication get
+// mfa_required with an mfa_token instead of tokens, the token is exchanged at POST /auth/mfa/verify
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Login    string `json:"login"`
@@ -83,16 +106,247 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := h.AuthService.Login(r.Context(), req.Login, req.Password)
+	user, tokens, err := h.AuthService.Login(r.Context(), req.Login, req.Password, clientInfo(r))
+	var pending *service.MFARequiredError
+	if errors.As(err, &pending) {
+		writeMFARequired(w, pending)
+		return
+	}
 	if err != nil {
 		h.logger.Error.Println("error:", err)
+		var locked *service.TooManyAttemptsError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusTooManyRequests)
+			return
+		}
 		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
 		return
 	}
 
+	writeAuthResponse(w, user, tokens)
+}
+
+// Refresh handles POST /auth/refresh — exchanges a refresh token for a new access token and refresh token
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user, tokens, err := h.AuthService.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) ||
+			errors.Is(err, service.ErrAccountDisabled) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, `{"error":"failed to refresh token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	writeAuthResponse(w, user, tokens)
+}
+
+// Logout handles POST /auth/logout — revokes a refresh token and the tokens rotated from the same login
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.AuthService.Logout(r.Context(), refreshToken); err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to log out"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword handles POST /auth/password/change — replaces the password of the current user,
+// other sessions of the user are ended and the response carries new tokens
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.NewPassword = strings.TrimSpace(req.NewPassword)
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, `{"error":"current_password and new_password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, tokens, err := h.AuthService.ChangePassword(r.Context(), middleware.GetUserID(r), req.CurrentPassword, req.NewPassword, clientInfo(r))
+	if err != nil {
+		h.writePasswordError(w, err, "failed to change password")
+		return
+	}
+
+	writeAuthResponse(w, user, tokens)
+}
+
+// ChangeEmail handles PUT /auth/email — sets the address password reset links are mailed to, an empty email removes it
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		Email           string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" {
+		http.Error(w, `{"error":"current_password is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.ChangeEmail(r.Context(), middleware.GetUserID(r), req.CurrentPassword, req.Email); err != nil {
+		h.writePasswordError(w, err, "failed to change email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestPasswordReset handles POST /auth/password/reset-request — mails a reset token to the user with the login.
+// The response is the same whether the login exists or not
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Login string `json:"login"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Login = strings.TrimSpace(req.Login)
+	if req.Login == "" {
+		http.Error(w, `{"error":"login is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.RequestPasswordReset(r.Context(), req.Login); err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to request password reset"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword handles POST /auth/password/reset — sets a new password with a reset token and ends all sessions of the user
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	req.NewPassword = strings.TrimSpace(req.NewPassword)
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, `{"error":"token and new_password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		h.writePasswordError(w, err, "failed to reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePasswordError logs err and responds with its status. Password rule violations and invalid emails are reported
+// as they are, other errors are replaced by fallback
+func (h *AuthHandler) writePasswordError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	var policy *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policy):
+		writePasswordViolations(w, policy)
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrInvalidResetToken),
+		errors.Is(err, service.ErrPasswordPolicy), errors.Is(err, service.ErrInvalidEmail):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, service.ErrAccountDisabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+	default:
+		http.Error(w, `{"error":"`+fallback+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// refreshTokenFromRequest reads the refresh_token field of the request body, writing an error response when it is missing
+func (h *AuthHandler) refreshTokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return "", false
+	}
+
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		http.Error(w, `{"error":"refresh_token is required"}`, http.StatusBadRequest)
+		return "", false
+	}
+
+	return req.RefreshToken, true
+}
+
+// writePasswordViolations responds with 400 and every password rule a new password breaks, error joins their messages
+func writePasswordViolations(w http.ResponseWriter, policy *service.PasswordPolicyError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      policy.Error(),
+		"violations": policy.Violations,
+	})
+}
+
+// clientInfo returns the address and user agent a new session of r is recorded with
+func clientInfo(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{IP: middleware.GetClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// writeMFARequired writes the token a login continues with at POST /auth/mfa/verify
+func writeMFARequired(w http.ResponseWriter, pending *service.MFARequiredError) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    pending.Token,
+		"expires_in":   pending.ExpiresIn,
+	})
+}
+
+// writeAuthResponse writes the user with their tokens, token is the access token
+func writeAuthResponse(w http.ResponseWriter, user *models.User, tokens *models.AuthTokens) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/artnikel/marketplace/internal/logging"
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -21,22 +24,54 @@ type MockAuthService struct {
 	mock.Mock
 }
 
-func (m *MockAuthService) Register(ctx context.Context, login, password string) (*models.User, string, error) {
-	args := m.Called(ctx, login, password)
-	user := args.Get(0)
-	if user == nil {
-		return nil, "", args.Error(2)
-	}
-	return user.(*models.User), args.String(1), args.Error(2)
+func (m *MockAuthService) Register(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
+	args := m.Called(ctx, login, password, client)
+	user, _ := args.Get(0).(*models.User)
+	tokens, _ := args.Get(1).(*models.AuthTokens)
+	return user, tokens, args.Error(2)
 }
 
-func (m *MockAuthService) Login(ctx context.Context, login, password string) (*models.User, string, error) {
-	args := m.Called(ctx, login, password)
-	user := args.Get(0)
-	if user == nil {
-		return nil, "", args.Error(2)
-	}
-	return user.(*models.User), args.String(1), args.Error(2)
+func (m *MockAuthService) Login(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
+	args := m.Called(ctx, login, password, client)
+	user, _ := args.Get(0).(*models.User)
+	tokens, _ := args.Get(1).(*models.AuthTokens)
+	return user, tokens, args.Error(2)
+}
+
+func (m *MockAuthService) Refresh(ctx context.Context, refreshToken string) (*models.User, *models.AuthTokens, error) {
+	args := m.Called(ctx, refreshToken)
+	user, _ := args.Get(0).(*models.User)
+	tokens, _ := args.Get(1).(*models.AuthTokens)
+	return user, tokens, args.Error(2)
+}
+
+func (m *MockAuthService) Logout(ctx context.Context, refreshToken string) error {
+	args := m.Called(ctx, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ChangePassword(
+	ctx context.Context, userID int, current, password string, client models.ClientInfo,
+) (*models.User, *models.AuthTokens, error) {
+	args := m.Called(ctx, userID, current, password, client)
+	user, _ := args.Get(0).(*models.User)
+	tokens, _ := args.Get(1).(*models.AuthTokens)
+	return user, tokens, args.Error(2)
+}
+
+func (m *MockAuthService) ChangeEmail(ctx context.Context, userID int, current, email string) error {
+	args := m.Called(ctx, userID, current, email)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) RequestPasswordReset(ctx context.Context, login string) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ResetPassword(ctx context.Context, token, password string) error {
+	args := m.Called(ctx, token, password)
+	return args.Error(0)
 }
 
 func TestAuthHandler_Register(t *testing.T) {
@@ -56,8 +91,8 @@ func TestAuthHandler_Register(t *testing.T) {
 			name: "successful registration",
 			body: `{"login":"testuser","password":"password123"}`,
 			setupMock: func(m *MockAuthService) {
-				m.On("Register", mock.Anything, "testuser", "password123").
-					Return(&models.User{ID: 1, Login: "testuser"}, "token123", nil)
+				m.On("Register", mock.Anything, "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(&models.User{ID: 1, Login: "testuser"}, &models.AuthTokens{AccessToken: "token123", RefreshToken: "refresh123", ExpiresIn: 900}, nil)
 			},
 			wantStatusCode: http.StatusOK,
 			wantBody:       `"token":"token123"`,
@@ -80,12 +115,25 @@ func TestAuthHandler_Register(t *testing.T) {
 			name: "service error",
 			body: `{"login":"testuser","password":"password123"}`,
 			setupMock: func(m *MockAuthService) {
-				m.On("Register", mock.Anything, "testuser", "password123").
-					Return(nil, "", errors.New("user already exists"))
+				m.On("Register", mock.Anything, "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, errors.New("user already exists"))
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       `user already exists`,
 		},
+		{
+			name: "password breaks the policy",
+			body: `{"login":"testuser","password":"testuser"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Register", mock.Anything, "testuser", "testuser", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, &service.PasswordPolicyError{Violations: []service.PasswordViolation{
+						{Rule: service.RuleCharacterClasses, Message: "password must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"},
+						{Rule: service.RuleLogin, Message: "password may not contain the login"},
+					}})
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `"violations":[{"rule":"character_classes","message":"password must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"},{"rule":"login","message":"password may not contain the login"}]`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,6 +165,60 @@ func TestAuthHandler_Register(t *testing.T) {
 	}
 }
 
+func (m *MockAuthService) VerifyMFA(ctx context.Context, mfaToken, code string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
+	args := m.Called(ctx, mfaToken, code, client)
+	user, _ := args.Get(0).(*models.User)
+	tokens, _ := args.Get(1).(*models.AuthTokens)
+	return user, tokens, args.Error(2)
+}
+
+func (m *MockAuthService) SetupTOTP(ctx context.Context, userID int) (*models.TOTPSetup, error) {
+	args := m.Called(ctx, userID)
+	setup, _ := args.Get(0).(*models.TOTPSetup)
+	return setup, args.Error(1)
+}
+
+func (m *MockAuthService) ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	args := m.Called(ctx, userID, code)
+	codes, _ := args.Get(0).([]string)
+	return codes, args.Error(1)
+}
+
+func (m *MockAuthService) DisableTOTP(ctx context.Context, userID int, password, code string) error {
+	args := m.Called(ctx, userID, password, code)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) CreateAPIKey(
+	ctx context.Context, userID int, name string, scopes []models.APIKeyScope, expiresAt *time.Time,
+) (*models.APIKey, string, error) {
+	args := m.Called(ctx, userID, name, scopes, expiresAt)
+	key, _ := args.Get(0).(*models.APIKey)
+	return key, args.String(1), args.Error(2)
+}
+
+func (m *MockAuthService) ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	args := m.Called(ctx, userID)
+	keys, _ := args.Get(0).([]*models.APIKey)
+	return keys, args.Error(1)
+}
+
+func (m *MockAuthService) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ListSessions(ctx context.Context, userID, currentID int) ([]*models.Session, error) {
+	args := m.Called(ctx, userID, currentID)
+	sessions, _ := args.Get(0).([]*models.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *MockAuthService) RevokeSession(ctx context.Context, userID, id int) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
 func TestAuthHandler_Login(t *testing.T) {
 	mockLogger := log.New(io.Discard, "", 0)
 	logger := &logging.Logger{
@@ -129,13 +231,14 @@ func TestAuthHandler_Login(t *testing.T) {
 		setupMock      func(m *MockAuthService)
 		wantStatusCode int
 		wantBody       string
+		wantRetryAfter string
 	}{
 		{
 			name: "successful login",
 			body: `{"login":"testuser","password":"password123"}`,
 			setupMock: func(m *MockAuthService) {
-				m.On("Login", mock.Anything, "testuser", "password123").
-					Return(&models.User{ID: 1, Login: "testuser"}, "token123", nil)
+				m.On("Login", mock.Anything, "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(&models.User{ID: 1, Login: "testuser"}, &models.AuthTokens{AccessToken: "token123", RefreshToken: "refresh123", ExpiresIn: 900}, nil)
 			},
 			wantStatusCode: http.StatusOK,
 			wantBody:       `"token":"token123"`,
@@ -158,12 +261,33 @@ func TestAuthHandler_Login(t *testing.T) {
 			name: "invalid credentials",
 			body: `{"login":"testuser","password":"wrongpass"}`,
 			setupMock: func(m *MockAuthService) {
-				m.On("Login", mock.Anything, "testuser", "wrongpass").
-					Return(nil, "", errors.New("invalid credentials"))
+				m.On("Login", mock.Anything, "testuser", "wrongpass", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, errors.New("invalid credentials"))
 			},
 			wantStatusCode: http.StatusUnauthorized,
 			wantBody:       `invalid credentials`,
 		},
+		{
+			name: "locked out",
+			body: `{"login":"testuser","password":"password123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Login", mock.Anything, "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, &service.TooManyAttemptsError{RetryAfter: 1500 * time.Millisecond})
+			},
+			wantStatusCode: http.StatusTooManyRequests,
+			wantBody:       `too many failed login attempts`,
+			wantRetryAfter: "2",
+		},
+		{
+			name: "two-factor code required",
+			body: `{"login":"testuser","password":"password123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Login", mock.Anything, "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, &service.MFARequiredError{Token: "pending123", ExpiresIn: 300})
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"mfa_token":"pending123"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -186,8 +310,304 @@ func TestAuthHandler_Login(t *testing.T) {
 
 			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
 			assert.Contains(t, bodyStr, tt.wantBody)
+			assert.Equal(t, tt.wantRetryAfter, resp.Header.Get("Retry-After"))
 
 			mockAuth.AssertExpectations(t)
 		})
 	}
 }
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(m *MockAuthService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "successful refresh",
+			body: `{"refresh_token":"refresh123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Refresh", mock.Anything, "refresh123").
+					Return(&models.User{ID: 1, Login: "testuser"}, &models.AuthTokens{AccessToken: "token456", RefreshToken: "refresh456", ExpiresIn: 900}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"refresh_token":"refresh456"`,
+		},
+		{
+			name:           "missing token",
+			body:           `{}`,
+			setupMock:      func(_ *MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `refresh_token is required`,
+		},
+		{
+			name: "expired token",
+			body: `{"refresh_token":"old"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Refresh", mock.Anything, "old").Return(nil, nil, service.ErrInvalidRefreshToken)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       `invalid or expired refresh token`,
+		},
+		{
+			name: "reused token",
+			body: `{"refresh_token":"used"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Refresh", mock.Anything, "used").Return(nil, nil, service.ErrRefreshTokenReused)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       `already used`,
+		},
+		{
+			name: "database error",
+			body: `{"refresh_token":"refresh123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("Refresh", mock.Anything, "refresh123").Return(nil, nil, errors.New("database error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `failed to refresh token`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := new(MockAuthService)
+			tt.setupMock(mockAuth)
+
+			handler := NewAuthHandler(mockAuth, logger)
+			req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Refresh(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+
+			mockAuth.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	mockAuth := new(MockAuthService)
+	handler := NewAuthHandler(mockAuth, logger)
+
+	logout := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.Logout(w, req)
+		return w
+	}
+
+	mockAuth.On("Logout", mock.Anything, "refresh123").Return(nil).Once()
+	assert.Equal(t, http.StatusNoContent, logout(`{"refresh_token":"refresh123"}`).Code)
+
+	assert.Equal(t, http.StatusBadRequest, logout(`{"refresh_token":" "}`).Code)
+
+	mockAuth.On("Logout", mock.Anything, "refresh456").Return(errors.New("database error")).Once()
+	assert.Equal(t, http.StatusInternalServerError, logout(`{"refresh_token":"refresh456"}`).Code)
+
+	mockAuth.AssertExpectations(t)
+}
+
+func TestAuthHandler_ChangePassword(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockAuthService)
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name: "successful change",
+			body: `{"current_password":"oldpass","new_password":"newpass123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangePassword", mock.Anything, 1, "oldpass", "newpass123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(&models.User{ID: 1, Login: "testuser"}, &models.AuthTokens{AccessToken: "token123", RefreshToken: "refresh123"}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"refresh_token":"refresh123"`,
+		},
+		{
+			name:           "missing new password",
+			body:           `{"current_password":"oldpass"}`,
+			setupMock:      func(_ *MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "current_password and new_password are required",
+		},
+		{
+			name: "wrong current password",
+			body: `{"current_password":"wrong","new_password":"newpass123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangePassword", mock.Anything, 1, "wrong", "newpass123", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, nil, service.ErrWrongPassword)
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "current password is incorrect",
+		},
+		{
+			name: "new password too short",
+			body: `{"current_password":"oldpass","new_password":"123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangePassword", mock.Anything, 1, "oldpass", "123", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, fmt.Errorf("%w: too short", service.ErrPasswordPolicy))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "password does not meet the requirements",
+		},
+		{
+			name: "new password breaks the policy",
+			body: `{"current_password":"oldpass","new_password":"password1"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangePassword", mock.Anything, 1, "oldpass", "password1", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(nil, nil, &service.PasswordPolicyError{Violations: []service.PasswordViolation{
+						{Rule: service.RuleBreached, Message: "password appears in known data breaches"},
+					}})
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   `"violations":[{"rule":"breached","message":"password appears in known data breaches"}]`,
+		},
+		{
+			name: "database error",
+			body: `{"current_password":"oldpass","new_password":"newpass123"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangePassword", mock.Anything, 1, "oldpass", "newpass123", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, nil, errors.New("database error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   "failed to change password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := new(MockAuthService)
+			tt.setupMock(mockAuth)
+			handler := NewAuthHandler(mockAuth, logger)
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/password/change", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ChangePassword(w, setUserContext(req, 1, "testuser"))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+			mockAuth.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_ChangeEmail(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockAuthService)
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name: "successful change",
+			body: `{"current_password":"password123","email":"test@example.com"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangeEmail", mock.Anything, 1, "password123", "test@example.com").Return(nil)
+			},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "missing current password",
+			body:           `{"email":"test@example.com"}`,
+			setupMock:      func(_ *MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "current_password is required",
+		},
+		{
+			name: "invalid email",
+			body: `{"current_password":"password123","email":"testuser"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangeEmail", mock.Anything, 1, "password123", "testuser").Return(service.ErrInvalidEmail)
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid email address",
+		},
+		{
+			name: "database error",
+			body: `{"current_password":"password123","email":"test@example.com"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("ChangeEmail", mock.Anything, 1, "password123", "test@example.com").Return(errors.New("database error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   "failed to change email",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := new(MockAuthService)
+			tt.setupMock(mockAuth)
+			handler := NewAuthHandler(mockAuth, logger)
+
+			req := httptest.NewRequest(http.MethodPut, "/auth/email", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ChangeEmail(w, setUserContext(req, 1, "testuser"))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+			mockAuth.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_PasswordReset(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	mockAuth := new(MockAuthService)
+	handler := NewAuthHandler(mockAuth, logger)
+
+	request := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password/reset-request", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.RequestPasswordReset(w, req)
+		return w
+	}
+	reset := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password/reset", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ResetPassword(w, req)
+		return w
+	}
+
+	mockAuth.On("RequestPasswordReset", mock.Anything, "testuser").Return(nil).Once()
+	assert.Equal(t, http.StatusAccepted, request(`{"login":" testuser "}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(`{"login":""}`).Code)
+
+	mockAuth.On("RequestPasswordReset", mock.Anything, "testuser").Return(errors.New("failed to send reset email")).Once()
+	assert.Equal(t, http.StatusInternalServerError, request(`{"login":"testuser"}`).Code)
+
+	mockAuth.On("ResetPassword", mock.Anything, "reset123", "newpass123").Return(nil).Once()
+	assert.Equal(t, http.StatusNoContent, reset(`{"token":"reset123","new_password":"newpass123"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, reset(`{"token":"reset123"}`).Code)
+
+	mockAuth.On("ResetPassword", mock.Anything, "used", "newpass123").Return(service.ErrInvalidResetToken).Once()
+	w := reset(`{"token":"used","new_password":"newpass123"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid or expired reset token")
+
+	mockAuth.AssertExpectations(t)
+}
@@ -0,0 +1,130 @@
+// Package handlers contains HTTP handlers for category management
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// CategoriesService is an interface that contains categories service methods
+type CategoriesService interface {
+	ListTree(ctx context.Context) ([]*models.Category, error)
+	CreateCategory(ctx context.Context, name string, parentID *int) (*models.Category, error)
+	UpdateCategory(ctx context.Context, id int, name string, parentID *int) (*models.Category, error)
+	DeleteCategory(ctx context.Context, id int) error
+}
+
+// CategoriesHandler handles category-related HTTP requests
+type CategoriesHandler struct {
+	Svc    CategoriesService
+	logger *logging.Logger
+}
+
+// NewCategoriesHandler creates a new CategoriesHandler instance
+func NewCategoriesHandler(svc CategoriesService, logger *logging.Logger) *CategoriesHandler {
+	return &CategoriesHandler{Svc: svc, logger: logger}
+}
+
+// categoryRequest is the request body for creating and updating a category
+type categoryRequest struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id"`
+}
+
+// GetCategories handles GET /categories — returns the categories tree
+func (h *CategoriesHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.Svc.ListTree(r.Context())
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to list categories"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tree)
+}
+
+// CreateCategory handles POST /admin/categories — creates a new category
+func (h *CategoriesHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request body:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.Svc.CreateCategory(r.Context(), req.Name, req.ParentID)
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"`+err.Error()+`"}`, categoryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// UpdateCategory handles PUT /admin/categories/{id} — renames or moves a category
+func (h *CategoriesHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid category id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request body:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.Svc.UpdateCategory(r.Context(), id, req.Name, req.ParentID)
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"`+err.Error()+`"}`, categoryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DeleteCategory handles DELETE /admin/categories/{id} — removes an unused category
+func (h *CategoriesHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid category id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Svc.DeleteCategory(r.Context(), id); err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"`+err.Error()+`"}`, categoryErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// categoryErrorStatus maps categories service errors to HTTP status codes
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCategoryInUse), errors.Is(err, service.ErrCategoryCycle):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCategoriesService struct {
+	mock.Mock
+}
+
+func (m *MockCategoriesService) ListTree(ctx context.Context) ([]*models.Category, error) {
+	args := m.Called(ctx)
+	tree, _ := args.Get(0).([]*models.Category)
+	return tree, args.Error(1)
+}
+
+func (m *MockCategoriesService) CreateCategory(ctx context.Context, name string, parentID *int) (*models.Category, error) {
+	args := m.Called(ctx, name, parentID)
+	c, _ := args.Get(0).(*models.Category)
+	return c, args.Error(1)
+}
+
+func (m *MockCategoriesService) UpdateCategory(ctx context.Context, id int, name string, parentID *int) (*models.Category, error) {
+	args := m.Called(ctx, id, name, parentID)
+	c, _ := args.Get(0).(*models.Category)
+	return c, args.Error(1)
+}
+
+func (m *MockCategoriesService) DeleteCategory(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestCategoriesHandler_GetCategories(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockCategoriesService)
+	handler := NewCategoriesHandler(mockSvc, logger)
+
+	parentID := 1
+	mockSvc.On("ListTree", mock.Anything).Return([]*models.Category{
+		{ID: 1, Name: "Electronics", Children: []*models.Category{{ID: 2, Name: "Phones", ParentID: &parentID}}},
+	}, nil).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories", http.NoBody)
+	w := httptest.NewRecorder()
+	handler.GetCategories(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	body := new(bytes.Buffer)
+	_, _ = body.ReadFrom(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body.String(), `"children":[{"id":2,"name":"Phones","parent_id":1}]`)
+
+	mockSvc.On("ListTree", mock.Anything).Return(nil, errors.New("db error")).Once()
+	w = httptest.NewRecorder()
+	handler.GetCategories(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestCategoriesHandler_CreateCategory(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockCategoriesService)
+	handler := NewCategoriesHandler(mockSvc, logger)
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name: "successful create",
+			body: `{"name":"Phones","parent_id":1}`,
+			setupMock: func() {
+				mockSvc.On("CreateCategory", mock.Anything, "Phones", mock.MatchedBy(func(p *int) bool {
+					return p != nil && *p == 1
+				})).Return(&models.Category{ID: 2, Name: "Phones"}, nil).Once()
+			},
+			wantStatusCode: http.StatusCreated,
+			wantContains:   `"name":"Phones"`,
+		},
+		{
+			name:           "invalid json body",
+			body:           `{"name":`,
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid request format",
+		},
+		{
+			name: "unknown parent",
+			body: `{"name":"Phones","parent_id":99}`,
+			setupMock: func() {
+				mockSvc.On("CreateCategory", mock.Anything, "Phones", mock.Anything).
+					Return(nil, service.ErrCategoryNotFound).Once()
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantContains:   "category not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/categories", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.CreateCategory(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(resp.Body)
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			assert.Contains(t, body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCategoriesHandler_UpdateAndDeleteCategory(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockCategoriesService)
+	handler := NewCategoriesHandler(mockSvc, logger)
+
+	mockSvc.On("UpdateCategory", mock.Anything, 1, "Gadgets", mock.Anything).
+		Return(nil, service.ErrCategoryCycle).Once()
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/categories/1", strings.NewReader(`{"name":"Gadgets","parent_id":3}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	handler.UpdateCategory(w, req)
+	assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+
+	mockSvc.On("DeleteCategory", mock.Anything, 1).Return(service.ErrCategoryInUse).Once()
+
+	req = httptest.NewRequest(http.MethodDelete, "/admin/categories/1", http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	handler.DeleteCategory(w, req)
+	assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+
+	mockSvc.On("DeleteCategory", mock.Anything, 1).Return(nil).Once()
+
+	w = httptest.NewRecorder()
+	handler.DeleteCategory(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodDelete, "/admin/categories/x", http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"id": "x"})
+	w = httptest.NewRecorder()
+	handler.DeleteCategory(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockSvc.AssertExpectations(t)
+}
@@ -0,0 +1,255 @@
+// Package handlers contains HTTP handlers for item images
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// multipartOverhead is the room left in a request body for multipart headers around the image
+const multipartOverhead = 64 << 10
+
+// ImagesService is an interface that contains image service methods
+type ImagesService interface {
+	MaxImageSize() int64
+	UploadItemImage(ctx context.Context, userID, itemID int, r io.Reader) (*models.ItemImage, error)
+	DeleteItemImage(ctx context.Context, userID, itemID, imageID int) error
+	ReorderItemImages(ctx context.Context, userID, itemID int, imageIDs []int) ([]*models.ItemImage, error)
+	SetPrimaryItemImage(ctx context.Context, userID, itemID, imageID int) ([]*models.ItemImage, error)
+	OpenImage(ctx context.Context, key string) (io.ReadCloser, string, error)
+}
+
+// ImagesHandler handles image upload and download HTTP requests
+type ImagesHandler struct {
+	Svc    ImagesService
+	logger *logging.Logger
+}
+
+// NewImagesHandler creates a new ImagesHandler instance
+func NewImagesHandler(svc ImagesService, logger *logging.Logger) *ImagesHandler {
+	return &ImagesHandler{Svc: svc, logger: logger}
+}
+
+// UploadItemImage handles POST /items/{id}/images — adds the "image" field of a multipart form
+// to the images of the user's own item
+func (h *ImagesHandler) UploadItemImage(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.Svc.MaxImageSize()+multipartOverhead)
+	part, err := imagePart(r)
+	if err != nil {
+		h.logger.Error.Println("invalid image upload:", err)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, `{"error":"image is too large"}`, http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, `{"error":"image field is required"}`, http.StatusBadRequest)
+		return
+	}
+	defer part.Close()
+
+	img, err := h.Svc.UploadItemImage(r.Context(), userID, id, part)
+	if err != nil {
+		h.writeImageError(w, err, "failed to store image")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(img)
+}
+
+// DeleteItemImage handles DELETE /items/{id}/images/{imageID} — removes an image of the user's own item
+func (h *ImagesHandler) DeleteItemImage(w http.ResponseWriter, r *http.Request) {
+	id, imageID, err := imageIDsFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Svc.DeleteItemImage(r.Context(), userID, id, imageID); err != nil {
+		h.writeImageError(w, err, "failed to delete image")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReorderItemImages handles PUT /items/{id}/images/order — arranges the images of the user's own item
+// in the order of the image_ids list, which names every image of the item once
+func (h *ImagesHandler) ReorderItemImages(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		ImageIDs []int `json:"image_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request body:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	images, err := h.Svc.ReorderItemImages(r.Context(), userID, id, req.ImageIDs)
+	if err != nil {
+		h.writeImageError(w, err, "failed to reorder images")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"images": images})
+}
+
+// SetPrimaryItemImage handles POST /items/{id}/images/{imageID}/primary — makes an image the one
+// that represents the user's own item in listings
+func (h *ImagesHandler) SetPrimaryItemImage(w http.ResponseWriter, r *http.Request) {
+	id, imageID, err := imageIDsFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	images, err := h.Svc.SetPrimaryItemImage(r.Context(), userID, id, imageID)
+	if err != nil {
+		h.writeImageError(w, err, "failed to update images")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"images": images})
+}
+
+// ServeImage handles GET /media/{key} — streams a stored image.
+// Keys are never reused, so responses may be cached indefinitely
+func (h *ImagesHandler) ServeImage(w http.ResponseWriter, r *http.Request) {
+	rc, contentType, err := h.Svc.OpenImage(r.Context(), mux.Vars(r)["key"])
+	if err != nil {
+		if errors.Is(err, service.ErrImageNotFound) {
+			http.Error(w, `{"error":"image not found"}`, http.StatusNotFound)
+			return
+		}
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to load image"}`, http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	if _, err := io.Copy(w, rc); err != nil {
+		h.logger.Error.Println("failed to write image:", err)
+	}
+}
+
+// writeImageError logs err and responds with its status, internal errors are replaced by fallback
+func (h *ImagesHandler) writeImageError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	status := imageErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		http.Error(w, `{"error":"`+fallback+`"}`, status)
+		return
+	}
+	http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+}
+
+// imageIDsFromRequest reads the {id} and {imageID} path variables
+func imageIDsFromRequest(r *http.Request) (int, int, error) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	imageID, err := strconv.Atoi(mux.Vars(r)["imageID"])
+	if err != nil || imageID < 1 {
+		return 0, 0, errors.New("invalid image id")
+	}
+	return id, imageID, nil
+}
+
+// imagePart streams the multipart form of a request up to its "image" field
+func imagePart(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return nil, errors.New("request is not a multipart form")
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "image" {
+			return part, nil
+		}
+		_ = part.Close()
+	}
+}
+
+// imageErrorStatus maps images service errors to HTTP status codes
+func imageErrorStatus(err error) int {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, service.ErrImageTooLarge), errors.As(err, &maxErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrTooManyImages):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidImageOrder):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrItemNotFound), errors.Is(err, service.ErrImageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,76 @@
+// Package handlers contains HTTP handlers for proxied external images
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// proxyMaxAge is how long browsers may cache a proxied image, in seconds
+const proxyMaxAge = 24 * 60 * 60
+
+// ImageProxyService is an interface that contains image proxy service methods
+type ImageProxyService interface {
+	FetchImage(ctx context.Context, url string) (*models.RemoteImage, error)
+}
+
+// ImageProxyHandler serves external images through the application
+type ImageProxyHandler struct {
+	Svc    ImageProxyService
+	logger *logging.Logger
+}
+
+// NewImageProxyHandler creates a new ImageProxyHandler instance
+func NewImageProxyHandler(svc ImageProxyService, logger *logging.Logger) *ImageProxyHandler {
+	return &ImageProxyHandler{Svc: svc, logger: logger}
+}
+
+// GetImage handles GET /image-proxy?url=... — streams the image at an external URL,
+// so item image_url values never make browsers contact third party hosts
+func (h *ImageProxyHandler) GetImage(w http.ResponseWriter, r *http.Request) {
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" {
+		http.Error(w, `{"error":"url is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	img, err := h.Svc.FetchImage(r.Context(), rawURL)
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		status := proxyErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			http.Error(w, `{"error":"failed to load image"}`, status)
+			return
+		}
+		http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(proxyMaxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	if _, err := w.Write(img.Data); err != nil {
+		h.logger.Error.Println("failed to write image:", err)
+	}
+}
+
+// proxyErrorStatus maps image proxy service errors to HTTP status codes
+func proxyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidImageURL):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrImageTooLarge), errors.Is(err, service.ErrUnsupportedImage),
+		errors.Is(err, service.ErrRemoteImage):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockImageProxyService struct {
+	mock.Mock
+}
+
+func (m *MockImageProxyService) FetchImage(ctx context.Context, rawURL string) (*models.RemoteImage, error) {
+	args := m.Called(ctx, rawURL)
+	img, _ := args.Get(0).(*models.RemoteImage)
+	return img, args.Error(1)
+}
+
+func TestImageProxyHandler_GetImage(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		setupMock  func(m *MockImageProxyService)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "success",
+			url:  "https://cdn.example.com/a.png",
+			setupMock: func(m *MockImageProxyService) {
+				m.On("FetchImage", mock.Anything, "https://cdn.example.com/a.png").
+					Return(&models.RemoteImage{ContentType: "image/png", Data: []byte("png data")}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "png data",
+		},
+		{
+			name:       "missing url",
+			setupMock:  func(_ *MockImageProxyService) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "private host",
+			url:  "http://10.0.0.1/a.png",
+			setupMock: func(m *MockImageProxyService) {
+				m.On("FetchImage", mock.Anything, "http://10.0.0.1/a.png").
+					Return(nil, fmt.Errorf("%w: host is not public", service.ErrInvalidImageURL))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "not an image",
+			url:  "https://cdn.example.com/page",
+			setupMock: func(m *MockImageProxyService) {
+				m.On("FetchImage", mock.Anything, "https://cdn.example.com/page").
+					Return(nil, fmt.Errorf("%w: remote file is not an image", service.ErrUnsupportedImage))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "upstream down",
+			url:  "https://cdn.example.com/b.png",
+			setupMock: func(m *MockImageProxyService) {
+				m.On("FetchImage", mock.Anything, "https://cdn.example.com/b.png").
+					Return(nil, fmt.Errorf("%w: status 503", service.ErrRemoteImage))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "internal error",
+			url:  "https://cdn.example.com/c.png",
+			setupMock: func(m *MockImageProxyService) {
+				m.On("FetchImage", mock.Anything, "https://cdn.example.com/c.png").Return(nil, errors.New("boom"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"failed to load image"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(MockImageProxyService)
+			tt.setupMock(mockSvc)
+			handler := NewImageProxyHandler(mockSvc, logger)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/image-proxy?url="+url.QueryEscape(tt.url), http.NoBody)
+			w := httptest.NewRecorder()
+			handler.GetImage(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+				assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+				assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockImagesService struct {
+	mock.Mock
+}
+
+func (m *MockImagesService) MaxImageSize() int64 {
+	return 1 << 10
+}
+
+func (m *MockImagesService) UploadItemImage(ctx context.Context, userID, itemID int, r io.Reader) (*models.ItemImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	args := m.Called(ctx, userID, itemID, string(data))
+	img, _ := args.Get(0).(*models.ItemImage)
+	return img, args.Error(1)
+}
+
+func (m *MockImagesService) DeleteItemImage(ctx context.Context, userID, itemID, imageID int) error {
+	args := m.Called(ctx, userID, itemID, imageID)
+	return args.Error(0)
+}
+
+func (m *MockImagesService) ReorderItemImages(ctx context.Context, userID, itemID int, imageIDs []int) ([]*models.ItemImage, error) {
+	args := m.Called(ctx, userID, itemID, imageIDs)
+	images, _ := args.Get(0).([]*models.ItemImage)
+	return images, args.Error(1)
+}
+
+func (m *MockImagesService) SetPrimaryItemImage(ctx context.Context, userID, itemID, imageID int) ([]*models.ItemImage, error) {
+	args := m.Called(ctx, userID, itemID, imageID)
+	images, _ := args.Get(0).([]*models.ItemImage)
+	return images, args.Error(1)
+}
+
+func (m *MockImagesService) OpenImage(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	args := m.Called(ctx, key)
+	rc, _ := args.Get(0).(io.ReadCloser)
+	return rc, args.String(1), args.Error(2)
+}
+
+func TestImagesHandler_UploadItemImage(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockImagesService)
+	handler := NewImagesHandler(mockSvc, logger)
+
+	imageForm := func(field string, content []byte) (*bytes.Buffer, string) {
+		buf := new(bytes.Buffer)
+		mw := multipart.NewWriter(buf)
+		require.NoError(t, mw.WriteField("caption", "ignored"))
+		part, err := mw.CreateFormFile(field, "photo.png")
+		require.NoError(t, err)
+		_, _ = part.Write(content)
+		require.NoError(t, mw.Close())
+		return buf, mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		name           string
+		userID         int
+		body           func() (*bytes.Buffer, string)
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name:   "successful upload",
+			userID: 1,
+			body:   func() (*bytes.Buffer, string) { return imageForm("image", []byte("png")) },
+			setupMock: func() {
+				mockSvc.On("UploadItemImage", mock.Anything, 1, 5, "png").
+					Return(&models.ItemImage{ID: 3, ItemID: 5, IsPrimary: true, ThumbnailURL: "/media/items/5/a_thumb.jpg"}, nil).Once()
+			},
+			wantStatusCode: http.StatusCreated,
+			wantContains:   `"thumbnail_url":"/media/items/5/a_thumb.jpg"`,
+		},
+		{
+			name:           "not authenticated",
+			body:           func() (*bytes.Buffer, string) { return imageForm("image", []byte("png")) },
+			setupMock:      func() {},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing image field",
+			userID:         1,
+			body:           func() (*bytes.Buffer, string) { return imageForm("file", []byte("png")) },
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "image field is required",
+		},
+		{
+			name:   "not a multipart form",
+			userID: 1,
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("png"), "image/png"
+			},
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "body over the limit",
+			userID:         1,
+			body:           func() (*bytes.Buffer, string) { return imageForm("image", make([]byte, 128<<10)) },
+			setupMock:      func() {},
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "unsupported type",
+			userID: 1,
+			body:   func() (*bytes.Buffer, string) { return imageForm("image", []byte("<html>")) },
+			setupMock: func() {
+				mockSvc.On("UploadItemImage", mock.Anything, 1, 5, "<html>").
+					Return(nil, fmt.Errorf("%w, use jpeg, png, gif or webp", service.ErrUnsupportedImage)).Once()
+			},
+			wantStatusCode: http.StatusUnsupportedMediaType,
+			wantContains:   "unsupported image type",
+		},
+		{
+			name:   "image limit reached",
+			userID: 1,
+			body:   func() (*bytes.Buffer, string) { return imageForm("image", []byte("png")) },
+			setupMock: func() {
+				mockSvc.On("UploadItemImage", mock.Anything, 1, 5, "png").
+					Return(nil, fmt.Errorf("%w (max 10 per item)", service.ErrTooManyImages)).Once()
+			},
+			wantStatusCode: http.StatusConflict,
+			wantContains:   "too many images",
+		},
+		{
+			name:   "not the owner",
+			userID: 2,
+			body:   func() (*bytes.Buffer, string) { return imageForm("image", []byte("png")) },
+			setupMock: func() {
+				mockSvc.On("UploadItemImage", mock.Anything, 2, 5, "png").Return(nil, service.ErrForbidden).Once()
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:   "storage error",
+			userID: 1,
+			body:   func() (*bytes.Buffer, string) { return imageForm("image", []byte("png")) },
+			setupMock: func() {
+				mockSvc.On("UploadItemImage", mock.Anything, 1, 5, "png").Return(nil, errors.New("disk full")).Once()
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   "failed to store image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			body, contentType := tt.body()
+			req := httptest.NewRequest(http.MethodPost, "/items/5/images", body)
+			req.Header.Set("Content-Type", contentType)
+			req = mux.SetURLVars(req, map[string]string{"id": "5"})
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "user")
+			}
+			w := httptest.NewRecorder()
+
+			handler.UploadItemImage(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImagesHandler_ServeImage(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockImagesService)
+	handler := NewImagesHandler(mockSvc, logger)
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+key, http.NoBody)
+		req = mux.SetURLVars(req, map[string]string{"key": key})
+		w := httptest.NewRecorder()
+		handler.ServeImage(w, req)
+		return w
+	}
+
+	mockSvc.On("OpenImage", mock.Anything, "items/5/a.png").
+		Return(io.NopCloser(bytes.NewBufferString("png data")), "image/png", nil).Once()
+	w := serve("items/5/a.png")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "png data", w.Body.String())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+
+	mockSvc.On("OpenImage", mock.Anything, "items/5/missing.png").Return(nil, "", service.ErrImageNotFound).Once()
+	assert.Equal(t, http.StatusNotFound, serve("items/5/missing.png").Code)
+
+	mockSvc.On("OpenImage", mock.Anything, "items/5/b.png").Return(nil, "", errors.New("s3 down")).Once()
+	assert.Equal(t, http.StatusInternalServerError, serve("items/5/b.png").Code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestImagesHandler_DeleteItemImage(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockImagesService)
+	handler := NewImagesHandler(mockSvc, logger)
+
+	remove := func(imageID string, userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/items/5/images/"+imageID, http.NoBody)
+		req = mux.SetURLVars(req, map[string]string{"id": "5", "imageID": imageID})
+		if userID != 0 {
+			req = setUserContext(req, userID, "user")
+		}
+		w := httptest.NewRecorder()
+		handler.DeleteItemImage(w, req)
+		return w
+	}
+
+	mockSvc.On("DeleteItemImage", mock.Anything, 1, 5, 3).Return(nil).Once()
+	assert.Equal(t, http.StatusNoContent, remove("3", 1).Code)
+
+	mockSvc.On("DeleteItemImage", mock.Anything, 1, 5, 4).Return(service.ErrImageNotFound).Once()
+	assert.Equal(t, http.StatusNotFound, remove("4", 1).Code)
+
+	assert.Equal(t, http.StatusBadRequest, remove("abc", 1).Code)
+	assert.Equal(t, http.StatusUnauthorized, remove("3", 0).Code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestImagesHandler_ReorderItemImages(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockImagesService)
+	handler := NewImagesHandler(mockSvc, logger)
+
+	reorder := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/items/5/images/order", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+		req = setUserContext(req, 1, "user")
+		w := httptest.NewRecorder()
+		handler.ReorderItemImages(w, req)
+		return w
+	}
+
+	mockSvc.On("ReorderItemImages", mock.Anything, 1, 5, []int{2, 1}).Return([]*models.ItemImage{
+		{ID: 2, Position: 0},
+		{ID: 1, Position: 1, IsPrimary: true},
+	}, nil).Once()
+	w := reorder(`{"image_ids":[2,1]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"images":[{"id":2`)
+
+	mockSvc.On("ReorderItemImages", mock.Anything, 1, 5, []int{2}).
+		Return(nil, fmt.Errorf("%w: expected 2 image ids", service.ErrInvalidImageOrder)).Once()
+	w = reorder(`{"image_ids":[2]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected 2 image ids")
+
+	assert.Equal(t, http.StatusBadRequest, reorder(`{"image_ids":`).Code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestImagesHandler_SetPrimaryItemImage(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockImagesService)
+	handler := NewImagesHandler(mockSvc, logger)
+
+	setPrimary := func(imageID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/items/5/images/"+imageID+"/primary", http.NoBody)
+		req = mux.SetURLVars(req, map[string]string{"id": "5", "imageID": imageID})
+		req = setUserContext(req, 1, "user")
+		w := httptest.NewRecorder()
+		handler.SetPrimaryItemImage(w, req)
+		return w
+	}
+
+	mockSvc.On("SetPrimaryItemImage", mock.Anything, 1, 5, 2).Return([]*models.ItemImage{{ID: 2, IsPrimary: true}}, nil).Once()
+	w := setPrimary("2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_primary":true`)
+
+	mockSvc.On("SetPrimaryItemImage", mock.Anything, 1, 5, 9).Return(nil, service.ErrForbidden).Once()
+	assert.Equal(t, http.StatusForbidden, setPrimary("9").Code)
+
+	mockSvc.AssertExpectations(t)
+}
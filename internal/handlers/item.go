@@ -4,19 +4,28 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/gorilla/mux"
+
 	"github.com/artnikel/marketplace/internal/logging"
 	"github.com/artnikel/marketplace/internal/middleware"
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/artnikel/marketplace/pkg/money"
 )
 
 // ItemsService is an interface that contains items service methods
 type ItemsService interface {
 	CreateItem(ctx context.Context, input *models.Item) (*models.Item, error)
-	ListItems(ctx context.Context, page, limit int, filters *models.ItemFilters) ([]*models.Item, error)
+	ListItems(ctx context.Context, req models.PageRequest, filters *models.ItemFilters) (*models.ItemPage, error)
+	GetItem(ctx context.Context, viewerID, id int) (*models.ItemDetails, error)
+	UpdateItem(ctx context.Context, userID, id int, upd *models.ItemUpdate) (*models.Item, error)
+	DeleteItem(ctx context.Context, userID, id int) error
+	ChangeItemStatus(ctx context.Context, userID, id int, to models.ItemStatus) (*models.Item, error)
 }
 
 // ItemsHandler handles item-related HTTP requests
@@ -33,10 +42,13 @@ func NewItemsHandler(svc ItemsService, logger *logging.Logger) *ItemsHandler {
 // CreateItem handles POST /items — creates a new item
 func (h *ItemsHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title       string  `json:"title"`
-		Description string  `json:"description"`
-		ImageURL    string  `json:"image_url"`
-		Price       float64 `json:"price"`
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		ImageURL    string            `json:"image_url"`
+		Price       money.Amount      `json:"price"`
+		Currency    string            `json:"currency"`
+		CategoryID  int               `json:"category_id"`
+		Status      models.ItemStatus `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -58,6 +70,9 @@ func (h *ItemsHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		Description: req.Description,
 		ImageURL:    req.ImageURL,
 		Price:       req.Price,
+		Currency:    req.Currency,
+		CategoryID:  req.CategoryID,
+		Status:      req.Status,
 		AuthorID:    userID,
 		AuthorLogin: userLogin,
 	}
@@ -85,46 +100,260 @@ func (h *ItemsHandler) GetItems(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
-	minPrice, _ := strconv.ParseFloat(r.URL.Query().Get("min_price"), 64)
-	maxPrice, _ := strconv.ParseFloat(r.URL.Query().Get("max_price"), 64)
+	minPrice, _ := money.Parse(r.URL.Query().Get("min_price"))
+	maxPrice, _ := money.Parse(r.URL.Query().Get("max_price"))
+
+	categoryID, _ := strconv.Atoi(r.URL.Query().Get("category"))
 
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
 	titleFilter := strings.TrimSpace(r.URL.Query().Get("title"))
 	descriptionFilter := strings.TrimSpace(r.URL.Query().Get("description"))
 
+	status := models.ItemStatus(strings.TrimSpace(r.URL.Query().Get("status")))
+	if status != "" && !status.Valid() {
+		http.Error(w, `{"error":"unknown item status"}`, http.StatusBadRequest)
+		return
+	}
+
 	var currentUserID int
 	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
 		currentUserID = middleware.GetUserID(r)
 	}
 
 	filters := &models.ItemFilters{
-		MinPrice:    minPrice,
-		MaxPrice:    maxPrice,
-		Title:       titleFilter,
-		Description: descriptionFilter,
+		MinPrice:        minPrice,
+		MaxPrice:        maxPrice,
+		Currency:        r.URL.Query().Get("currency"),
+		Query:           query,
+		Title:           titleFilter,
+		Description:     descriptionFilter,
+		Status:          status,
+		CategoryID:      categoryID,
+		Sort:            models.ItemSort(strings.TrimSpace(r.URL.Query().Get("sort"))),
+		DisplayCurrency: r.URL.Query().Get("display_currency"),
+	}
+	if status != "" && status != models.ItemStatusActive {
+		// non-active listings are only visible to their author
+		filters.AuthorID = currentUserID
 	}
 
-	items, err := h.Svc.ListItems(r.Context(), page, limit, filters)
+	req := models.PageRequest{
+		Page:      page,
+		Limit:     limit,
+		Cursor:    strings.TrimSpace(r.URL.Query().Get("cursor")),
+		SkipTotal: r.URL.Query().Get("count") == "false",
+	}
+
+	result, err := h.Svc.ListItems(r.Context(), req, filters)
 	if err != nil {
 		h.logger.Error.Println("error:", err)
+		if errors.Is(err, service.ErrForbidden) {
+			http.Error(w, `{"error":"authorization required to filter by status"}`, http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidFilter) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
 		http.Error(w, `{"error":"failed to list items"}`, http.StatusInternalServerError)
 		return
 	}
 
-	response := make([]map[string]interface{}, len(items))
-	for i, item := range items {
-		response[i] = map[string]interface{}{
-			"id":           item.ID,
-			"title":        item.Title,
-			"description":  item.Description,
-			"image_url":    item.ImageURL,
-			"price":        item.Price,
-			"author_id":    item.AuthorID,
-			"author_login": item.AuthorLogin,
-			"created_at":   item.CreatedAt,
-			"is_mine":      currentUserID > 0 && item.AuthorID == currentUserID,
+	items := make([]map[string]interface{}, len(result.Items))
+	for i, item := range result.Items {
+		items[i] = itemResponse(item, currentUserID)
+	}
+
+	response := map[string]interface{}{
+		"items":       items,
+		"limit":       result.Limit,
+		"total":       result.Total,
+		"total_pages": result.TotalPages,
+		"has_next":    result.HasNext,
+		"next_cursor": nil,
+	}
+	if result.NextCursor != "" {
+		response["next_cursor"] = result.NextCursor
+	}
+	if result.Page > 0 {
+		response["page"] = result.Page
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// GetItem handles GET /items/{id} — returns a single item with its author profile and images
+func (h *ItemsHandler) GetItem(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.Svc.GetItem(r.Context(), middleware.GetUserID(r), id)
+	if err != nil {
+		if errors.Is(err, service.ErrItemNotFound) {
+			http.Error(w, `{"error":"item not found"}`, http.StatusNotFound)
+			return
 		}
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to get item"}`, http.StatusInternalServerError)
+		return
 	}
 
+	response := itemResponse(details.Item, middleware.GetUserID(r))
+	response["author"] = details.Author
+	response["images"] = details.Images
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
 }
+
+// UpdateItem handles PUT/PATCH /items/{id} — updates fields of the user's own item
+func (h *ItemsHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var upd models.ItemUpdate
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		h.logger.Error.Println("invalid request body:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	out, err := h.Svc.UpdateItem(r.Context(), userID, id, &upd)
+	if err != nil {
+		h.writeItemError(w, err, "failed to update item")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DeleteItem handles DELETE /items/{id} — removes the user's own item
+func (h *ItemsHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	id, err := itemIDFromRequest(r)
+	if err != nil {
+		http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Svc.DeleteItem(r.Context(), userID, id); err != nil {
+		h.writeItemError(w, err, "failed to delete item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangeItemStatus returns a handler for POST /items/{id}/<transition> — moves the user's own item to the given status
+func (h *ItemsHandler) ChangeItemStatus(to models.ItemStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := itemIDFromRequest(r)
+		if err != nil {
+			http.Error(w, `{"error":"invalid item id"}`, http.StatusBadRequest)
+			return
+		}
+
+		userID := middleware.GetUserID(r)
+		if userID == 0 {
+			http.Error(w, `{"error":"user not authenticated"}`, http.StatusUnauthorized)
+			return
+		}
+
+		out, err := h.Svc.ChangeItemStatus(r.Context(), userID, id, to)
+		if err != nil {
+			h.writeItemError(w, err, "failed to change item status")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+// itemResponse builds the JSON representation of an item for the current user
+func itemResponse(item *models.Item, currentUserID int) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":           item.ID,
+		"title":        item.Title,
+		"description":  item.Description,
+		"image_url":    item.ImageURL,
+		"price":        item.Price,
+		"currency":     item.Currency,
+		"author_id":    item.AuthorID,
+		"author_login": item.AuthorLogin,
+		"category_id":  item.CategoryID,
+		"status":       item.Status,
+		"created_at":   item.CreatedAt,
+		"published_at": item.PublishedAt,
+		"reserved_at":  item.ReservedAt,
+		"sold_at":      item.SoldAt,
+		"archived_at":  item.ArchivedAt,
+		"is_mine":      currentUserID > 0 && item.AuthorID == currentUserID,
+	}
+	if item.Highlights != nil {
+		response["highlights"] = item.Highlights
+	}
+	if item.ThumbnailURL != "" {
+		response["thumbnail_url"] = item.ThumbnailURL
+	}
+	if item.DisplayPrice != nil {
+		response["display_price"] = item.DisplayPrice
+		response["display_currency"] = item.DisplayCurrency
+	}
+	return response
+}
+
+// itemIDFromRequest reads the {id} path variable
+func itemIDFromRequest(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid item id")
+	}
+	return id, nil
+}
+
+// writeItemError logs err and responds with its status, internal errors are replaced by fallback
+func (h *ItemsHandler) writeItemError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	status := itemErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		http.Error(w, `{"error":"`+fallback+`"}`, status)
+		return
+	}
+	http.Error(w, `{"error":"`+err.Error()+`"}`, status)
+}
+
+// itemErrorStatus maps items service errors to HTTP status codes, unknown errors are internal
+func itemErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidItem), errors.Is(err, service.ErrCategoryNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrInvalidTransition):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
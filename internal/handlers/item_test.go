@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -15,6 +16,9 @@ import (
 	"github.com/artnikel/marketplace/internal/logging"
 	"github.com/artnikel/marketplace/internal/middleware"
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/artnikel/marketplace/pkg/money"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -29,10 +33,37 @@ func (m *MockItemsService) CreateItem(ctx context.Context, input *models.Item) (
 	return item, args.Error(1)
 }
 
-func (m *MockItemsService) ListItems(ctx context.Context, page, limit int, filters *models.ItemFilters) ([]*models.Item, error) {
-	args := m.Called(ctx, page, limit, filters)
-	items, _ := args.Get(0).([]*models.Item)
-	return items, args.Error(1)
+func (m *MockItemsService) ListItems(ctx context.Context, req models.PageRequest, filters *models.ItemFilters) (*models.ItemPage, error) {
+	args := m.Called(ctx, req, filters)
+	result, _ := args.Get(0).(*models.ItemPage)
+	return result, args.Error(1)
+}
+
+func (m *MockItemsService) GetItem(ctx context.Context, viewerID, id int) (*models.ItemDetails, error) {
+	args := m.Called(ctx, viewerID, id)
+	details, _ := args.Get(0).(*models.ItemDetails)
+	return details, args.Error(1)
+}
+
+func (m *MockItemsService) UpdateItem(ctx context.Context, userID, id int, upd *models.ItemUpdate) (*models.Item, error) {
+	args := m.Called(ctx, userID, id, upd)
+	item, _ := args.Get(0).(*models.Item)
+	return item, args.Error(1)
+}
+
+func (m *MockItemsService) DeleteItem(ctx context.Context, userID, id int) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockItemsService) ChangeItemStatus(ctx context.Context, userID, id int, to models.ItemStatus) (*models.Item, error) {
+	args := m.Called(ctx, userID, id, to)
+	item, _ := args.Get(0).(*models.Item)
+	return item, args.Error(1)
+}
+
+func intPtr(v int) *int {
+	return &v
 }
 
 func setUserContext(r *http.Request, id int, login string) *http.Request {
@@ -54,7 +85,8 @@ func TestItemsHandler_CreateItem(t *testing.T) {
 		Title:       "Test Title",
 		Description: "Test Desc",
 		ImageURL:    "http://example.com/image.jpg",
-		Price:       10.5,
+		Price:       money.MustParse("10.50"),
+		Currency:    "USD",
 		AuthorID:    123,
 		AuthorLogin: "user123",
 	}
@@ -81,6 +113,28 @@ func TestItemsHandler_CreateItem(t *testing.T) {
 			wantStatusCode: http.StatusOK,
 			wantContains:   `"title":"Test Title"`,
 		},
+		{
+			name:      "exact price and currency",
+			body:      `{"title":"Test Title","description":"Test Desc","price":"0.30","currency":"EUR"}`,
+			userID:    123,
+			userLogin: "user123",
+			setupMock: func() {
+				mockSvc.On("CreateItem", mock.Anything, mock.MatchedBy(func(item *models.Item) bool {
+					return item.Price.String() == "0.30" && item.Currency == "EUR"
+				})).Return(validItem, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"price":"10.50"`,
+		},
+		{
+			name:           "malformed price",
+			body:           `{"title":"Test Title","description":"Test Desc","price":"ten"}`,
+			userID:         123,
+			userLogin:      "user123",
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid request format",
+		},
 		{
 			name:           "invalid json body",
 			body:           `{"title":"Test Title",`,
@@ -153,7 +207,7 @@ func TestItemsHandler_GetItems(t *testing.T) {
 			Title:       "Item 1",
 			Description: "Desc 1",
 			ImageURL:    "http://example.com/1.jpg",
-			Price:       100,
+			Price:       money.MustParse("100.00"),
 			AuthorID:    123,
 			AuthorLogin: "user1",
 			CreatedAt:   time.Now(),
@@ -163,7 +217,7 @@ func TestItemsHandler_GetItems(t *testing.T) {
 			Title:       "Item 2",
 			Description: "Desc 2",
 			ImageURL:    "http://example.com/2.jpg",
-			Price:       200,
+			Price:       money.MustParse("200.00"),
 			AuthorID:    456,
 			AuthorLogin: "user2",
 			CreatedAt:   time.Now(),
@@ -187,30 +241,139 @@ func TestItemsHandler_GetItems(t *testing.T) {
 			userID:     123,
 			userLogin:  "user123",
 			setupMock: func() {
-				mockSvc.On("ListItems", mock.Anything, 1, 2, mock.Anything).
-					Return(mockItems, nil).Once()
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 2}, mock.Anything).
+					Return(&models.ItemPage{Items: mockItems, Page: 1, Limit: 10, Total: intPtr(2), TotalPages: intPtr(1)}, nil).Once()
 			},
 			wantStatusCode: http.StatusOK,
-			wantContains:   []string{`"title":"Item 1"`, `"title":"Item 2"`, `"is_mine":true`, `"is_mine":false`},
+			wantContains:   []string{`"items":[`, `"title":"Item 1"`, `"price":"100.00"`, `"title":"Item 2"`, `"is_mine":true`, `"is_mine":false`, `"page":1`, `"total":2`, `"total_pages":1`, `"has_next":false`, `"next_cursor":null`},
 		},
 		{
 			name:       "service error",
 			query:      "?page=1&limit=10",
 			authHeader: "",
 			setupMock: func() {
-				mockSvc.On("ListItems", mock.Anything, 1, 10, mock.Anything).
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.Anything).
 					Return(nil, errors.New("db error")).Once()
 			},
 			wantStatusCode: http.StatusInternalServerError,
 			wantContains:   []string{"failed to list items"},
 		},
+		{
+			name:  "search with highlights",
+			query: "?q=item+one",
+			setupMock: func() {
+				found := *mockItems[0]
+				found.Highlights = &models.ItemHighlights{Title: "<mark>Item</mark> 1", Description: "Desc 1"}
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Query == "item one"
+				})).Return(&models.ItemPage{Items: []*models.Item{&found}, Page: 1, Limit: 10}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"highlights":{"title":"\u003cmark\u003eItem\u003c/mark\u003e 1","description":"Desc 1"}`},
+		},
+		{
+			name:  "cursor page",
+			query: "?limit=1&cursor=abc",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 1, Cursor: "abc"}, mock.Anything).
+					Return(&models.ItemPage{Items: mockItems[1:], Limit: 1, HasNext: true, NextCursor: "def"}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"title":"Item 2"`, `"next_cursor":"def"`, `"has_next":true`},
+		},
+		{
+			name:  "counting skipped",
+			query: "?page=2&limit=5&count=false",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 2, Limit: 5, SkipTotal: true}, mock.Anything).
+					Return(&models.ItemPage{Items: mockItems, Page: 2, Limit: 5}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"page":2`, `"total":null`, `"total_pages":null`},
+		},
+		{
+			name:  "invalid cursor",
+			query: "?cursor=abc",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10, Cursor: "abc"}, mock.Anything).
+					Return(nil, service.ErrInvalidCursor).Once()
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"invalid cursor"},
+		},
+		{
+			name:           "unknown status",
+			query:          "?status=deleted",
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"unknown item status"},
+		},
+		{
+			name:       "owner status filter",
+			query:      "?page=1&limit=10&status=draft",
+			authHeader: "Bearer token",
+			userID:     123,
+			userLogin:  "user123",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Status == models.ItemStatusDraft && f.AuthorID == 123
+				})).Return(&models.ItemPage{Items: mockItems[:1], Page: 1, Limit: 10}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"is_mine":true`},
+		},
+		{
+			name:  "anonymous status filter",
+			query: "?page=1&limit=10&status=sold",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.Anything).
+					Return(nil, service.ErrForbidden).Once()
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantContains:   []string{"authorization required to filter by status"},
+		},
+		{
+			name:  "sort by price",
+			query: "?page=1&limit=10&sort=price_desc",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Sort == models.ItemSortPriceDesc
+				})).Return(&models.ItemPage{Items: mockItems, Page: 1, Limit: 10}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"title":"Item 1"`},
+		},
+		{
+			name:  "display currency",
+			query: "?display_currency=EUR&currency=USD&min_price=5",
+			setupMock: func() {
+				display := money.MustParse("92.00")
+				mockSvc.On("ListItems", mock.Anything, mock.Anything, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.DisplayCurrency == "EUR" && f.Currency == "USD" && f.MinPrice.String() == "5"
+				})).Return(&models.ItemPage{Items: []*models.Item{
+					{ID: 1, Title: "Item 1", Price: money.MustParse("100.00"), Currency: "USD", DisplayPrice: &display, DisplayCurrency: "EUR"},
+				}, Limit: 10}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"display_price":"92.00"`, `"display_currency":"EUR"`, `"currency":"USD"`},
+		},
+		{
+			name:  "unknown sort",
+			query: "?sort=random",
+			setupMock: func() {
+				mockSvc.On("ListItems", mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("%w: unknown sort order", service.ErrInvalidFilter)).Once()
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"unknown sort order"},
+		},
 		{
 			name:       "no auth header",
 			query:      "?page=1&limit=10",
 			authHeader: "",
 			setupMock: func() {
-				mockSvc.On("ListItems", mock.Anything, 1, 10, mock.Anything).
-					Return(mockItems, nil).Once()
+				mockSvc.On("ListItems", mock.Anything, models.PageRequest{Page: 1, Limit: 10}, mock.Anything).
+					Return(&models.ItemPage{Items: mockItems, Page: 1, Limit: 10, Total: intPtr(2), TotalPages: intPtr(1)}, nil).Once()
 			},
 			wantStatusCode: http.StatusOK,
 			wantContains:   []string{`"is_mine":false`},
@@ -248,3 +411,354 @@ func TestItemsHandler_GetItems(t *testing.T) {
 		})
 	}
 }
+
+func TestItemsHandler_GetItem(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockItemsService)
+	handler := NewItemsHandler(mockSvc, logger)
+
+	details := &models.ItemDetails{
+		Item:   &models.Item{ID: 1, Title: "Item 1", AuthorID: 123, AuthorLogin: "user123", ThumbnailURL: "/media/items/1/a_thumb.jpg"},
+		Author: &models.User{ID: 123, Login: "user123"},
+		Images: []*models.ItemImage{{ID: 4, ItemID: 1, IsPrimary: true, URL: "/media/items/1/a.png"}},
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		userID         int
+		setupMock      func()
+		wantStatusCode int
+		wantContains   []string
+	}{
+		{
+			name:   "own item",
+			id:     "1",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("GetItem", mock.Anything, 123, 1).Return(details, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`"title":"Item 1"`, `"author":{"id":123,"login":"user123"}`, `"is_mine":true`,
+				`"thumbnail_url":"/media/items/1/a_thumb.jpg"`, `"images":[{"id":4,"item_id":1,"position":0,"is_primary":true,"url":"/media/items/1/a.png"`,
+			},
+		},
+		{
+			name: "anonymous user",
+			id:   "1",
+			setupMock: func() {
+				mockSvc.On("GetItem", mock.Anything, 0, 1).Return(details, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"is_mine":false`},
+		},
+		{
+			name: "item not found",
+			id:   "2",
+			setupMock: func() {
+				mockSvc.On("GetItem", mock.Anything, 0, 2).Return(nil, service.ErrItemNotFound).Once()
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantContains:   []string{`{"error":"item not found"}`},
+		},
+		{
+			name: "service error",
+			id:   "1",
+			setupMock: func() {
+				mockSvc.On("GetItem", mock.Anything, 0, 1).Return(nil, errors.New("db error")).Once()
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   []string{"failed to get item"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodGet, "/items/"+tt.id, http.NoBody)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "user123")
+			}
+			w := httptest.NewRecorder()
+
+			handler.GetItem(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(resp.Body)
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			for _, substr := range tt.wantContains {
+				assert.Contains(t, body.String(), substr)
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsHandler_UpdateItem(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockItemsService)
+	handler := NewItemsHandler(mockSvc, logger)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		userID         int
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name:   "successful update",
+			id:     "1",
+			body:   `{"title":"New"}`,
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("UpdateItem", mock.Anything, 123, 1, mock.MatchedBy(func(u *models.ItemUpdate) bool {
+					return u.Title != nil && *u.Title == "New" && u.Description == nil
+				})).Return(&models.Item{ID: 1, Title: "New"}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"title":"New"`,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			body:           `{"title":"New"}`,
+			userID:         123,
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "invalid item id",
+		},
+		{
+			name:           "unauthenticated user",
+			id:             "1",
+			body:           `{"title":"New"}`,
+			setupMock:      func() {},
+			wantStatusCode: http.StatusUnauthorized,
+			wantContains:   "user not authenticated",
+		},
+		{
+			name:   "not the owner",
+			id:     "1",
+			body:   `{"title":"New"}`,
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("UpdateItem", mock.Anything, 123, 1, mock.Anything).
+					Return(nil, service.ErrForbidden).Once()
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantContains:   "access denied",
+		},
+		{
+			name:   "item not found",
+			id:     "1",
+			body:   `{"title":"New"}`,
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("UpdateItem", mock.Anything, 123, 1, mock.Anything).
+					Return(nil, service.ErrItemNotFound).Once()
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantContains:   "item not found",
+		},
+		{
+			name:   "invalid update",
+			id:     "1",
+			body:   `{"title":" "}`,
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("UpdateItem", mock.Anything, 123, 1, mock.Anything).
+					Return(nil, fmt.Errorf("%w: title cannot be empty", service.ErrInvalidItem)).Once()
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "title cannot be empty",
+		},
+		{
+			name:   "database error is not exposed",
+			id:     "1",
+			body:   `{"title":"New"}`,
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("UpdateItem", mock.Anything, 123, 1, mock.Anything).
+					Return(nil, errors.New("pq: relation items does not exist")).Once()
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   `{"error":"failed to update item"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodPatch, "/items/"+tt.id, strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "user123")
+			}
+			w := httptest.NewRecorder()
+
+			handler.UpdateItem(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(resp.Body)
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			assert.Contains(t, body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsHandler_DeleteItem(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockItemsService)
+	handler := NewItemsHandler(mockSvc, logger)
+
+	tests := []struct {
+		name           string
+		userID         int
+		setupMock      func()
+		wantStatusCode int
+	}{
+		{
+			name:   "successful delete",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("DeleteItem", mock.Anything, 123, 1).Return(nil).Once()
+			},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "unauthenticated user",
+			setupMock:      func() {},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "not the owner",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("DeleteItem", mock.Anything, 123, 1).Return(service.ErrForbidden).Once()
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:   "database error",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("DeleteItem", mock.Anything, 123, 1).Return(errors.New("connection refused")).Once()
+			},
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodDelete, "/items/1", http.NoBody)
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "user123")
+			}
+			w := httptest.NewRecorder()
+
+			handler.DeleteItem(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsHandler_ChangeItemStatus(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockItemsService)
+	handler := NewItemsHandler(mockSvc, logger)
+
+	tests := []struct {
+		name           string
+		userID         int
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name:   "successful transition",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("ChangeItemStatus", mock.Anything, 123, 1, models.ItemStatusReserved).
+					Return(&models.Item{ID: 1, Status: models.ItemStatusReserved}, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"status":"reserved"`,
+		},
+		{
+			name:           "unauthenticated user",
+			setupMock:      func() {},
+			wantStatusCode: http.StatusUnauthorized,
+			wantContains:   "user not authenticated",
+		},
+		{
+			name:   "illegal transition",
+			userID: 123,
+			setupMock: func() {
+				mockSvc.On("ChangeItemStatus", mock.Anything, 123, 1, models.ItemStatusReserved).
+					Return(nil, service.ErrInvalidTransition).Once()
+			},
+			wantStatusCode: http.StatusConflict,
+			wantContains:   "item status transition not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			req := httptest.NewRequest(http.MethodPost, "/items/1/reserve", http.NoBody)
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "user123")
+			}
+			w := httptest.NewRecorder()
+
+			handler.ChangeItemStatus(models.ItemStatusReserved)(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(resp.Body)
+
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			assert.Contains(t, body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
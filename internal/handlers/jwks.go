@@ -0,0 +1,32 @@
+// Package handlers contains HTTP handlers for publishing token verification keys
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	mjwt "github.com/artnikel/marketplace/pkg/jwt"
+)
+
+// JWKSService is an interface that contains the method returning token verification keys
+type JWKSService interface {
+	JWKS() mjwt.JWKS
+}
+
+// JWKSHandler publishes the public keys other services use to verify access tokens
+type JWKSHandler struct {
+	Svc JWKSService
+}
+
+// NewJWKSHandler creates a new JWKSHandler instance
+func NewJWKSHandler(svc JWKSService) *JWKSHandler {
+	return &JWKSHandler{Svc: svc}
+}
+
+// GetJWKS handles GET /.well-known/jwks.json — lists the keys that verify access tokens.
+// Verifiers cache the set briefly and refetch it when they meet an unknown kid
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(h.Svc.JWKS())
+}
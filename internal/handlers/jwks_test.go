@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mjwt "github.com/artnikel/marketplace/pkg/jwt"
+)
+
+func TestJWKSHandler_GetJWKS(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signing, err := mjwt.NewSigningKey("2024-05", private)
+	require.NoError(t, err)
+	keys, err := mjwt.NewKeySet("2024-05", signing, mjwt.NewHMACKey("legacy", []byte("secret")))
+	require.NoError(t, err)
+
+	handler := NewJWKSHandler(keys)
+	w := httptest.NewRecorder()
+	handler.GetJWKS(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	var set mjwt.JWKS
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "2024-05", set.Keys[0].KeyID)
+	assert.Equal(t, "EdDSA", set.Keys[0].Algorithm)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(public), set.Keys[0].X)
+}
@@ -0,0 +1,140 @@
+// Package handlers contains HTTP handlers for two-factor authentication
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// VerifyMFA handles POST /auth/mfa/verify — finishes a login with the mfa_token from /auth/login and
+// a TOTP or recovery code
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.MFAToken = strings.TrimSpace(req.MFAToken)
+	req.Code = strings.TrimSpace(req.Code)
+	if req.MFAToken == "" || req.Code == "" {
+		http.Error(w, `{"error":"mfa_token and code are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, tokens, err := h.AuthService.VerifyMFA(r.Context(), req.MFAToken, req.Code, clientInfo(r))
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		var locked *service.TooManyAttemptsError
+		switch {
+		case errors.As(err, &locked):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrInvalidMFAToken), errors.Is(err, service.ErrInvalidMFACode),
+			errors.Is(err, service.ErrAccountDisabled):
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
+		default:
+			http.Error(w, `{"error":"failed to verify code"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeAuthResponse(w, user, tokens)
+}
+
+// SetupTOTP handles POST /auth/mfa/totp/setup — creates a TOTP secret for the current user,
+// it is enabled by POST /auth/mfa/totp/confirm
+func (h *AuthHandler) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	setup, err := h.AuthService.SetupTOTP(r.Context(), middleware.GetUserID(r))
+	if err != nil {
+		h.writeMFAError(w, err, "failed to set up two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(setup)
+}
+
+// ConfirmTOTP handles POST /auth/mfa/totp/confirm — enables TOTP with a first code and responds with recovery codes
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		http.Error(w, `{"error":"code is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.AuthService.ConfirmTOTP(r.Context(), middleware.GetUserID(r), req.Code)
+	if err != nil {
+		h.writeMFAError(w, err, "failed to enable two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// DisableTOTP handles POST /auth/mfa/totp/disable — turns two-factor authentication off with the password and a code
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Password == "" || req.Code == "" {
+		http.Error(w, `{"error":"password and code are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.DisableTOTP(r.Context(), middleware.GetUserID(r), req.Password, req.Code); err != nil {
+		h.writeMFAError(w, err, "failed to disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMFAError logs err and responds with its status, errors the user can fix are reported as they are
+// and other errors are replaced by fallback
+func (h *AuthHandler) writeMFAError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrWrongPassword),
+		errors.Is(err, service.ErrMFANotSetUp), errors.Is(err, service.ErrMFANotEnabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusConflict)
+	case errors.Is(err, service.ErrAccountDisabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+	default:
+		http.Error(w, `{"error":"`+fallback+`"}`, http.StatusInternalServerError)
+	}
+}
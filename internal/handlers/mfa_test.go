@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthHandler_VerifyMFA(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(m *MockAuthService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "valid code",
+			body: `{"mfa_token":"pending123","code":"123456"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("VerifyMFA", mock.Anything, "pending123", "123456", models.ClientInfo{IP: "192.0.2.1"}).
+					Return(&models.User{ID: 1, Login: "testuser"}, &models.AuthTokens{AccessToken: "token123", RefreshToken: "refresh123", ExpiresIn: 900}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"token":"token123"`,
+		},
+		{
+			name:           "missing code",
+			body:           `{"mfa_token":"pending123"}`,
+			setupMock:      func(_ *MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `mfa_token and code are required`,
+		},
+		{
+			name: "wrong code",
+			body: `{"mfa_token":"pending123","code":"000000"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("VerifyMFA", mock.Anything, "pending123", "000000", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, nil, service.ErrInvalidMFACode)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       `invalid two-factor code`,
+		},
+		{
+			name: "expired login",
+			body: `{"mfa_token":"old","code":"123456"}`,
+			setupMock: func(m *MockAuthService) {
+				m.On("VerifyMFA", mock.Anything, "old", "123456", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, nil, service.ErrInvalidMFAToken)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       `please log in again`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := new(MockAuthService)
+			tt.setupMock(mockAuth)
+
+			handler := NewAuthHandler(mockAuth, logger)
+			req := httptest.NewRequest(http.MethodPost, "/auth/mfa/verify", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.VerifyMFA(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Result().StatusCode)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+			mockAuth.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_TOTPEnrollment(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockAuth := new(MockAuthService)
+	handler := NewAuthHandler(mockAuth, logger)
+
+	mockAuth.On("SetupTOTP", mock.Anything, 1).
+		Return(&models.TOTPSetup{Secret: "ABC", URI: "otpauth://totp/Marketplace:testuser?secret=ABC"}, nil).Once()
+	req := setUserContext(httptest.NewRequest(http.MethodPost, "/auth/mfa/totp/setup", http.NoBody), 1, "testuser")
+	w := httptest.NewRecorder()
+	handler.SetupTOTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `"otpauth_uri":"otpauth://totp/Marketplace:testuser?secret=ABC"`)
+
+	mockAuth.On("SetupTOTP", mock.Anything, 1).Return(nil, service.ErrMFAAlreadyEnabled).Once()
+	w = httptest.NewRecorder()
+	handler.SetupTOTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+
+	mockAuth.On("ConfirmTOTP", mock.Anything, 1, "123456").Return([]string{"abcd-efgh-ijkl-mnop"}, nil).Once()
+	req = setUserContext(httptest.NewRequest(http.MethodPost, "/auth/mfa/totp/confirm", strings.NewReader(`{"code":"123456"}`)), 1, "testuser")
+	w = httptest.NewRecorder()
+	handler.ConfirmTOTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `"recovery_codes":["abcd-efgh-ijkl-mnop"]`)
+
+	mockAuth.On("ConfirmTOTP", mock.Anything, 1, "000000").Return(nil, service.ErrInvalidMFACode).Once()
+	req = setUserContext(httptest.NewRequest(http.MethodPost, "/auth/mfa/totp/confirm", strings.NewReader(`{"code":"000000"}`)), 1, "testuser")
+	w = httptest.NewRecorder()
+	handler.ConfirmTOTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockAuth.On("DisableTOTP", mock.Anything, 1, "password123", "123456").Return(nil).Once()
+	req = setUserContext(httptest.NewRequest(http.MethodPost, "/auth/mfa/totp/disable",
+		strings.NewReader(`{"password":"password123","code":"123456"}`)), 1, "testuser")
+	w = httptest.NewRecorder()
+	handler.DisableTOTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	mockAuth.On("DisableTOTP", mock.Anything, 1, "wrong", "123456").Return(service.ErrWrongPassword).Once()
+	req = setUserContext(httptest.NewRequest(http.MethodPost, "/auth/mfa/totp/disable",
+		strings.NewReader(`{"password":"wrong","code":"123456"}`)), 1, "testuser")
+	w = httptest.NewRecorder()
+	handler.DisableTOTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockAuth.AssertExpectations(t)
+}
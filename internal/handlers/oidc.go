@@ -0,0 +1,145 @@
+// Package handlers contains HTTP handlers for OpenID Connect login
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// OIDCService is an interface that contains OpenID Connect login service methods
+type OIDCService interface {
+	ProviderNames() []string
+	Start(ctx context.Context, provider string, userID int) (string, string, error)
+	Callback(ctx context.Context, code, state string, client models.ClientInfo) (*service.OIDCResult, error)
+	ListIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error)
+	UnlinkIdentity(ctx context.Context, userID, id int) error
+}
+
+// OIDCHandler handles sign-in with external OpenID providers and the identities linked to users
+type OIDCHandler struct {
+	OIDCService OIDCService
+	logger      *logging.Logger
+}
+
+// NewOIDCHandler creates a new OIDCHandler
+func NewOIDCHandler(s OIDCService, logger *logging.Logger) *OIDCHandler {
+	return &OIDCHandler{OIDCService: s, logger: logger}
+}
+
+// GetProviders handles GET /auth/oidc/providers — lists the providers users can sign in with
+func (h *OIDCHandler) GetProviders(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"providers": h.OIDCService.ProviderNames()})
+}
+
+// Start handles POST /auth/oidc/{provider}/start — responds with the authorization_url to send the user to and
+// the state the provider redirects back with. Signed in users link the identity to their account instead of logging in
+func (h *OIDCHandler) Start(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.OIDCService.Start(r.Context(), mux.Vars(r)["provider"], middleware.GetUserID(r))
+	if err != nil {
+		h.writeOIDCError(w, err, "failed to start sign-in")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL, "state": state})
+}
+
+// Callback handles POST /auth/oidc/callback — finishes a sign-in with the code and state of the redirect.
+// Responds like login, or with the linked identity when the sign-in was started by a signed in user
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error.Println("invalid request format:", err)
+		http.Error(w, `{"error":"invalid request format"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	req.State = strings.TrimSpace(req.State)
+	if req.Code == "" || req.State == "" {
+		http.Error(w, `{"error":"code and state are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.OIDCService.Callback(r.Context(), req.Code, req.State, clientInfo(r))
+	var pending *service.MFARequiredError
+	if errors.As(err, &pending) {
+		writeMFARequired(w, pending)
+		return
+	}
+	if err != nil {
+		h.writeOIDCError(w, err, "failed to sign in")
+		return
+	}
+
+	if result.Tokens == nil {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"user": result.User, "identity": result.Identity})
+		return
+	}
+	writeAuthResponse(w, result.User, result.Tokens)
+}
+
+// ListIdentities handles GET /auth/oidc/identities — lists the identities linked to the current user
+func (h *OIDCHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	identities, err := h.OIDCService.ListIdentities(r.Context(), middleware.GetUserID(r))
+	if err != nil {
+		h.writeOIDCError(w, err, "failed to list identities")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"identities": identities})
+}
+
+// UnlinkIdentity handles DELETE /auth/oidc/identities/{id} — unlinks an identity of the current user
+func (h *OIDCHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid identity id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.OIDCService.UnlinkIdentity(r.Context(), middleware.GetUserID(r), id); err != nil {
+		h.writeOIDCError(w, err, "failed to unlink identity")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOIDCError logs err and responds with its status, errors the user can act on are reported as they are
+// and other errors are replaced by fallback
+func (h *OIDCHandler) writeOIDCError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	switch {
+	case errors.Is(err, service.ErrUnknownProvider), errors.Is(err, service.ErrIdentityNotFound):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, service.ErrOIDCLogin):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
+	case errors.Is(err, service.ErrIdentityLinked), errors.Is(err, service.ErrLastIdentity):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusConflict)
+	case errors.Is(err, service.ErrAccountDisabled):
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+	default:
+		http.Error(w, `{"error":"`+fallback+`"}`, http.StatusInternalServerError)
+	}
+}
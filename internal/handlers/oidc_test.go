@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockOIDCService struct {
+	mock.Mock
+}
+
+func (m *MockOIDCService) ProviderNames() []string {
+	args := m.Called()
+	names, _ := args.Get(0).([]string)
+	return names
+}
+
+func (m *MockOIDCService) Start(ctx context.Context, provider string, userID int) (string, string, error) {
+	args := m.Called(ctx, provider, userID)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *MockOIDCService) Callback(ctx context.Context, code, state string, client models.ClientInfo) (*service.OIDCResult, error) {
+	args := m.Called(ctx, code, state, client)
+	result, _ := args.Get(0).(*service.OIDCResult)
+	return result, args.Error(1)
+}
+
+func (m *MockOIDCService) ListIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	args := m.Called(ctx, userID)
+	identities, _ := args.Get(0).([]*models.UserIdentity)
+	return identities, args.Error(1)
+}
+
+func (m *MockOIDCService) UnlinkIdentity(ctx context.Context, userID, id int) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func TestOIDCHandler_Start(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		provider       string
+		userID         int
+		setupMock      func(m *MockOIDCService)
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name:     "sign-in started",
+			provider: "mock",
+			setupMock: func(m *MockOIDCService) {
+				m.On("Start", mock.Anything, "mock", 0).Return("http://idp/authorize?state=abc", "abc", nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"authorization_url":"http://idp/authorize?state=abc"`,
+		},
+		{
+			name:     "signed in user links an identity",
+			provider: "mock",
+			userID:   4,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Start", mock.Anything, "mock", 4).Return("http://idp/authorize?state=abc", "abc", nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"state":"abc"`,
+		},
+		{
+			name:     "unknown provider",
+			provider: "other",
+			setupMock: func(m *MockOIDCService) {
+				m.On("Start", mock.Anything, "other", 0).Return("", "", service.ErrUnknownProvider)
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantContains:   service.ErrUnknownProvider.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOIDC := new(MockOIDCService)
+			tt.setupMock(mockOIDC)
+
+			handler := NewOIDCHandler(mockOIDC, logger)
+			req := httptest.NewRequest(http.MethodPost, "/auth/oidc/"+tt.provider+"/start", nil)
+			if tt.userID != 0 {
+				req = setUserContext(req, tt.userID, "seller")
+			}
+			req = mux.SetURLVars(req, map[string]string{"provider": tt.provider})
+			w := httptest.NewRecorder()
+
+			handler.Start(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Result().StatusCode)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+			mockOIDC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOIDCHandler_Callback(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	user := &models.User{ID: 1, Login: "seller", Role: models.RoleUser}
+	identity := &models.UserIdentity{ID: 3, UserID: 1, Provider: "mock", Subject: "sub-1"}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(m *MockOIDCService)
+		wantStatusCode int
+		wantContains   []string
+	}{
+		{
+			name: "logged in",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(&service.OIDCResult{
+					User: user, Identity: identity, Tokens: &models.AuthTokens{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"token":"access"`, `"refresh_token":"refresh"`},
+		},
+		{
+			name: "identity linked",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(&service.OIDCResult{User: user, Identity: identity}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"identity":{"id":3,"provider":"mock","subject":"sub-1"`},
+		},
+		{
+			name: "second factor required",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, &service.MFARequiredError{Token: "pending", ExpiresIn: 300})
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{`"mfa_required":true`, `"mfa_token":"pending"`},
+		},
+		{
+			name:           "missing state",
+			body:           `{"code":"code-1"}`,
+			setupMock:      func(_ *MockOIDCService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"code and state are required"},
+		},
+		{
+			name: "used state",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, service.ErrInvalidOIDCState)
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{service.ErrInvalidOIDCState.Error()},
+		},
+		{
+			name: "identity of another user",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, service.ErrIdentityLinked)
+			},
+			wantStatusCode: http.StatusConflict,
+			wantContains:   []string{service.ErrIdentityLinked.Error()},
+		},
+		{
+			name: "provider rejected the code",
+			body: `{"code":"code-1","state":"abc"}`,
+			setupMock: func(m *MockOIDCService) {
+				m.On("Callback", mock.Anything, "code-1", "abc", models.ClientInfo{IP: "192.0.2.1"}).Return(nil, service.ErrOIDCLogin)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantContains:   []string{service.ErrOIDCLogin.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOIDC := new(MockOIDCService)
+			tt.setupMock(mockOIDC)
+
+			handler := NewOIDCHandler(mockOIDC, logger)
+			req := httptest.NewRequest(http.MethodPost, "/auth/oidc/callback", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Callback(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Result().StatusCode)
+			for _, want := range tt.wantContains {
+				assert.Contains(t, w.Body.String(), want)
+			}
+			mockOIDC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOIDCHandler_UnlinkIdentity(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		setupMock      func(m *MockOIDCService)
+		wantStatusCode int
+	}{
+		{
+			name:           "unlinked",
+			id:             "3",
+			setupMock:      func(m *MockOIDCService) { m.On("UnlinkIdentity", mock.Anything, 1, 3).Return(nil) },
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "last sign-in method",
+			id:             "3",
+			setupMock:      func(m *MockOIDCService) { m.On("UnlinkIdentity", mock.Anything, 1, 3).Return(service.ErrLastIdentity) },
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name: "unknown identity",
+			id:   "9",
+			setupMock: func(m *MockOIDCService) {
+				m.On("UnlinkIdentity", mock.Anything, 1, 9).Return(service.ErrIdentityNotFound)
+			},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			setupMock:      func(_ *MockOIDCService) {},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOIDC := new(MockOIDCService)
+			tt.setupMock(mockOIDC)
+
+			handler := NewOIDCHandler(mockOIDC, logger)
+			req := setUserContext(httptest.NewRequest(http.MethodDelete, "/auth/oidc/identities/"+tt.id, nil), 1, "seller")
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+
+			handler.UnlinkIdentity(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Result().StatusCode)
+			mockOIDC.AssertExpectations(t)
+		})
+	}
+}
+
+// TestOIDCHandler_WebClientPaths calls the OIDC paths used by the web client through a router that mounts
+// the handlers under /api like main does
+func TestOIDCHandler_WebClientPaths(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+
+	page, err := os.ReadFile("../../web/index.html")
+	require.NoError(t, err)
+	matches := regexp.MustCompile("\\$\\{API_BASE\\}(/[^`]*/oidc/[^`]*)`").FindAllSubmatch(page, -1)
+	require.Len(t, matches, 3)
+
+	mockOIDC := new(MockOIDCService)
+	mockOIDC.On("ProviderNames").Return([]string{"mock"})
+	mockOIDC.On("Start", mock.Anything, "mock", 0).Return("http://idp/authorize?state=abc", "abc", nil)
+	mockOIDC.On("Callback", mock.Anything, "code-1", "abc", mock.Anything).Return(&service.OIDCResult{
+		User: &models.User{ID: 1, Login: "seller"}, Tokens: &models.AuthTokens{AccessToken: "access", RefreshToken: "refresh"},
+	}, nil)
+
+	handler := NewOIDCHandler(mockOIDC, logger)
+	r := mux.NewRouter()
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/auth/oidc/providers", handler.GetProviders).Methods("GET", "OPTIONS")
+	api.HandleFunc("/auth/oidc/{provider}/start", handler.Start).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/oidc/callback", handler.Callback).Methods("POST", "OPTIONS")
+
+	for _, match := range matches {
+		path := strings.ReplaceAll(string(match[1]), "${encodeURIComponent(provider)}", "mock")
+		t.Run(path, func(t *testing.T) {
+			method := http.MethodPost
+			if strings.HasSuffix(path, "/providers") {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, path, strings.NewReader(`{"code":"code-1","state":"abc"}`))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		})
+	}
+	mockOIDC.AssertExpectations(t)
+}
@@ -0,0 +1,106 @@
+// Package handlers contains HTTP handlers for exchange rates
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+)
+
+// maxRatesFileSize limits the size of an uploaded exchange rates file
+const maxRatesFileSize = 1 << 20
+
+// RatesService is an interface that contains exchange rates service methods
+type RatesService interface {
+	BaseCurrency() string
+	ListRates(ctx context.Context) ([]*models.ExchangeRate, error)
+	ImportRates(ctx context.Context, format string, r io.Reader) ([]*models.ExchangeRate, error)
+}
+
+// RatesHandler handles exchange rate HTTP requests
+type RatesHandler struct {
+	Svc    RatesService
+	logger *logging.Logger
+}
+
+// NewRatesHandler creates a new RatesHandler instance
+func NewRatesHandler(svc RatesService, logger *logging.Logger) *RatesHandler {
+	return &RatesHandler{Svc: svc, logger: logger}
+}
+
+// GetRates handles GET /exchange-rates — returns the rates against the base currency
+func (h *RatesHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.Svc.ListRates(r.Context())
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		http.Error(w, `{"error":"failed to list exchange rates"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":  h.Svc.BaseCurrency(),
+		"rates": rates,
+	})
+}
+
+// ImportRates handles POST /admin/exchange-rates — replaces all rates with an uploaded file.
+// The file is sent either as the request body with a text/csv or application/json content type
+// or as the "file" field of a multipart form, where its extension selects the format
+func (h *RatesHandler) ImportRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRatesFileSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format := ratesFormat(mediaType)
+	var body io.Reader = r.Body
+
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			h.logger.Error.Println("invalid rates upload:", err)
+			http.Error(w, `{"error":"file field is required"}`, http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		body = file
+	}
+
+	rates, err := h.Svc.ImportRates(r.Context(), format, body)
+	if err != nil {
+		h.logger.Error.Println("error:", err)
+		if errors.Is(err, service.ErrInvalidRates) {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"error":"failed to import exchange rates"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":  h.Svc.BaseCurrency(),
+		"rates": rates,
+	})
+}
+
+// ratesFormat maps a request media type to an exchange rates file format
+func ratesFormat(mediaType string) string {
+	switch mediaType {
+	case "text/csv":
+		return service.RatesFormatCSV
+	case "application/json":
+		return service.RatesFormatJSON
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/artnikel/marketplace/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockRatesService struct {
+	mock.Mock
+}
+
+func (m *MockRatesService) BaseCurrency() string {
+	return "USD"
+}
+
+func (m *MockRatesService) ListRates(ctx context.Context) ([]*models.ExchangeRate, error) {
+	args := m.Called(ctx)
+	rates, _ := args.Get(0).([]*models.ExchangeRate)
+	return rates, args.Error(1)
+}
+
+func (m *MockRatesService) ImportRates(ctx context.Context, format string, r io.Reader) ([]*models.ExchangeRate, error) {
+	data, _ := io.ReadAll(r)
+	args := m.Called(ctx, format, string(data))
+	rates, _ := args.Get(0).([]*models.ExchangeRate)
+	return rates, args.Error(1)
+}
+
+func TestRatesHandler_GetRates(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockRatesService)
+	handler := NewRatesHandler(mockSvc, logger)
+
+	mockSvc.On("ListRates", mock.Anything).Return([]*models.ExchangeRate{
+		{Currency: "EUR", Rate: money.MustParse("0.92")},
+	}, nil).Once()
+
+	w := httptest.NewRecorder()
+	handler.GetRates(w, httptest.NewRequest(http.MethodGet, "/exchange-rates", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"base":"USD"`)
+	assert.Contains(t, w.Body.String(), `"currency":"EUR","rate":"0.92"`)
+
+	mockSvc.On("ListRates", mock.Anything).Return(nil, errors.New("db error")).Once()
+	w = httptest.NewRecorder()
+	handler.GetRates(w, httptest.NewRequest(http.MethodGet, "/exchange-rates", http.NoBody))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestRatesHandler_ImportRates(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockSvc := new(MockRatesService)
+	handler := NewRatesHandler(mockSvc, logger)
+
+	imported := []*models.ExchangeRate{{Currency: "EUR", Rate: money.MustParse("0.92")}}
+
+	multipartBody := func(filename, content string) (*bytes.Buffer, string) {
+		buf := new(bytes.Buffer)
+		mw := multipart.NewWriter(buf)
+		part, err := mw.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		_, _ = part.Write([]byte(content))
+		require.NoError(t, mw.Close())
+		return buf, mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		name           string
+		body           func() (*bytes.Buffer, string)
+		setupMock      func()
+		wantStatusCode int
+		wantContains   string
+	}{
+		{
+			name: "csv body",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("EUR,0.92\n"), "text/csv; charset=utf-8"
+			},
+			setupMock: func() {
+				mockSvc.On("ImportRates", mock.Anything, service.RatesFormatCSV, "EUR,0.92\n").Return(imported, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"rate":"0.92"`,
+		},
+		{
+			name: "json file upload",
+			body: func() (*bytes.Buffer, string) {
+				return multipartBody("rates.JSON", `{"rates":{"EUR":0.92}}`)
+			},
+			setupMock: func() {
+				mockSvc.On("ImportRates", mock.Anything, service.RatesFormatJSON, `{"rates":{"EUR":0.92}}`).Return(imported, nil).Once()
+			},
+			wantStatusCode: http.StatusOK,
+			wantContains:   `"base":"USD"`,
+		},
+		{
+			name: "upload without file",
+			body: func() (*bytes.Buffer, string) {
+				buf := new(bytes.Buffer)
+				mw := multipart.NewWriter(buf)
+				_ = mw.Close()
+				return buf, mw.FormDataContentType()
+			},
+			setupMock:      func() {},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "file field is required",
+		},
+		{
+			name: "invalid rates",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("EUR,abc\n"), "text/csv"
+			},
+			setupMock: func() {
+				mockSvc.On("ImportRates", mock.Anything, service.RatesFormatCSV, mock.Anything).
+					Return(nil, fmt.Errorf("%w: bad rate on line 1", service.ErrInvalidRates)).Once()
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   "bad rate on line 1",
+		},
+		{
+			name: "storage error",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("EUR,0.92\n"), "text/csv"
+			},
+			setupMock: func() {
+				mockSvc.On("ImportRates", mock.Anything, service.RatesFormatCSV, mock.Anything).
+					Return(nil, errors.New("db error")).Once()
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantContains:   "failed to import exchange rates",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil
+			tt.setupMock()
+
+			body, contentType := tt.body()
+			req := httptest.NewRequest(http.MethodPost, "/admin/exchange-rates", body)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+
+			handler.ImportRates(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Package handlers contains HTTP handlers for session management
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// ListSessions handles GET /auth/sessions — lists the logins of the current user that were not ended,
+// the session of the request is marked as current
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.AuthService.ListSessions(r.Context(), middleware.GetUserID(r), middleware.GetSessionID(r))
+	if err != nil {
+		h.writeSessionError(w, err, "failed to list sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"sessions": sessions})
+}
+
+// RevokeSession handles DELETE /auth/sessions/{id} — ends a session of the current user, its refresh token
+// stops working and its access tokens are refused
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid session id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.RevokeSession(r.Context(), middleware.GetUserID(r), id); err != nil {
+		h.writeSessionError(w, err, "failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSessionError logs err and responds with its status, unknown sessions are reported as they are
+// and other errors are replaced by fallback
+func (h *AuthHandler) writeSessionError(w http.ResponseWriter, err error, fallback string) {
+	h.logger.Error.Println("error:", err)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusNotFound)
+		return
+	}
+	http.Error(w, `{"error":"`+fallback+`"}`, http.StatusInternalServerError)
+}
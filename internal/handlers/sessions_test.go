@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthHandler_ListAndRevokeSessions(t *testing.T) {
+	logger := &logging.Logger{
+		Error: log.New(io.Discard, "", 0),
+	}
+	mockAuth := new(MockAuthService)
+	handler := NewAuthHandler(mockAuth, logger)
+
+	mockAuth.On("ListSessions", mock.Anything, 1, 5).
+		Return([]*models.Session{{ID: 5, FamilyID: "family", UserAgent: "Firefox", IP: "192.0.2.1", Current: true}}, nil).Once()
+	req := setUserContext(httptest.NewRequest(http.MethodGet, "/auth/sessions", http.NoBody), 1, "seller")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.SessionIDKey, 5))
+	w := httptest.NewRecorder()
+	handler.ListSessions(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `"user_agent":"Firefox"`)
+	assert.Contains(t, w.Body.String(), `"current":true`)
+	assert.NotContains(t, w.Body.String(), "family")
+
+	mockAuth.On("RevokeSession", mock.Anything, 1, 5).Return(nil).Once()
+	req = httptest.NewRequest(http.MethodDelete, "/auth/sessions/5", http.NoBody)
+	req = mux.SetURLVars(setUserContext(req, 1, "seller"), map[string]string{"id": "5"})
+	w = httptest.NewRecorder()
+	handler.RevokeSession(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	mockAuth.On("RevokeSession", mock.Anything, 1, 5).Return(service.ErrSessionNotFound).Once()
+	w = httptest.NewRecorder()
+	handler.RevokeSession(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	mockAuth.On("RevokeSession", mock.Anything, 1, 5).Return(errors.New("database error")).Once()
+	w = httptest.NewRecorder()
+	handler.RevokeSession(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	assert.JSONEq(t, `{"error":"failed to revoke session"}`, w.Body.String())
+
+	req = mux.SetURLVars(req, map[string]string{"id": "x"})
+	w = httptest.NewRecorder()
+	handler.RevokeSession(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	mockAuth.AssertExpectations(t)
+}
@@ -0,0 +1,49 @@
+// Package mail provides mailers that deliver messages to users
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/constants"
+)
+
+// WriterMailer writes messages to a writer instead of sending them, for local development
+type WriterMailer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewWriterMailer creates a mailer writing messages to w
+func NewWriterMailer(w io.Writer) *WriterMailer {
+	return &WriterMailer{w: w, now: time.Now}
+}
+
+// NewFileMailer creates a mailer appending messages to the file at path, creating it when needed
+func NewFileMailer(path string) (*WriterMailer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), constants.DirPerm); err != nil {
+		return nil, err
+	}
+
+	// #nosec G304 -- mail path is trusted and not user-controlled
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, constants.FilePerm)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterMailer(f), nil
+}
+
+// Send writes a message with its recipient and subject
+func (m *WriterMailer) Send(_ context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", m.now().UTC().Format(time.RFC1123Z), to, subject, body)
+	return err
+}
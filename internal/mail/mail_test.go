@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterMailer_Send(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewWriterMailer(&buf)
+	mailer.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	require.NoError(t, mailer.Send(context.Background(), "testuser", "Reset your password", "token: abc"))
+
+	assert.Equal(t, "Date: Wed, 01 May 2024 12:00:00 +0000\nTo: testuser\nSubject: Reset your password\n\ntoken: abc\n\n", buf.String())
+}
+
+func TestNewFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail", "outbox.txt")
+
+	mailer, err := NewFileMailer(path)
+	require.NoError(t, err)
+	require.NoError(t, mailer.Send(context.Background(), "first", "Subject", "one"))
+	require.NoError(t, mailer.Send(context.Background(), "second", "Subject", "two"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: first")
+	assert.Contains(t, string(data), "To: second")
+}
@@ -3,12 +3,16 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/artnikel/marketplace/internal/models"
 	"github.com/artnikel/marketplace/internal/service"
+	mjwt "github.com/artnikel/marketplace/pkg/jwt"
 )
 
 // contextKey is a custom type used for storing values in context
@@ -18,6 +22,9 @@ type contextKey string
 const (
 	UserIDKey    contextKey = "userID"
 	UserLoginKey contextKey = "userLogin"
+	UserRoleKey  contextKey = "userRole"
+	ClientIPKey  contextKey = "clientIP"
+	SessionIDKey contextKey = "sessionID"
 )
 
 // CORSMiddleware adds CORS headers to the response
@@ -31,7 +38,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, Origin, User-Agent, Cache-Control, X-Requested-With")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "86400")
@@ -53,39 +60,166 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// AuthMiddleware validates JWT token and injects user info into the request context
-func AuthMiddleware(authService service.AuthServiceInterface) func(http.Handler) http.Handler {
+// ClientIPMiddleware stores the client address in the request context. With trustProxy the address is
+// the last X-Forwarded-For entry, added by the proxy in front of the server, otherwise the connection address
+func ClientIPMiddleware(trustProxy bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			ip := remoteIP(r)
+			if trustProxy {
+				if entries := strings.Split(r.Header.Get("X-Forwarded-For"), ","); len(entries) > 0 {
+					if last := strings.TrimSpace(entries[len(entries)-1]); net.ParseIP(last) != nil {
+						ip = last
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip)))
+		})
+	}
+}
+
+// remoteIP returns the host part of the connection address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AuthMiddleware validates the credentials of a request and injects user info into the request context.
+// Requests carry an access token as "Bearer <token>" or an API key as "ApiKey <key>". API keys are accepted
+// only when they have one of scopes, so routes without scopes are for logged-in users only
+func AuthMiddleware(authService service.AuthServiceInterface, scopes ...models.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
 				http.Error(w, `{"error":"authorization token required"}`, http.StatusUnauthorized)
 				return
 			}
 
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-			if token == authHeader {
-				http.Error(w, `{"error":"invalid authorization header format"}`, http.StatusUnauthorized)
+			ctx, status, message := authenticate(r, authService, scopes)
+			if status != 0 {
+				http.Error(w, `{"error":"`+message+`"}`, status)
 				return
 			}
 
-			claims, err := authService.ParseToken(token)
-			if err != nil {
-				http.Error(w, `{"error":"invalid or expired token"}`, http.StatusUnauthorized)
-				return
+			r = r.WithContext(ctx)
+			r.Header.Set("User-ID", strconv.Itoa(GetUserID(r)))
+			r.Header.Set("User-Login", GetUserLogin(r))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate checks the Authorization header of r and returns the request context with the user info.
+// Access tokens of ended sessions are refused, tokens issued before sessions were recorded carry none and are
+// refused once they can no longer be valid.
+// When the credentials are refused it returns the status and message of the error response instead
+func authenticate(r *http.Request, authService service.AuthServiceInterface, scopes []models.APIKeyScope) (context.Context, int, string) {
+	authHeader := r.Header.Get("Authorization")
+
+	if token, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
+		claims, err := authService.ParseToken(token)
+		if err != nil {
+			return nil, http.StatusUnauthorized, tokenErrorMessage(err)
+		}
+		active, err := authService.SessionActive(r.Context(), claims.SessionID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "failed to check session"
+		}
+		if !active {
+			return nil, http.StatusUnauthorized, "session has ended"
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, UserLoginKey, claims.Login)
+		ctx = context.WithValue(ctx, UserRoleKey, models.Role(claims.Role))
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		return ctx, 0, ""
+	}
+
+	if secret, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+		user, key, err := authService.AuthenticateAPIKey(r.Context(), secret)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAPIKey) {
+				return nil, http.StatusUnauthorized, err.Error()
 			}
+			return nil, http.StatusInternalServerError, "failed to check api key"
+		}
+		if !keyAllowed(key, scopes) {
+			return nil, http.StatusForbidden, "api key is not allowed for this request"
+		}
+
+		// API keys never carry a role, so role-checked routes stay out of reach of scripts
+		ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+		ctx = context.WithValue(ctx, UserLoginKey, user.Login)
+		return ctx, 0, ""
+	}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, UserLoginKey, claims.Login)
+	return nil, http.StatusUnauthorized, "invalid authorization header format"
+}
 
-			r.Header.Set("User-ID", strconv.Itoa(claims.UserID))
-			r.Header.Set("User-Login", claims.Login)
+// keyAllowed reports whether key has one of scopes
+func keyAllowed(key *models.APIKey, scopes []models.APIKeyScope) bool {
+	for _, scope := range scopes {
+		if key.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenErrorMessage describes why a token was rejected without revealing the expected issuer or audience
+func tokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, mjwt.ErrTokenExpired):
+		return "token has expired"
+	case errors.Is(err, mjwt.ErrTokenNotYetValid):
+		return "token is not valid yet"
+	case errors.Is(err, mjwt.ErrInvalidIssuer), errors.Is(err, mjwt.ErrInvalidAudience):
+		return "token was not issued for this service"
+	default:
+		return "invalid token"
+	}
+}
+
+// OptionalAuthMiddleware injects user info into the request context when valid credentials are present, API keys
+// are accepted like in AuthMiddleware. Requests without credentials or with refused ones are passed through anonymously
+func OptionalAuthMiddleware(authService service.AuthServiceInterface, scopes ...models.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, status, _ := authenticate(r, authService, scopes)
+			if status != 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequireRole allows only users whose role includes role, it must run after AuthMiddleware
+func RequireRole(role models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !GetUserRole(r).Includes(role) {
+				http.Error(w, `{"error":"`+string(role)+` role required"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserID extracts the user ID from the request context
 func GetUserID(r *http.Request) int {
 	if id, ok := r.Context().Value(UserIDKey).(int); ok {
@@ -101,3 +235,27 @@ func GetUserLogin(r *http.Request) string {
 	}
 	return ""
 }
+
+// GetSessionID extracts the session ID of the access token from the request context, it is zero for API keys
+func GetSessionID(r *http.Request) int {
+	if id, ok := r.Context().Value(SessionIDKey).(int); ok {
+		return id
+	}
+	return 0
+}
+
+// GetClientIP extracts the client address from the request context, falling back to the connection address
+func GetClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// GetUserRole extracts the user role from the request context
+func GetUserRole(r *http.Request) models.Role {
+	if role, ok := r.Context().Value(UserRoleKey).(models.Role); ok {
+		return role
+	}
+	return ""
+}
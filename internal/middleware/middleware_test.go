@@ -3,10 +3,13 @@ package middleware
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/internal/service"
 	"github.com/artnikel/marketplace/pkg/jwt"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,12 +17,47 @@ import (
 type mockAuthService struct{}
 
 func (m *mockAuthService) ParseToken(token string) (*jwt.Claims, error) {
-	if token == "valid-token" {
-		return &jwt.Claims{UserID: 42, Login: "user42"}, nil
+	switch token {
+	case "valid-token":
+		return &jwt.Claims{UserID: 42, Login: "user42", Role: "moderator"}, nil
+	case "expired-token":
+		return nil, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, jwt.ErrTokenExpired)
+	case "future-token":
+		return nil, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, jwt.ErrTokenNotYetValid)
+	case "staging-token":
+		return nil, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, jwt.ErrInvalidAudience)
+	case "session-token":
+		return &jwt.Claims{UserID: 42, Login: "user42", SessionID: 3}, nil
+	case "ended-token":
+		return &jwt.Claims{UserID: 42, Login: "user42", SessionID: 4}, nil
+	case "unchecked-token":
+		return &jwt.Claims{UserID: 42, Login: "user42", SessionID: 5}, nil
 	}
 	return nil, errors.New("invalid token")
 }
 
+func (m *mockAuthService) SessionActive(_ context.Context, id int) (bool, error) {
+	switch id {
+	case 0, 3:
+		return true, nil
+	case 4:
+		return false, nil
+	}
+	return false, errors.New("database error")
+}
+
+func (m *mockAuthService) AuthenticateAPIKey(_ context.Context, key string) (*models.User, *models.APIKey, error) {
+	switch key {
+	case "mk_write":
+		return &models.User{ID: 7, Login: "script", Role: models.RoleAdmin}, &models.APIKey{ID: 1, UserID: 7, Scopes: []models.APIKeyScope{models.ScopeItemsWrite}}, nil
+	case "mk_read":
+		return &models.User{ID: 7, Login: "script", Role: models.RoleAdmin}, &models.APIKey{ID: 2, UserID: 7, Scopes: []models.APIKeyScope{models.ScopeItemsRead}}, nil
+	case "mk_down":
+		return nil, nil, errors.New("database error")
+	}
+	return nil, nil, service.ErrInvalidAPIKey
+}
+
 func TestCORSMiddleware(t *testing.T) {
 	nextCalled := false
 	nextHandler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
@@ -61,6 +99,37 @@ func TestCORSMiddleware(t *testing.T) {
 	})
 }
 
+func TestClientIPMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		trustProxy   bool
+		forwardedFor string
+		wantIP       string
+	}{
+		{name: "connection address", wantIP: "192.0.2.1"},
+		{name: "forwarded header ignored without a trusted proxy", forwardedFor: "203.0.113.9", wantIP: "192.0.2.1"},
+		{name: "last forwarded entry behind a proxy", trustProxy: true, forwardedFor: "10.0.0.1, 203.0.113.9", wantIP: "203.0.113.9"},
+		{name: "invalid forwarded entry", trustProxy: true, forwardedFor: "unknown", wantIP: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIPMiddleware(tt.trustProxy)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = GetClientIP(r)
+			}))
+
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantIP, got)
+		})
+	}
+}
+
 func TestLoggingMiddleware(t *testing.T) {
 	nextCalled := false
 	nextHandler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
@@ -81,12 +150,14 @@ func TestAuthMiddleware(t *testing.T) {
 	nextCalled := false
 	var userIDInCtx int
 	var userLoginInCtx string
+	var userRoleInCtx models.Role
 	var userIDHeader, userLoginHeader string
 
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		nextCalled = true
 		userIDInCtx = GetUserID(r)
 		userLoginInCtx = GetUserLogin(r)
+		userRoleInCtx = GetUserRole(r)
 		userIDHeader = r.Header.Get("User-ID")
 		userLoginHeader = r.Header.Get("User-Login")
 		w.WriteHeader(http.StatusOK)
@@ -125,6 +196,194 @@ func TestAuthMiddleware(t *testing.T) {
 	assert.Equal(t, "user42", userLoginHeader)
 	assert.Equal(t, 42, userIDInCtx)
 	assert.Equal(t, "user42", userLoginInCtx)
+	assert.Equal(t, models.RoleModerator, userRoleInCtx)
+}
+
+func TestAuthMiddleware_TokenErrors(t *testing.T) {
+	handler := AuthMiddleware(&mockAuthService{})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		token    string
+		wantBody string
+	}{
+		{token: "expired-token", wantBody: `{"error":"token has expired"}`},
+		{token: "future-token", wantBody: `{"error":"token is not valid yet"}`},
+		{token: "staging-token", wantBody: `{"error":"token was not issued for this service"}`},
+		{token: "badtoken", wantBody: `{"error":"invalid token"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestAuthMiddleware_Sessions(t *testing.T) {
+	var sessionIDInCtx int
+	handler := AuthMiddleware(&mockAuthService{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionIDInCtx = GetSessionID(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		token      string
+		wantStatus int
+		wantBody   string
+		wantID     int
+	}{
+		{token: "session-token", wantStatus: http.StatusOK, wantID: 3},
+		{token: "valid-token", wantStatus: http.StatusOK, wantID: 0},
+		{token: "ended-token", wantStatus: http.StatusUnauthorized, wantBody: `{"error":"session has ended"}`},
+		{token: "unchecked-token", wantStatus: http.StatusInternalServerError, wantBody: `{"error":"failed to check session"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			sessionIDInCtx = -1
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+				return
+			}
+			assert.Equal(t, tt.wantID, sessionIDInCtx)
+		})
+	}
+}
+
+func TestAuthMiddleware_APIKeys(t *testing.T) {
+	var userIDInCtx int
+	var userLoginInCtx string
+	var userRoleInCtx models.Role
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userIDInCtx = GetUserID(r)
+		userLoginInCtx = GetUserLogin(r)
+		userRoleInCtx = GetUserRole(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		scopes     []models.APIKeyScope
+		authHeader string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "write key on a write route", scopes: []models.APIKeyScope{models.ScopeItemsWrite}, authHeader: "ApiKey mk_write", wantStatus: http.StatusOK},
+		{name: "write key on a read route", scopes: []models.APIKeyScope{models.ScopeItemsRead}, authHeader: "ApiKey mk_write", wantStatus: http.StatusOK},
+		{name: "read key on a write route", scopes: []models.APIKeyScope{models.ScopeItemsWrite}, authHeader: "ApiKey mk_read", wantStatus: http.StatusForbidden, wantBody: "api key is not allowed for this request"},
+		{name: "key on a session-only route", authHeader: "ApiKey mk_write", wantStatus: http.StatusForbidden},
+		{name: "unknown key", scopes: []models.APIKeyScope{models.ScopeItemsRead}, authHeader: "ApiKey mk_unknown", wantStatus: http.StatusUnauthorized, wantBody: "invalid or expired api key"},
+		{name: "key check fails", scopes: []models.APIKeyScope{models.ScopeItemsRead}, authHeader: "ApiKey mk_down", wantStatus: http.StatusInternalServerError, wantBody: "failed to check api key"},
+		{name: "bearer token on a route with scopes", scopes: []models.APIKeyScope{models.ScopeItemsWrite}, authHeader: "Bearer valid-token", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthMiddleware(&mockAuthService{}, tt.scopes...)(nextHandler)
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Authorization", tt.authHeader)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+
+	// API keys identify their user like access tokens do, but never carry the role of the user
+	handler := AuthMiddleware(&mockAuthService{}, models.ScopeItemsWrite)(nextHandler)
+	req := httptest.NewRequest("GET", "/", http.NoBody)
+	req.Header.Set("Authorization", "ApiKey mk_write")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 7, userIDInCtx)
+	assert.Equal(t, "script", userLoginInCtx)
+	assert.Equal(t, models.Role(""), userRoleInCtx)
+}
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	var userIDInCtx int
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userIDInCtx = GetUserID(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := OptionalAuthMiddleware(&mockAuthService{}, models.ScopeItemsRead)(nextHandler)
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantUserID int
+	}{
+		{name: "no token", authHeader: "", wantUserID: 0},
+		{name: "invalid header format", authHeader: "valid-token", wantUserID: 0},
+		{name: "invalid token", authHeader: "Bearer badtoken", wantUserID: 0},
+		{name: "valid token", authHeader: "Bearer valid-token", wantUserID: 42},
+		{name: "api key with the scope", authHeader: "ApiKey mk_read", wantUserID: 7},
+		{name: "unknown api key", authHeader: "ApiKey mk_unknown", wantUserID: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userIDInCtx = -1
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+			assert.Equal(t, tt.wantUserID, userIDInCtx)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		required models.Role
+		role     models.Role
+		want     int
+	}{
+		{name: "admin on admin route", required: models.RoleAdmin, role: models.RoleAdmin, want: http.StatusOK},
+		{name: "admin on moderator route", required: models.RoleModerator, role: models.RoleAdmin, want: http.StatusOK},
+		{name: "moderator on moderator route", required: models.RoleModerator, role: models.RoleModerator, want: http.StatusOK},
+		{name: "moderator on admin route", required: models.RoleAdmin, role: models.RoleModerator, want: http.StatusForbidden},
+		{name: "user on moderator route", required: models.RoleModerator, role: models.RoleUser, want: http.StatusForbidden},
+		{name: "token without role", required: models.RoleModerator, role: "", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireRole(tt.required)(nextHandler)
+
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			if tt.role != "" {
+				req = req.WithContext(context.WithValue(req.Context(), UserRoleKey, tt.role))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
 }
 
 func TestGetUserIDAndLogin(t *testing.T) {
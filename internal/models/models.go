@@ -1,31 +1,400 @@
 // Package models provides the data models used in the application
 package models
 
-import "time"
+import (
+	"time"
 
-// User entity
+	"github.com/artnikel/marketplace/pkg/money"
+)
+
+// User entity, a disabled user cannot log in
 type User struct {
-	ID    int    `json:"id"`
-	Login string `json:"login"`
-	Hash  string `json:"-"`
+	ID         int        `json:"id"`
+	Login      string     `json:"login"`
+	Hash       string     `json:"-"`
+	Role       Role       `json:"role,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Role is a user role, every role has the permissions of the roles listed before it
+type Role string
+
+// User roles: moderators may remove any item, admins also manage users, categories and exchange rates
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Valid reports whether the role is one of the known roles
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Includes reports whether the role has the permissions of other
+func (r Role) Includes(other Role) bool {
+	return other.Valid() && r.rank() >= other.rank()
+}
+
+// rank orders roles by privilege, higher roles include lower ones and unknown roles rank 0
+func (r Role) rank() int {
+	switch r {
+	case RoleUser:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// UserPage is a page of users with pagination metadata
+type UserPage struct {
+	Users      []*User `json:"users"`
+	Page       int     `json:"page"`
+	Limit      int     `json:"limit"`
+	Total      int     `json:"total"`
+	TotalPages int     `json:"total_pages"`
+}
+
+// RefreshToken is an issued refresh token, only the hash of the opaque token is stored.
+// Every token is used once, rotating it issues a new token of the same family
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// PasswordResetToken is a stored single-use password reset token, only the hash of the token is kept
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+// TOTPCredential is the TOTP secret of a user, EnabledAt is nil until the user confirmed a first code
+// and LastCounter is the time step of the last accepted code
+type TOTPCredential struct {
+	UserID      int
+	Secret      string
+	EnabledAt   *time.Time
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+// TOTPSetup is a TOTP secret waiting for confirmation with the otpauth URI that adds it to an authenticator app
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// APIKeyScope is a permission granted to an API key
+type APIKeyScope string
+
+// API key scopes, ScopeItemsWrite includes ScopeItemsRead
+const (
+	ScopeItemsRead  APIKeyScope = "items:read"
+	ScopeItemsWrite APIKeyScope = "items:write"
+)
+
+// Valid reports whether the scope is known
+func (s APIKeyScope) Valid() bool {
+	return s == ScopeItemsRead || s == ScopeItemsWrite
+}
+
+// Includes reports whether the scope grants the permissions of other
+func (s APIKeyScope) Includes(other APIKeyScope) bool {
+	return s == other || (s == ScopeItemsWrite && other == ScopeItemsRead)
+}
+
+// APIKey is a personal API key of a user, only the hash of the key is kept and Prefix identifies it in listings
+type APIKey struct {
+	ID         int           `json:"id"`
+	UserID     int           `json:"-"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	KeyHash    string        `json:"-"`
+	Scopes     []APIKeyScope `json:"scopes"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time    `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	RevokedAt  *time.Time    `json:"-"`
+}
+
+// HasScope reports whether one of the scopes of the key includes scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s.Includes(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Session is a login of a user on a device, the refresh tokens rotated from the login share its FamilyID.
+// Ending a session revokes those tokens and the access tokens issued for it. Current marks the session of the caller in listings
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	FamilyID   string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
+
+// ClientInfo describes the client a login comes from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// UserIdentity links a user to the subject of an external OpenID provider, Provider is the configured provider name
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is a pending sign-in at an OpenID provider, only the hash of the state sent to the provider is kept.
+// UserID is set when a signed in user links a new identity instead of logging in
+type OIDCState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       *int
+	ExpiresAt    time.Time
+}
+
+// AuditEvent is the kind of a security event recorded in the audit log
+type AuditEvent string
+
+// Audit log events
+const (
+	AuditAccountLocked AuditEvent = "account_locked"
+	AuditIPLocked      AuditEvent = "ip_locked"
+)
+
+// AuditEntry is a security event, UserID is nil when the event is not tied to an existing user
+type AuditEntry struct {
+	ID        int
+	Event     AuditEvent
+	UserID    *int
+	Login     string
+	IP        string
+	Details   string
+	CreatedAt time.Time
+}
+
+// AuthTokens is a short-lived access token with the refresh token that renews it, ExpiresIn is in seconds
+type AuthTokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// ItemStatus is a lifecycle state of an item
+type ItemStatus string
+
+// Item lifecycle states
+const (
+	ItemStatusDraft    ItemStatus = "draft"
+	ItemStatusActive   ItemStatus = "active"
+	ItemStatusReserved ItemStatus = "reserved"
+	ItemStatusSold     ItemStatus = "sold"
+	ItemStatusArchived ItemStatus = "archived"
+)
+
+// Valid reports whether the status is one of the known lifecycle states
+func (s ItemStatus) Valid() bool {
+	switch s {
+	case ItemStatusDraft, ItemStatusActive, ItemStatusReserved, ItemStatusSold, ItemStatusArchived:
+		return true
+	default:
+		return false
+	}
+}
+
+// ItemSort is a sort order of item listings
+type ItemSort string
+
+// Item sort orders, relevance is only available for search queries
+const (
+	ItemSortNewest    ItemSort = "newest"
+	ItemSortOldest    ItemSort = "oldest"
+	ItemSortPriceAsc  ItemSort = "price_asc"
+	ItemSortPriceDesc ItemSort = "price_desc"
+	ItemSortTitle     ItemSort = "title"
+	ItemSortRelevance ItemSort = "relevance"
+)
+
+// Valid reports whether the sort order is one of the known ones
+func (s ItemSort) Valid() bool {
+	switch s {
+	case ItemSortNewest, ItemSortOldest, ItemSortPriceAsc, ItemSortPriceDesc, ItemSortTitle, ItemSortRelevance:
+		return true
+	default:
+		return false
+	}
 }
 
 // Item entity
 type Item struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	ImageURL    string    `json:"image_url"`
-	Price       float64   `json:"price"`
-	AuthorID    int       `json:"author_id"`
-	AuthorLogin string    `json:"author_login"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int             `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	ImageURL    string          `json:"image_url"`
+	Price       money.Amount    `json:"price"`
+	Currency    string          `json:"currency"`
+	AuthorID    int             `json:"author_id"`
+	AuthorLogin string          `json:"author_login"`
+	CategoryID  int             `json:"category_id"`
+	Status      ItemStatus      `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PublishedAt *time.Time      `json:"published_at,omitempty"`
+	ReservedAt  *time.Time      `json:"reserved_at,omitempty"`
+	SoldAt      *time.Time      `json:"sold_at,omitempty"`
+	ArchivedAt  *time.Time      `json:"archived_at,omitempty"`
+	Highlights  *ItemHighlights `json:"highlights,omitempty"`
+
+	// ThumbnailURL is the thumbnail of the primary image, empty when the item has no uploaded images
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+
+	// DisplayPrice is Price converted to DisplayCurrency when a listing asks for it
+	DisplayPrice    *money.Amount `json:"display_price,omitempty"`
+	DisplayCurrency string        `json:"display_currency,omitempty"`
+
+	// BasePrice is Price in the base currency as exact decimal text, set by listings sorted by price for their cursor
+	BasePrice string `json:"-"`
+}
+
+// ItemHighlights holds search snippets with matches wrapped in <mark></mark>,
+// the surrounding text is not HTML-escaped
+type ItemHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
-// ItemFilters for filtering items by fields
+// ItemDetails is an item together with its author profile and images
+type ItemDetails struct {
+	Item   *Item
+	Author *User
+	Images []*ItemImage
+}
+
+// ItemImage is an uploaded photo of an item with its resized variants,
+// Position orders the images of an item starting from 0 and the primary image represents the item in listings
+type ItemImage struct {
+	ID           int       `json:"id"`
+	ItemID       int       `json:"item_id"`
+	Position     int       `json:"position"`
+	IsPrimary    bool      `json:"is_primary"`
+	URL          string    `json:"url"`
+	MediumURL    string    `json:"medium_url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ItemUpdate holds item fields for partial update, nil fields are left unchanged
+type ItemUpdate struct {
+	Title       *string       `json:"title"`
+	Description *string       `json:"description"`
+	ImageURL    *string       `json:"image_url"`
+	Price       *money.Amount `json:"price"`
+	Currency    *string       `json:"currency"`
+	CategoryID  *int          `json:"category_id"`
+}
+
+// ItemFilters for filtering items by fields,
+// Status defaults to active and other statuses are only listed for the author set in AuthorID,
+// Title and Description are kept for older clients and are searched as part of Query,
+// Sort must be validated before reaching the repository and After continues the feed from a cursor instead of an offset.
+// MinPrice and MaxPrice are in Currency, the service converts them to the base currency item prices are compared in
+// and sets Currency to it, items in currencies without an exchange rate are left out of price filters and sorts,
+// DisplayCurrency converts the prices of listed items
 type ItemFilters struct {
-	MinPrice    float64 `json:"min_price"`
-	MaxPrice    float64 `json:"max_price"`
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
+	MinPrice        money.Amount `json:"min_price"`
+	MaxPrice        money.Amount `json:"max_price"`
+	Currency        string       `json:"currency"`
+	DisplayCurrency string       `json:"display_currency"`
+	Query           string       `json:"q"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	Status          ItemStatus   `json:"status"`
+	AuthorID        int          `json:"author_id"`
+	CategoryID      int          `json:"category"`
+	Sort            ItemSort     `json:"sort"`
+	After           *ItemCursor  `json:"-"`
+}
+
+// ItemCursor is a keyset pagination position in the items feed for a sort order,
+// listing continues with items ordered after it. BasePrice is the base currency price of the item
+// when its page was listed, so exchange rate changes between pages do not move the position
+type ItemCursor struct {
+	Sort      ItemSort  `json:"s"`
+	CreatedAt time.Time `json:"c"`
+	BasePrice string    `json:"b,omitempty"`
+	Title     string    `json:"t,omitempty"`
+	ID        int       `json:"i"`
+}
+
+// PageRequest describes which page of a listing to return,
+// Cursor takes precedence over Page and counting the total can be skipped for cheaper listing
+type PageRequest struct {
+	Page      int
+	Limit     int
+	Cursor    string
+	SkipTotal bool
+}
+
+// ItemPage is a page of items with pagination metadata,
+// Page is zero when the page was requested by cursor and Total is nil when counting was skipped
+type ItemPage struct {
+	Items      []*Item
+	Page       int
+	Limit      int
+	Total      *int
+	TotalPages *int
+	HasNext    bool
+	NextCursor string
+}
+
+// Category entity, categories form a tree through ParentID
+type Category struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name"`
+	ParentID *int        `json:"parent_id"`
+	Children []*Category `json:"children,omitempty"`
+}
+
+// RemoteImage is an image fetched from an external URL, ContentType is detected from Data
+type RemoteImage struct {
+	ContentType string
+	Data        []byte
+	FetchedAt   time.Time
+}
+
+// ExchangeRate is how many units of Currency one unit of the base currency buys
+type ExchangeRate struct {
+	Currency  string       `json:"currency"`
+	Rate      money.Amount `json:"rate"`
+	UpdatedAt time.Time    `json:"updated_at"`
 }
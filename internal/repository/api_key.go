@@ -0,0 +1,162 @@
+// Package repository provides access to the api_keys table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// APIKeyRepo handles database operations related to API keys
+type APIKeyRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewAPIKeyRepo creates a new instance of APIKeyRepo
+func NewAPIKeyRepo(db *pgxpool.Pool) *APIKeyRepo {
+	return &APIKeyRepo{DB: db}
+}
+
+// countActiveAPIKeysQuery counts the keys of user $1 that are neither revoked nor expired at $2
+const countActiveAPIKeysQuery = `
+	SELECT count(*)
+	FROM api_keys
+	WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)
+`
+
+// Create inserts a new API key and sets its ID and CreatedAt, it reports false without inserting when the user
+// already has maxActive keys that are neither revoked nor expired at now. Creates of one user are serialized
+// by locking the user, so concurrent requests cannot exceed maxActive
+func (r *APIKeyRepo) Create(ctx context.Context, key *models.APIKey, maxActive int, now time.Time) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", key.UserID); err != nil {
+		return false, err
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, countActiveAPIKeysQuery, key.UserID, now.UTC()).Scan(&count); err != nil {
+		return false, err
+	}
+	if count >= maxActive {
+		return false, nil
+	}
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	var expiresAt any
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+	err = tx.QueryRow(ctx, query, key.UserID, key.Name, key.Prefix, key.KeyHash, scopeStrings(key.Scopes), expiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// GetByHash retrieves an API key by the hash of its value, revoked keys included
+func (r *APIKeyRepo) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+
+	key, err := scanAPIKey(r.DB.QueryRow(ctx, query, hash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListByUser retrieves the keys of a user that were not revoked, newest first
+func (r *APIKeyRepo) ListByUser(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke revokes a key of a user, it reports false when the user has no such key that is not revoked yet
+func (r *APIKeyRepo) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Touch records that a key was used
+func (r *APIKeyRepo) Touch(ctx context.Context, id int) error {
+	_, err := r.DB.Exec(ctx, `UPDATE api_keys SET last_used_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// scanAPIKey scans a row of the api_keys columns in table order
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes []string
+	err := row.Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes,
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = make([]models.APIKeyScope, len(scopes))
+	for i, s := range scopes {
+		key.Scopes[i] = models.APIKeyScope(s)
+	}
+	return &key, nil
+}
+
+// scopeStrings converts scopes to the text array stored in the database
+func scopeStrings(scopes []models.APIKeyScope) []string {
+	out := make([]string, len(scopes))
+	for i, s := range scopes {
+		out[i] = string(s)
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+// Package repository provides access to the audit_log table in the database
+package repository
+
+import (
+	"context"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AuditRepo handles database operations related to the audit log
+type AuditRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewAuditRepo creates a new instance of AuditRepo
+func NewAuditRepo(db *pgxpool.Pool) *AuditRepo {
+	return &AuditRepo{DB: db}
+}
+
+// Record inserts an audit entry and sets its ID and CreatedAt
+func (r *AuditRepo) Record(ctx context.Context, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (event, user_id, login, ip, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	return r.DB.QueryRow(ctx, query, entry.Event, entry.UserID, entry.Login, entry.IP, entry.Details).
+		Scan(&entry.ID, &entry.CreatedAt)
+}
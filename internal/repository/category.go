@@ -0,0 +1,106 @@
+// Package repository provides access to the categories table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CategoryRepo handles database operations related to categories
+type CategoryRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewCategoryRepo creates a new instance of CategoryRepo
+func NewCategoryRepo(db *pgxpool.Pool) *CategoryRepo {
+	return &CategoryRepo{DB: db}
+}
+
+// Create inserts a new category into the database
+func (r *CategoryRepo) Create(ctx context.Context, c *models.Category) error {
+	q := `
+		INSERT INTO categories (name, parent_id)
+		VALUES ($1, $2)
+		RETURNING id
+	`
+	return r.DB.QueryRow(ctx, q, c.Name, c.ParentID).Scan(&c.ID)
+}
+
+// GetByID retrieves a category by its ID
+func (r *CategoryRepo) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	q := `
+		SELECT id, name, parent_id
+		FROM categories
+		WHERE id = $1
+	`
+
+	var c models.Category
+	err := r.DB.QueryRow(ctx, q, id).Scan(&c.ID, &c.Name, &c.ParentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// List retrieves all categories as a flat list ordered by name
+func (r *CategoryRepo) List(ctx context.Context) ([]*models.Category, error) {
+	q := `
+		SELECT id, name, parent_id
+		FROM categories
+		ORDER BY name, id
+	`
+
+	rows, err := r.DB.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		c := &models.Category{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.ParentID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// Update changes the name and parent of a category
+func (r *CategoryRepo) Update(ctx context.Context, c *models.Category) error {
+	q := `
+		UPDATE categories
+		SET name = $2, parent_id = $3
+		WHERE id = $1
+	`
+	_, err := r.DB.Exec(ctx, q, c.ID, c.Name, c.ParentID)
+	return err
+}
+
+// Delete removes a category by its ID
+func (r *CategoryRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.DB.Exec(ctx, "DELETE FROM categories WHERE id = $1", id)
+	return err
+}
+
+// InUse reports whether a category has child categories or items
+func (r *CategoryRepo) InUse(ctx context.Context, id int) (bool, error) {
+	q := `
+		SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)
+			OR EXISTS (SELECT 1 FROM items WHERE category_id = $1)
+	`
+
+	var inUse bool
+	err := r.DB.QueryRow(ctx, q, id).Scan(&inUse)
+	return inUse, err
+}
@@ -3,14 +3,25 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// searchConfig is the text search configuration used for the items search_vector column
+const searchConfig = "english"
+
+// itemColumns is the list of columns selected for an item
+const itemColumns = `id, title, description, image_url, price::text, currency, author_id, author_login, COALESCE(category_id, 0), status,
+	created_at, published_at, reserved_at, sold_at, archived_at,
+	COALESCE((SELECT thumbnail_url FROM item_images WHERE item_images.item_id = items.id AND is_primary), '')`
+
 // ItemRepo handles database operations related to items
 type ItemRepo struct {
 	DB *pgxpool.Pool
@@ -23,77 +34,379 @@ func NewItemRepo(db *pgxpool.Pool) *ItemRepo {
 
 // Create inserts a new item into the database
 func (r *ItemRepo) Create(ctx context.Context, item *models.Item) error {
+	if item.Status == "" {
+		item.Status = models.ItemStatusActive
+	}
+	if item.Currency == "" {
+		item.Currency = money.DefaultCurrency
+	}
+	now := time.Now()
+	if item.Status == models.ItemStatusActive {
+		item.PublishedAt = &now
+	}
+
 	q := `
-    INSERT INTO items (title, description, image_url, price, author_id, author_login, created_at)
-    VALUES ($1,$2,$3,$4,$5,$6,$7)
+    INSERT INTO items (title, description, image_url, price, currency, author_id, author_login, category_id, status, created_at, published_at)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
     RETURNING id, created_at
   `
 	return r.DB.QueryRow(ctx, q,
-		item.Title, item.Description, item.ImageURL, item.Price,
-		item.AuthorID, item.AuthorLogin, time.Now(),
+		item.Title, item.Description, item.ImageURL, item.Price, item.Currency,
+		item.AuthorID, item.AuthorLogin, nullableID(item.CategoryID), item.Status, now, item.PublishedAt,
 	).Scan(&item.ID, &item.CreatedAt)
 }
 
-// List retrieves a list of items from the database with filters and pagination
+// List retrieves a list of items from the database with filters and pagination,
+// items matching a search query are ordered by relevance and carry highlighted snippets
 func (r *ItemRepo) List(ctx context.Context, offset, limit int, filters *models.ItemFilters) ([]*models.Item, error) {
-	args := []interface{}{limit, offset}
-	argIndex := 3
+	where := buildItemWhere(filters, []interface{}{limit, offset})
+
+	orderBy, err := itemOrderBy(filters.Sort, where)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.After != nil {
+		if err := addItemKeyset(where, filters.Sort, filters.After); err != nil {
+			return nil, err
+		}
+	}
+
+	highlights := "'', ''"
+	if where.tsQuery != "" {
+		highlights = "ts_headline('" + searchConfig + "', title, " + where.tsQuery + ", 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'), " +
+			"ts_headline('" + searchConfig + "', description, " + where.tsQuery + ", 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')"
+	}
+	// the exact base price goes into the cursor of price sorts
+	basePrice := "''"
+	if filters.Sort == models.ItemSortPriceAsc || filters.Sort == models.ItemSortPriceDesc {
+		basePrice = where.basePrice("price", "currency") + "::text"
+	}
+
+	q := `
+		SELECT ` + itemColumns + `, ` + highlights + `, ` + basePrice + `
+		FROM items
+		WHERE ` + where.String() + `
+		ORDER BY ` + orderBy + `
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.DB.Query(ctx, q, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.Item
+	for rows.Next() {
+		item := &models.Item{}
+		hl := &models.ItemHighlights{}
+		if err := rows.Scan(append(itemDest(item), &hl.Title, &hl.Description, &item.BasePrice)...); err != nil {
+			return nil, err
+		}
+		if filters.Query != "" {
+			item.Highlights = hl
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// Count returns the number of items matching the filters, the After cursor is ignored
+func (r *ItemRepo) Count(ctx context.Context, filters *models.ItemFilters) (int, error) {
+	where := buildItemWhere(filters, nil)
+
+	var total int
+	err := r.DB.QueryRow(ctx, "SELECT COUNT(*) FROM items WHERE "+where.String(), where.args...).Scan(&total)
+	return total, err
+}
+
+// itemOrderBy maps a validated sort order to its ORDER BY clause, every order ends with id
+// so that rows with equal sort keys keep a deterministic position between pages.
+// Price sorts compute base_price for every matching row, it reads exchange_rates so no index can back it
+// and those sorts cost a scan of the rows left by the status and other filters
+func itemOrderBy(sort models.ItemSort, where *itemWhere) (string, error) {
+	switch sort {
+	case "", models.ItemSortNewest:
+		return "created_at DESC, id DESC", nil
+	case models.ItemSortOldest:
+		return "created_at ASC, id ASC", nil
+	case models.ItemSortPriceAsc:
+		return where.basePrice("price", "currency") + " ASC, id ASC", nil
+	case models.ItemSortPriceDesc:
+		return where.basePrice("price", "currency") + " DESC, id DESC", nil
+	case models.ItemSortTitle:
+		return "title ASC, id ASC", nil
+	case models.ItemSortRelevance:
+		if where.tsQuery == "" {
+			return "", errors.New("relevance sort requires a search query")
+		}
+		return "ts_rank(search_vector, " + where.tsQuery + ") DESC, created_at DESC, id DESC", nil
+	default:
+		return "", errors.New("unsupported item sort")
+	}
+}
+
+// addItemKeyset restricts the listing to rows ordered after the cursor for the sort order
+func addItemKeyset(where *itemWhere, sort models.ItemSort, after *models.ItemCursor) error {
+	if sort == models.ItemSortPriceAsc || sort == models.ItemSortPriceDesc {
+		// the base currency placeholder has to be bound before the cursor placeholders are numbered
+		where.basePrice("price", "currency")
+	}
+	first, second := pgxPlaceholder(len(where.args)+1), pgxPlaceholder(len(where.args)+2)
+
+	switch sort {
+	case "", models.ItemSortNewest:
+		where.add("(created_at, id) < ("+first+", "+second+")", after.CreatedAt, after.ID)
+	case models.ItemSortOldest:
+		where.add("(created_at, id) > ("+first+", "+second+")", after.CreatedAt, after.ID)
+	case models.ItemSortPriceAsc, models.ItemSortPriceDesc:
+		op := ">"
+		if sort == models.ItemSortPriceDesc {
+			op = "<"
+		}
+		where.add("("+where.basePrice("price", "currency")+", id) "+op+" ("+first+"::numeric, "+second+")", after.BasePrice, after.ID)
+	case models.ItemSortTitle:
+		where.add("(title, id) > ("+first+", "+second+")", after.Title, after.ID)
+	default:
+		return errors.New("keyset pagination is not supported for this sort")
+	}
+	return nil
+}
+
+// itemWhere accumulates WHERE conditions and their positional arguments
+type itemWhere struct {
+	conditions []string
+	args       []interface{}
+	// tsQuery is the SQL expression of the search query, empty when not searching
+	tsQuery string
+	// baseCurrency is bound to the basePlaceholder argument once a price expression needs it
+	baseCurrency    string
+	basePlaceholder string
+}
+
+// basePrice returns the expression converting amount in currency to the base currency, it is NULL
+// for currencies without an exchange rate so that such prices never match price filters
+func (w *itemWhere) basePrice(amount, currency string) string {
+	if w.basePlaceholder == "" {
+		w.basePlaceholder = w.next()
+		w.args = append(w.args, w.baseCurrency)
+	}
+	return "base_price(" + amount + ", " + currency + ", " + w.basePlaceholder + ")"
+}
+
+// add appends a condition along with the arguments it references
+func (w *itemWhere) add(condition string, args ...interface{}) {
+	w.conditions = append(w.conditions, condition)
+	w.args = append(w.args, args...)
+}
+
+// next returns the placeholder for the next argument
+func (w *itemWhere) next() string {
+	return pgxPlaceholder(len(w.args) + 1)
+}
+
+// String joins the conditions with AND
+func (w *itemWhere) String() string {
+	return strings.Join(w.conditions, " AND ")
+}
+
+// buildItemWhere translates item filters into conditions, numbering placeholders after the given args
+func buildItemWhere(filters *models.ItemFilters, args []interface{}) *itemWhere {
+	where := &itemWhere{args: args, baseCurrency: money.NormalizeCurrency(filters.Currency)}
+
+	status := filters.Status
+	if status == "" {
+		status = models.ItemStatusActive
+	}
+	where.add("status = "+where.next(), status)
+
+	if filters.AuthorID > 0 {
+		where.add("author_id = "+where.next(), filters.AuthorID)
+	}
+
+	if filters.CategoryID > 0 {
+		where.add(`category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = `+where.next()+`
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree
+		)`, filters.CategoryID)
+	}
+
+	if filters.MinPrice.Sign() > 0 {
+		price := where.basePrice("price", "currency")
+		where.add(price+" >= "+where.next(), filters.MinPrice)
+	}
+
+	if filters.MaxPrice.Sign() > 0 {
+		price := where.basePrice("price", "currency")
+		where.add(price+" <= "+where.next(), filters.MaxPrice)
+	}
+
+	if filters.Sort == models.ItemSortPriceAsc || filters.Sort == models.ItemSortPriceDesc {
+		where.add(where.basePrice("price", "currency") + " IS NOT NULL")
+	}
+
+	if filters.Query != "" {
+		where.tsQuery = "websearch_to_tsquery('" + searchConfig + "', " + where.next() + ")"
+		where.add("search_vector @@ "+where.tsQuery, filters.Query)
+	}
+
+	return where
+}
 
+// GetByID retrieves an item by its ID
+func (r *ItemRepo) GetByID(ctx context.Context, id int) (*models.Item, error) {
 	q := `
-		SELECT id, title, description, image_url, price, author_id, author_login, created_at
+		SELECT ` + itemColumns + `
 		FROM items
+		WHERE id = $1
 	`
 
-	var conditions []string
+	item, err := scanItem(r.DB.QueryRow(ctx, q, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// HasImageURL reports whether url is the image_url of a publicly visible item, drafts and archived items do not count
+func (r *ItemRepo) HasImageURL(ctx context.Context, url string) (bool, error) {
+	var exists bool
+	err := r.DB.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM items WHERE image_url = $1 AND status IN ('active', 'reserved', 'sold'))", url,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Update changes only the fields set in upd and returns the updated item
+func (r *ItemRepo) Update(ctx context.Context, id int, upd *models.ItemUpdate) (*models.Item, error) {
+	args := []interface{}{id}
+	argIndex := 2
+
+	var sets []string
+
+	if upd.Title != nil {
+		sets = append(sets, "title = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.Title)
+		argIndex++
+	}
+
+	if upd.Description != nil {
+		sets = append(sets, "description = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.Description)
+		argIndex++
+	}
 
-	if filters.MinPrice > 0 {
-		conditions = append(conditions, "price >= "+pgxPlaceholder(argIndex))
-		args = append(args, filters.MinPrice)
+	if upd.ImageURL != nil {
+		sets = append(sets, "image_url = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.ImageURL)
 		argIndex++
 	}
 
-	if filters.MaxPrice > 0 {
-		conditions = append(conditions, "price <= "+pgxPlaceholder(argIndex))
-		args = append(args, filters.MaxPrice)
+	if upd.Price != nil {
+		sets = append(sets, "price = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.Price)
 		argIndex++
 	}
 
-	if filters.Title != "" {
-		conditions = append(conditions, "title ILIKE "+pgxPlaceholder(argIndex))
-		args = append(args, "%"+filters.Title+"%")
+	if upd.Currency != nil {
+		sets = append(sets, "currency = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.Currency)
 		argIndex++
 	}
 
-	if filters.Description != "" {
-		conditions = append(conditions, "description ILIKE "+pgxPlaceholder(argIndex))
-		args = append(args, "%"+filters.Description+"%")
+	if upd.CategoryID != nil {
+		sets = append(sets, "category_id = "+pgxPlaceholder(argIndex))
+		args = append(args, *upd.CategoryID)
 	}
 
-	if len(conditions) > 0 {
-		q += " WHERE " + strings.Join(conditions, " AND ")
+	if len(sets) == 0 {
+		return r.GetByID(ctx, id)
 	}
 
-	q += " ORDER BY created_at DESC LIMIT $1 OFFSET $2"
+	q := "UPDATE items SET " + strings.Join(sets, ", ") + " WHERE id = $1 RETURNING " + itemColumns
 
-	rows, err := r.DB.Query(ctx, q, args...)
+	item, err := scanItem(r.DB.QueryRow(ctx, q, args...))
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	defer rows.Close()
 
-	var items []*models.Item
-	for rows.Next() {
-		item := &models.Item{}
-		if err := rows.Scan(
-			&item.ID, &item.Title, &item.Description, &item.ImageURL,
-			&item.Price, &item.AuthorID, &item.AuthorLogin, &item.CreatedAt,
-		); err != nil {
-			return nil, err
+	return item, nil
+}
+
+// Delete removes an item by its ID
+func (r *ItemRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.DB.Exec(ctx, "DELETE FROM items WHERE id = $1", id)
+	return err
+}
+
+// UpdateStatus moves an item from one status to another and stamps the transition time,
+// it returns nil if the item no longer has the expected from status
+func (r *ItemRepo) UpdateStatus(ctx context.Context, id int, from, to models.ItemStatus) (*models.Item, error) {
+	var column string
+	switch to {
+	case models.ItemStatusActive:
+		column = "published_at"
+	case models.ItemStatusReserved:
+		column = "reserved_at"
+	case models.ItemStatusSold:
+		column = "sold_at"
+	case models.ItemStatusArchived:
+		column = "archived_at"
+	default:
+		return nil, errors.New("unsupported item status")
+	}
+
+	q := "UPDATE items SET status = $3, " + column + " = $4 WHERE id = $1 AND status = $2 RETURNING " + itemColumns
+
+	item, err := scanItem(r.DB.QueryRow(ctx, q, id, from, to, time.Now()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
 		}
-		items = append(items, item)
+		return nil, err
 	}
 
-	return items, nil
+	return item, nil
+}
+
+// scanItem reads a single item row selected with itemColumns
+func scanItem(row pgx.Row) (*models.Item, error) {
+	item := &models.Item{}
+	if err := row.Scan(itemDest(item)...); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// itemDest returns scan destinations matching itemColumns
+func itemDest(item *models.Item) []interface{} {
+	return []interface{}{
+		&item.ID, &item.Title, &item.Description, &item.ImageURL,
+		&item.Price, &item.Currency, &item.AuthorID, &item.AuthorLogin, &item.CategoryID, &item.Status,
+		&item.CreatedAt, &item.PublishedAt, &item.ReservedAt, &item.SoldAt, &item.ArchivedAt,
+		&item.ThumbnailURL,
+	}
+}
+
+// nullableID maps a zero ID to SQL NULL
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
 }
 
 // pgxPlaceholder returns a PostgreSQL-style placeholder for prepared statements
@@ -0,0 +1,250 @@
+// Package repository provides access to the item_images table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// itemImageColumns is the list of columns selected for an item image
+const itemImageColumns = `id, item_id, position, is_primary, url, medium_url, thumbnail_url, width, height, created_at`
+
+// ItemImageRepo handles database operations related to item images,
+// every change keeps items.image_url pointing at the primary image
+type ItemImageRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewItemImageRepo creates a new instance of ItemImageRepo
+func NewItemImageRepo(db *pgxpool.Pool) *ItemImageRepo {
+	return &ItemImageRepo{DB: db}
+}
+
+// Create appends an image to its item, the first image of an item becomes primary.
+// The image count is checked under the item lock, Create reports false when the item already has maxImages images
+func (r *ItemImageRepo) Create(ctx context.Context, img *models.ItemImage, maxImages int) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockItem(ctx, tx, img.ItemID); err != nil {
+		return false, err
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM item_images WHERE item_id = $1", img.ItemID).Scan(&count); err != nil {
+		return false, err
+	}
+	if count >= maxImages {
+		return false, nil
+	}
+
+	q := `
+		INSERT INTO item_images (item_id, position, is_primary, url, medium_url, thumbnail_url, width, height)
+		SELECT $1,
+			COALESCE((SELECT MAX(position) + 1 FROM item_images WHERE item_id = $1), 0),
+			NOT EXISTS (SELECT 1 FROM item_images WHERE item_id = $1 AND is_primary),
+			$2, $3, $4, $5, $6
+		RETURNING id, position, is_primary, created_at
+	`
+	err = tx.QueryRow(ctx, q, img.ItemID, img.URL, img.MediumURL, img.ThumbnailURL, img.Width, img.Height).
+		Scan(&img.ID, &img.Position, &img.IsPrimary, &img.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	if img.IsPrimary {
+		if err := syncItemImageURL(ctx, tx, img.ItemID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
+
+// ListByItem retrieves the images of an item ordered by position
+func (r *ItemImageRepo) ListByItem(ctx context.Context, itemID int) ([]*models.ItemImage, error) {
+	q := `
+		SELECT ` + itemImageColumns + `
+		FROM item_images
+		WHERE item_id = $1
+		ORDER BY position, id
+	`
+
+	rows, err := r.DB.Query(ctx, q, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*models.ItemImage
+	for rows.Next() {
+		img, err := scanItemImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// Delete removes an image of an item and returns it, the remaining images are renumbered
+// and the first of them becomes primary when the primary image is removed
+func (r *ItemImageRepo) Delete(ctx context.Context, itemID, imageID int) (*models.ItemImage, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockItem(ctx, tx, itemID); err != nil {
+		return nil, err
+	}
+
+	q := "DELETE FROM item_images WHERE item_id = $1 AND id = $2 RETURNING " + itemImageColumns
+	img, err := scanItemImage(tx.QueryRow(ctx, q, itemID, imageID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	q = `
+		UPDATE item_images SET position = ordered.n - 1
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position, id) AS n FROM item_images WHERE item_id = $1) AS ordered
+		WHERE item_images.id = ordered.id
+	`
+	if _, err := tx.Exec(ctx, q, itemID); err != nil {
+		return nil, err
+	}
+
+	if img.IsPrimary {
+		q = "UPDATE item_images SET is_primary = TRUE WHERE item_id = $1 AND position = 0"
+		if _, err := tx.Exec(ctx, q, itemID); err != nil {
+			return nil, err
+		}
+		if err := syncItemImageURL(ctx, tx, itemID); err != nil {
+			return nil, err
+		}
+	}
+
+	return img, tx.Commit(ctx)
+}
+
+// Reorder sets the position of each image of an item to its index in imageIDs. The images are locked
+// before they are compared with imageIDs, Reorder reports false when imageIDs no longer lists every image exactly once
+func (r *ItemImageRepo) Reorder(ctx context.Context, itemID int, imageIDs []int) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockItem(ctx, tx, itemID); err != nil {
+		return false, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT id FROM item_images WHERE item_id = $1 FOR UPDATE", itemID)
+	if err != nil {
+		return false, err
+	}
+	pending := make(map[int]bool, len(imageIDs))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		pending[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	if len(pending) != len(imageIDs) {
+		return false, nil
+	}
+	for _, id := range imageIDs {
+		if !pending[id] {
+			return false, nil
+		}
+		delete(pending, id)
+	}
+
+	q := `
+		UPDATE item_images SET position = ordered.n - 1
+		FROM unnest($2::int[]) WITH ORDINALITY AS ordered(id, n)
+		WHERE item_images.item_id = $1 AND item_images.id = ordered.id
+	`
+	if _, err := tx.Exec(ctx, q, itemID, imageIDs); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// SetPrimary makes an image the primary image of its item, it reports false when the image does not exist
+func (r *ItemImageRepo) SetPrimary(ctx context.Context, itemID, imageID int) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockItem(ctx, tx, itemID); err != nil {
+		return false, err
+	}
+
+	q := "UPDATE item_images SET is_primary = FALSE WHERE item_id = $1 AND is_primary AND id <> $2"
+	if _, err := tx.Exec(ctx, q, itemID, imageID); err != nil {
+		return false, err
+	}
+
+	tag, err := tx.Exec(ctx, "UPDATE item_images SET is_primary = TRUE WHERE item_id = $1 AND id = $2", itemID, imageID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := syncItemImageURL(ctx, tx, itemID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// lockItem serializes image changes of one item
+func lockItem(ctx context.Context, tx pgx.Tx, itemID int) error {
+	_, err := tx.Exec(ctx, "SELECT 1 FROM items WHERE id = $1 FOR UPDATE", itemID)
+	return err
+}
+
+// syncItemImageURL points items.image_url at the primary image of the item
+func syncItemImageURL(ctx context.Context, tx pgx.Tx, itemID int) error {
+	q := `
+		UPDATE items
+		SET image_url = COALESCE((SELECT url FROM item_images WHERE item_id = $1 AND is_primary), '')
+		WHERE id = $1
+	`
+	_, err := tx.Exec(ctx, q, itemID)
+	return err
+}
+
+// scanItemImage reads a single row selected with itemImageColumns
+func scanItemImage(row pgx.Row) (*models.ItemImage, error) {
+	img := &models.ItemImage{}
+	err := row.Scan(&img.ID, &img.ItemID, &img.Position, &img.IsPrimary, &img.URL, &img.MediumURL, &img.ThumbnailURL,
+		&img.Width, &img.Height, &img.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,142 @@
+// Package repository provides access to the totp_credentials and recovery_codes tables in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MFARepo handles database operations related to TOTP credentials and recovery codes
+type MFARepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewMFARepo creates a new instance of MFARepo
+func NewMFARepo(db *pgxpool.Pool) *MFARepo {
+	return &MFARepo{DB: db}
+}
+
+// GetTOTP retrieves the TOTP credential of a user
+func (r *MFARepo) GetTOTP(ctx context.Context, userID int) (*models.TOTPCredential, error) {
+	query := `
+		SELECT user_id, secret, enabled_at, last_counter, created_at
+		FROM totp_credentials
+		WHERE user_id = $1
+	`
+
+	var cred models.TOTPCredential
+	err := r.DB.QueryRow(ctx, query, userID).Scan(
+		&cred.UserID, &cred.Secret, &cred.EnabledAt, &cred.LastCounter, &cred.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &cred, nil
+}
+
+// SaveTOTP stores a new unconfirmed secret of a user, replacing an earlier unconfirmed one.
+// It reports false when the user already has TOTP enabled
+func (r *MFARepo) SaveTOTP(ctx context.Context, userID int, secret string) (bool, error) {
+	query := `
+		INSERT INTO totp_credentials (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_counter = 0, created_at = now()
+		WHERE totp_credentials.enabled_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// EnableTOTP enables the unconfirmed secret of a user after a code of time step counter was accepted
+// and replaces the recovery codes of the user with codeHashes. It reports false when there is no unconfirmed secret
+func (r *MFARepo) EnableTOTP(ctx context.Context, userID int, counter int64, codeHashes []string) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE totp_credentials
+		SET enabled_at = now(), last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return false, err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// UseTOTPCounter records that a code of time step counter was accepted, it reports false when a code of the same
+// or a later step was already accepted, so a code cannot be replayed even under concurrent requests
+func (r *MFARepo) UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	query := `
+		UPDATE totp_credentials
+		SET last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_counter < $2
+	`
+
+	tag, err := r.DB.Exec(ctx, query, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, it reports false when there is no such code
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteTOTP removes the TOTP credential and the recovery codes of a user
+func (r *MFARepo) DeleteTOTP(ctx context.Context, userID int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_credentials WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,57 @@
+// Package repository provides access to the oidc_states table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OIDCStateRepo handles database operations related to pending OpenID Connect sign-ins
+type OIDCStateRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewOIDCStateRepo creates a new instance of OIDCStateRepo
+func NewOIDCStateRepo(db *pgxpool.Pool) *OIDCStateRepo {
+	return &OIDCStateRepo{DB: db}
+}
+
+// Create stores a pending sign-in and removes the expired ones
+func (r *OIDCStateRepo) Create(ctx context.Context, state *models.OIDCState) error {
+	if _, err := r.DB.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at < now() AT TIME ZONE 'UTC'`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_states (state_hash, provider, nonce, code_verifier, user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.DB.Exec(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.UserID, state.ExpiresAt.UTC())
+	return err
+}
+
+// Consume removes and returns the pending sign-in with the state hash, expired ones included,
+// so every state is accepted once even under concurrent requests
+func (r *OIDCStateRepo) Consume(ctx context.Context, hash string) (*models.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE state_hash = $1
+		RETURNING state_hash, provider, nonce, code_verifier, user_id, expires_at
+	`
+
+	var state models.OIDCState
+	err := r.DB.QueryRow(ctx, query, hash).
+		Scan(&state.StateHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.UserID, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,83 @@
+// Package repository provides access to the password_reset_tokens table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PasswordResetTokenRepo handles database operations related to password reset tokens
+type PasswordResetTokenRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewPasswordResetTokenRepo creates a new instance of PasswordResetTokenRepo
+func NewPasswordResetTokenRepo(db *pgxpool.Pool) *PasswordResetTokenRepo {
+	return &PasswordResetTokenRepo{DB: db}
+}
+
+// Create inserts a new reset token and sets its ID and CreatedAt
+func (r *PasswordResetTokenRepo) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	return r.DB.QueryRow(ctx, query, token.UserID, token.TokenHash, token.ExpiresAt.UTC()).
+		Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetByHash retrieves a reset token by the hash of its value
+func (r *PasswordResetTokenRepo) GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	query := `
+		SELECT id, user_id, token_hash, expires_at, created_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+	`
+
+	var token models.PasswordResetToken
+	err := r.DB.QueryRow(ctx, query, hash).Scan(
+		&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkUsed records that a reset token was redeemed, it reports false when the token was already used,
+// so a token changes the password only once even under concurrent requests
+func (r *PasswordResetTokenRepo) MarkUsed(ctx context.Context, id int) (bool, error) {
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = now()
+		WHERE id = $1 AND used_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// InvalidateUser marks every unused reset token of a user as used
+func (r *PasswordResetTokenRepo) InvalidateUser(ctx context.Context, userID int) error {
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = now()
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+
+	_, err := r.DB.Exec(ctx, query, userID)
+	return err
+}
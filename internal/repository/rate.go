@@ -0,0 +1,73 @@
+// Package repository provides access to the exchange_rates table in the database
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateRepo handles database operations related to exchange rates
+type RateRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewRateRepo creates a new instance of RateRepo
+func NewRateRepo(db *pgxpool.Pool) *RateRepo {
+	return &RateRepo{DB: db}
+}
+
+// Replace swaps the whole exchange rates table for the given rates in one transaction
+func (r *RateRepo) Replace(ctx context.Context, rates []*models.ExchangeRate) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "DELETE FROM exchange_rates"); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rate := range rates {
+		q := `
+			INSERT INTO exchange_rates (currency, rate, updated_at)
+			VALUES ($1, $2, $3)
+		`
+		if _, err := tx.Exec(ctx, q, rate.Currency, rate.Rate, now); err != nil {
+			return err
+		}
+		rate.UpdatedAt = now
+	}
+
+	return tx.Commit(ctx)
+}
+
+// List retrieves all exchange rates ordered by currency
+func (r *RateRepo) List(ctx context.Context) ([]*models.ExchangeRate, error) {
+	q := `
+		SELECT currency, rate::text, updated_at
+		FROM exchange_rates
+		ORDER BY currency
+	`
+
+	rows, err := r.DB.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []*models.ExchangeRate
+	for rows.Next() {
+		rate := &models.ExchangeRate{}
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
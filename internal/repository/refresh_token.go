@@ -0,0 +1,102 @@
+// Package repository provides access to the refresh_tokens table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RefreshTokenRepo handles database operations related to refresh tokens
+type RefreshTokenRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewRefreshTokenRepo creates a new instance of RefreshTokenRepo
+func NewRefreshTokenRepo(db *pgxpool.Pool) *RefreshTokenRepo {
+	return &RefreshTokenRepo{DB: db}
+}
+
+// Create inserts a new refresh token and sets its ID and CreatedAt
+func (r *RefreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	return r.DB.QueryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt.UTC()).
+		Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetByHash retrieves a refresh token by the hash of its value
+func (r *RefreshTokenRepo) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+
+	var token models.RefreshToken
+	err := r.DB.QueryRow(ctx, query, hash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkUsed records that a refresh token was exchanged, it reports false when the token
+// was already used or revoked, so only one of concurrent refreshes succeeds
+func (r *RefreshTokenRepo) MarkUsed(ctx context.Context, id int) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = now()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeFamily revokes every refresh token of a family and ends the session of the family
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `
+		WITH ended AS (
+			UPDATE sessions SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.DB.Exec(ctx, query, familyID)
+	return err
+}
+
+// RevokeUser revokes every refresh token of a user and ends all of their sessions
+func (r *RefreshTokenRepo) RevokeUser(ctx context.Context, userID int) error {
+	query := `
+		WITH ended AS (
+			UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.DB.Exec(ctx, query, userID)
+	return err
+}
@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ory/dockertest/v3"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +18,17 @@ import (
 var db *pgxpool.Pool
 var userRepo *UserRepo
 var itemRepo *ItemRepo
+var categoryRepo *CategoryRepo
+var rateRepo *RateRepo
+var imageRepo *ItemImageRepo
+var refreshTokenRepo *RefreshTokenRepo
+var resetTokenRepo *PasswordResetTokenRepo
+var auditRepo *AuditRepo
+var mfaRepo *MFARepo
+var apiKeyRepo *APIKeyRepo
+var identityRepo *IdentityRepo
+var oidcStateRepo *OIDCStateRepo
+var sessionRepo *SessionRepo
 var pool *dockertest.Pool
 var resource *dockertest.Resource
 
@@ -52,6 +65,17 @@ func TestMain(m *testing.M) {
 
 	userRepo = NewUserRepo(db)
 	itemRepo = NewItemRepo(db)
+	categoryRepo = NewCategoryRepo(db)
+	rateRepo = NewRateRepo(db)
+	imageRepo = NewItemImageRepo(db)
+	refreshTokenRepo = NewRefreshTokenRepo(db)
+	resetTokenRepo = NewPasswordResetTokenRepo(db)
+	auditRepo = NewAuditRepo(db)
+	mfaRepo = NewMFARepo(db)
+	apiKeyRepo = NewAPIKeyRepo(db)
+	identityRepo = NewIdentityRepo(db)
+	oidcStateRepo = NewOIDCStateRepo(db)
+	sessionRepo = NewSessionRepo(db)
 
 	code := m.Run()
 
@@ -67,18 +91,140 @@ func createTables() {
 	CREATE TABLE IF NOT EXISTS users (
 		id SERIAL PRIMARY KEY,
 		login TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+		disabled_at TIMESTAMP,
+		email TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE IF NOT EXISTS categories (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		parent_id INT REFERENCES categories (id) ON DELETE RESTRICT,
+		created_at TIMESTAMP NOT NULL DEFAULT now()
 	);
 	CREATE TABLE IF NOT EXISTS items (
 		id SERIAL PRIMARY KEY,
 		title TEXT NOT NULL,
 		description TEXT NOT NULL,
 		image_url TEXT NOT NULL,
-		price NUMERIC(10,2) NOT NULL,
+		price NUMERIC NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'USD',
 		author_id INT NOT NULL,
 		author_login TEXT NOT NULL,
-		created_at TIMESTAMP NOT NULL
+		category_id INT REFERENCES categories (id) ON DELETE RESTRICT,
+		status TEXT NOT NULL DEFAULT 'active',
+		created_at TIMESTAMP NOT NULL,
+		published_at TIMESTAMP,
+		reserved_at TIMESTAMP,
+		sold_at TIMESTAMP,
+		archived_at TIMESTAMP,
+		search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(description, '')), 'B')
+		) STORED
+	);
+	CREATE TABLE IF NOT EXISTS exchange_rates (
+		currency TEXT PRIMARY KEY,
+		rate NUMERIC NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS item_images (
+		id SERIAL PRIMARY KEY,
+		item_id INT NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+		position INT NOT NULL,
+		is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+		url TEXT NOT NULL,
+		medium_url TEXT NOT NULL,
+		thumbnail_url TEXT NOT NULL,
+		width INT NOT NULL DEFAULT 0,
+		height INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		family_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		used_at TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		used_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id SERIAL PRIMARY KEY,
+		event TEXT NOT NULL,
+		user_id INT REFERENCES users (id) ON DELETE SET NULL,
+		login TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS totp_credentials (
+		user_id INT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+		secret TEXT NOT NULL,
+		enabled_at TIMESTAMP,
+		last_counter BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at TIMESTAMP,
+		UNIQUE (user_id, code_hash)
 	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		scopes TEXT[] NOT NULL,
+		expires_at TIMESTAMP,
+		last_used_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		revoked_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		UNIQUE (provider, subject)
+	);
+	CREATE TABLE IF NOT EXISTS oidc_states (
+		state_hash TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		user_id INT REFERENCES users (id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS sessions (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		family_id TEXT UNIQUE NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+		revoked_at TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_item_images_primary ON item_images (item_id) WHERE is_primary;
+	CREATE OR REPLACE FUNCTION base_price(amount NUMERIC, cur TEXT, base TEXT) RETURNS NUMERIC
+		LANGUAGE SQL STABLE
+		AS $$ SELECT CASE WHEN cur = base THEN amount ELSE amount / (SELECT rate FROM exchange_rates WHERE currency = cur) END $$;
 	`)
 	if err != nil {
 		log.Fatalf("Could not create tables: %v", err)
@@ -90,6 +236,14 @@ func cleanTables(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = db.Exec(context.Background(), "DELETE FROM users")
 	assert.NoError(t, err)
+	_, err = db.Exec(context.Background(), "DELETE FROM categories WHERE parent_id IS NOT NULL")
+	assert.NoError(t, err)
+	_, err = db.Exec(context.Background(), "DELETE FROM categories")
+	assert.NoError(t, err)
+	_, err = db.Exec(context.Background(), "DELETE FROM exchange_rates")
+	assert.NoError(t, err)
+	_, err = db.Exec(context.Background(), "DELETE FROM oidc_states")
+	assert.NoError(t, err)
 }
 
 func TestUserRepo_CreateAndGetByLogin(t *testing.T) {
@@ -113,6 +267,15 @@ func TestUserRepo_CreateAndGetByLogin(t *testing.T) {
 	noUser, err := userRepo.GetByLogin(ctx, "nonexistent")
 	assert.NoError(t, err)
 	assert.Nil(t, noUser)
+
+	byID, err := userRepo.GetByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, byID)
+	assert.Equal(t, user.Login, byID.Login)
+
+	noUser, err = userRepo.GetByID(ctx, user.ID+1000)
+	assert.NoError(t, err)
+	assert.Nil(t, noUser)
 }
 
 func TestItemRepo_CreateAndList(t *testing.T) {
@@ -124,7 +287,7 @@ func TestItemRepo_CreateAndList(t *testing.T) {
 		Title:       "Test item",
 		Description: "Desc",
 		ImageURL:    "http://image.url",
-		Price:       123.45,
+		Price:       money.MustParse("123.45"),
 		AuthorID:    1,
 		AuthorLogin: "author1",
 	}
@@ -134,6 +297,13 @@ func TestItemRepo_CreateAndList(t *testing.T) {
 	assert.NotZero(t, item.ID)
 	assert.False(t, item.CreatedAt.IsZero())
 
+	known, err := itemRepo.HasImageURL(ctx, "http://image.url")
+	assert.NoError(t, err)
+	assert.True(t, known)
+	known, err = itemRepo.HasImageURL(ctx, "http://other.url")
+	assert.NoError(t, err)
+	assert.False(t, known)
+
 	items, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
 	assert.NoError(t, err)
 	assert.Len(t, items, 1)
@@ -143,7 +313,7 @@ func TestItemRepo_CreateAndList(t *testing.T) {
 		Title:       "Second item",
 		Description: "Other desc",
 		ImageURL:    "http://image2.url",
-		Price:       200,
+		Price:       money.MustParse("200"),
 		AuthorID:    2,
 		AuthorLogin: "author2",
 	}
@@ -151,9 +321,915 @@ func TestItemRepo_CreateAndList(t *testing.T) {
 	assert.NoError(t, err)
 
 	filteredItems, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{
-		MinPrice: 150,
+		MinPrice: money.MustParse("150"),
 	})
 	assert.NoError(t, err)
 	assert.Len(t, filteredItems, 1)
 	assert.Equal(t, item2.Title, filteredItems[0].Title)
 }
+
+func TestItemRepo_GetByIDUpdateDelete(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	item := &models.Item{
+		Title:       "Original",
+		Description: "Desc",
+		ImageURL:    "http://image.url",
+		Price:       money.MustParse("10.00"),
+		AuthorID:    1,
+		AuthorLogin: "author1",
+	}
+	err := itemRepo.Create(ctx, item)
+	assert.NoError(t, err)
+
+	got, err := itemRepo.GetByID(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+	assert.Equal(t, item.Title, got.Title)
+
+	newTitle := "Updated"
+	updated, err := itemRepo.Update(ctx, item.ID, &models.ItemUpdate{Title: &newTitle})
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", updated.Title)
+	assert.Equal(t, item.Description, updated.Description)
+	assert.Equal(t, "10.00", updated.Price.String())
+	assert.Equal(t, "USD", updated.Currency)
+
+	price, currency := money.MustParse("1500"), "JPY"
+	updated, err = itemRepo.Update(ctx, item.ID, &models.ItemUpdate{Price: &price, Currency: &currency})
+	assert.NoError(t, err)
+	assert.Equal(t, "1500", updated.Price.String())
+	assert.Equal(t, "JPY", updated.Currency)
+
+	err = itemRepo.Delete(ctx, item.ID)
+	assert.NoError(t, err)
+
+	missing, err := itemRepo.GetByID(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestItemRepo_StatusLifecycle(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	item := &models.Item{
+		Title:       "Draft item",
+		Description: "Desc",
+		ImageURL:    "http://image.url",
+		Price:       money.MustParse("10"),
+		AuthorID:    1,
+		AuthorLogin: "author1",
+		Status:      models.ItemStatusDraft,
+	}
+	err := itemRepo.Create(ctx, item)
+	assert.NoError(t, err)
+	assert.Nil(t, item.PublishedAt)
+
+	items, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	drafts, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{Status: models.ItemStatusDraft, AuthorID: 1})
+	assert.NoError(t, err)
+	assert.Len(t, drafts, 1)
+
+	known, err := itemRepo.HasImageURL(ctx, "http://image.url")
+	assert.NoError(t, err)
+	assert.False(t, known)
+
+	published, err := itemRepo.UpdateStatus(ctx, item.ID, models.ItemStatusDraft, models.ItemStatusActive)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ItemStatusActive, published.Status)
+	assert.NotNil(t, published.PublishedAt)
+
+	known, err = itemRepo.HasImageURL(ctx, "http://image.url")
+	assert.NoError(t, err)
+	assert.True(t, known)
+
+	stale, err := itemRepo.UpdateStatus(ctx, item.ID, models.ItemStatusDraft, models.ItemStatusActive)
+	assert.NoError(t, err)
+	assert.Nil(t, stale)
+
+	items, err = itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestCategoryRepo_TreeAndItemFilter(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	electronics := &models.Category{Name: "Electronics"}
+	assert.NoError(t, categoryRepo.Create(ctx, electronics))
+	phones := &models.Category{Name: "Phones", ParentID: &electronics.ID}
+	assert.NoError(t, categoryRepo.Create(ctx, phones))
+	books := &models.Category{Name: "Books"}
+	assert.NoError(t, categoryRepo.Create(ctx, books))
+
+	categories, err := categoryRepo.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, categories, 3)
+
+	phone := &models.Item{
+		Title: "Phone", Description: "Desc", ImageURL: "http://image.url", Price: money.MustParse("100"),
+		AuthorID: 1, AuthorLogin: "author1", CategoryID: phones.ID,
+	}
+	assert.NoError(t, itemRepo.Create(ctx, phone))
+	novel := &models.Item{
+		Title: "Novel", Description: "Desc", ImageURL: "http://image.url", Price: money.MustParse("10"),
+		AuthorID: 1, AuthorLogin: "author1", CategoryID: books.ID,
+	}
+	assert.NoError(t, itemRepo.Create(ctx, novel))
+
+	items, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{CategoryID: electronics.ID})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Phone", items[0].Title)
+	assert.Equal(t, phones.ID, items[0].CategoryID)
+
+	inUse, err := categoryRepo.InUse(ctx, electronics.ID)
+	assert.NoError(t, err)
+	assert.True(t, inUse)
+
+	assert.NoError(t, itemRepo.Delete(ctx, novel.ID))
+	inUse, err = categoryRepo.InUse(ctx, books.ID)
+	assert.NoError(t, err)
+	assert.False(t, inUse)
+	assert.NoError(t, categoryRepo.Delete(ctx, books.ID))
+
+	got, err := categoryRepo.GetByID(ctx, books.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestItemRepo_FullTextSearch(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	for _, item := range []*models.Item{
+		{Title: "Mountain bike", Description: "Aluminium frame, barely ridden", Price: money.MustParse("300")},
+		{Title: "Helmet", Description: "Fits any bike rider", Price: money.MustParse("40")},
+		{Title: "Kitchen table", Description: "Oak wood", Price: money.MustParse("120")},
+	} {
+		item.ImageURL = "http://image.url"
+		item.AuthorID = 1
+		item.AuthorLogin = "author1"
+		assert.NoError(t, itemRepo.Create(ctx, item))
+	}
+
+	items, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{Query: "bikes"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Mountain bike", items[0].Title)
+	assert.NotNil(t, items[0].Highlights)
+	assert.Contains(t, items[0].Highlights.Title, "<mark>bike</mark>")
+
+	items, err = itemRepo.List(ctx, 0, 10, &models.ItemFilters{Query: "bike -helmet"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	total, err := itemRepo.Count(ctx, &models.ItemFilters{Query: "bikes", MaxPrice: money.MustParse("100")})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	items, err = itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.Nil(t, items[0].Highlights)
+}
+
+func TestItemRepo_KeysetPagination(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		item := &models.Item{
+			Title: fmt.Sprintf("Item %d", i), Description: "Desc", ImageURL: "http://image.url",
+			Price: money.MustParse("10"), AuthorID: 1, AuthorLogin: "author1",
+		}
+		assert.NoError(t, itemRepo.Create(ctx, item))
+	}
+
+	first, err := itemRepo.List(ctx, 0, 2, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Len(t, first, 2)
+
+	last := first[len(first)-1]
+	rest, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{
+		After: &models.ItemCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rest, 3)
+
+	total, err := itemRepo.Count(ctx, &models.ItemFilters{
+		After: &models.ItemCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	for _, item := range rest {
+		assert.NotEqual(t, first[0].ID, item.ID)
+		assert.NotEqual(t, first[1].ID, item.ID)
+	}
+}
+
+func TestItemRepo_SortOrders(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	for i, price := range []string{"30", "10", "20", "10"} {
+		item := &models.Item{
+			Title: fmt.Sprintf("Item %c", 'D'-rune(i)), Description: "Desc", ImageURL: "http://image.url",
+			Price: money.MustParse(price), AuthorID: 1, AuthorLogin: "author1",
+		}
+		assert.NoError(t, itemRepo.Create(ctx, item))
+	}
+
+	byPrice, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{Sort: models.ItemSortPriceAsc})
+	assert.NoError(t, err)
+	assert.Len(t, byPrice, 4)
+	for i := 1; i < len(byPrice); i++ {
+		prev, cur := byPrice[i-1], byPrice[i]
+		assert.True(t, prev.Price.Cmp(cur.Price) < 0 || (prev.Price.Cmp(cur.Price) == 0 && prev.ID < cur.ID))
+	}
+
+	// equal prices are split across pages by the id tiebreaker
+	first, err := itemRepo.List(ctx, 0, 1, &models.ItemFilters{Sort: models.ItemSortPriceAsc})
+	assert.NoError(t, err)
+	rest, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{
+		Sort:  models.ItemSortPriceAsc,
+		After: &models.ItemCursor{Sort: models.ItemSortPriceAsc, BasePrice: first[0].BasePrice, ID: first[0].ID},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rest, 3)
+	assert.Equal(t, byPrice[1].ID, rest[0].ID)
+
+	byTitle, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{Sort: models.ItemSortTitle})
+	assert.NoError(t, err)
+	assert.Equal(t, "Item A", byTitle[0].Title)
+	assert.Equal(t, "Item D", byTitle[3].Title)
+
+	_, err = itemRepo.List(ctx, 0, 10, &models.ItemFilters{Sort: models.ItemSortRelevance})
+	assert.Error(t, err)
+}
+
+func TestRateRepo_CrossCurrencyPrices(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	assert.NoError(t, rateRepo.Replace(ctx, []*models.ExchangeRate{
+		{Currency: "EUR", Rate: money.MustParse("0.8")},
+		{Currency: "JPY", Rate: money.MustParse("150")},
+	}))
+
+	rates, err := rateRepo.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.Equal(t, "EUR", rates[0].Currency)
+	assert.Equal(t, "0.8", rates[0].Rate.String())
+
+	euro := &models.Item{Title: "Euro", Price: money.MustParse("8.00"), Currency: "EUR"}
+	for _, item := range []*models.Item{
+		{Title: "Dollar", Price: money.MustParse("12.00"), Currency: "USD"},
+		euro,
+		{Title: "Yen", Price: money.MustParse("3000"), Currency: "JPY"},
+		{Title: "Pound", Price: money.MustParse("1"), Currency: "GBP"},
+	} {
+		item.Description, item.ImageURL, item.AuthorID, item.AuthorLogin = "Desc", "http://image.url", 1, "author1"
+		assert.NoError(t, itemRepo.Create(ctx, item))
+	}
+
+	// 8 EUR and 3000 JPY are 10 and 20 USD
+	filtered, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{
+		MinPrice: money.MustParse("11"), Currency: "USD", Sort: models.ItemSortPriceAsc,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "Dollar", filtered[0].Title)
+	assert.Equal(t, "Yen", filtered[1].Title)
+
+	first, err := itemRepo.List(ctx, 0, 1, &models.ItemFilters{Sort: models.ItemSortPriceAsc})
+	assert.NoError(t, err)
+	assert.Len(t, first, 1)
+	assert.Equal(t, euro.ID, first[0].ID)
+
+	// the cursor keeps the base price of the first page, so a rate change making the euro item 16 USD
+	// neither skips the dollar item nor repeats the euro one
+	assert.NoError(t, rateRepo.Replace(ctx, []*models.ExchangeRate{
+		{Currency: "EUR", Rate: money.MustParse("0.5")},
+		{Currency: "JPY", Rate: money.MustParse("150")},
+	}))
+	rest, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{
+		Sort:  models.ItemSortPriceAsc,
+		After: &models.ItemCursor{Sort: models.ItemSortPriceAsc, BasePrice: first[0].BasePrice, ID: first[0].ID},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rest, 2)
+	assert.Equal(t, "Dollar", rest[0].Title)
+	assert.Equal(t, "Yen", rest[1].Title)
+
+	// GBP has no rate, so the pound item has no comparable price but is still listed by date
+	byPrice, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{Currency: "USD", Sort: models.ItemSortPriceDesc})
+	assert.NoError(t, err)
+	assert.Len(t, byPrice, 3)
+	assert.Equal(t, "Yen", byPrice[0].Title)
+	total, err := itemRepo.Count(ctx, &models.ItemFilters{MaxPrice: money.MustParse("5"), Currency: "USD"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	newest, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Len(t, newest, 4)
+
+	assert.NoError(t, rateRepo.Replace(ctx, []*models.ExchangeRate{{Currency: "EUR", Rate: money.MustParse("0.9")}}))
+	rates, err = rateRepo.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, rates, 1)
+}
+
+func TestItemImageRepo_OrderAndPrimary(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	item := &models.Item{Title: "Camera", Description: "Desc", Price: money.MustParse("100"), AuthorID: 1, AuthorLogin: "author1"}
+	assert.NoError(t, itemRepo.Create(ctx, item))
+
+	var images []*models.ItemImage
+	for _, name := range []string{"a", "b", "c"} {
+		img := &models.ItemImage{
+			ItemID:       item.ID,
+			URL:          "/media/" + name + ".png",
+			MediumURL:    "/media/" + name + "_medium.jpg",
+			ThumbnailURL: "/media/" + name + "_thumb.jpg",
+		}
+		created, err := imageRepo.Create(ctx, img, 3)
+		assert.NoError(t, err)
+		assert.True(t, created)
+		images = append(images, img)
+	}
+	created, err := imageRepo.Create(ctx, &models.ItemImage{ItemID: item.ID, URL: "/media/d.png"}, 3)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.True(t, images[0].IsPrimary)
+	assert.False(t, images[1].IsPrimary)
+	assert.Equal(t, 2, images[2].Position)
+
+	got, err := itemRepo.GetByID(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "/media/a.png", got.ImageURL)
+	assert.Equal(t, "/media/a_thumb.jpg", got.ThumbnailURL)
+
+	ok, err := imageRepo.Reorder(ctx, item.ID, []int{images[2].ID, images[0].ID})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = imageRepo.Reorder(ctx, item.ID, []int{images[2].ID, images[0].ID, images[1].ID})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = imageRepo.SetPrimary(ctx, item.ID, images[2].ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	listed, err := itemRepo.List(ctx, 0, 10, &models.ItemFilters{})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "/media/c_thumb.jpg", listed[0].ThumbnailURL)
+	assert.Equal(t, "/media/c.png", listed[0].ImageURL)
+
+	deleted, err := imageRepo.Delete(ctx, item.ID, images[2].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "/media/c.png", deleted.URL)
+
+	// a was moved to the front, so it is promoted when the primary image is removed
+	rest, err := imageRepo.ListByItem(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Len(t, rest, 2)
+	assert.Equal(t, images[0].ID, rest[0].ID)
+	assert.Equal(t, 0, rest[0].Position)
+	assert.True(t, rest[0].IsPrimary)
+	assert.Equal(t, 1, rest[1].Position)
+
+	got, err = itemRepo.GetByID(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "/media/a.png", got.ImageURL)
+
+	missing, err := imageRepo.Delete(ctx, item.ID, images[2].ID)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	ok, err = imageRepo.SetPrimary(ctx, item.ID, images[2].ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRefreshTokenRepo_RotationAndRevocation(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "tokenuser", "hashedpass")
+	assert.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	first := &models.RefreshToken{UserID: user.ID, FamilyID: "family-1", TokenHash: "hash-1", ExpiresAt: expiresAt}
+	assert.NoError(t, refreshTokenRepo.Create(ctx, first))
+	assert.NotZero(t, first.ID)
+
+	got, err := refreshTokenRepo.GetByHash(ctx, "hash-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+	assert.Equal(t, "family-1", got.FamilyID)
+	assert.True(t, expiresAt.Equal(got.ExpiresAt))
+	assert.Nil(t, got.UsedAt)
+
+	ok, err := refreshTokenRepo.MarkUsed(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// a token is exchanged only once
+	ok, err = refreshTokenRepo.MarkUsed(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	second := &models.RefreshToken{UserID: user.ID, FamilyID: "family-1", TokenHash: "hash-2", ExpiresAt: expiresAt}
+	assert.NoError(t, refreshTokenRepo.Create(ctx, second))
+	other := &models.RefreshToken{UserID: user.ID, FamilyID: "family-2", TokenHash: "hash-3", ExpiresAt: expiresAt}
+	assert.NoError(t, refreshTokenRepo.Create(ctx, other))
+
+	assert.NoError(t, refreshTokenRepo.RevokeFamily(ctx, "family-1"))
+
+	got, err = refreshTokenRepo.GetByHash(ctx, "hash-2")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	ok, err = refreshTokenRepo.MarkUsed(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	got, err = refreshTokenRepo.GetByHash(ctx, "hash-3")
+	assert.NoError(t, err)
+	assert.Nil(t, got.RevokedAt)
+
+	missing, err := refreshTokenRepo.GetByHash(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestUserRepo_RolesAndDisabling(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	first, err := userRepo.Create(ctx, "firstuser", "hashedpass")
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleUser, first.Role)
+	second, err := userRepo.Create(ctx, "seconduser", "hashedpass")
+	assert.NoError(t, err)
+
+	ok, err := userRepo.SetRoleByLogin(ctx, "firstuser", models.RoleAdmin)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = userRepo.SetRoleByLogin(ctx, "nobody", models.RoleAdmin)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = userRepo.SetRole(ctx, second.ID, models.RoleModerator)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = userRepo.SetDisabled(ctx, second.ID, true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	got, err := userRepo.GetByID(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleModerator, got.Role)
+	assert.NotNil(t, got.DisabledAt)
+
+	ok, err = userRepo.SetDisabled(ctx, second.ID, false)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	got, err = userRepo.GetByLogin(ctx, "seconduser")
+	assert.NoError(t, err)
+	assert.Nil(t, got.DisabledAt)
+
+	ok, err = userRepo.SetDisabled(ctx, second.ID+100, true)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	users, err := userRepo.List(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "firstuser", users[0].Login)
+	assert.Equal(t, models.RoleAdmin, users[0].Role)
+
+	total, err := userRepo.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	token := &models.RefreshToken{UserID: first.ID, FamilyID: "family-1", TokenHash: "hash-revoke", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, refreshTokenRepo.Create(ctx, token))
+	assert.NoError(t, refreshTokenRepo.RevokeUser(ctx, first.ID))
+	revoked, err := refreshTokenRepo.GetByHash(ctx, "hash-revoke")
+	assert.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+}
+
+func TestPasswordResetTokenRepo_SingleUse(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "resetuser", "hashedpass")
+	assert.NoError(t, err)
+
+	email, err := userRepo.GetEmail(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, email)
+	ok, err := userRepo.SetEmail(ctx, user.ID, "reset@example.com")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	email, err = userRepo.GetEmail(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "reset@example.com", email)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	first := &models.PasswordResetToken{UserID: user.ID, TokenHash: "reset-1", ExpiresAt: expiresAt}
+	assert.NoError(t, resetTokenRepo.Create(ctx, first))
+	second := &models.PasswordResetToken{UserID: user.ID, TokenHash: "reset-2", ExpiresAt: expiresAt}
+	assert.NoError(t, resetTokenRepo.Create(ctx, second))
+
+	got, err := resetTokenRepo.GetByHash(ctx, "reset-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+	assert.Equal(t, user.ID, got.UserID)
+	assert.True(t, expiresAt.Equal(got.ExpiresAt))
+
+	ok, err = resetTokenRepo.MarkUsed(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = resetTokenRepo.MarkUsed(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, resetTokenRepo.InvalidateUser(ctx, user.ID))
+	got, err = resetTokenRepo.GetByHash(ctx, "reset-2")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.UsedAt)
+
+	ok, err = userRepo.UpdatePassword(ctx, user.ID, "newhash")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	updated, err := userRepo.GetByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "newhash", updated.Hash)
+
+	// an upgraded hash does not overwrite a password changed in the meantime
+	ok, err = userRepo.ReplacePasswordHash(ctx, user.ID, "hashedpass", "upgradedhash")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = userRepo.ReplacePasswordHash(ctx, user.ID, "newhash", "upgradedhash")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	updated, err = userRepo.GetByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "upgradedhash", updated.Hash)
+
+	missing, err := resetTokenRepo.GetByHash(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestMFARepo_EnrollmentAndSingleUse(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "mfauser", "hashedpass")
+	assert.NoError(t, err)
+
+	missing, err := mfaRepo.GetTOTP(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	ok, err := mfaRepo.SaveTOTP(ctx, user.ID, "SECRET1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = mfaRepo.SaveTOTP(ctx, user.ID, "SECRET2")
+	assert.NoError(t, err)
+	assert.True(t, ok, "an unconfirmed secret is replaced")
+
+	// counters of an unconfirmed secret are not accepted
+	ok, err = mfaRepo.UseTOTPCounter(ctx, user.ID, 100)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = mfaRepo.EnableTOTP(ctx, user.ID, 100, []string{"hash-1", "hash-2"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = mfaRepo.EnableTOTP(ctx, user.ID, 100, []string{"hash-3"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	cred, err := mfaRepo.GetTOTP(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "SECRET2", cred.Secret)
+	assert.NotNil(t, cred.EnabledAt)
+	assert.Equal(t, int64(100), cred.LastCounter)
+
+	ok, err = mfaRepo.SaveTOTP(ctx, user.ID, "SECRET3")
+	assert.NoError(t, err)
+	assert.False(t, ok, "an enabled secret is kept")
+
+	ok, err = mfaRepo.UseTOTPCounter(ctx, user.ID, 100)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = mfaRepo.UseTOTPCounter(ctx, user.ID, 101)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mfaRepo.DeleteTOTP(ctx, user.ID))
+	missing, err = mfaRepo.GetTOTP(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	ok, err = mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAPIKeyRepo_Lifecycle(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "keyuser", "hashedpass")
+	assert.NoError(t, err)
+	other, err := userRepo.Create(ctx, "otheruser", "hashedpass")
+	assert.NoError(t, err)
+
+	expired := time.Now().Add(-time.Hour).UTC()
+	write := &models.APIKey{UserID: user.ID, Name: "sync", Prefix: "mk_aaaaaaaa", KeyHash: "key-1",
+		Scopes: []models.APIKeyScope{models.ScopeItemsWrite}}
+	ok, err := apiKeyRepo.Create(ctx, write, 2, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	old := &models.APIKey{UserID: user.ID, Name: "old", Prefix: "mk_bbbbbbbb", KeyHash: "key-2",
+		Scopes: []models.APIKeyScope{models.ScopeItemsRead}, ExpiresAt: &expired}
+	ok, err = apiKeyRepo.Create(ctx, old, 2, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// the expired key does not count against the limit, so a second active key fits and a third does not
+	second := &models.APIKey{UserID: user.ID, Name: "second", Prefix: "mk_cccccccc", KeyHash: "key-3",
+		Scopes: []models.APIKeyScope{models.ScopeItemsRead}}
+	ok, err = apiKeyRepo.Create(ctx, second, 2, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	third := &models.APIKey{UserID: user.ID, Name: "third", Prefix: "mk_dddddddd", KeyHash: "key-4",
+		Scopes: []models.APIKeyScope{models.ScopeItemsRead}}
+	ok, err = apiKeyRepo.Create(ctx, third, 2, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	got, err := apiKeyRepo.GetByHash(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "sync", got.Name)
+	assert.Equal(t, []models.APIKeyScope{models.ScopeItemsWrite}, got.Scopes)
+	assert.Nil(t, got.ExpiresAt)
+	assert.Nil(t, got.LastUsedAt)
+
+	assert.NoError(t, apiKeyRepo.Touch(ctx, write.ID))
+	got, err = apiKeyRepo.GetByHash(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.LastUsedAt)
+
+	// keys of other users cannot be revoked
+	ok, err = apiKeyRepo.Revoke(ctx, other.ID, write.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = apiKeyRepo.Revoke(ctx, user.ID, write.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	keys, err := apiKeyRepo.ListByUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "second", keys[0].Name)
+	assert.Equal(t, "old", keys[1].Name)
+
+	got, err = apiKeyRepo.GetByHash(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	missing, err := apiKeyRepo.GetByHash(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestIdentityRepo_LinkAndSignUp(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "linkeduser", "hashedpass")
+	assert.NoError(t, err)
+
+	identity := &models.UserIdentity{UserID: user.ID, Provider: "mock", Subject: "sub-1", Email: "linked@example.com"}
+	ok, err := identityRepo.Create(ctx, identity)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NotZero(t, identity.ID)
+
+	// a subject belongs to one user
+	ok, err = identityRepo.Create(ctx, &models.UserIdentity{UserID: user.ID, Provider: "mock", Subject: "sub-1"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	got, err := identityRepo.GetBySubject(ctx, "mock", "sub-1")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, got.UserID)
+	assert.Equal(t, "linked@example.com", got.Email)
+
+	missing, err := identityRepo.GetBySubject(ctx, "other", "sub-1")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	signedUp := &models.UserIdentity{Provider: "mock", Subject: "sub-2"}
+	newUser, err := identityRepo.CreateWithUser(ctx, "newuser", signedUp)
+	assert.NoError(t, err)
+	assert.Equal(t, newUser.ID, signedUp.UserID)
+	stored, err := userRepo.GetByLogin(ctx, "newuser")
+	assert.NoError(t, err)
+	assert.Empty(t, stored.Hash, "users of an identity have no password")
+
+	// a taken login leaves neither a user nor an identity behind
+	_, err = identityRepo.CreateWithUser(ctx, "newuser", &models.UserIdentity{Provider: "mock", Subject: "sub-3"})
+	assert.Error(t, err)
+	missing, err = identityRepo.GetBySubject(ctx, "mock", "sub-3")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	count, err := identityRepo.CountByUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	ok, err = identityRepo.Delete(ctx, newUser.ID, identity.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok, "identities of other users cannot be unlinked")
+	ok, err = identityRepo.Delete(ctx, user.ID, identity.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	identities, err := identityRepo.ListByUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, identities)
+}
+
+func TestOIDCStateRepo_ConsumeOnce(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	expired := &models.OIDCState{StateHash: "expired", Provider: "mock", Nonce: "n", CodeVerifier: "v", ExpiresAt: time.Now().Add(-time.Minute)}
+	assert.NoError(t, oidcStateRepo.Create(ctx, expired))
+
+	user, err := userRepo.Create(ctx, "stateuser", "hashedpass")
+	assert.NoError(t, err)
+	userID := user.ID
+
+	pending := &models.OIDCState{
+		StateHash: "state-1", Provider: "mock", Nonce: "nonce", CodeVerifier: "verifier", UserID: &userID, ExpiresAt: time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, oidcStateRepo.Create(ctx, pending))
+
+	// creating a state removes the expired ones
+	got, err := oidcStateRepo.Consume(ctx, "expired")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	got, err = oidcStateRepo.Consume(ctx, "state-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "verifier", got.CodeVerifier)
+	assert.Equal(t, userID, *got.UserID)
+	assert.WithinDuration(t, pending.ExpiresAt, got.ExpiresAt, time.Second)
+
+	got, err = oidcStateRepo.Consume(ctx, "state-1")
+	assert.NoError(t, err)
+	assert.Nil(t, got, "a state is consumed once")
+}
+
+func TestSessionRepo_ListAndRevoke(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "sessionuser", "hashedpass")
+	assert.NoError(t, err)
+	other, err := userRepo.Create(ctx, "otheruser", "hashedpass")
+	assert.NoError(t, err)
+
+	laptop := &models.Session{UserID: user.ID, FamilyID: "family-laptop", UserAgent: "Firefox", IP: "192.0.2.1"}
+	assert.NoError(t, sessionRepo.Create(ctx, laptop))
+	assert.NotZero(t, laptop.ID)
+	phone := &models.Session{UserID: user.ID, FamilyID: "family-phone", UserAgent: "Safari", IP: "198.51.100.7"}
+	assert.NoError(t, sessionRepo.Create(ctx, phone))
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	token := &models.RefreshToken{UserID: user.ID, FamilyID: "family-phone", TokenHash: "hash-phone", ExpiresAt: expiresAt}
+	assert.NoError(t, refreshTokenRepo.Create(ctx, token))
+
+	got, err := sessionRepo.GetByFamily(ctx, "family-laptop")
+	assert.NoError(t, err)
+	assert.Equal(t, laptop.ID, got.ID)
+	assert.Equal(t, "Firefox", got.UserAgent)
+
+	assert.NoError(t, sessionRepo.Touch(ctx, phone.ID))
+	sessions, err := sessionRepo.ListActive(ctx, user.ID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, phone.ID, sessions[0].ID)
+
+	// batched uses move the last use of a session forward but never back
+	later := time.Now().Add(time.Minute).UTC()
+	assert.NoError(t, sessionRepo.TouchMany(ctx, map[int]time.Time{laptop.ID: later, phone.ID: time.Now().Add(-time.Hour)}))
+	got, err = sessionRepo.GetByID(ctx, laptop.ID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, later, got.LastSeenAt, time.Second)
+	got, err = sessionRepo.GetByID(ctx, phone.ID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), got.LastSeenAt, time.Minute)
+
+	// sessions of other users are not ended
+	ok, err := sessionRepo.Revoke(ctx, other.ID, phone.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = sessionRepo.Revoke(ctx, user.ID, phone.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = sessionRepo.Revoke(ctx, user.ID, phone.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// the refresh tokens of an ended session stop working
+	stored, err := refreshTokenRepo.GetByHash(ctx, "hash-phone")
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	got, err = sessionRepo.GetByID(ctx, phone.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	sessions, err = sessionRepo.ListActive(ctx, user.ID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	// revoking all refresh tokens of a user ends their sessions
+	assert.NoError(t, refreshTokenRepo.RevokeUser(ctx, user.ID))
+	got, err = sessionRepo.GetByID(ctx, laptop.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	missing, err := sessionRepo.GetByID(ctx, -1)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestAuditRepo_Record(t *testing.T) {
+	cleanTables(t)
+
+	ctx := context.Background()
+
+	user, err := userRepo.Create(ctx, "audituser", "hashedpass")
+	assert.NoError(t, err)
+
+	entry := &models.AuditEntry{Event: models.AuditAccountLocked, UserID: &user.ID, Login: "audituser", IP: "192.0.2.1", Details: "locked"}
+	assert.NoError(t, auditRepo.Record(ctx, entry))
+	assert.NotZero(t, entry.ID)
+	assert.False(t, entry.CreatedAt.IsZero())
+
+	anonymous := &models.AuditEntry{Event: models.AuditIPLocked, IP: "192.0.2.1"}
+	assert.NoError(t, auditRepo.Record(ctx, anonymous))
+
+	// entries outlive the users they mention
+	_, err = db.Exec(ctx, "DELETE FROM users WHERE id = $1", user.ID)
+	assert.NoError(t, err)
+
+	var count int
+	err = db.QueryRow(ctx, "SELECT count(*) FROM audit_log WHERE ip = '192.0.2.1' AND user_id IS NULL").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,163 @@
+// Package repository provides access to the sessions table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SessionRepo handles database operations related to login sessions
+type SessionRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewSessionRepo creates a new instance of SessionRepo
+func NewSessionRepo(db *pgxpool.Pool) *SessionRepo {
+	return &SessionRepo{DB: db}
+}
+
+// Create inserts a new session and sets its ID, CreatedAt and LastSeenAt
+func (r *SessionRepo) Create(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (user_id, family_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_seen_at
+	`
+
+	return r.DB.QueryRow(ctx, query, session.UserID, session.FamilyID, session.UserAgent, session.IP).
+		Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+}
+
+// GetByID retrieves a session by its ID, ended sessions included
+func (r *SessionRepo) GetByID(ctx context.Context, id int) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, family_id, user_agent, ip, created_at, last_seen_at, revoked_at
+		FROM sessions
+		WHERE id = $1
+	`
+
+	return r.get(ctx, query, id)
+}
+
+// GetByFamily retrieves the session of a refresh token family, ended sessions included
+func (r *SessionRepo) GetByFamily(ctx context.Context, familyID string) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, family_id, user_agent, ip, created_at, last_seen_at, revoked_at
+		FROM sessions
+		WHERE family_id = $1
+	`
+
+	return r.get(ctx, query, familyID)
+}
+
+// ListActive retrieves the sessions of a user that were not ended and were seen after since, most recently seen first
+func (r *SessionRepo) ListActive(ctx context.Context, userID int, since time.Time) ([]*models.Session, error) {
+	query := `
+		SELECT id, user_id, family_id, user_agent, ip, created_at, last_seen_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+		ORDER BY last_seen_at DESC, id DESC
+	`
+
+	rows, err := r.DB.Query(ctx, query, userID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records that a session was used
+func (r *SessionRepo) Touch(ctx context.Context, id int) error {
+	_, err := r.DB.Exec(ctx, `UPDATE sessions SET last_seen_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// TouchMany records the last uses of sessions by session ID, a use older than the recorded one is ignored
+func (r *SessionRepo) TouchMany(ctx context.Context, seen map[int]time.Time) error {
+	ids := make([]int32, 0, len(seen))
+	times := make([]time.Time, 0, len(seen))
+	for id, at := range seen {
+		ids = append(ids, int32(id)) // #nosec G115 -- session IDs are SERIAL
+		times = append(times, at.UTC())
+	}
+
+	query := `
+		UPDATE sessions AS s
+		SET last_seen_at = v.seen_at
+		FROM unnest($1::int[], $2::timestamp[]) AS v(id, seen_at)
+		WHERE s.id = v.id AND s.last_seen_at < v.seen_at
+	`
+
+	_, err := r.DB.Exec(ctx, query, ids, times)
+	return err
+}
+
+// Revoke ends a session of a user and revokes the refresh tokens of its family,
+// it reports false when the user has no such session that was not ended yet
+func (r *SessionRepo) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var familyID string
+	err = tx.QueryRow(ctx, `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		RETURNING family_id
+	`, id, userID).Scan(&familyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`, familyID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// get retrieves the session selected by query
+func (r *SessionRepo) get(ctx context.Context, query string, arg any) (*models.Session, error) {
+	session, err := scanSession(r.DB.QueryRow(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// scanSession scans a row of the sessions columns in table order
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.FamilyID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
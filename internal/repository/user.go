@@ -38,13 +38,14 @@ func (r *UserRepo) Create(ctx context.Context, login, hash string) (*models.User
 		ID:    id,
 		Login: login,
 		Hash:  hash,
+		Role:  models.RoleUser,
 	}, nil
 }
 
 // GetByLogin retrieves a user by their login
 func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*models.User, error) {
 	query := `
-		SELECT id, login, password_hash
+		SELECT id, login, password_hash, role, disabled_at
 		FROM users
 		WHERE login = $1
 	`
@@ -52,7 +53,7 @@ func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*models.User,
 	row := r.DB.QueryRow(ctx, query, login)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Login, &user.Hash)
+	err := row.Scan(&user.ID, &user.Login, &user.Hash, &user.Role, &user.DisabledAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -62,3 +63,130 @@ func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*models.User,
 
 	return &user, nil
 }
+
+// GetByID retrieves a user by their ID
+func (r *UserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
+	query := `
+		SELECT id, login, password_hash, role, disabled_at
+		FROM users
+		WHERE id = $1
+	`
+
+	row := r.DB.QueryRow(ctx, query, id)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Login, &user.Hash, &user.Role, &user.DisabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// List retrieves a page of users ordered by ID
+func (r *UserRepo) List(ctx context.Context, offset, limit int) ([]*models.User, error) {
+	query := `
+		SELECT id, login, password_hash, role, disabled_at
+		FROM users
+		ORDER BY id
+		OFFSET $1 LIMIT $2
+	`
+
+	rows, err := r.DB.Query(ctx, query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Login, &user.Hash, &user.Role, &user.DisabledAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Count returns the number of users
+func (r *UserRepo) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.DB.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+// UpdatePassword replaces the password hash of a user, it reports false when the user does not exist
+func (r *UserRepo) UpdatePassword(ctx context.Context, id int, hash string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE users SET password_hash = $2 WHERE id = $1", id, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetEmail returns the email of a user, it is empty when the user gave none or does not exist
+func (r *UserRepo) GetEmail(ctx context.Context, id int) (string, error) {
+	var email string
+	err := r.DB.QueryRow(ctx, "SELECT email FROM users WHERE id = $1", id).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return email, err
+}
+
+// SetEmail replaces the email of a user, it reports false when the user does not exist
+func (r *UserRepo) SetEmail(ctx context.Context, id int, email string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE users SET email = $2 WHERE id = $1", id, email)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReplacePasswordHash replaces the password hash of a user while it is still old, it reports false when the user
+// does not exist or the hash was changed in the meantime
+func (r *UserRepo) ReplacePasswordHash(ctx context.Context, id int, old, hash string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2", id, old, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetRole changes the role of a user, it reports false when the user does not exist
+func (r *UserRepo) SetRole(ctx context.Context, id int, role models.Role) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE users SET role = $2 WHERE id = $1", id, role)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetRoleByLogin changes the role of the user with a login, it reports false when the user does not exist
+func (r *UserRepo) SetRoleByLogin(ctx context.Context, login string, role models.Role) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE users SET role = $2 WHERE login = $1", login, role)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetDisabled disables or re-enables a user, it reports false when the user does not exist
+func (r *UserRepo) SetDisabled(ctx context.Context, id int, disabled bool) (bool, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END
+		WHERE id = $1
+	`
+
+	tag, err := r.DB.Exec(ctx, query, id, disabled)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
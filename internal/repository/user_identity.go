@@ -0,0 +1,138 @@
+// Package repository provides access to the user_identities table in the database
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdentityRepo handles database operations related to identities of external OpenID providers
+type IdentityRepo struct {
+	DB *pgxpool.Pool
+}
+
+// NewIdentityRepo creates a new instance of IdentityRepo
+func NewIdentityRepo(db *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{DB: db}
+}
+
+// GetBySubject retrieves the identity of a subject at a provider
+func (r *IdentityRepo) GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	identity, err := scanIdentity(r.DB.QueryRow(ctx, query, provider, subject))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+// ListByUser retrieves the identities of a user, oldest first
+func (r *IdentityRepo) ListByUser(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// Create links an identity to its user and sets its ID and CreatedAt,
+// it reports false when the subject is already linked to a user
+func (r *IdentityRepo) Create(ctx context.Context, identity *models.UserIdentity) (bool, error) {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := r.DB.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateWithUser creates a user without a password together with its first identity, the user ID is set on identity
+func (r *IdentityRepo) CreateWithUser(ctx context.Context, login string, identity *models.UserIdentity) (*models.User, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	user := models.User{Login: login, Role: models.RoleUser}
+	if err := tx.QueryRow(ctx, `INSERT INTO users (login, password_hash) VALUES ($1, '') RETURNING id`, login).Scan(&user.ID); err != nil {
+		return nil, err
+	}
+
+	identity.UserID = user.ID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, tx.Commit(ctx)
+}
+
+// CountByUser returns the number of identities of a user
+func (r *IdentityRepo) CountByUser(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRow(ctx, `SELECT count(*) FROM user_identities WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+// Delete unlinks an identity of a user, it reports false when the user has no such identity
+func (r *IdentityRepo) Delete(ctx context.Context, userID, id int) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// scanIdentity scans a row of the user_identities columns in table order
+func scanIdentity(row pgx.Row) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,154 @@
+// Package service contains business logic for user and content moderation
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// Errors returned by AdminService
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrInvalidRole    = errors.New("unknown role, use user, moderator or admin")
+	ErrOwnAccount     = errors.New("you cannot change your own account")
+	ErrRoleNotAllowed = errors.New("insufficient role")
+)
+
+// AdminUserRepository is an interface that contains the user repository methods used for user management
+type AdminUserRepository interface {
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	List(ctx context.Context, offset, limit int) ([]*models.User, error)
+	Count(ctx context.Context) (int, error)
+	SetRole(ctx context.Context, id int, role models.Role) (bool, error)
+	SetDisabled(ctx context.Context, id int, disabled bool) (bool, error)
+}
+
+// UserTokenRevoker revokes every refresh token of a user
+type UserTokenRevoker interface {
+	RevokeUser(ctx context.Context, userID int) error
+}
+
+// AdminService lets moderators and admins manage users and content. Every method checks the current role
+// of the acting user in the database, so a demoted or disabled user loses access before their token expires
+type AdminService struct {
+	UserRepo  AdminUserRepository
+	ItemRepo  ItemRepository
+	TokenRepo UserTokenRevoker
+}
+
+// NewAdminService creates a new instance of AdminService
+func NewAdminService(userRepo AdminUserRepository, itemRepo ItemRepository, tokenRepo UserTokenRevoker) *AdminService {
+	return &AdminService{UserRepo: userRepo, ItemRepo: itemRepo, TokenRepo: tokenRepo}
+}
+
+// ListUsers returns a page of users, only admins may list users
+func (s *AdminService) ListUsers(ctx context.Context, actorID, page, limit int) (*models.UserPage, error) {
+	if err := s.authorize(ctx, actorID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	users, err := s.UserRepo.List(ctx, (page-1)*limit, limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.UserRepo.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	return &models.UserPage{
+		Users:      users,
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit,
+	}, nil
+}
+
+// SetUserRole changes the role of another user, only admins may change roles
+func (s *AdminService) SetUserRole(ctx context.Context, actorID, userID int, role models.Role) (*models.User, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if err := s.authorize(ctx, actorID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if actorID == userID {
+		return nil, ErrOwnAccount
+	}
+
+	ok, err := s.UserRepo.SetRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.UserRepo.GetByID(ctx, userID)
+}
+
+// SetUserDisabled disables or re-enables another user, only admins may do it.
+// Disabling revokes the user's refresh tokens, so their session ends when the access token expires
+func (s *AdminService) SetUserDisabled(ctx context.Context, actorID, userID int, disabled bool) (*models.User, error) {
+	if err := s.authorize(ctx, actorID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if actorID == userID {
+		return nil, ErrOwnAccount
+	}
+
+	ok, err := s.UserRepo.SetDisabled(ctx, userID, disabled)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if disabled {
+		if err := s.TokenRepo.RevokeUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return s.UserRepo.GetByID(ctx, userID)
+}
+
+// RemoveItem deletes any item regardless of its author, moderators and admins may remove items
+func (s *AdminService) RemoveItem(ctx context.Context, actorID, itemID int) error {
+	if err := s.authorize(ctx, actorID, models.RoleModerator); err != nil {
+		return err
+	}
+
+	item, err := s.ItemRepo.GetByID(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrItemNotFound
+	}
+	return s.ItemRepo.Delete(ctx, itemID)
+}
+
+// authorize checks that the acting user exists, is enabled and has a role including role
+func (s *AdminService) authorize(ctx context.Context, actorID int, role models.Role) error {
+	actor, err := s.UserRepo.GetByID(ctx, actorID)
+	if err != nil {
+		return err
+	}
+	if actor == nil || actor.DisabledAt != nil || !actor.Role.Includes(role) {
+		return fmt.Errorf("%w: %s role required", ErrRoleNotAllowed, role)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+var (
+	testAdmin     = &models.User{ID: 1, Login: "admin", Role: models.RoleAdmin}
+	testModerator = &models.User{ID: 2, Login: "moderator", Role: models.RoleModerator}
+)
+
+func TestAdminService_ListUsers(t *testing.T) {
+	userRepo := new(MockUserRepo)
+	userRepo.On("GetByID", mock.Anything, 1).Return(testAdmin, nil)
+	userRepo.On("List", mock.Anything, 10, 10).Return([]*models.User{testModerator}, nil)
+	userRepo.On("Count", mock.Anything).Return(11, nil)
+
+	service := NewAdminService(userRepo, new(MockItemRepo), new(MockRefreshTokenRepo))
+	page, err := service.ListUsers(context.Background(), 1, 2, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, []*models.User{testModerator}, page.Users)
+	assert.Equal(t, 2, page.Page)
+	assert.Equal(t, 10, page.Limit)
+	assert.Equal(t, 11, page.Total)
+	assert.Equal(t, 2, page.TotalPages)
+	userRepo.AssertExpectations(t)
+
+	userRepo = new(MockUserRepo)
+	userRepo.On("GetByID", mock.Anything, 2).Return(testModerator, nil)
+	service = NewAdminService(userRepo, new(MockItemRepo), new(MockRefreshTokenRepo))
+	_, err = service.ListUsers(context.Background(), 2, 1, 10)
+	require.ErrorIs(t, err, ErrRoleNotAllowed)
+}
+
+func TestAdminService_SetUserRole(t *testing.T) {
+	disabledAt := time.Now()
+
+	tests := []struct {
+		name      string
+		actorID   int
+		userID    int
+		role      models.Role
+		setupMock func(*MockUserRepo)
+		wantErr   error
+	}{
+		{
+			name:    "admin promotes a user",
+			actorID: 1,
+			userID:  3,
+			role:    models.RoleModerator,
+			setupMock: func(m *MockUserRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(testAdmin, nil)
+				m.On("SetRole", mock.Anything, 3, models.RoleModerator).Return(true, nil)
+				m.On("GetByID", mock.Anything, 3).Return(&models.User{ID: 3, Role: models.RoleModerator}, nil)
+			},
+		},
+		{
+			name:      "unknown role",
+			actorID:   1,
+			userID:    3,
+			role:      "owner",
+			setupMock: func(_ *MockUserRepo) {},
+			wantErr:   ErrInvalidRole,
+		},
+		{
+			name:    "moderator may not change roles",
+			actorID: 2,
+			userID:  3,
+			role:    models.RoleModerator,
+			setupMock: func(m *MockUserRepo) {
+				m.On("GetByID", mock.Anything, 2).Return(testModerator, nil)
+			},
+			wantErr: ErrRoleNotAllowed,
+		},
+		{
+			name:    "disabled admin",
+			actorID: 1,
+			userID:  3,
+			role:    models.RoleModerator,
+			setupMock: func(m *MockUserRepo) {
+				m.On("GetByID", mock.Anything, 1).
+					Return(&models.User{ID: 1, Role: models.RoleAdmin, DisabledAt: &disabledAt}, nil)
+			},
+			wantErr: ErrRoleNotAllowed,
+		},
+		{
+			name:    "own account",
+			actorID: 1,
+			userID:  1,
+			role:    models.RoleUser,
+			setupMock: func(m *MockUserRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(testAdmin, nil)
+			},
+			wantErr: ErrOwnAccount,
+		},
+		{
+			name:    "user not found",
+			actorID: 1,
+			userID:  3,
+			role:    models.RoleModerator,
+			setupMock: func(m *MockUserRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(testAdmin, nil)
+				m.On("SetRole", mock.Anything, 3, models.RoleModerator).Return(false, nil)
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			tt.setupMock(userRepo)
+
+			service := NewAdminService(userRepo, new(MockItemRepo), new(MockRefreshTokenRepo))
+			user, err := service.SetUserRole(context.Background(), tt.actorID, tt.userID, tt.role)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.role, user.Role)
+			}
+
+			userRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminService_SetUserDisabled(t *testing.T) {
+	disabledAt := time.Now()
+
+	userRepo := new(MockUserRepo)
+	tokenRepo := new(MockRefreshTokenRepo)
+	userRepo.On("GetByID", mock.Anything, 1).Return(testAdmin, nil)
+	userRepo.On("SetDisabled", mock.Anything, 3, true).Return(true, nil).Once()
+	tokenRepo.On("RevokeUser", mock.Anything, 3).Return(nil).Once()
+	userRepo.On("GetByID", mock.Anything, 3).Return(&models.User{ID: 3, DisabledAt: &disabledAt}, nil).Once()
+
+	service := NewAdminService(userRepo, new(MockItemRepo), tokenRepo)
+	user, err := service.SetUserDisabled(context.Background(), 1, 3, true)
+	require.NoError(t, err)
+	assert.NotNil(t, user.DisabledAt)
+
+	userRepo.On("SetDisabled", mock.Anything, 3, false).Return(true, nil).Once()
+	userRepo.On("GetByID", mock.Anything, 3).Return(&models.User{ID: 3}, nil).Once()
+	user, err = service.SetUserDisabled(context.Background(), 1, 3, false)
+	require.NoError(t, err)
+	assert.Nil(t, user.DisabledAt)
+
+	_, err = service.SetUserDisabled(context.Background(), 1, 1, true)
+	require.ErrorIs(t, err, ErrOwnAccount)
+
+	userRepo.AssertExpectations(t)
+	tokenRepo.AssertExpectations(t)
+}
+
+func TestAdminService_RemoveItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		actor     *models.User
+		setupMock func(*MockItemRepo)
+		wantErr   error
+	}{
+		{
+			name:  "moderator removes an item of another author",
+			actor: testModerator,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 5).Return(&models.Item{ID: 5, AuthorID: 9}, nil)
+				m.On("Delete", mock.Anything, 5).Return(nil)
+			},
+		},
+		{
+			name:  "admin removes an item",
+			actor: testAdmin,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 5).Return(&models.Item{ID: 5, AuthorID: 9}, nil)
+				m.On("Delete", mock.Anything, 5).Return(nil)
+			},
+		},
+		{
+			name:      "user may not remove items",
+			actor:     &models.User{ID: 3, Role: models.RoleUser},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   ErrRoleNotAllowed,
+		},
+		{
+			name:  "item not found",
+			actor: testModerator,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 5).Return(nil, nil)
+			},
+			wantErr: ErrItemNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			userRepo.On("GetByID", mock.Anything, tt.actor.ID).Return(tt.actor, nil)
+			itemRepo := new(MockItemRepo)
+			tt.setupMock(itemRepo)
+
+			service := NewAdminService(userRepo, itemRepo, new(MockRefreshTokenRepo))
+			err := service.RemoveItem(context.Background(), tt.actor.ID, 5)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			itemRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package service contains business logic for personal API keys
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognize
+const apiKeyPrefix = "mk_"
+
+// apiKeyVisibleChars is the number of random characters of a key kept in its visible prefix
+const apiKeyVisibleChars = 8
+
+// apiKeyTouchInterval limits how often the last use of a key is written
+const apiKeyTouchInterval = time.Minute
+
+// Errors returned by AuthService for API keys
+var (
+	ErrInvalidAPIKey        = errors.New("invalid or expired api key")
+	ErrAPIKeyNotFound       = errors.New("api key not found")
+	ErrInvalidAPIKeyRequest = errors.New("invalid api key request")
+	ErrTooManyAPIKeys       = errors.New("too many api keys, revoke one first")
+)
+
+// CreateAPIKey creates an API key of a user with scopes, expiresAt is optional. The key is returned only here,
+// only its hash and its visible prefix are stored
+func (s *AuthService) CreateAPIKey(
+	ctx context.Context, userID int, name string, scopes []models.APIKeyScope, expiresAt *time.Time,
+) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIKeyRequest)
+	}
+	if len(name) > constants.MaxLenAPIKeyName {
+		return nil, "", fmt.Errorf("%w: name too long (max %d characters)", ErrInvalidAPIKeyRequest, constants.MaxLenAPIKeyName)
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyRequest)
+	}
+	for _, scope := range scopes {
+		if !scope.Valid() {
+			return nil, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyRequest, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return nil, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyRequest)
+	}
+
+	if _, err := s.activeUser(ctx, userID); err != nil {
+		return nil, "", err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", errors.New("failed to generate api key")
+	}
+	secret := apiKeyPrefix + token
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:len(apiKeyPrefix)+apiKeyVisibleChars],
+		KeyHash:   hashRefreshToken(secret),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	ok, err := s.KeyRepo.Create(ctx, key, constants.MaxAPIKeys, s.now())
+	if err != nil {
+		return nil, "", errors.New("failed to store api key")
+	}
+	if !ok {
+		return nil, "", ErrTooManyAPIKeys
+	}
+	return key, secret, nil
+}
+
+// ListAPIKeys returns the API keys of a user that were not revoked, expired keys included
+func (s *AuthService) ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	keys, err := s.KeyRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key of a user, keys of other users are reported as not found
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	ok, err := s.KeyRepo.Revoke(ctx, userID, id)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the key and its user, keys that are revoked, expired or belong to a disabled user
+// are refused with ErrInvalidAPIKey
+func (s *AuthService) AuthenticateAPIKey(ctx context.Context, secret string) (*models.User, *models.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.KeyRepo.GetByHash(ctx, hashRefreshToken(secret))
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	now := s.now()
+	if key == nil || key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.KeyRepo.Touch(ctx, key.ID); err != nil {
+			return nil, nil, errors.New("database error")
+		}
+	}
+
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, key, nil
+}
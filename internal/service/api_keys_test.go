@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+type MockAPIKeyRepo struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepo) Create(ctx context.Context, key *models.APIKey, maxActive int, now time.Time) (bool, error) {
+	args := m.Called(ctx, key, maxActive, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	args := m.Called(ctx, hash)
+	key, _ := args.Get(0).(*models.APIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) ListByUser(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	args := m.Called(ctx, userID)
+	keys, _ := args.Get(0).([]*models.APIKey)
+	return keys, args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) Touch(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestAuthService_CreateAPIKey(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		keyName   string
+		scopes    []models.APIKeyScope
+		expiresAt *time.Time
+		setupMock func(*MockUserRepo, *MockAPIKeyRepo)
+		wantErr   error
+	}{
+		{
+			name:      "key with expiry",
+			keyName:   "sync script",
+			scopes:    []models.APIKeyScope{models.ScopeItemsWrite},
+			expiresAt: &future,
+			setupMock: func(u *MockUserRepo, k *MockAPIKeyRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller"}, nil)
+				k.On("Create", mock.Anything, mock.MatchedBy(func(key *models.APIKey) bool {
+					return key.UserID == 1 && key.Name == "sync script" && key.ExpiresAt.Equal(future) &&
+						strings.HasPrefix(key.Prefix, "mk_") && len(key.Prefix) == 11 && len(key.KeyHash) == 64
+				}), constants.MaxAPIKeys, now).Return(true, nil)
+			},
+		},
+		{
+			name:      "missing name",
+			keyName:   " ",
+			scopes:    []models.APIKeyScope{models.ScopeItemsRead},
+			setupMock: func(_ *MockUserRepo, _ *MockAPIKeyRepo) {},
+			wantErr:   ErrInvalidAPIKeyRequest,
+		},
+		{
+			name:      "unknown scope",
+			keyName:   "script",
+			scopes:    []models.APIKeyScope{"users:write"},
+			setupMock: func(_ *MockUserRepo, _ *MockAPIKeyRepo) {},
+			wantErr:   ErrInvalidAPIKeyRequest,
+		},
+		{
+			name:      "no scopes",
+			keyName:   "script",
+			setupMock: func(_ *MockUserRepo, _ *MockAPIKeyRepo) {},
+			wantErr:   ErrInvalidAPIKeyRequest,
+		},
+		{
+			name:      "expiry in the past",
+			keyName:   "script",
+			scopes:    []models.APIKeyScope{models.ScopeItemsRead},
+			expiresAt: &past,
+			setupMock: func(_ *MockUserRepo, _ *MockAPIKeyRepo) {},
+			wantErr:   ErrInvalidAPIKeyRequest,
+		},
+		{
+			name:    "too many keys",
+			keyName: "script",
+			scopes:  []models.APIKeyScope{models.ScopeItemsRead},
+			setupMock: func(u *MockUserRepo, k *MockAPIKeyRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller"}, nil)
+				k.On("Create", mock.Anything, mock.Anything, constants.MaxAPIKeys, now).Return(false, nil)
+			},
+			wantErr: ErrTooManyAPIKeys,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			keyRepo := new(MockAPIKeyRepo)
+			tt.setupMock(userRepo, keyRepo)
+
+			authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), keyRepo, noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+			authService.now = func() time.Time { return now }
+
+			key, secret, err := authService.CreateAPIKey(context.Background(), 1, tt.keyName, tt.scopes, tt.expiresAt)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(secret, key.Prefix))
+				assert.Equal(t, hashRefreshToken(secret), key.KeyHash)
+			}
+
+			userRepo.AssertExpectations(t)
+			keyRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_AuthenticateAPIKey(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	recently := now.Add(-10 * time.Second)
+	expired := now.Add(-time.Second)
+	secret := "mk_test-key"
+	hash := hashRefreshToken(secret)
+	seller := &models.User{ID: 1, Login: "seller", Role: models.RoleAdmin}
+
+	tests := []struct {
+		name      string
+		secret    string
+		setupMock func(*MockUserRepo, *MockAPIKeyRepo)
+		wantErr   error
+	}{
+		{
+			name:   "valid key is touched",
+			secret: secret,
+			setupMock: func(u *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(&models.APIKey{ID: 5, UserID: 1}, nil)
+				u.On("GetByID", mock.Anything, 1).Return(seller, nil)
+				k.On("Touch", mock.Anything, 5).Return(nil)
+			},
+		},
+		{
+			name:   "recently used key is not touched again",
+			secret: secret,
+			setupMock: func(u *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(&models.APIKey{ID: 5, UserID: 1, LastUsedAt: &recently}, nil)
+				u.On("GetByID", mock.Anything, 1).Return(seller, nil)
+			},
+		},
+		{
+			name:      "not an api key",
+			secret:    "token",
+			setupMock: func(_ *MockUserRepo, _ *MockAPIKeyRepo) {},
+			wantErr:   ErrInvalidAPIKey,
+		},
+		{
+			name:   "unknown key",
+			secret: secret,
+			setupMock: func(_ *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(nil, nil)
+			},
+			wantErr: ErrInvalidAPIKey,
+		},
+		{
+			name:   "revoked key",
+			secret: secret,
+			setupMock: func(_ *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(&models.APIKey{ID: 5, UserID: 1, RevokedAt: &recently}, nil)
+			},
+			wantErr: ErrInvalidAPIKey,
+		},
+		{
+			name:   "expired key",
+			secret: secret,
+			setupMock: func(_ *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(&models.APIKey{ID: 5, UserID: 1, ExpiresAt: &expired}, nil)
+			},
+			wantErr: ErrInvalidAPIKey,
+		},
+		{
+			name:   "disabled user",
+			secret: secret,
+			setupMock: func(u *MockUserRepo, k *MockAPIKeyRepo) {
+				k.On("GetByHash", mock.Anything, hash).Return(&models.APIKey{ID: 5, UserID: 1}, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, DisabledAt: &recently}, nil)
+			},
+			wantErr: ErrInvalidAPIKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			keyRepo := new(MockAPIKeyRepo)
+			tt.setupMock(userRepo, keyRepo)
+
+			authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), keyRepo, noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+			authService.now = func() time.Time { return now }
+
+			user, key, err := authService.AuthenticateAPIKey(context.Background(), tt.secret)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "seller", user.Login)
+				assert.Equal(t, 5, key.ID)
+			}
+
+			userRepo.AssertExpectations(t)
+			keyRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_RevokeAPIKey(t *testing.T) {
+	keyRepo := new(MockAPIKeyRepo)
+	authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), keyRepo, noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+
+	keyRepo.On("Revoke", mock.Anything, 1, 5).Return(true, nil).Once()
+	require.NoError(t, authService.RevokeAPIKey(context.Background(), 1, 5))
+
+	keyRepo.On("Revoke", mock.Anything, 1, 6).Return(false, nil).Once()
+	require.ErrorIs(t, authService.RevokeAPIKey(context.Background(), 1, 6), ErrAPIKeyNotFound)
+
+	keyRepo.On("Revoke", mock.Anything, 1, 7).Return(false, errors.New("connection lost")).Once()
+	require.EqualError(t, authService.RevokeAPIKey(context.Background(), 1, 7), "database error")
+
+	keyRepo.AssertExpectations(t)
+}
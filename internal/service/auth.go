@@ -3,11 +3,17 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"net/mail"
 	"regexp"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
 
 	"github.com/artnikel/marketplace/internal/config"
 	"github.com/artnikel/marketplace/internal/constants"
@@ -18,90 +24,662 @@ import (
 // AuthServiceInterface is an interface that contains method for middleware
 type AuthServiceInterface interface {
 	ParseToken(token string) (*mjwt.Claims, error)
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.User, *models.APIKey, error)
+	SessionActive(ctx context.Context, id int) (bool, error)
 }
 
 // UserRepository is an interface that contains user repository methods
 type UserRepository interface {
 	Create(ctx context.Context, login, hash string) (*models.User, error)
 	GetByLogin(ctx context.Context, login string) (*models.User, error)
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	UpdatePassword(ctx context.Context, id int, hash string) (bool, error)
+	GetEmail(ctx context.Context, id int) (string, error)
+	SetEmail(ctx context.Context, id int, email string) (bool, error)
+	ReplacePasswordHash(ctx context.Context, id int, old, hash string) (bool, error)
+}
+
+// BreachedPasswords is a list of passwords known from data breaches
+type BreachedPasswords interface {
+	Count(password string) (int, error)
+}
+
+// PasswordHasher hashes new passwords and checks passwords against stored hashes of any supported algorithm
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// RefreshTokenRepository is an interface that contains refresh token repository methods
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	MarkUsed(ctx context.Context, id int) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID int) error
+}
+
+// PasswordResetRepository is an interface that contains password reset token repository methods
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error)
+	MarkUsed(ctx context.Context, id int) (bool, error)
+	InvalidateUser(ctx context.Context, userID int) error
+}
+
+// MFARepository is an interface that contains TOTP credential and recovery code repository methods
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID int) (*models.TOTPCredential, error)
+	SaveTOTP(ctx context.Context, userID int, secret string) (bool, error)
+	EnableTOTP(ctx context.Context, userID int, counter int64, codeHashes []string) (bool, error)
+	UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int) error
+}
+
+// APIKeyRepository is an interface that contains API key repository methods
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey, maxActive int, now time.Time) (bool, error)
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	ListByUser(ctx context.Context, userID int) ([]*models.APIKey, error)
+	Revoke(ctx context.Context, userID, id int) (bool, error)
+	Touch(ctx context.Context, id int) error
 }
 
+// SessionRepository is an interface that contains login session repository methods
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetByID(ctx context.Context, id int) (*models.Session, error)
+	GetByFamily(ctx context.Context, familyID string) (*models.Session, error)
+	ListActive(ctx context.Context, userID int, since time.Time) ([]*models.Session, error)
+	Touch(ctx context.Context, id int) error
+	TouchMany(ctx context.Context, seen map[int]time.Time) error
+	Revoke(ctx context.Context, userID, id int) (bool, error)
+}
+
+// AuditLog records security events
+type AuditLog interface {
+	Record(ctx context.Context, entry *models.AuditEntry) error
+}
+
+// Mailer delivers messages to the email addresses of users
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// refreshTokenBytes is the amount of randomness in a refresh token and a token family ID
+const refreshTokenBytes = 32
+
+// Errors returned by AuthService when a token cannot be exchanged, the account was disabled or a password cannot be changed
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, please log in again")
+	ErrAccountDisabled     = errors.New("account is disabled")
+	ErrWrongPassword       = errors.New("current password is incorrect")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+	ErrInvalidEmail        = errors.New("invalid email address")
+	ErrPasswordPolicy      = errors.New("password does not meet the requirements")
+	ErrTooManyAttempts     = errors.New("too many failed login attempts, try again later")
+)
+
+// TooManyAttemptsError is returned while a login or the address of the client is locked out, it matches ErrTooManyAttempts
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the message of ErrTooManyAttempts
+func (e *TooManyAttemptsError) Error() string { return ErrTooManyAttempts.Error() }
+
+// Is reports whether target is ErrTooManyAttempts
+func (e *TooManyAttemptsError) Is(target error) bool { return target == ErrTooManyAttempts }
+
 // AuthService provides authentication and user management functionality
 type AuthService struct {
-	UserRepo UserRepository
-	cfg      *config.Config
+	UserRepo    UserRepository
+	TokenRepo   RefreshTokenRepository
+	ResetRepo   PasswordResetRepository
+	MFARepo     MFARepository
+	KeyRepo     APIKeyRepository
+	SessionRepo SessionRepository
+	Mailer      Mailer
+	Audit       AuditLog
+	Keys        *mjwt.KeySet
+	Hasher      PasswordHasher
+	Breached    BreachedPasswords
+	cfg         *config.Config
+	now         func() time.Time
+
+	accounts  *loginGuard
+	addresses *loginGuard
+	sessions  *sessionCache
+	// sessionlessUntil ends the acceptance of access tokens without a session
+	sessionlessUntil time.Time
+	dummyOnce        sync.Once
+	dummyHash        string
 }
 
-// NewAuthService creates a new instance of AuthService
-func NewAuthService(repo UserRepository, cfg *config.Config) *AuthService {
-	return &AuthService{UserRepo: repo, cfg: cfg}
+// NewAuthService creates a new instance of AuthService, access tokens are signed and verified with keys,
+// password reset tokens are delivered by mailer, second factors are kept in mfaRepo, API keys in keyRepo,
+// logins in sessionRepo and lockouts are recorded in audit
+func NewAuthService(
+	repo UserRepository, tokenRepo RefreshTokenRepository, resetRepo PasswordResetRepository, mfaRepo MFARepository,
+	keyRepo APIKeyRepository, sessionRepo SessionRepository, mailer Mailer, audit AuditLog, keys *mjwt.KeySet, cfg *config.Config,
+) *AuthService {
+	maxAttempts := cfg.Login.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = constants.LoginMaxAttempts
+	}
+	maxAttemptsPerIP := cfg.Login.MaxAttemptsPerIP
+	if maxAttemptsPerIP <= 0 {
+		maxAttemptsPerIP = constants.LoginMaxAttemptsPerIP
+	}
+	lockout := cfg.Login.Lockout
+	if lockout <= 0 {
+		lockout = constants.LoginLockout
+	}
+	maxLockout := cfg.Login.MaxLockout
+	if maxLockout <= 0 {
+		maxLockout = constants.LoginMaxLockout
+	}
+	maxLockout = max(maxLockout, lockout)
+
+	s := &AuthService{
+		UserRepo: repo, TokenRepo: tokenRepo, ResetRepo: resetRepo, MFARepo: mfaRepo, KeyRepo: keyRepo, SessionRepo: sessionRepo,
+		Mailer: mailer, Audit: audit, Keys: keys, Hasher: newPasswordHasher(cfg.Password.Hash), cfg: cfg, now: time.Now,
+		accounts:  newLoginGuard(maxAttempts, lockout, maxLockout),
+		addresses: newLoginGuard(maxAttemptsPerIP, lockout, maxLockout),
+		sessions:  newSessionCache(constants.SessionCacheTTL),
+	}
+	// access tokens signed before sessions were recorded have expired once their lifetime and the leeway passed
+	leeway := cfg.JWT.Leeway
+	if leeway <= 0 {
+		leeway = constants.TokenLeeway
+	}
+	s.sessionlessUntil = time.Now().Add(s.accessTTL() + leeway)
+	return s
 }
 
-// Register registers a new user and returns a JWT token
-func (s *AuthService) Register(ctx context.Context, login, password string) (*models.User, string, error) {
+// Register registers a new user and returns an access token with a refresh token of a new session from client
+func (s *AuthService) Register(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
 	if err := s.validateLogin(login); err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	if err := s.validatePassword(password); err != nil {
-		return nil, "", err
+	if err := s.validatePassword(login, password); err != nil {
+		return nil, nil, err
 	}
 
 	existing, err := s.UserRepo.GetByLogin(ctx, login)
 	if err != nil {
-		return nil, "", errors.New("database error")
+		return nil, nil, errors.New("database error")
 	}
 	if existing != nil {
-		return nil, "", errors.New("user already exists")
+		return nil, nil, errors.New("user already exists")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := s.Hasher.Hash(password)
 	if err != nil {
-		return nil, "", errors.New("password hashing failed")
+		return nil, nil, errors.New("password hashing failed")
 	}
 
-	user, err := s.UserRepo.Create(ctx, login, string(hash))
+	user, err := s.UserRepo.Create(ctx, login, hash)
 	if err != nil {
-		return nil, "", errors.New("failed to create user")
+		return nil, nil, errors.New("failed to create user")
 	}
 
-	token, err := mjwt.GenerateJWT(user.ID, user.Login, s.cfg.JWT.Secret)
+	tokens, err := s.startSession(ctx, user, client)
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		return nil, nil, err
 	}
 
-	return &models.User{ID: user.ID, Login: user.Login}, token, nil
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, tokens, nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(ctx context.Context, login, password string) (*models.User, string, error) {
+// Login authenticates a user and returns an access token with a refresh token of a new session from client.
+// Users with two-factor authentication get an *MFARequiredError instead, its token is exchanged by VerifyMFA.
+// Failed logins are counted per existing login and per client address, either is locked out after too many failures.
+// Unknown logins are checked against a dummy hash, so they take as long as wrong passwords
+func (s *AuthService) Login(ctx context.Context, login, password string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
 	if strings.TrimSpace(login) == "" || strings.TrimSpace(password) == "" {
-		return nil, "", errors.New("login and password are required")
+		return nil, nil, errors.New("login and password are required")
+	}
+	ip := client.IP
+
+	now := s.now()
+	if wait := s.lockedOut(login, ip, now); wait > 0 {
+		return nil, nil, &TooManyAttemptsError{RetryAfter: wait}
 	}
 
 	user, err := s.UserRepo.GetByLogin(ctx, login)
 	if err != nil {
-		return nil, "", errors.New("database error")
+		return nil, nil, errors.New("database error")
+	}
+
+	hash := s.dummyPasswordHash()
+	if user != nil {
+		hash = user.Hash
+	}
+	if !s.passwordMatches(hash, password) || user == nil {
+		if err := s.recordFailure(ctx, user, login, ip, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("invalid login or password")
+	}
+
+	if user.DisabledAt != nil {
+		return nil, nil, ErrAccountDisabled
+	}
+	s.upgradePasswordHash(ctx, user, password)
+
+	// failures of the code step count against the login, so they are only forgotten once it succeeds too
+	if err := s.requireMFA(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	s.accounts.reset(login)
+
+	tokens, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, tokens, nil
+}
+
+// lockedOut returns how long logins with login from ip stay locked out, zero when they are allowed
+func (s *AuthService) lockedOut(login, ip string, now time.Time) time.Duration {
+	wait := s.accounts.retryAfter(login, now)
+	if ip != "" {
+		wait = max(wait, s.addresses.retryAfter(ip, now))
+	}
+	return wait
+}
+
+// recordFailure counts a failed login and records an audit entry when it locks out the login or the address,
+// user is nil for unknown logins, whose failures only count against the address so they cannot fill the login counters
+func (s *AuthService) recordFailure(ctx context.Context, user *models.User, login, ip string, now time.Time) error {
+	if user != nil {
+		if d := s.accounts.fail(login, now); d > 0 {
+			err := s.Audit.Record(ctx, &models.AuditEntry{
+				Event: models.AuditAccountLocked, UserID: &user.ID, Login: login, IP: ip,
+				Details: fmt.Sprintf("login locked for %s after failed logins", d),
+			})
+			if err != nil {
+				return errors.New("database error")
+			}
+		}
+	}
+	if ip == "" {
+		return nil
+	}
+	if d := s.addresses.fail(ip, now); d > 0 {
+		err := s.Audit.Record(ctx, &models.AuditEntry{
+			Event: models.AuditIPLocked, Login: login, IP: ip,
+			Details: fmt.Sprintf("address locked for %s after failed logins", d),
+		})
+		if err != nil {
+			return errors.New("database error")
+		}
+	}
+	return nil
+}
+
+// dummyPasswordHash returns a hash no password matches, compared for unknown logins to keep the timing of wrong passwords
+func (s *AuthService) dummyPasswordHash() string {
+	s.dummyOnce.Do(func() {
+		secret, err := randomToken()
+		if err != nil {
+			secret = "unknown login"
+		}
+		s.dummyHash, _ = s.Hasher.Hash(secret)
+	})
+	return s.dummyHash
+}
+
+// Refresh exchanges a refresh token for a new pair of tokens of the same family.
+// Presenting a token that was already exchanged revokes the whole family, since either the client or someone
+// who stole the token is replaying it
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.User, *models.AuthTokens, error) {
+	stored, err := s.TokenRepo.GetByHash(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if stored == nil || stored.RevokedAt != nil || !s.now().Before(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return nil, nil, s.revokeReused(ctx, stored)
+	}
+
+	ok, err := s.TokenRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if !ok {
+		// a concurrent request exchanged the token first
+		return nil, nil, s.revokeReused(ctx, stored)
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrAccountDisabled
+	}
+
+	session, err := s.familySession(ctx, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, stored.FamilyID, session.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, tokens, nil
+}
+
+// familySession returns the session of the family of a refresh token and records its use. Families issued before
+// sessions were recorded get a session without client details
+func (s *AuthService) familySession(ctx context.Context, stored *models.RefreshToken) (*models.Session, error) {
+	session, err := s.SessionRepo.GetByFamily(ctx, stored.FamilyID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if session == nil {
+		session = &models.Session{UserID: stored.UserID, FamilyID: stored.FamilyID}
+		if err := s.SessionRepo.Create(ctx, session); err != nil {
+			return nil, errors.New("failed to store session")
+		}
+		return session, nil
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.SessionRepo.Touch(ctx, session.ID); err != nil {
+		return nil, errors.New("database error")
+	}
+	return session, nil
+}
+
+// Logout revokes the family of a refresh token and ends its session, unknown tokens are ignored
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.TokenRepo.GetByHash(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if stored == nil {
+		return nil
+	}
+	if err := s.TokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return errors.New("database error")
+	}
+	s.sessions.forgetUser(stored.UserID)
+	return nil
+}
+
+// ChangePassword replaces the password of a user who knows the current one. Every session of the user is ended
+// and a new pair of tokens of a new session from client is returned, so only the client changing the password stays logged in
+func (s *AuthService) ChangePassword(
+	ctx context.Context, userID int, current, password string, client models.ClientInfo,
+) (*models.User, *models.AuthTokens, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, nil, ErrAccountDisabled
+	}
+	if !s.passwordMatches(user.Hash, current) {
+		return nil, nil, ErrWrongPassword
+	}
+	if err := s.validatePassword(user.Login, password); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.setPassword(ctx, user.ID, password); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, tokens, nil
+}
+
+// ChangeEmail sets the address password reset links are mailed to for a user who knows the current password,
+// an empty email removes it
+func (s *AuthService) ChangeEmail(ctx context.Context, userID int, current, email string) error {
+	email = strings.TrimSpace(email)
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	if !s.passwordMatches(user.Hash, current) {
+		return ErrWrongPassword
+	}
+
+	ok, err := s.UserRepo.SetEmail(ctx, user.ID, email)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// validateEmail accepts an empty email or a single bare address such as user@example.com
+func validateEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	if len(email) > constants.MaxLenEmail {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidEmail, constants.MaxLenEmail)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a single-use reset token to the email of the user with login. Unknown and disabled
+// logins and users without an email are ignored without an error, so the response does not reveal which logins exist
+func (s *AuthService) RequestPasswordReset(ctx context.Context, login string) error {
+	user, err := s.UserRepo.GetByLogin(ctx, strings.TrimSpace(login))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil
+	}
+	email, err := s.UserRepo.GetEmail(ctx, user.ID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if email == "" {
+		return nil
+	}
+
+	ttl := s.cfg.Password.ResetTTL
+	if ttl <= 0 {
+		ttl = constants.PasswordResetTTL
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return errors.New("failed to generate token")
+	}
+	err = s.ResetRepo.Create(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: s.now().Add(ttl),
+	})
+	if err != nil {
+		return errors.New("failed to store reset token")
+	}
+
+	body := fmt.Sprintf("Open %s%s to choose a new password. The link expires in %s and works once.\n"+
+		"If you did not ask to reset your password, ignore this message.", s.cfg.Password.ResetURL, token, ttl)
+	if err := s.Mailer.Send(ctx, email, "Reset your password", body); err != nil {
+		return fmt.Errorf("failed to send reset email: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token. The token and every other reset token of the user
+// stop working, and every session of the user is ended. A password that breaks the policy keeps the token
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	stored, err := s.ResetRepo.GetByHash(ctx, hashRefreshToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if stored == nil || stored.UsedAt != nil || !s.now().Before(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		return errors.New("database error")
 	}
 	if user == nil {
-		return nil, "", errors.New("invalid login or password")
+		return ErrInvalidResetToken
+	}
+	if err := s.validatePassword(user.Login, password); err != nil {
+		return err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid login or password")
+	ok, err := s.ResetRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrInvalidResetToken
+	}
+	if err := s.ResetRepo.InvalidateUser(ctx, stored.UserID); err != nil {
+		return errors.New("database error")
 	}
 
-	token, err := mjwt.GenerateJWT(user.ID, user.Login, s.cfg.JWT.Secret)
+	return s.setPassword(ctx, stored.UserID, password)
+}
+
+// setPassword stores a new password of a user, checked against the policy by the caller, and ends all of their sessions
+func (s *AuthService) setPassword(ctx context.Context, userID int, password string) error {
+	hash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return errors.New("password hashing failed")
+	}
+
+	ok, err := s.UserRepo.UpdatePassword(ctx, userID, hash)
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrUserNotFound
 	}
 
-	return &models.User{ID: user.ID, Login: user.Login}, token, nil
+	if err := s.TokenRepo.RevokeUser(ctx, userID); err != nil {
+		return errors.New("database error")
+	}
+	s.sessions.forgetUser(userID)
+	return nil
 }
 
 // ParseToken parses and validates a JWT token
 func (s *AuthService) ParseToken(tokenStr string) (*mjwt.Claims, error) {
-	return mjwt.ParseToken(tokenStr, s.cfg.JWT.Secret)
+	return s.Keys.Parse(tokenStr)
+}
+
+// JWKS returns the public keys that verify access tokens
+func (s *AuthService) JWKS() mjwt.JWKS {
+	return s.Keys.JWKS()
+}
+
+// issueTokens creates an access token of the session sessionID and stores a new refresh token in familyID
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string, sessionID int) (*models.AuthTokens, error) {
+	accessTTL := s.accessTTL()
+	refreshTTL := s.refreshTTL()
+
+	accessToken, err := s.Keys.SignSession(user.ID, user.Login, string(user.Role), sessionID, accessTTL)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	err = s.TokenRepo.Create(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: s.now().Add(refreshTTL),
+	})
+	if err != nil {
+		return nil, errors.New("failed to store refresh token")
+	}
+
+	return &models.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTTL / time.Second),
+	}, nil
+}
+
+// accessTTL returns the lifetime of an access token
+func (s *AuthService) accessTTL() time.Duration {
+	if s.cfg.JWT.AccessTTL > 0 {
+		return s.cfg.JWT.AccessTTL
+	}
+	return constants.AccessTokenTTL
+}
+
+// refreshTTL returns the lifetime of a refresh token
+func (s *AuthService) refreshTTL() time.Duration {
+	if s.cfg.JWT.RefreshTTL > 0 {
+		return s.cfg.JWT.RefreshTTL
+	}
+	return constants.RefreshTokenTTL
+}
+
+// revokeReused revokes the family of a replayed refresh token and ends its session
+func (s *AuthService) revokeReused(ctx context.Context, stored *models.RefreshToken) error {
+	if err := s.TokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return errors.New("database error")
+	}
+	s.sessions.forgetUser(stored.UserID)
+	return ErrRefreshTokenReused
+}
+
+// randomToken returns a random URL-safe string
+func randomToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the stored form of a refresh or reset token, tokens are random so a plain hash is enough
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // validateLogin checks if the login meets required rules
@@ -123,16 +701,3 @@ func (s *AuthService) validateLogin(login string) error {
 
 	return nil
 }
-
-// validatePassword checks if the password meets required rules
-func (s *AuthService) validatePassword(password string) error {
-	if len(password) < constants.MinLenPassword {
-		return errors.New("password must be at least 6 characters")
-	}
-
-	if len(password) > constants.MaxLenPassword {
-		return errors.New("password too long (max 100 characters)")
-	}
-
-	return nil
-}
@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -11,7 +13,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/constants"
 	"github.com/artnikel/marketplace/internal/models"
+	mjwt "github.com/artnikel/marketplace/pkg/jwt"
 )
 
 type MockUserRepo struct {
@@ -34,6 +38,142 @@ func (m *MockUserRepo) GetByLogin(ctx context.Context, login string) (*models.Us
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepo) List(ctx context.Context, offset, limit int) ([]*models.User, error) {
+	args := m.Called(ctx, offset, limit)
+	users, _ := args.Get(0).([]*models.User)
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepo) Count(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserRepo) SetRole(ctx context.Context, id int, role models.Role) (bool, error) {
+	args := m.Called(ctx, id, role)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepo) SetDisabled(ctx context.Context, id int, disabled bool) (bool, error) {
+	args := m.Called(ctx, id, disabled)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepo) UpdatePassword(ctx context.Context, id int, hash string) (bool, error) {
+	args := m.Called(ctx, id, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepo) GetEmail(ctx context.Context, id int) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserRepo) SetEmail(ctx context.Context, id int, email string) (bool, error) {
+	args := m.Called(ctx, id, email)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepo) ReplacePasswordHash(ctx context.Context, id int, old, hash string) (bool, error) {
+	args := m.Called(ctx, id, old, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockRefreshTokenRepo struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepo) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	token, _ := args.Get(0).(*models.RefreshToken)
+	return token, args.Error(1)
+}
+
+func (m *MockRefreshTokenRepo) MarkUsed(ctx context.Context, id int) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepo) RevokeUser(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockPasswordResetRepo struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepo) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepo) GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	args := m.Called(ctx, hash)
+	token, _ := args.Get(0).(*models.PasswordResetToken)
+	return token, args.Error(1)
+}
+
+func (m *MockPasswordResetRepo) MarkUsed(ctx context.Context, id int) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPasswordResetRepo) InvalidateUser(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockAuditLog struct {
+	mock.Mock
+}
+
+func (m *MockAuditLog) Record(ctx context.Context, entry *models.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(ctx context.Context, to, subject, body string) error {
+	args := m.Called(ctx, to, subject, body)
+	return args.Error(0)
+}
+
+// testKeySet returns a key set signing with an HS256 secret
+func testKeySet(t *testing.T) *mjwt.KeySet {
+	keys, err := mjwt.NewKeySet("test", mjwt.NewHMACKey("test", []byte("test-secret")))
+	require.NoError(t, err)
+	return keys
+}
+
+// hashPassword hashes password like an AuthService with the default cost parameters
+func hashPassword(t *testing.T, password string) string {
+	hash, err := newPasswordHasher(config.PasswordHashConfig{}).Hash(password)
+	require.NoError(t, err)
+	return hash
+}
+
 func TestAuthService_Register(t *testing.T) {
 	cfg := &config.Config{
 		JWT: config.JWTConfig{
@@ -137,19 +277,25 @@ func TestAuthService_Register(t *testing.T) {
 			mockRepo := new(MockUserRepo)
 			tt.setupMock(mockRepo)
 
-			authService := NewAuthService(mockRepo, cfg)
+			tokenRepo := new(MockRefreshTokenRepo)
+			tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil).Maybe()
+
+			authService := NewAuthService(mockRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
 
-			user, token, err := authService.Register(context.Background(), tt.login, tt.password)
+			user, tokens, err := authService.Register(context.Background(), tt.login, tt.password, models.ClientInfo{})
 
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.wantErrMsg)
 				assert.Nil(t, user)
-				assert.Empty(t, token)
+				assert.Nil(t, tokens)
 			} else {
 				require.NoError(t, err)
 				assert.NotNil(t, user)
-				assert.NotEmpty(t, token)
+				require.NotNil(t, tokens)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
+				assert.Equal(t, 900, tokens.ExpiresIn)
 				assert.Equal(t, tt.wantUserID, user.ID)
 				assert.Equal(t, tt.wantUserLogin, user.Login)
 			}
@@ -167,8 +313,7 @@ func TestAuthService_Login(t *testing.T) {
 	}
 
 	testPassword := "password123"
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.DefaultCost)
-	require.NoError(t, err)
+	hashedPassword := hashPassword(t, testPassword)
 
 	tests := []struct {
 		name          string
@@ -189,7 +334,7 @@ func TestAuthService_Login(t *testing.T) {
 					Return(&models.User{
 						ID:    1,
 						Login: "testuser",
-						Hash:  string(hashedPassword),
+						Hash:  hashedPassword,
 					}, nil)
 			},
 			wantErr:       false,
@@ -215,12 +360,29 @@ func TestAuthService_Login(t *testing.T) {
 					Return(&models.User{
 						ID:    1,
 						Login: "testuser",
-						Hash:  string(hashedPassword),
+						Hash:  hashedPassword,
 					}, nil)
 			},
 			wantErr:    true,
 			wantErrMsg: "invalid login or password",
 		},
+		{
+			name:     "disabled account",
+			login:    "testuser",
+			password: testPassword,
+			setupMock: func(m *MockUserRepo) {
+				disabledAt := time.Now()
+				m.On("GetByLogin", mock.Anything, "testuser").
+					Return(&models.User{
+						ID:         1,
+						Login:      "testuser",
+						Hash:       hashedPassword,
+						DisabledAt: &disabledAt,
+					}, nil)
+			},
+			wantErr:    true,
+			wantErrMsg: "account is disabled",
+		},
 		{
 			name:       "empty login",
 			login:      "",
@@ -255,19 +417,25 @@ func TestAuthService_Login(t *testing.T) {
 			mockRepo := new(MockUserRepo)
 			tt.setupMock(mockRepo)
 
-			authService := NewAuthService(mockRepo, cfg)
+			tokenRepo := new(MockRefreshTokenRepo)
+			tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil).Maybe()
 
-			user, token, err := authService.Login(context.Background(), tt.login, tt.password)
+			authService := NewAuthService(mockRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+
+			user, tokens, err := authService.Login(context.Background(), tt.login, tt.password, models.ClientInfo{IP: "192.0.2.1"})
 
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.wantErrMsg)
 				assert.Nil(t, user)
-				assert.Empty(t, token)
+				assert.Nil(t, tokens)
 			} else {
 				require.NoError(t, err)
 				assert.NotNil(t, user)
-				assert.NotEmpty(t, token)
+				require.NotNil(t, tokens)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
+				assert.Equal(t, 900, tokens.ExpiresIn)
 				assert.Equal(t, tt.wantUserID, user.ID)
 				assert.Equal(t, tt.wantUserLogin, user.Login)
 			}
@@ -280,7 +448,7 @@ func TestAuthService_Login(t *testing.T) {
 func TestAuthService_ValidateLogin(t *testing.T) {
 	cfg := &config.Config{}
 	mockRepo := new(MockUserRepo)
-	authService := NewAuthService(mockRepo, cfg)
+	authService := NewAuthService(mockRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
 
 	tests := []struct {
 		name    string
@@ -313,7 +481,7 @@ func TestAuthService_ValidateLogin(t *testing.T) {
 func TestAuthService_ValidatePassword(t *testing.T) {
 	cfg := &config.Config{}
 	mockRepo := new(MockUserRepo)
-	authService := NewAuthService(mockRepo, cfg)
+	authService := NewAuthService(mockRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
 
 	tests := []struct {
 		name     string
@@ -329,7 +497,7 @@ func TestAuthService_ValidatePassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := authService.validatePassword(tt.password)
+			err := authService.validatePassword("testuser", tt.password)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -338,3 +506,541 @@ func TestAuthService_ValidatePassword(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthService_Refresh(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "test-secret",
+		},
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	usedAt := now.Add(-time.Minute)
+	stored := func() *models.RefreshToken {
+		return &models.RefreshToken{ID: 7, UserID: 1, FamilyID: "family-1", TokenHash: hashRefreshToken("refresh123"), ExpiresAt: now.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name       string
+		setupMock  func(*MockUserRepo, *MockRefreshTokenRepo)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			name: "rotates the token within its family",
+			setupMock: func(u *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(stored(), nil)
+				r.On("MarkUsed", mock.Anything, 7).Return(true, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+				r.On("Create", mock.Anything, mock.MatchedBy(func(token *models.RefreshToken) bool {
+					return token.UserID == 1 && token.FamilyID == "family-1" &&
+						token.TokenHash != hashRefreshToken("refresh123") && token.ExpiresAt.Equal(now.Add(constants.RefreshTokenTTL))
+				})).Return(nil)
+			},
+		},
+		{
+			name: "unknown token",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(nil, nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired token",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				token := stored()
+				token.ExpiresAt = now
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(token, nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "revoked token",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				token := stored()
+				token.RevokedAt = &usedAt
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(token, nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "reused token revokes the family",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				token := stored()
+				token.UsedAt = &usedAt
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(token, nil)
+				r.On("RevokeFamily", mock.Anything, "family-1").Return(nil)
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "concurrent refresh revokes the family",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(stored(), nil)
+				r.On("MarkUsed", mock.Anything, 7).Return(false, nil)
+				r.On("RevokeFamily", mock.Anything, "family-1").Return(nil)
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "deleted user",
+			setupMock: func(u *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(stored(), nil)
+				r.On("MarkUsed", mock.Anything, 7).Return(true, nil)
+				u.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "disabled user",
+			setupMock: func(u *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(stored(), nil)
+				r.On("MarkUsed", mock.Anything, 7).Return(true, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser", DisabledAt: &usedAt}, nil)
+			},
+			wantErr: ErrAccountDisabled,
+		},
+		{
+			name: "database error",
+			setupMock: func(_ *MockUserRepo, r *MockRefreshTokenRepo) {
+				r.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).Return(nil, errors.New("connection lost"))
+			},
+			wantErrMsg: "database error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			tokenRepo := new(MockRefreshTokenRepo)
+			tt.setupMock(userRepo, tokenRepo)
+
+			authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+			authService.now = func() time.Time { return now }
+
+			user, tokens, err := authService.Refresh(context.Background(), "refresh123")
+
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, tokens)
+			case tt.wantErrMsg != "":
+				require.EqualError(t, err, tt.wantErrMsg)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, "testuser", user.Login)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEqual(t, "refresh123", tokens.RefreshToken)
+			}
+
+			userRepo.AssertExpectations(t)
+			tokenRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	tokenRepo := new(MockRefreshTokenRepo)
+	authService := NewAuthService(new(MockUserRepo), tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+
+	tokenRepo.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).
+		Return(&models.RefreshToken{ID: 7, FamilyID: "family-1"}, nil).Once()
+	tokenRepo.On("RevokeFamily", mock.Anything, "family-1").Return(nil).Once()
+	require.NoError(t, authService.Logout(context.Background(), "refresh123"))
+
+	tokenRepo.On("GetByHash", mock.Anything, hashRefreshToken("unknown")).Return(nil, nil).Once()
+	require.NoError(t, authService.Logout(context.Background(), "unknown"))
+
+	tokenRepo.On("GetByHash", mock.Anything, hashRefreshToken("refresh456")).Return(nil, errors.New("connection lost")).Once()
+	require.EqualError(t, authService.Logout(context.Background(), "refresh456"), "database error")
+
+	tokenRepo.AssertExpectations(t)
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	hashed := hashPassword(t, "oldpass")
+	user := &models.User{ID: 1, Login: "testuser", Hash: hashed}
+
+	tests := []struct {
+		name      string
+		current   string
+		password  string
+		setupMock func(*MockUserRepo, *MockRefreshTokenRepo)
+		wantErr   error
+	}{
+		{
+			name:     "ends other sessions and issues new tokens",
+			current:  "oldpass",
+			password: "newpass123",
+			setupMock: func(u *MockUserRepo, r *MockRefreshTokenRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+				u.On("UpdatePassword", mock.Anything, 1, mock.MatchedBy(func(hash string) bool {
+					ok, err := newPasswordHasher(config.PasswordHashConfig{}).Verify(hash, "newpass123")
+					return err == nil && ok
+				})).Return(true, nil)
+				r.On("RevokeUser", mock.Anything, 1).Return(nil)
+				r.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+			},
+		},
+		{
+			name:     "wrong current password",
+			current:  "wrong",
+			password: "newpass123",
+			setupMock: func(u *MockUserRepo, _ *MockRefreshTokenRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+			},
+			wantErr: ErrWrongPassword,
+		},
+		{
+			name:     "new password too short",
+			current:  "oldpass",
+			password: "123",
+			setupMock: func(u *MockUserRepo, _ *MockRefreshTokenRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+			},
+			wantErr: ErrPasswordPolicy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			tokenRepo := new(MockRefreshTokenRepo)
+			tt.setupMock(userRepo, tokenRepo)
+
+			authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+			got, tokens, err := authService.ChangePassword(context.Background(), 1, tt.current, tt.password, models.ClientInfo{})
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, tokens)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "testuser", got.Login)
+				assert.NotEmpty(t, tokens.RefreshToken)
+			}
+
+			userRepo.AssertExpectations(t)
+			tokenRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_ChangeEmail(t *testing.T) {
+	user := &models.User{ID: 1, Login: "testuser", Hash: hashPassword(t, "password123")}
+
+	tests := []struct {
+		name      string
+		current   string
+		email     string
+		setupMock func(*MockUserRepo)
+		wantErr   error
+	}{
+		{
+			name:    "sets the email",
+			current: "password123",
+			email:   " test@example.com ",
+			setupMock: func(u *MockUserRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+				u.On("SetEmail", mock.Anything, 1, "test@example.com").Return(true, nil)
+			},
+		},
+		{
+			name:    "empty email removes it",
+			current: "password123",
+			setupMock: func(u *MockUserRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+				u.On("SetEmail", mock.Anything, 1, "").Return(true, nil)
+			},
+		},
+		{
+			name:    "wrong current password",
+			current: "wrong",
+			email:   "test@example.com",
+			setupMock: func(u *MockUserRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(user, nil)
+			},
+			wantErr: ErrWrongPassword,
+		},
+		{
+			name:      "display name is not a bare address",
+			current:   "password123",
+			email:     "Test <test@example.com>",
+			setupMock: func(_ *MockUserRepo) {},
+			wantErr:   ErrInvalidEmail,
+		},
+		{
+			name:      "not an address",
+			current:   "password123",
+			email:     "testuser",
+			setupMock: func(_ *MockUserRepo) {},
+			wantErr:   ErrInvalidEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			tt.setupMock(userRepo)
+
+			authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+			err := authService.ChangeEmail(context.Background(), 1, tt.current, tt.email)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			userRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_RequestPasswordReset(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{Password: config.PasswordConfig{ResetURL: "http://localhost/?reset_token="}}
+
+	userRepo := new(MockUserRepo)
+	resetRepo := new(MockPasswordResetRepo)
+	mailer := new(MockMailer)
+	authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), resetRepo, noMFA(), new(MockAPIKeyRepo), noSessions(), mailer, new(MockAuditLog), testKeySet(t), cfg)
+	authService.now = func() time.Time { return now }
+
+	var stored *models.PasswordResetToken
+	userRepo.On("GetByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser"}, nil).Once()
+	userRepo.On("GetEmail", mock.Anything, 1).Return("test@example.com", nil).Once()
+	resetRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *models.PasswordResetToken) bool {
+		stored = token
+		return token.UserID == 1 && token.ExpiresAt.Equal(now.Add(constants.PasswordResetTTL))
+	})).Return(nil).Once()
+	mailer.On("Send", mock.Anything, "test@example.com", "Reset your password", mock.MatchedBy(func(body string) bool {
+		// the mail carries the token itself, only its hash is stored
+		i := strings.Index(body, "reset_token=")
+		if i < 0 {
+			return false
+		}
+		token := strings.Fields(body[i+len("reset_token="):])[0]
+		return hashRefreshToken(token) == stored.TokenHash
+	})).Return(nil).Once()
+	require.NoError(t, authService.RequestPasswordReset(context.Background(), "testuser"))
+
+	// unknown and disabled logins and users without an email look the same as the others
+	disabledAt := now
+	userRepo.On("GetByLogin", mock.Anything, "nobody").Return(nil, nil).Once()
+	require.NoError(t, authService.RequestPasswordReset(context.Background(), "nobody"))
+	userRepo.On("GetByLogin", mock.Anything, "disabled").Return(&models.User{ID: 2, DisabledAt: &disabledAt}, nil).Once()
+	require.NoError(t, authService.RequestPasswordReset(context.Background(), "disabled"))
+	userRepo.On("GetByLogin", mock.Anything, "nomail").Return(&models.User{ID: 3, Login: "nomail"}, nil).Once()
+	userRepo.On("GetEmail", mock.Anything, 3).Return("", nil).Once()
+	require.NoError(t, authService.RequestPasswordReset(context.Background(), "nomail"))
+
+	userRepo.AssertExpectations(t)
+	resetRepo.AssertExpectations(t)
+	mailer.AssertExpectations(t)
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	usedAt := now.Add(-time.Minute)
+	stored := func() *models.PasswordResetToken {
+		return &models.PasswordResetToken{ID: 3, UserID: 1, TokenHash: hashRefreshToken("reset123"), ExpiresAt: now.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name      string
+		password  string
+		setupMock func(*MockUserRepo, *MockRefreshTokenRepo, *MockPasswordResetRepo)
+		wantErr   error
+	}{
+		{
+			name:     "sets the password and ends every session",
+			password: "newpass123",
+			setupMock: func(u *MockUserRepo, r *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(stored(), nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+				p.On("MarkUsed", mock.Anything, 3).Return(true, nil)
+				p.On("InvalidateUser", mock.Anything, 1).Return(nil)
+				u.On("UpdatePassword", mock.Anything, 1, mock.AnythingOfType("string")).Return(true, nil)
+				r.On("RevokeUser", mock.Anything, 1).Return(nil)
+			},
+		},
+		{
+			name:     "weak password keeps the token",
+			password: "123",
+			setupMock: func(u *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(stored(), nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+			},
+			wantErr: ErrPasswordPolicy,
+		},
+		{
+			name:     "deleted user",
+			password: "newpass123",
+			setupMock: func(u *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(stored(), nil)
+				u.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:     "unknown token",
+			password: "newpass123",
+			setupMock: func(_ *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(nil, nil)
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:     "expired token",
+			password: "newpass123",
+			setupMock: func(_ *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				token := stored()
+				token.ExpiresAt = now
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(token, nil)
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:     "used token",
+			password: "newpass123",
+			setupMock: func(_ *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				token := stored()
+				token.UsedAt = &usedAt
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(token, nil)
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:     "token redeemed by a concurrent request",
+			password: "newpass123",
+			setupMock: func(u *MockUserRepo, _ *MockRefreshTokenRepo, p *MockPasswordResetRepo) {
+				p.On("GetByHash", mock.Anything, hashRefreshToken("reset123")).Return(stored(), nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+				p.On("MarkUsed", mock.Anything, 3).Return(false, nil)
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			tokenRepo := new(MockRefreshTokenRepo)
+			resetRepo := new(MockPasswordResetRepo)
+			tt.setupMock(userRepo, tokenRepo, resetRepo)
+
+			authService := NewAuthService(userRepo, tokenRepo, resetRepo, noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+			authService.now = func() time.Time { return now }
+
+			err := authService.ResetPassword(context.Background(), "reset123", tt.password)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			userRepo.AssertExpectations(t)
+			tokenRepo.AssertExpectations(t)
+			resetRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_LoginUpgradesPasswordHash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	oldParams, err := newPasswordHasher(config.PasswordHashConfig{Memory: 1024, Iterations: 1, Parallelism: 1}).Hash("password123")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		hash        string
+		wantReplace bool
+	}{
+		{name: "bcrypt hash", hash: string(legacy), wantReplace: true},
+		{name: "argon2id hash with older cost parameters", hash: oldParams, wantReplace: true},
+		{name: "current hash", hash: hashPassword(t, "password123")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(MockUserRepo)
+			userRepo.On("GetByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser", Hash: tt.hash}, nil)
+			tokenRepo := new(MockRefreshTokenRepo)
+			tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+			authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+
+			var upgraded string
+			if tt.wantReplace {
+				// a failed upgrade keeps the old hash and does not fail the login
+				userRepo.On("ReplacePasswordHash", mock.Anything, 1, tt.hash, mock.AnythingOfType("string")).
+					Run(func(args mock.Arguments) { upgraded = args.String(3) }).Return(false, errors.New("connection lost"))
+			}
+
+			_, tokens, err := authService.Login(context.Background(), "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"})
+			require.NoError(t, err)
+			assert.NotEmpty(t, tokens.AccessToken)
+
+			if tt.wantReplace {
+				assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"))
+				assert.False(t, authService.Hasher.NeedsRehash(upgraded))
+				ok, err := authService.Hasher.Verify(upgraded, "password123")
+				require.NoError(t, err)
+				assert.True(t, ok)
+			}
+			userRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_LoginLockout(t *testing.T) {
+	hashed := hashPassword(t, "password123")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{Login: config.LoginConfig{MaxAttempts: 3, MaxAttemptsPerIP: 5, Lockout: time.Minute, MaxLockout: time.Hour}}
+
+	userRepo := new(MockUserRepo)
+	tokenRepo := new(MockRefreshTokenRepo)
+	audit := new(MockAuditLog)
+	authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), audit, testKeySet(t), cfg)
+	authService.now = func() time.Time { return now }
+
+	userRepo.On("GetByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser", Hash: hashed}, nil)
+	userRepo.On("GetByLogin", mock.Anything, "nobody").Return(nil, nil)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+	audit.On("Record", mock.Anything, mock.MatchedBy(func(e *models.AuditEntry) bool {
+		return e.Event == models.AuditAccountLocked && *e.UserID == 1 && e.Login == "testuser" && e.IP == "192.0.2.1"
+	})).Return(nil).Once()
+
+	for i := 0; i < 3; i++ {
+		_, _, err := authService.Login(context.Background(), "testuser", "wrong", models.ClientInfo{IP: "192.0.2.1"})
+		require.EqualError(t, err, "invalid login or password")
+	}
+
+	// the right password is refused during the lockout, from any address
+	_, _, err := authService.Login(context.Background(), "testuser", "password123", models.ClientInfo{IP: "198.51.100.7"})
+	var locked *TooManyAttemptsError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, time.Minute, locked.RetryAfter)
+	require.ErrorIs(t, err, ErrTooManyAttempts)
+
+	now = now.Add(time.Minute)
+	_, tokens, err := authService.Login(context.Background(), "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// unknown logins are checked against a dummy hash and only count against the address
+	audit.On("Record", mock.Anything, mock.MatchedBy(func(e *models.AuditEntry) bool {
+		return e.Event == models.AuditIPLocked && e.UserID == nil && e.IP == "192.0.2.1"
+	})).Return(nil).Once()
+	for i := 0; i < 2; i++ {
+		_, _, err := authService.Login(context.Background(), "nobody", "wrong", models.ClientInfo{IP: "192.0.2.1"})
+		require.EqualError(t, err, "invalid login or password")
+	}
+	assert.NotEmpty(t, authService.dummyHash)
+	assert.NotContains(t, authService.accounts.entries, "nobody")
+
+	_, _, err = authService.Login(context.Background(), "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"})
+	require.ErrorIs(t, err, ErrTooManyAttempts)
+
+	audit.AssertExpectations(t)
+}
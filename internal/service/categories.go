@@ -0,0 +1,163 @@
+// Package service contains business logic for handling categories
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// Errors returned by CategoriesService that handlers map to HTTP statuses
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryInUse    = errors.New("category has subcategories or items")
+	ErrCategoryCycle    = errors.New("category cannot be moved under itself or its subcategory")
+)
+
+// CategoryRepository is an interface that contains category repository methods
+type CategoryRepository interface {
+	Create(ctx context.Context, c *models.Category) error
+	GetByID(ctx context.Context, id int) (*models.Category, error)
+	List(ctx context.Context) ([]*models.Category, error)
+	Update(ctx context.Context, c *models.Category) error
+	Delete(ctx context.Context, id int) error
+	InUse(ctx context.Context, id int) (bool, error)
+}
+
+// CategoriesService provides methods for managing the categories tree
+type CategoriesService struct {
+	CategoryRepo CategoryRepository
+}
+
+// NewCategoriesService creates a new instance of CategoriesService
+func NewCategoriesService(repo CategoryRepository) *CategoriesService {
+	return &CategoriesService{CategoryRepo: repo}
+}
+
+// ListTree returns all categories arranged as a tree of root categories
+func (s *CategoriesService) ListTree(ctx context.Context) ([]*models.Category, error) {
+	categories, err := s.CategoryRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+
+	roots := []*models.Category{}
+	for _, c := range categories {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+			continue
+		}
+		if parent, ok := byID[*c.ParentID]; ok {
+			parent.Children = append(parent.Children, c)
+		}
+	}
+
+	return roots, nil
+}
+
+// CreateCategory validates and creates a new category under an optional parent
+func (s *CategoriesService) CreateCategory(ctx context.Context, name string, parentID *int) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("category name is required")
+	}
+
+	if parentID != nil {
+		if err := requireCategory(ctx, s.CategoryRepo, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &models.Category{Name: name, ParentID: parentID}
+	if err := s.CategoryRepo.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateCategory renames a category and moves it under a new parent
+func (s *CategoriesService) UpdateCategory(ctx context.Context, id int, name string, parentID *int) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("category name is required")
+	}
+
+	if err := requireCategory(ctx, s.CategoryRepo, id); err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		categories, err := s.CategoryRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if isDescendantOrSelf(categories, *parentID, id) {
+			return nil, ErrCategoryCycle
+		}
+		if err := requireCategory(ctx, s.CategoryRepo, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &models.Category{ID: id, Name: name, ParentID: parentID}
+	if err := s.CategoryRepo.Update(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DeleteCategory removes a category that has no subcategories and no items
+func (s *CategoriesService) DeleteCategory(ctx context.Context, id int) error {
+	if err := requireCategory(ctx, s.CategoryRepo, id); err != nil {
+		return err
+	}
+
+	inUse, err := s.CategoryRepo.InUse(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+
+	return s.CategoryRepo.Delete(ctx, id)
+}
+
+// requireCategory returns ErrCategoryNotFound if the category does not exist
+func requireCategory(ctx context.Context, repo CategoryRepository, id int) error {
+	c, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// isDescendantOrSelf reports whether id is ancestorID or lies in its subtree
+func isDescendantOrSelf(categories []*models.Category, id, ancestorID int) bool {
+	parents := make(map[int]*int, len(categories))
+	for _, c := range categories {
+		parents[c.ID] = c.ParentID
+	}
+
+	for visited := 0; visited <= len(categories); visited++ {
+		if id == ancestorID {
+			return true
+		}
+		parent, ok := parents[id]
+		if !ok || parent == nil {
+			return false
+		}
+		id = *parent
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// MockCategoryRepo is a mock implementation of CategoryRepo
+type MockCategoryRepo struct {
+	mock.Mock
+}
+
+func (m *MockCategoryRepo) Create(ctx context.Context, c *models.Category) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *MockCategoryRepo) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepo) List(ctx context.Context) ([]*models.Category, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepo) Update(ctx context.Context, c *models.Category) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *MockCategoryRepo) Delete(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockCategoryRepo) InUse(ctx context.Context, id int) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// categoriesFixture returns Electronics(1) > Phones(2) > Smartphones(3) and Books(4)
+func categoriesFixture() []*models.Category {
+	return []*models.Category{
+		{ID: 4, Name: "Books"},
+		{ID: 1, Name: "Electronics"},
+		{ID: 2, Name: "Phones", ParentID: intPtr(1)},
+		{ID: 3, Name: "Smartphones", ParentID: intPtr(2)},
+	}
+}
+
+func TestCategoriesService_ListTree(t *testing.T) {
+	mockRepo := new(MockCategoryRepo)
+	mockRepo.On("List", mock.Anything).Return(categoriesFixture(), nil)
+
+	service := NewCategoriesService(mockRepo)
+	tree, err := service.ListTree(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, tree, 2)
+	assert.Equal(t, "Books", tree[0].Name)
+	assert.Equal(t, "Electronics", tree[1].Name)
+	require.Len(t, tree[1].Children, 1)
+	assert.Equal(t, "Phones", tree[1].Children[0].Name)
+	require.Len(t, tree[1].Children[0].Children, 1)
+	assert.Equal(t, "Smartphones", tree[1].Children[0].Children[0].Name)
+}
+
+func TestCategoriesService_CreateCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		catName   string
+		parentID  *int
+		setupMock func(*MockCategoryRepo)
+		wantErr   error
+		wantMsg   string
+	}{
+		{
+			name:    "root category",
+			catName: "  Books ",
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("Create", mock.Anything, mock.MatchedBy(func(c *models.Category) bool {
+					return c.Name == "Books" && c.ParentID == nil
+				})).Return(nil)
+			},
+		},
+		{
+			name:     "child category",
+			catName:  "Phones",
+			parentID: intPtr(1),
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1, Name: "Electronics"}, nil)
+				m.On("Create", mock.Anything, mock.AnythingOfType("*models.Category")).Return(nil)
+			},
+		},
+		{
+			name:      "empty name",
+			catName:   " ",
+			setupMock: func(_ *MockCategoryRepo) {},
+			wantMsg:   "category name is required",
+		},
+		{
+			name:     "unknown parent",
+			catName:  "Phones",
+			parentID: intPtr(99),
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 99).Return(nil, nil)
+			},
+			wantErr: ErrCategoryNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCategoryRepo)
+			tt.setupMock(mockRepo)
+
+			service := NewCategoriesService(mockRepo)
+			c, err := service.CreateCategory(context.Background(), tt.catName, tt.parentID)
+
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, c)
+			case tt.wantMsg != "":
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantMsg)
+				assert.Nil(t, c)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.parentID, c.ParentID)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCategoriesService_UpdateCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        int
+		parentID  *int
+		setupMock func(*MockCategoryRepo)
+		wantErr   error
+	}{
+		{
+			name:     "move under another branch",
+			id:       2,
+			parentID: intPtr(4),
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 2).Return(&models.Category{ID: 2}, nil)
+				m.On("GetByID", mock.Anything, 4).Return(&models.Category{ID: 4}, nil)
+				m.On("List", mock.Anything).Return(categoriesFixture(), nil)
+				m.On("Update", mock.Anything, mock.AnythingOfType("*models.Category")).Return(nil)
+			},
+		},
+		{
+			name: "move to root",
+			id:   2,
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 2).Return(&models.Category{ID: 2}, nil)
+				m.On("Update", mock.Anything, mock.AnythingOfType("*models.Category")).Return(nil)
+			},
+		},
+		{
+			name:     "move under itself",
+			id:       2,
+			parentID: intPtr(2),
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 2).Return(&models.Category{ID: 2}, nil)
+				m.On("List", mock.Anything).Return(categoriesFixture(), nil)
+			},
+			wantErr: ErrCategoryCycle,
+		},
+		{
+			name:     "move under descendant",
+			id:       1,
+			parentID: intPtr(3),
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1}, nil)
+				m.On("List", mock.Anything).Return(categoriesFixture(), nil)
+			},
+			wantErr: ErrCategoryCycle,
+		},
+		{
+			name: "unknown category",
+			id:   99,
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 99).Return(nil, nil)
+			},
+			wantErr: ErrCategoryNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCategoryRepo)
+			tt.setupMock(mockRepo)
+
+			service := NewCategoriesService(mockRepo)
+			c, err := service.UpdateCategory(context.Background(), tt.id, "Name", tt.parentID)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, c)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.parentID, c.ParentID)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCategoriesService_DeleteCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		setupMock func(*MockCategoryRepo)
+		wantErr   error
+	}{
+		{
+			name: "unused category",
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1}, nil)
+				m.On("InUse", mock.Anything, 1).Return(false, nil)
+				m.On("Delete", mock.Anything, 1).Return(nil)
+			},
+		},
+		{
+			name: "category in use",
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1}, nil)
+				m.On("InUse", mock.Anything, 1).Return(true, nil)
+			},
+			wantErr: ErrCategoryInUse,
+		},
+		{
+			name: "unknown category",
+			setupMock: func(m *MockCategoryRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrCategoryNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCategoryRepo)
+			tt.setupMock(mockRepo)
+
+			service := NewCategoriesService(mockRepo)
+			err := service.DeleteCategory(context.Background(), 1)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package service contains business logic for proxying external images
+package service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/safeurl"
+)
+
+const (
+	// proxyCacheTTL is how long a fetched image is served from the cache
+	proxyCacheTTL = time.Hour
+	// proxyCacheBytes bounds the total size of cached images
+	proxyCacheBytes = 64 << 20
+)
+
+// Errors returned by ImageProxyService that handlers map to HTTP statuses
+var (
+	ErrInvalidImageURL = errors.New("invalid image url")
+	ErrRemoteImage     = errors.New("remote image unavailable")
+)
+
+// ImageURLRepository is an interface that reports whether an external URL is the image of an item
+type ImageURLRepository interface {
+	HasImageURL(ctx context.Context, url string) (bool, error)
+}
+
+// ImageProxyService fetches images from external hosts on behalf of browsers, so they never contact those hosts.
+// Only image URLs of items on public hosts are fetched, so the proxy cannot be used to relay arbitrary requests,
+// responses must be images no larger than MaxSize, and recent images are cached in memory
+type ImageProxyService struct {
+	ItemRepo ImageURLRepository
+	Client   *http.Client
+	Resolver safeurl.Resolver
+	MaxSize  int64
+	TTL      time.Duration
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	cacheBytes int64
+	maxBytes   int64
+	now        func() time.Time
+}
+
+// proxyEntry is a cached image, the list holds the most recently used entry at the front
+type proxyEntry struct {
+	url       string
+	image     *models.RemoteImage
+	expiresAt time.Time
+}
+
+// NewImageProxyService creates a new instance of ImageProxyService, the client must refuse non-public addresses
+// like the one from safeurl.NewClient and a non-positive maxSize uses DefaultMaxImageSize
+func NewImageProxyService(itemRepo ImageURLRepository, client *http.Client, resolver safeurl.Resolver, maxSize int64) *ImageProxyService {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxImageSize
+	}
+	return &ImageProxyService{
+		ItemRepo: itemRepo,
+		Client:   client,
+		Resolver: resolver,
+		MaxSize:  maxSize,
+		TTL:      proxyCacheTTL,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		maxBytes: proxyCacheBytes,
+		now:      time.Now,
+	}
+}
+
+// FetchImage returns the image at an external URL that is the image_url of an item,
+// from the cache when it was fetched recently
+func (s *ImageProxyService) FetchImage(ctx context.Context, rawURL string) (*models.RemoteImage, error) {
+	u, err := safeurl.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImageURL, err)
+	}
+	// items store the normalized URL, the same string is the cache key and what is fetched
+	key := u.String()
+
+	// unknown URLs are refused before their host is ever looked up
+	known, err := s.ItemRepo.HasImageURL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: not the image of any item", ErrInvalidImageURL)
+	}
+	if err := safeurl.CheckHost(ctx, s.Resolver, u); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImageURL, err)
+	}
+
+	if img := s.cached(key); img != nil {
+		return img, nil
+	}
+
+	img, err := s.fetch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, img)
+	return img, nil
+}
+
+// fetch downloads and checks a remote image
+func (s *ImageProxyService) fetch(ctx context.Context, url string) (*models.RemoteImage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImageURL, err)
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		// the client error quotes the URL, so only the reason is passed on
+		if errors.Is(err, safeurl.ErrForbiddenHost) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImageURL, safeurl.ErrForbiddenHost)
+		}
+		if errors.Is(err, safeurl.ErrInvalidURL) {
+			return nil, fmt.Errorf("%w: %w: redirect not allowed", ErrInvalidImageURL, safeurl.ErrInvalidURL)
+		}
+		return nil, fmt.Errorf("%w: request failed", ErrRemoteImage)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrRemoteImage, resp.StatusCode)
+	}
+	if resp.ContentLength > s.MaxSize {
+		return nil, fmt.Errorf("%w (max %d bytes)", ErrImageTooLarge, s.MaxSize)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("%w: remote file is not an image", ErrUnsupportedImage)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading failed", ErrRemoteImage)
+	}
+	if int64(len(data)) > s.MaxSize {
+		return nil, fmt.Errorf("%w (max %d bytes)", ErrImageTooLarge, s.MaxSize)
+	}
+
+	// the declared type is only a hint, the content decides what the browser is told
+	contentType := http.DetectContentType(data)
+	if _, ok := imageExtension(contentType); !ok {
+		return nil, fmt.Errorf("%w: remote file is not a jpeg, png, gif or webp image", ErrUnsupportedImage)
+	}
+
+	return &models.RemoteImage{ContentType: contentType, Data: data, FetchedAt: s.now()}, nil
+}
+
+// cached returns an unexpired cached image and marks it as recently used
+func (s *ImageProxyService) cached(url string) *models.RemoteImage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[url]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*proxyEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(el)
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return entry.image
+}
+
+// store caches an image, evicting the least recently used images to stay within the byte budget
+func (s *ImageProxyService) store(url string, img *models.RemoteImage) {
+	size := int64(len(img.Data))
+	if size > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[url]; ok {
+		s.remove(el)
+	}
+	for s.cacheBytes+size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	s.entries[url] = s.lru.PushFront(&proxyEntry{url: url, image: img, expiresAt: s.now().Add(s.TTL)})
+	s.cacheBytes += size
+}
+
+// remove drops a cache entry, the caller holds s.mu
+func (s *ImageProxyService) remove(el *list.Element) {
+	entry := s.lru.Remove(el).(*proxyEntry)
+	delete(s.entries, entry.url)
+	s.cacheBytes -= int64(len(entry.image.Data))
+}
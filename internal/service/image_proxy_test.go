@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is the signature content sniffing recognises as a png
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// fakeImageURLs reports the URLs starting with one of its prefixes as item images
+type fakeImageURLs []string
+
+func (f fakeImageURLs) HasImageURL(_ context.Context, url string) (bool, error) {
+	for _, prefix := range f {
+		if strings.HasPrefix(url, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newProxyFixture starts a stand-in image host reachable as images.example.com
+// and returns a proxy service using it together with the number of requests it served
+func newProxyFixture(t *testing.T, handler http.HandlerFunc) (*ImageProxyService, *atomic.Int32) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	resolver := fakeResolver{"images.example.com": "93.184.216.34", "intranet.example.com": "10.0.0.7"}
+	images := fakeImageURLs{"http://images.example.com/", "http://intranet.example.com/"}
+	return NewImageProxyService(images, client, resolver, 1<<10), &hits
+}
+
+func TestImageProxyService_FetchImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		handler  http.HandlerFunc
+		wantType string
+		wantErr  error
+		wantMsg  string
+	}{
+		{
+			name: "png",
+			url:  "http://images.example.com/a.png",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(pngHeader + "data"))
+			},
+			wantType: "image/png",
+		},
+		{
+			name: "declared type is not trusted",
+			url:  "http://images.example.com/a.png",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte("<svg onload=alert(1)>"))
+			},
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name: "html page",
+			url:  "http://images.example.com/",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = w.Write([]byte(pngHeader))
+			},
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name: "too large",
+			url:  "http://images.example.com/big.png",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(pngHeader + strings.Repeat("x", 2<<10)))
+			},
+			wantErr: ErrImageTooLarge,
+		},
+		{
+			name: "upstream error",
+			url:  "http://images.example.com/missing.png",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: ErrRemoteImage,
+			wantMsg: "status 404",
+		},
+		{
+			name:    "private host",
+			url:     "http://intranet.example.com/a.png",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {},
+			wantErr: ErrInvalidImageURL,
+		},
+		{
+			name:    "not an item image",
+			url:     "https://images.example.com/a.png",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {},
+			wantErr: ErrInvalidImageURL,
+			wantMsg: "not the image of any item",
+		},
+		{
+			name: "checked in normalized form",
+			url:  " HTTP://images.example.com/a.png",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(pngHeader + "data"))
+			},
+			wantType: "image/png",
+		},
+		{
+			name:    "unknown host is refused before lookup",
+			url:     "http://unresolvable.example.com/a.png",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {},
+			wantErr: ErrInvalidImageURL,
+			wantMsg: "not the image of any item",
+		},
+		{
+			name:    "unsupported scheme",
+			url:     "file:///etc/passwd",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {},
+			wantErr: ErrInvalidImageURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newProxyFixture(t, tt.handler)
+			img, err := service.FetchImage(context.Background(), tt.url)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, err.Error(), tt.wantMsg)
+				assert.NotContains(t, err.Error(), `"`)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, img.ContentType)
+		})
+	}
+}
+
+func TestImageProxyService_Cache(t *testing.T) {
+	service, hits := newProxyFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = fmt.Fprintf(w, "GIF89a%s", strings.Repeat("x", 300)+r.URL.Path)
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	service.maxBytes = 700
+
+	fetch := func(path string) {
+		_, err := service.FetchImage(context.Background(), "http://images.example.com"+path)
+		require.NoError(t, err)
+	}
+
+	fetch("/a.gif")
+	fetch("/a.gif")
+	assert.Equal(t, int32(1), hits.Load())
+
+	// b fits next to a, c evicts the least recently used a
+	fetch("/b.gif")
+	fetch("/c.gif")
+	fetch("/b.gif")
+	assert.Equal(t, int32(3), hits.Load())
+	fetch("/a.gif")
+	assert.Equal(t, int32(4), hits.Load())
+
+	now = now.Add(proxyCacheTTL)
+	fetch("/a.gif")
+	assert.Equal(t, int32(5), hits.Load())
+	assert.LessOrEqual(t, service.cacheBytes, service.maxBytes)
+}
@@ -0,0 +1,362 @@
+// Package service contains business logic for handling item images
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder for image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/imaging"
+)
+
+// MediaURLPrefix is the URL path stored images are served under
+const MediaURLPrefix = "/media/"
+
+// DefaultMaxImageSize limits the size of an uploaded image when no limit is configured
+const DefaultMaxImageSize = 5 << 20
+
+const (
+	// imageKeyBytes is the number of random bytes in an image file name
+	imageKeyBytes = 16
+	// maxImagesPerItem limits the number of images of one item
+	maxImagesPerItem = 10
+	// maxImagePixels rejects images that would take too much memory to decode
+	maxImagePixels = 40_000_000
+	// thumbnailSize and mediumSize bound the width and height of the resized variants
+	thumbnailSize = 320
+	mediumSize    = 1024
+	// variantJPEGQuality is the quality variants of opaque images are encoded with
+	variantJPEGQuality = 85
+)
+
+// Errors returned by ImagesService that handlers map to HTTP statuses
+var (
+	ErrImageTooLarge     = errors.New("image is too large")
+	ErrUnsupportedImage  = errors.New("unsupported image type")
+	ErrImageNotFound     = errors.New("image not found")
+	ErrTooManyImages     = errors.New("too many images")
+	ErrInvalidImageOrder = errors.New("invalid image order")
+)
+
+// imageKeyPattern matches the keys generated by UploadItemImage
+var imageKeyPattern = regexp.MustCompile(`^items/[0-9]+/[0-9a-f]{32}(_medium|_thumb)?\.(jpg|png|gif|webp)$`)
+
+// ImageStore is an interface that contains object storage methods,
+// Get and Delete report a missing object with an error wrapping fs.ErrNotExist
+type ImageStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ItemImageRepository is an interface that contains item image repository methods
+type ItemImageRepository interface {
+	Create(ctx context.Context, img *models.ItemImage, maxImages int) (bool, error)
+	ListByItem(ctx context.Context, itemID int) ([]*models.ItemImage, error)
+	Delete(ctx context.Context, itemID, imageID int) (*models.ItemImage, error)
+	Reorder(ctx context.Context, itemID int, imageIDs []int) (bool, error)
+	SetPrimary(ctx context.Context, itemID, imageID int) (bool, error)
+}
+
+// ImagesService provides methods for uploading, arranging and serving item images
+type ImagesService struct {
+	ItemRepo  ItemRepository
+	ImageRepo ItemImageRepository
+	Store     ImageStore
+	MaxSize   int64
+}
+
+// NewImagesService creates a new instance of ImagesService, a non-positive maxSize uses DefaultMaxImageSize
+func NewImagesService(itemRepo ItemRepository, imageRepo ItemImageRepository, store ImageStore, maxSize int64) *ImagesService {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxImageSize
+	}
+	return &ImagesService{ItemRepo: itemRepo, ImageRepo: imageRepo, Store: store, MaxSize: maxSize}
+}
+
+// MaxImageSize returns the largest accepted image in bytes
+func (s *ImagesService) MaxImageSize() int64 {
+	return s.MaxSize
+}
+
+// UploadItemImage stores an image with its thumbnail and medium variants and appends it to the images
+// of an item owned by userID. The type is detected from the content rather than trusted from the client,
+// WebP has no standard library decoder so WebP images serve as their own variants
+func (s *ImagesService) UploadItemImage(ctx context.Context, userID, itemID int, r io.Reader) (*models.ItemImage, error) {
+	if _, err := ownedItem(ctx, s.ItemRepo, userID, itemID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.ImageRepo.ListByItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxImagesPerItem {
+		return nil, fmt.Errorf("%w (max %d per item)", ErrTooManyImages, maxImagesPerItem)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.MaxSize {
+		return nil, fmt.Errorf("%w (max %d bytes)", ErrImageTooLarge, s.MaxSize)
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtension(contentType)
+	if !ok {
+		return nil, fmt.Errorf("%w, use jpeg, png, gif or webp", ErrUnsupportedImage)
+	}
+
+	name, err := newImageName(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []imageObject{{key: name + "." + ext, contentType: contentType, data: data}}
+	img := &models.ItemImage{ItemID: itemID, URL: MediaURLPrefix + objects[0].key}
+	img.MediumURL, img.ThumbnailURL = img.URL, img.URL
+
+	if contentType != "image/webp" {
+		src, err := decodeImage(data)
+		if err != nil {
+			return nil, err
+		}
+		img.Width, img.Height = src.Bounds().Dx(), src.Bounds().Dy()
+
+		for _, v := range []struct {
+			suffix string
+			size   int
+			url    *string
+		}{
+			{suffix: "_medium", size: mediumSize, url: &img.MediumURL},
+			{suffix: "_thumb", size: thumbnailSize, url: &img.ThumbnailURL},
+		} {
+			obj, err := encodeVariant(src, v.size, name+v.suffix)
+			if err != nil {
+				return nil, err
+			}
+			if obj == nil {
+				continue
+			}
+			objects = append(objects, *obj)
+			*v.url = MediaURLPrefix + obj.key
+		}
+	}
+
+	for i, obj := range objects {
+		if err := s.Store.Put(ctx, obj.key, obj.contentType, obj.data); err != nil {
+			s.deleteObjects(ctx, objects[:i])
+			return nil, err
+		}
+	}
+
+	// the count above only saves processing, the repository checks it again under the item lock
+	created, err := s.ImageRepo.Create(ctx, img, maxImagesPerItem)
+	if err != nil || !created {
+		s.deleteObjects(ctx, objects)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, fmt.Errorf("%w (max %d per item)", ErrTooManyImages, maxImagesPerItem)
+	}
+	return img, nil
+}
+
+// DeleteItemImage removes an image of an item owned by userID together with its stored files
+func (s *ImagesService) DeleteItemImage(ctx context.Context, userID, itemID, imageID int) error {
+	if _, err := ownedItem(ctx, s.ItemRepo, userID, itemID); err != nil {
+		return err
+	}
+
+	img, err := s.ImageRepo.Delete(ctx, itemID, imageID)
+	if err != nil {
+		return err
+	}
+	if img == nil {
+		return ErrImageNotFound
+	}
+
+	// the files are no longer referenced, failing to remove them only leaves orphaned files
+	for _, url := range []string{img.URL, img.MediumURL, img.ThumbnailURL} {
+		if key, ok := strings.CutPrefix(url, MediaURLPrefix); ok && imageKeyPattern.MatchString(key) {
+			_ = s.Store.Delete(ctx, key)
+		}
+	}
+	return nil
+}
+
+// ReorderItemImages arranges the images of an item owned by userID in the order of imageIDs,
+// which must list every image of the item exactly once
+func (s *ImagesService) ReorderItemImages(ctx context.Context, userID, itemID int, imageIDs []int) ([]*models.ItemImage, error) {
+	if _, err := ownedItem(ctx, s.ItemRepo, userID, itemID); err != nil {
+		return nil, err
+	}
+
+	images, err := s.ImageRepo.ListByItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageIDs) != len(images) {
+		return nil, fmt.Errorf("%w: expected %d image ids", ErrInvalidImageOrder, len(images))
+	}
+	pending := make(map[int]bool, len(images))
+	for _, img := range images {
+		pending[img.ID] = true
+	}
+	for _, id := range imageIDs {
+		if !pending[id] {
+			return nil, fmt.Errorf("%w: unknown or repeated image id %d", ErrInvalidImageOrder, id)
+		}
+		delete(pending, id)
+	}
+
+	ok, err := s.ImageRepo.Reorder(ctx, itemID, imageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: images changed while reordering", ErrInvalidImageOrder)
+	}
+	return s.listImages(ctx, itemID)
+}
+
+// SetPrimaryItemImage makes an image the primary image of an item owned by userID
+func (s *ImagesService) SetPrimaryItemImage(ctx context.Context, userID, itemID, imageID int) ([]*models.ItemImage, error) {
+	if _, err := ownedItem(ctx, s.ItemRepo, userID, itemID); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.ImageRepo.SetPrimary(ctx, itemID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+	return s.listImages(ctx, itemID)
+}
+
+// OpenImage returns a stored image and its content type, the caller closes the reader
+func (s *ImagesService) OpenImage(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	if !imageKeyPattern.MatchString(key) {
+		return nil, "", ErrImageNotFound
+	}
+	rc, contentType, err := s.Store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, "", ErrImageNotFound
+		}
+		return nil, "", err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return rc, contentType, nil
+}
+
+// listImages returns the images of an item, never nil
+func (s *ImagesService) listImages(ctx context.Context, itemID int) ([]*models.ItemImage, error) {
+	images, err := s.ImageRepo.ListByItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if images == nil {
+		images = []*models.ItemImage{}
+	}
+	return images, nil
+}
+
+// deleteObjects removes stored files of an upload that could not be completed
+func (s *ImagesService) deleteObjects(ctx context.Context, objects []imageObject) {
+	for _, obj := range objects {
+		_ = s.Store.Delete(ctx, obj.key)
+	}
+}
+
+// imageObject is a file of an upload waiting to be stored
+type imageObject struct {
+	key         string
+	contentType string
+	data        []byte
+}
+
+// decodeImage decodes a JPEG, PNG or GIF image after checking its dimensions
+func decodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image could not be decoded", ErrUnsupportedImage)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w (max %d pixels)", ErrImageTooLarge, maxImagePixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image could not be decoded", ErrUnsupportedImage)
+	}
+	return src, nil
+}
+
+// encodeVariant scales an image to fit in a size x size box and names the result name.jpg for opaque images
+// or name.png for others. It returns nil when the image already fits and the original can be used instead
+func encodeVariant(src image.Image, size int, name string) (*imageObject, error) {
+	resized := imaging.Fit(src, size, size)
+	if resized.Bounds().Size() == src.Bounds().Size() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if imaging.IsOpaque(resized) {
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: variantJPEGQuality}); err != nil {
+			return nil, err
+		}
+		return &imageObject{key: name + ".jpg", contentType: "image/jpeg", data: buf.Bytes()}, nil
+	}
+	if err := png.Encode(&buf, resized); err != nil {
+		return nil, err
+	}
+	return &imageObject{key: name + ".png", contentType: "image/png", data: buf.Bytes()}, nil
+}
+
+// imageExtension maps a sniffed content type to the extension images of that type are stored with
+func imageExtension(contentType string) (string, bool) {
+	switch contentType {
+	case "image/jpeg":
+		return "jpg", true
+	case "image/png":
+		return "png", true
+	case "image/gif":
+		return "gif", true
+	case "image/webp":
+		return "webp", true
+	default:
+		return "", false
+	}
+}
+
+// newImageName builds a unique, unguessable storage key prefix for the files of an item image
+func newImageName(itemID int) (string, error) {
+	b := make([]byte, imageKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "items/" + strconv.Itoa(itemID) + "/" + hex.EncodeToString(b), nil
+}
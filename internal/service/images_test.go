@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// MockImageStore is a mock implementation of ImageStore
+type MockImageStore struct {
+	mock.Mock
+}
+
+func (m *MockImageStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	args := m.Called(ctx, key, contentType, data)
+	return args.Error(0)
+}
+
+func (m *MockImageStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(io.ReadCloser), args.String(1), args.Error(2)
+}
+
+func (m *MockImageStore) Delete(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+// MockItemImageRepo is a mock implementation of ItemImageRepo
+type MockItemImageRepo struct {
+	mock.Mock
+}
+
+func (m *MockItemImageRepo) Create(ctx context.Context, img *models.ItemImage, maxImages int) (bool, error) {
+	args := m.Called(ctx, img, maxImages)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockItemImageRepo) ListByItem(ctx context.Context, itemID int) ([]*models.ItemImage, error) {
+	args := m.Called(ctx, itemID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ItemImage), args.Error(1)
+}
+
+func (m *MockItemImageRepo) Delete(ctx context.Context, itemID, imageID int) (*models.ItemImage, error) {
+	args := m.Called(ctx, itemID, imageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ItemImage), args.Error(1)
+}
+
+func (m *MockItemImageRepo) Reorder(ctx context.Context, itemID int, imageIDs []int) (bool, error) {
+	args := m.Called(ctx, itemID, imageIDs)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockItemImageRepo) SetPrimary(ctx context.Context, itemID, imageID int) (bool, error) {
+	args := m.Called(ctx, itemID, imageID)
+	return args.Bool(0), args.Error(1)
+}
+
+// pngImage encodes a w x h PNG, opaque images are solid gray and others fully transparent
+func pngImage(t *testing.T, w, h int, opaque bool) string {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if opaque {
+		for y := range h {
+			for x := range w {
+				img.SetNRGBA(x, y, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.String()
+}
+
+// imagesFixture returns n images of item 1 with ids starting from 1
+func imagesFixture(n int) []*models.ItemImage {
+	images := make([]*models.ItemImage, n)
+	for i := range images {
+		images[i] = &models.ItemImage{ID: i + 1, ItemID: 1, Position: i, IsPrimary: i == 0}
+	}
+	return images
+}
+
+func TestImagesService_UploadItemImage(t *testing.T) {
+	owned := &models.Item{ID: 1, AuthorID: 1}
+	large := pngImage(t, 2000, 1000, true)
+	small := pngImage(t, 100, 100, false)
+
+	tests := []struct {
+		name      string
+		userID    int
+		body      string
+		maxSize   int64
+		setupMock func(*MockItemRepo, *MockItemImageRepo, *MockImageStore)
+		wantErr   error
+		check     func(*testing.T, *models.ItemImage)
+	}{
+		{
+			name:   "large image gets resized variants",
+			userID: 1,
+			body:   large,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, store *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(imagesFixture(1), nil).Once()
+				store.On("Put", mock.Anything, mock.MatchedBy(func(key string) bool {
+					return imageKeyPattern.MatchString(key) && !strings.Contains(key, "_") && strings.HasSuffix(key, ".png")
+				}), "image/png", []byte(large)).Return(nil).Once()
+				store.On("Put", mock.Anything, mock.MatchedBy(func(key string) bool {
+					return imageKeyPattern.MatchString(key) && strings.HasSuffix(key, "_medium.jpg")
+				}), "image/jpeg", mock.MatchedBy(func(data []byte) bool {
+					cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+					return err == nil && cfg.Width == 1024 && cfg.Height == 512
+				})).Return(nil).Once()
+				store.On("Put", mock.Anything, mock.MatchedBy(func(key string) bool {
+					return imageKeyPattern.MatchString(key) && strings.HasSuffix(key, "_thumb.jpg")
+				}), "image/jpeg", mock.MatchedBy(func(data []byte) bool {
+					cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+					return err == nil && cfg.Width == 320 && cfg.Height == 160
+				})).Return(nil).Once()
+				repo.On("Create", mock.Anything, mock.Anything, maxImagesPerItem).Return(true, nil).Once()
+			},
+			check: func(t *testing.T, img *models.ItemImage) {
+				assert.Equal(t, 2000, img.Width)
+				assert.Equal(t, 1000, img.Height)
+				assert.True(t, strings.HasPrefix(img.URL, MediaURLPrefix+"items/1/"))
+				assert.True(t, strings.HasSuffix(img.MediumURL, "_medium.jpg"))
+				assert.True(t, strings.HasSuffix(img.ThumbnailURL, "_thumb.jpg"))
+			},
+		},
+		{
+			name:   "small image is its own variant",
+			userID: 1,
+			body:   small,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, store *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+				store.On("Put", mock.Anything, mock.Anything, "image/png", []byte(small)).Return(nil).Once()
+				repo.On("Create", mock.Anything, mock.Anything, maxImagesPerItem).Return(true, nil).Once()
+			},
+			check: func(t *testing.T, img *models.ItemImage) {
+				assert.Equal(t, img.URL, img.MediumURL)
+				assert.Equal(t, img.URL, img.ThumbnailURL)
+			},
+		},
+		{
+			name:   "webp is stored without variants",
+			userID: 1,
+			body:   "RIFF\x00\x00\x00\x00WEBPVP8 data",
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, store *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+				store.On("Put", mock.Anything, mock.Anything, "image/webp", mock.Anything).Return(nil).Once()
+				repo.On("Create", mock.Anything, mock.Anything, maxImagesPerItem).Return(true, nil).Once()
+			},
+			check: func(t *testing.T, img *models.ItemImage) {
+				assert.True(t, strings.HasSuffix(img.URL, ".webp"))
+				assert.Equal(t, img.URL, img.ThumbnailURL)
+			},
+		},
+		{
+			name:   "corrupt png",
+			userID: 1,
+			body:   "\x89PNG\r\n\x1a\ngarbage",
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+			},
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name:   "not an image",
+			userID: 1,
+			body:   "<html><script>alert(1)</script></html>",
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+			},
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name:    "too large",
+			userID:  1,
+			body:    small,
+			maxSize: 8,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+			},
+			wantErr: ErrImageTooLarge,
+		},
+		{
+			name:   "too many images",
+			userID: 1,
+			body:   small,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(imagesFixture(maxImagesPerItem), nil).Once()
+			},
+			wantErr: ErrTooManyImages,
+		},
+		{
+			name:   "limit reached while uploading",
+			userID: 1,
+			body:   small,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, store *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(imagesFixture(maxImagesPerItem-1), nil).Once()
+				store.On("Put", mock.Anything, mock.Anything, "image/png", []byte(small)).Return(nil).Once()
+				repo.On("Create", mock.Anything, mock.Anything, maxImagesPerItem).Return(false, nil).Once()
+				store.On("Delete", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			wantErr: ErrTooManyImages,
+		},
+		{
+			name:   "not the owner",
+			userID: 2,
+			body:   small,
+			setupMock: func(ir *MockItemRepo, _ *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "item not found",
+			userID: 1,
+			body:   small,
+			setupMock: func(ir *MockItemRepo, _ *MockItemImageRepo, _ *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(nil, nil).Once()
+			},
+			wantErr: ErrItemNotFound,
+		},
+		{
+			name:   "stored files removed when saving fails",
+			userID: 1,
+			body:   large,
+			setupMock: func(ir *MockItemRepo, repo *MockItemImageRepo, store *MockImageStore) {
+				ir.On("GetByID", mock.Anything, 1).Return(owned, nil).Once()
+				repo.On("ListByItem", mock.Anything, 1).Return(nil, nil).Once()
+				store.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Times(3)
+				repo.On("Create", mock.Anything, mock.Anything, maxImagesPerItem).Return(false, errors.New("db error")).Once()
+				store.On("Delete", mock.Anything, mock.Anything).Return(nil).Times(3)
+			},
+			wantErr: errors.New("db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itemRepo := new(MockItemRepo)
+			imageRepo := new(MockItemImageRepo)
+			store := new(MockImageStore)
+			tt.setupMock(itemRepo, imageRepo, store)
+
+			service := NewImagesService(itemRepo, imageRepo, store, tt.maxSize)
+			img, err := service.UploadItemImage(context.Background(), tt.userID, 1, strings.NewReader(tt.body))
+
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, tt.wantErr) {
+					assert.Equal(t, tt.wantErr.Error(), err.Error())
+				}
+				assert.Nil(t, img)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, 1, img.ItemID)
+				tt.check(t, img)
+			}
+			itemRepo.AssertExpectations(t)
+			imageRepo.AssertExpectations(t)
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImagesService_DeleteItemImage(t *testing.T) {
+	const key = "items/1/0123456789abcdef0123456789abcdef"
+
+	itemRepo := new(MockItemRepo)
+	imageRepo := new(MockItemImageRepo)
+	store := new(MockImageStore)
+	service := NewImagesService(itemRepo, imageRepo, store, 0)
+
+	itemRepo.On("GetByID", mock.Anything, 1).Return(&models.Item{ID: 1, AuthorID: 1}, nil)
+	imageRepo.On("Delete", mock.Anything, 1, 5).Return(&models.ItemImage{
+		ID:           5,
+		URL:          MediaURLPrefix + key + ".png",
+		MediumURL:    MediaURLPrefix + key + "_medium.jpg",
+		ThumbnailURL: MediaURLPrefix + key + "_thumb.jpg",
+	}, nil).Once()
+	store.On("Delete", mock.Anything, key+".png").Return(nil).Once()
+	store.On("Delete", mock.Anything, key+"_medium.jpg").Return(nil).Once()
+	store.On("Delete", mock.Anything, key+"_thumb.jpg").Return(errors.New("s3 down")).Once()
+	require.NoError(t, service.DeleteItemImage(context.Background(), 1, 1, 5))
+
+	imageRepo.On("Delete", mock.Anything, 1, 6).Return(nil, nil).Once()
+	require.ErrorIs(t, service.DeleteItemImage(context.Background(), 1, 1, 6), ErrImageNotFound)
+
+	require.ErrorIs(t, service.DeleteItemImage(context.Background(), 2, 1, 5), ErrForbidden)
+
+	imageRepo.AssertExpectations(t)
+	store.AssertExpectations(t)
+}
+
+func TestImagesService_ReorderItemImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int
+		changed bool
+		wantErr error
+	}{
+		{name: "valid order", ids: []int{3, 1, 2}},
+		{name: "images changed meanwhile", ids: []int{3, 1, 2}, changed: true, wantErr: ErrInvalidImageOrder},
+		{name: "missing image", ids: []int{3, 1}, wantErr: ErrInvalidImageOrder},
+		{name: "repeated image", ids: []int{3, 3, 1}, wantErr: ErrInvalidImageOrder},
+		{name: "foreign image", ids: []int{3, 1, 9}, wantErr: ErrInvalidImageOrder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itemRepo := new(MockItemRepo)
+			imageRepo := new(MockItemImageRepo)
+			itemRepo.On("GetByID", mock.Anything, 1).Return(&models.Item{ID: 1, AuthorID: 1}, nil).Once()
+			imageRepo.On("ListByItem", mock.Anything, 1).Return(imagesFixture(3), nil)
+			if tt.wantErr == nil || tt.changed {
+				imageRepo.On("Reorder", mock.Anything, 1, tt.ids).Return(!tt.changed, nil).Once()
+			}
+
+			service := NewImagesService(itemRepo, imageRepo, new(MockImageStore), 0)
+			images, err := service.ReorderItemImages(context.Background(), 1, 1, tt.ids)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, images, 3)
+			}
+			imageRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImagesService_SetPrimaryItemImage(t *testing.T) {
+	itemRepo := new(MockItemRepo)
+	imageRepo := new(MockItemImageRepo)
+	service := NewImagesService(itemRepo, imageRepo, new(MockImageStore), 0)
+
+	itemRepo.On("GetByID", mock.Anything, 1).Return(&models.Item{ID: 1, AuthorID: 1}, nil)
+	imageRepo.On("SetPrimary", mock.Anything, 1, 2).Return(true, nil).Once()
+	imageRepo.On("ListByItem", mock.Anything, 1).Return(imagesFixture(2), nil).Once()
+	images, err := service.SetPrimaryItemImage(context.Background(), 1, 1, 2)
+	require.NoError(t, err)
+	assert.Len(t, images, 2)
+
+	imageRepo.On("SetPrimary", mock.Anything, 1, 9).Return(false, nil).Once()
+	_, err = service.SetPrimaryItemImage(context.Background(), 1, 1, 9)
+	require.ErrorIs(t, err, ErrImageNotFound)
+
+	imageRepo.AssertExpectations(t)
+}
+
+func TestImagesService_OpenImage(t *testing.T) {
+	const key = "items/1/0123456789abcdef0123456789abcdef_thumb.jpg"
+
+	store := new(MockImageStore)
+	service := NewImagesService(new(MockItemRepo), new(MockItemImageRepo), store, 0)
+	assert.Equal(t, int64(DefaultMaxImageSize), service.MaxImageSize())
+
+	store.On("Get", mock.Anything, key).Return(io.NopCloser(bytes.NewReader([]byte("jpg"))), "image/jpeg", nil).Once()
+	rc, contentType, err := service.OpenImage(context.Background(), key)
+	require.NoError(t, err)
+	_ = rc.Close()
+	assert.Equal(t, "image/jpeg", contentType)
+
+	store.On("Get", mock.Anything, key).Return(nil, "", fmt.Errorf("open: %w", fs.ErrNotExist)).Once()
+	_, _, err = service.OpenImage(context.Background(), key)
+	require.ErrorIs(t, err, ErrImageNotFound)
+
+	store.On("Get", mock.Anything, key).Return(nil, "", errors.New("s3 down")).Once()
+	_, _, err = service.OpenImage(context.Background(), key)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrImageNotFound)
+
+	for _, bad := range []string{"../config.yaml", "items/1/../../config.yaml", "items/1/abc.png", "items/1/0123456789abcdef0123456789abcdef.html"} {
+		_, _, err = service.OpenImage(context.Background(), bad)
+		require.ErrorIs(t, err, ErrImageNotFound, bad)
+	}
+
+	store.AssertExpectations(t)
+}
@@ -3,42 +3,113 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"strings"
 
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
+	"github.com/artnikel/marketplace/pkg/safeurl"
+)
+
+// maxSearchQueryLen limits the length of a full-text search query
+const maxSearchQueryLen = 200
+
+// maxCursorPriceLength limits the length of the base price carried by a cursor
+const maxCursorPriceLength = 64
+
+// Errors returned by ItemsService that handlers map to HTTP statuses
+var (
+	ErrItemNotFound      = errors.New("item not found")
+	ErrForbidden         = errors.New("access denied")
+	ErrInvalidItem       = errors.New("invalid item")
+	ErrInvalidTransition = errors.New("item status transition not allowed")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrInvalidFilter     = errors.New("invalid filter")
 )
 
 // ItemRepository is an interface that contains item repository methods
 type ItemRepository interface {
 	Create(ctx context.Context, item *models.Item) error
 	List(ctx context.Context, offset, limit int, filters *models.ItemFilters) ([]*models.Item, error)
+	Count(ctx context.Context, filters *models.ItemFilters) (int, error)
+	GetByID(ctx context.Context, id int) (*models.Item, error)
+	Update(ctx context.Context, id int, upd *models.ItemUpdate) (*models.Item, error)
+	Delete(ctx context.Context, id int) error
+	UpdateStatus(ctx context.Context, id int, from, to models.ItemStatus) (*models.Item, error)
 }
 
-// ItemsService provides methods for managing items
+// ItemsService provides methods for managing items,
+// prices in different currencies are compared in BaseCurrency using the stored exchange rates
 type ItemsService struct {
-	ItemRepo ItemRepository
-	UserRepo UserRepository
+	ItemRepo     ItemRepository
+	UserRepo     UserRepository
+	CategoryRepo CategoryRepository
+	ImageRepo    ItemImageRepository
+	RateRepo     RateRepository
+	BaseCurrency string
+	// Resolver checks that external image URLs point at public hosts
+	Resolver safeurl.Resolver
 }
 
 // NewItemsService creates a new instance of ItemsService
-func NewItemsService(itemRepo ItemRepository, userRepo UserRepository) *ItemsService {
-	return &ItemsService{ItemRepo: itemRepo, UserRepo: userRepo}
+func NewItemsService(itemRepo ItemRepository, userRepo UserRepository, categoryRepo CategoryRepository,
+	imageRepo ItemImageRepository, rateRepo RateRepository, baseCurrency string,
+) *ItemsService {
+	return &ItemsService{
+		ItemRepo:     itemRepo,
+		UserRepo:     userRepo,
+		CategoryRepo: categoryRepo,
+		ImageRepo:    imageRepo,
+		RateRepo:     rateRepo,
+		BaseCurrency: money.NormalizeCurrency(baseCurrency),
+		Resolver:     net.DefaultResolver,
+	}
 }
 
 // CreateItem validates and creates a new item
 func (s *ItemsService) CreateItem(ctx context.Context, input *models.Item) (*models.Item, error) {
-	if input.Title == "" || input.Description == "" || input.Price <= 0 {
+	if input.Title == "" || input.Description == "" || input.Price.Sign() <= 0 {
 		return nil, errors.New("title, description and positive price are required")
 	}
+	input.Currency = money.NormalizeCurrency(input.Currency)
+	price, err := input.Price.ForCurrency(input.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("price: %w", err)
+	}
+	input.Price = price
+
+	input.ImageURL, err = s.validateImageURL(ctx, input.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch input.Status {
+	case "":
+		input.Status = models.ItemStatusActive
+	case models.ItemStatusDraft, models.ItemStatusActive:
+	default:
+		return nil, errors.New("new item status must be draft or active")
+	}
+	if input.CategoryID == 0 {
+		return nil, errors.New("category_id is required")
+	}
+	if err := requireCategory(ctx, s.CategoryRepo, input.CategoryID); err != nil {
+		return nil, err
+	}
 	if err := s.ItemRepo.Create(ctx, input); err != nil {
 		return nil, err
 	}
 	return input, nil
 }
 
-// ListItems returns a paginated list of items based on filters
-func (s *ItemsService) ListItems(ctx context.Context, page, limit int, filters *models.ItemFilters) ([]*models.Item, error) {
+// ListItems returns a page of items based on filters, addressed either by page number
+// or by an opaque cursor taken from the next_cursor of a previous page
+func (s *ItemsService) ListItems(ctx context.Context, req models.PageRequest, filters *models.ItemFilters) (*models.ItemPage, error) {
+	page, limit, cursor := req.Page, req.Limit, req.Cursor
 	if page < 1 {
 		page = 1
 	}
@@ -54,16 +125,387 @@ func (s *ItemsService) ListItems(ctx context.Context, page, limit int, filters *
 
 	filters.Title = strings.TrimSpace(filters.Title)
 	filters.Description = strings.TrimSpace(filters.Description)
+	filters.Query = strings.Join(strings.Fields(strings.Join([]string{filters.Query, filters.Title, filters.Description}, " ")), " ")
+	if len(filters.Query) > maxSearchQueryLen {
+		return nil, fmt.Errorf("%w: search query too long (max 200 characters)", ErrInvalidFilter)
+	}
+
+	if filters.MinPrice.Sign() < 0 {
+		filters.MinPrice = money.Amount{}
+	}
+	if filters.MaxPrice.Sign() < 0 {
+		filters.MaxPrice = money.Amount{}
+	}
+	if filters.MaxPrice.Sign() > 0 && filters.MinPrice.Cmp(filters.MaxPrice) > 0 {
+		return nil, fmt.Errorf("%w: min_price cannot be greater than max_price", ErrInvalidFilter)
+	}
+
+	if filters.CategoryID < 0 {
+		filters.CategoryID = 0
+	}
+
+	if filters.Status == "" {
+		filters.Status = models.ItemStatusActive
+	}
+	if !filters.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown item status", ErrInvalidFilter)
+	}
+	if filters.Status != models.ItemStatusActive && filters.AuthorID == 0 {
+		return nil, ErrForbidden
+	}
+
+	// only whitelisted sort orders reach the repository
+	if filters.Sort == "" {
+		filters.Sort = models.ItemSortNewest
+		if filters.Query != "" {
+			filters.Sort = models.ItemSortRelevance
+		}
+	}
+	if !filters.Sort.Valid() {
+		return nil, fmt.Errorf("%w: unknown sort order", ErrInvalidFilter)
+	}
+	if filters.Sort == models.ItemSortRelevance && filters.Query == "" {
+		return nil, fmt.Errorf("%w: relevance sort requires a search query", ErrInvalidFilter)
+	}
+
+	rates, err := s.normalizePriceFilters(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	filters.After = nil
+	if cursor != "" {
+		if filters.Sort == models.ItemSortRelevance {
+			return nil, fmt.Errorf("%w: not supported for relevance sort", ErrInvalidCursor)
+		}
+		after, err := decodeItemCursor(cursor)
+		if err != nil || after.Sort != filters.Sort {
+			return nil, ErrInvalidCursor
+		}
+		filters.After = after
+		page, offset = 0, 0
+	}
+
+	// one extra row tells whether there is a next page
+	items, err := s.ItemRepo.List(ctx, offset, limit+1, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ItemPage{Page: page, Limit: limit}
+	if len(items) > limit {
+		items = items[:limit]
+		result.HasNext = true
+		if filters.Sort != models.ItemSortRelevance {
+			result.NextCursor = encodeItemCursor(items[len(items)-1], filters.Sort)
+		}
+	}
+	result.Items = items
+
+	if filters.DisplayCurrency != "" {
+		if err := setDisplayPrices(items, rates, filters.DisplayCurrency); err != nil {
+			return nil, err
+		}
+	}
+
+	if !req.SkipTotal {
+		total, err := s.ItemRepo.Count(ctx, filters)
+		if err != nil {
+			return nil, err
+		}
+		totalPages := (total + limit - 1) / limit
+		result.Total = &total
+		result.TotalPages = &totalPages
+	}
+
+	return result, nil
+}
+
+// GetItem returns an item with its author profile and images, drafts are only visible to their author
+func (s *ItemsService) GetItem(ctx context.Context, viewerID, id int) (*models.ItemDetails, error) {
+	item, err := s.ItemRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || (item.Status == models.ItemStatusDraft && item.AuthorID != viewerID) {
+		return nil, ErrItemNotFound
+	}
+
+	author, err := s.UserRepo.GetByID(ctx, item.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	if author == nil {
+		author = &models.User{ID: item.AuthorID, Login: item.AuthorLogin}
+	}
+
+	images, err := s.ImageRepo.ListByItem(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	if images == nil {
+		images = []*models.ItemImage{}
+	}
+
+	return &models.ItemDetails{
+		Item:   item,
+		Author: &models.User{ID: author.ID, Login: author.Login},
+		Images: images,
+	}, nil
+}
+
+// UpdateItem applies a partial update to an item owned by userID
+func (s *ItemsService) UpdateItem(ctx context.Context, userID, id int, upd *models.ItemUpdate) (*models.Item, error) {
+	if upd == nil {
+		upd = &models.ItemUpdate{}
+	}
+	if upd.Title != nil && strings.TrimSpace(*upd.Title) == "" {
+		return nil, fmt.Errorf("%w: title cannot be empty", ErrInvalidItem)
+	}
+	if upd.Description != nil && strings.TrimSpace(*upd.Description) == "" {
+		return nil, fmt.Errorf("%w: description cannot be empty", ErrInvalidItem)
+	}
+	if upd.Price != nil && upd.Price.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: price must be positive", ErrInvalidItem)
+	}
+	if upd.CategoryID != nil {
+		if err := requireCategory(ctx, s.CategoryRepo, *upd.CategoryID); err != nil {
+			return nil, err
+		}
+	}
+	if upd.ImageURL != nil {
+		imageURL, err := s.validateImageURL(ctx, *upd.ImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidItem, err)
+		}
+		upd.ImageURL = &imageURL
+	}
 
-	if filters.MinPrice < 0 {
-		filters.MinPrice = 0
+	current, err := s.getOwnedItem(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Price != nil || upd.Currency != nil {
+		// the price has to fit the currency it ends up with, even when only one of them changes
+		price, currency := current.Price, current.Currency
+		if upd.Price != nil {
+			price = *upd.Price
+		}
+		if upd.Currency != nil {
+			currency = money.NormalizeCurrency(*upd.Currency)
+		}
+		price, err = price.ForCurrency(currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: price: %w", ErrInvalidItem, err)
+		}
+		upd.Price, upd.Currency = &price, &currency
+	}
+
+	item, err := s.ItemRepo.Update(ctx, id, upd)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// DeleteItem removes an item owned by userID
+func (s *ItemsService) DeleteItem(ctx context.Context, userID, id int) error {
+	if _, err := s.getOwnedItem(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.ItemRepo.Delete(ctx, id)
+}
+
+// ChangeItemStatus moves an item owned by userID to a new lifecycle status
+func (s *ItemsService) ChangeItemStatus(ctx context.Context, userID, id int, to models.ItemStatus) (*models.Item, error) {
+	item, err := s.getOwnedItem(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(item.Status, to) {
+		return nil, ErrInvalidTransition
+	}
+
+	updated, err := s.ItemRepo.UpdateStatus(ctx, id, item.Status, to)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, ErrInvalidTransition
+	}
+	return updated, nil
+}
+
+// canTransition reports whether an item may move from one status to another:
+// draft→active, active→reserved, reserved→sold and any→archived
+func canTransition(from, to models.ItemStatus) bool {
+	switch to {
+	case models.ItemStatusActive:
+		return from == models.ItemStatusDraft
+	case models.ItemStatusReserved:
+		return from == models.ItemStatusActive
+	case models.ItemStatusSold:
+		return from == models.ItemStatusReserved
+	case models.ItemStatusArchived:
+		return from != models.ItemStatusArchived
+	default:
+		return false
+	}
+}
+
+// getOwnedItem loads an item and checks that it belongs to userID
+func (s *ItemsService) getOwnedItem(ctx context.Context, userID, id int) (*models.Item, error) {
+	return ownedItem(ctx, s.ItemRepo, userID, id)
+}
+
+// ownedItem loads an item from repo and checks that it belongs to userID
+func ownedItem(ctx context.Context, repo ItemRepository, userID, id int) (*models.Item, error) {
+	item, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+	if userID == 0 || item.AuthorID != userID {
+		return nil, ErrForbidden
+	}
+	return item, nil
+}
+
+// validateImageURL accepts an empty URL, the URL of an uploaded image or an http(s) URL of a public host
+func (s *ItemsService) validateImageURL(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
 	}
-	if filters.MaxPrice < 0 {
-		filters.MaxPrice = 0
+	if key, ok := strings.CutPrefix(raw, MediaURLPrefix); ok {
+		if !imageKeyPattern.MatchString(key) {
+			return "", fmt.Errorf("image_url: %w: unknown uploaded image", safeurl.ErrInvalidURL)
+		}
+		return raw, nil
 	}
-	if filters.MaxPrice > 0 && filters.MinPrice > filters.MaxPrice {
-		return nil, errors.New("min_price cannot be greater than max_price")
+
+	u, err := safeurl.Validate(ctx, s.Resolver, raw)
+	if err != nil {
+		return "", fmt.Errorf("image_url: %w", err)
+	}
+	return u.String(), nil
+}
+
+// normalizePriceFilters validates the filter and display currencies and converts the price bounds
+// to the base currency, the returned rates are nil when no conversion is needed
+func (s *ItemsService) normalizePriceFilters(ctx context.Context, filters *models.ItemFilters) (*rateTable, error) {
+	base := money.NormalizeCurrency(s.BaseCurrency)
+	filters.DisplayCurrency = strings.ToUpper(strings.TrimSpace(filters.DisplayCurrency))
+	filters.Currency = strings.ToUpper(strings.TrimSpace(filters.Currency))
+	if filters.Currency == "" {
+		filters.Currency = filters.DisplayCurrency
+	}
+	if filters.Currency == "" {
+		filters.Currency = base
+	}
+
+	for _, currency := range []string{filters.Currency, filters.DisplayCurrency} {
+		if _, ok := money.Exponent(currency); currency != "" && !ok {
+			return nil, fmt.Errorf("%w: unknown currency %s", ErrInvalidFilter, currency)
+		}
+	}
+
+	convertBounds := filters.Currency != base && (filters.MinPrice.Sign() > 0 || filters.MaxPrice.Sign() > 0)
+	if !convertBounds && filters.DisplayCurrency == "" {
+		filters.Currency = base
+		return nil, nil
 	}
 
-	return s.ItemRepo.List(ctx, offset, limit, filters)
+	rates, err := loadRateTable(ctx, s.RateRepo, base)
+	if err != nil {
+		return nil, err
+	}
+	if filters.DisplayCurrency != "" {
+		if _, ok := rates.rate(filters.DisplayCurrency); !ok {
+			return nil, fmt.Errorf("%w: no exchange rate for %s", ErrInvalidFilter, filters.DisplayCurrency)
+		}
+	}
+
+	if convertBounds {
+		// a little extra precision keeps converted bounds from cutting off prices right at the limit
+		scale, _ := money.Exponent(base)
+		for _, bound := range []*money.Amount{&filters.MinPrice, &filters.MaxPrice} {
+			if bound.Sign() <= 0 {
+				continue
+			}
+			converted, err := rates.convert(*bound, filters.Currency, base, scale+4)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+			}
+			*bound = converted
+		}
+	}
+	filters.Currency = base
+
+	return rates, nil
+}
+
+// setDisplayPrices converts item prices to the display currency,
+// items in currencies without an exchange rate keep only their own price
+func setDisplayPrices(items []*models.Item, rates *rateTable, currency string) error {
+	scale, _ := money.Exponent(currency)
+	for _, item := range items {
+		price, err := rates.convert(item.Price, item.Currency, currency, scale)
+		if errors.Is(err, ErrNoExchangeRate) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		item.DisplayPrice, item.DisplayCurrency = &price, currency
+	}
+	return nil
+}
+
+// encodeItemCursor builds an opaque cursor pointing right after the item in the given sort order
+func encodeItemCursor(item *models.Item, sort models.ItemSort) string {
+	cursor := models.ItemCursor{Sort: sort, CreatedAt: item.CreatedAt, ID: item.ID}
+	switch sort {
+	case models.ItemSortPriceAsc, models.ItemSortPriceDesc:
+		cursor.BasePrice = item.BasePrice
+	case models.ItemSortTitle:
+		cursor.Title = item.Title
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeItemCursor parses a cursor produced by encodeItemCursor
+func decodeItemCursor(cursor string) (*models.ItemCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var c models.ItemCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.ID < 1 || c.CreatedAt.IsZero() {
+		return nil, errors.New("incomplete cursor")
+	}
+	if (c.Sort == models.ItemSortPriceAsc || c.Sort == models.ItemSortPriceDesc) && !isDecimal(c.BasePrice) {
+		return nil, errors.New("cursor without a valid price")
+	}
+	return &c, nil
+}
+
+// isDecimal reports whether s is a plain decimal number such as "12" or "-0.125", the form the database reads as numeric
+func isDecimal(s string) bool {
+	intPart, frac, hasDot := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if intPart == "" || hasDot && frac == "" || len(s) > maxCursorPriceLength {
+		return false
+	}
+	return strings.Trim(intPart+frac, "0123456789") == ""
 }
@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +13,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
+	"github.com/artnikel/marketplace/pkg/safeurl"
 )
 
 // MockItemRepo is a mock implementation of ItemRepo
@@ -31,6 +35,40 @@ func (m *MockItemRepo) List(ctx context.Context, offset, limit int, filters *mod
 	return args.Get(0).([]*models.Item), args.Error(1)
 }
 
+func (m *MockItemRepo) Count(ctx context.Context, filters *models.ItemFilters) (int, error) {
+	args := m.Called(ctx, filters)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockItemRepo) GetByID(ctx context.Context, id int) (*models.Item, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Item), args.Error(1)
+}
+
+func (m *MockItemRepo) Update(ctx context.Context, id int, upd *models.ItemUpdate) (*models.Item, error) {
+	args := m.Called(ctx, id, upd)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Item), args.Error(1)
+}
+
+func (m *MockItemRepo) Delete(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockItemRepo) UpdateStatus(ctx context.Context, id int, from, to models.ItemStatus) (*models.Item, error) {
+	args := m.Called(ctx, id, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Item), args.Error(1)
+}
+
 func TestItemsService_CreateItem(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -44,7 +82,8 @@ func TestItemsService_CreateItem(t *testing.T) {
 			input: &models.Item{
 				Title:       "Test Item",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       money.MustParse("99.99"),
+				CategoryID:  1,
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -64,7 +103,8 @@ func TestItemsService_CreateItem(t *testing.T) {
 			input: &models.Item{
 				Title:       "",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       money.MustParse("99.99"),
+				CategoryID:  1,
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -77,7 +117,8 @@ func TestItemsService_CreateItem(t *testing.T) {
 			input: &models.Item{
 				Title:       "Test Item",
 				Description: "",
-				Price:       99.99,
+				Price:       money.MustParse("99.99"),
+				CategoryID:  1,
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -90,7 +131,7 @@ func TestItemsService_CreateItem(t *testing.T) {
 			input: &models.Item{
 				Title:       "Test Item",
 				Description: "Test Description",
-				Price:       0,
+				Price:       money.Amount{},
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -103,7 +144,7 @@ func TestItemsService_CreateItem(t *testing.T) {
 			input: &models.Item{
 				Title:       "Test Item",
 				Description: "Test Description",
-				Price:       -10.50,
+				Price:       money.MustParse("-10.50"),
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -111,12 +152,116 @@ func TestItemsService_CreateItem(t *testing.T) {
 			wantErr:   true,
 			wantMsg:   "title, description and positive price are required",
 		},
+		{
+			name: "price padded to currency minor unit",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("1.5"),
+				Currency:    "eur",
+				CategoryID:  1,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(m *MockItemRepo) {
+				m.On("Create", mock.Anything, mock.MatchedBy(func(item *models.Item) bool {
+					return item.Price.String() == "1.50" && item.Currency == "EUR"
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "too many fraction digits",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("0.30000000000000004"),
+				CategoryID:  1,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "price: more fraction digits than the currency allows",
+		},
+		{
+			name: "fractional yen",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("100.5"),
+				Currency:    "JPY",
+				CategoryID:  1,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "more fraction digits than the currency allows",
+		},
+		{
+			name: "unknown currency",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("10"),
+				Currency:    "ABC",
+				CategoryID:  1,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "price: unknown currency",
+		},
+		{
+			name: "missing category",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("99.99"),
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "category_id is required",
+		},
+		{
+			name: "unknown category",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("99.99"),
+				CategoryID:  99,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "category not found",
+		},
+		{
+			name: "new item cannot be sold",
+			input: &models.Item{
+				Title:       "Test Item",
+				Description: "Test Description",
+				Price:       money.MustParse("99.99"),
+				Status:      models.ItemStatusSold,
+				AuthorID:    1,
+				AuthorLogin: "testuser",
+			},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "new item status must be draft or active",
+		},
 		{
 			name: "database error",
 			input: &models.Item{
 				Title:       "Test Item",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       money.MustParse("99.99"),
+				CategoryID:  1,
 				AuthorID:    1,
 				AuthorLogin: "testuser",
 			},
@@ -133,9 +278,12 @@ func TestItemsService_CreateItem(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockItemRepo := new(MockItemRepo)
 			mockUserRepo := new(MockUserRepo)
+			mockCategoryRepo := new(MockCategoryRepo)
+			mockCategoryRepo.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1, Name: "Books"}, nil).Maybe()
+			mockCategoryRepo.On("GetByID", mock.Anything, 99).Return(nil, nil).Maybe()
 			tt.setupMock(mockItemRepo)
 
-			service := NewItemsService(mockItemRepo, mockUserRepo)
+			service := NewItemsService(mockItemRepo, mockUserRepo, mockCategoryRepo, new(MockItemImageRepo), new(MockRateRepo), "USD")
 			result, err := service.CreateItem(context.Background(), tt.input)
 
 			if tt.wantErr {
@@ -161,7 +309,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			ID:          1,
 			Title:       "Item 1",
 			Description: "Description 1",
-			Price:       100.00,
+			Price:       money.MustParse("100.00"),
 			AuthorID:    1,
 			AuthorLogin: "user1",
 			CreatedAt:   time.Now(),
@@ -170,7 +318,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			ID:          2,
 			Title:       "Item 2",
 			Description: "Description 2",
-			Price:       200.00,
+			Price:       money.MustParse("200.00"),
 			AuthorID:    2,
 			AuthorLogin: "user2",
 			CreatedAt:   time.Now(),
@@ -191,40 +339,37 @@ func TestItemsService_ListItems(t *testing.T) {
 		wantFilters *models.ItemFilters
 	}{
 		{
-			name:  "successful list with default pagination",
-			page:  1,
-			limit: 10,
-			filters: &models.ItemFilters{
-				MinPrice: 0,
-				MaxPrice: 0,
-			},
+			name:    "successful list with default pagination",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems, nil)
 			},
 			wantErr:     false,
 			wantItems:   2,
 			wantOffset:  0,
 			wantLimit:   10,
-			wantFilters: &models.ItemFilters{MinPrice: 0, MaxPrice: 0},
+			wantFilters: &models.ItemFilters{},
 		},
 		{
 			name:  "page 2 with limit 5",
 			page:  2,
 			limit: 5,
 			filters: &models.ItemFilters{
-				MinPrice: 50,
-				MaxPrice: 150,
+				MinPrice: money.MustParse("50"),
+				MaxPrice: money.MustParse("150"),
 			},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 5, 5, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 5, 6, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems[:1], nil)
 			},
 			wantErr:     false,
 			wantItems:   1,
 			wantOffset:  5,
 			wantLimit:   5,
-			wantFilters: &models.ItemFilters{MinPrice: 50, MaxPrice: 150},
+			wantFilters: &models.ItemFilters{MinPrice: money.MustParse("50"), MaxPrice: money.MustParse("150")},
 		},
 		{
 			name:    "invalid page number (0)",
@@ -232,7 +377,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			limit:   10,
 			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems, nil)
 			},
 			wantErr:    false,
@@ -246,7 +391,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			limit:   10,
 			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems, nil)
 			},
 			wantErr:    false,
@@ -260,7 +405,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			limit:   0,
 			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems, nil)
 			},
 			wantErr:    false,
@@ -274,7 +419,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			limit:   150,
 			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(mockItems, nil)
 			},
 			wantErr:    false,
@@ -287,8 +432,8 @@ func TestItemsService_ListItems(t *testing.T) {
 			page:  1,
 			limit: 10,
 			filters: &models.ItemFilters{
-				MinPrice: 200,
-				MaxPrice: 100,
+				MinPrice: money.MustParse("200"),
+				MaxPrice: money.MustParse("100"),
 			},
 			setupMock: func(_ *MockItemRepo) {},
 			wantErr:   true,
@@ -300,7 +445,7 @@ func TestItemsService_ListItems(t *testing.T) {
 			limit:   10,
 			filters: &models.ItemFilters{},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.AnythingOfType("*models.ItemFilters")).
+				m.On("List", mock.Anything, 0, 11, mock.AnythingOfType("*models.ItemFilters")).
 					Return(nil, errors.New("database connection failed"))
 			},
 			wantErr: true,
@@ -314,7 +459,7 @@ func TestItemsService_ListItems(t *testing.T) {
 				Title: "  Test Item  ",
 			},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.MatchedBy(func(f *models.ItemFilters) bool {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
 					return f.Title == "Test Item"
 				})).Return(mockItems, nil)
 			},
@@ -329,53 +474,716 @@ func TestItemsService_ListItems(t *testing.T) {
 				Description: "  Test Description  ",
 			},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.MatchedBy(func(f *models.ItemFilters) bool {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
 					return f.Description == "Test Description"
 				})).Return(mockItems, nil)
 			},
 			wantErr:   false,
 			wantItems: 2,
 		},
+		{
+			name:  "search query combines legacy title and description filters",
+			page:  1,
+			limit: 10,
+			filters: &models.ItemFilters{
+				Query:       " red  bike ",
+				Title:       "vintage",
+				Description: "  steel frame ",
+			},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Query == "red bike vintage steel frame"
+				})).Return(mockItems, nil)
+			},
+			wantErr:   false,
+			wantItems: 2,
+		},
+		{
+			name:      "search query too long",
+			page:      1,
+			limit:     10,
+			filters:   &models.ItemFilters{Query: strings.Repeat("a", 201)},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "search query too long",
+		},
+		{
+			name:      "non-active status without author",
+			page:      1,
+			limit:     10,
+			filters:   &models.ItemFilters{Status: models.ItemStatusSold},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "access denied",
+		},
+		{
+			name:    "owner lists own drafts",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{Status: models.ItemStatusDraft, AuthorID: 1},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Status == models.ItemStatusDraft && f.AuthorID == 1
+				})).Return(mockItems, nil)
+			},
+			wantErr:   false,
+			wantItems: 2,
+		},
+		{
+			name:    "status defaults to active",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Status == models.ItemStatusActive
+				})).Return(mockItems, nil)
+			},
+			wantErr:   false,
+			wantItems: 2,
+		},
 		{
 			name:  "negative prices are normalized",
 			page:  1,
 			limit: 10,
 			filters: &models.ItemFilters{
-				MinPrice: -50,
-				MaxPrice: -10,
+				MinPrice: money.MustParse("-50"),
+				MaxPrice: money.MustParse("-10"),
+			},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.MinPrice.IsZero() && f.MaxPrice.IsZero()
+				})).Return(mockItems, nil)
+			},
+			wantErr:   false,
+			wantItems: 2,
+		},
+		{
+			name:    "sort defaults to newest",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Sort == models.ItemSortNewest
+				})).Return(mockItems, nil)
+			},
+			wantErr:   false,
+			wantItems: 2,
+		},
+		{
+			name:    "search sort defaults to relevance",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{Query: "bike"},
+			setupMock: func(m *MockItemRepo) {
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Sort == models.ItemSortRelevance
+				})).Return(mockItems, nil)
 			},
+			wantErr:   false,
+			wantItems: 2,
+		},
+		{
+			name:    "explicit price sort",
+			page:    1,
+			limit:   10,
+			filters: &models.ItemFilters{Query: "bike", Sort: models.ItemSortPriceAsc},
 			setupMock: func(m *MockItemRepo) {
-				m.On("List", mock.Anything, 0, 10, mock.MatchedBy(func(f *models.ItemFilters) bool {
-					return f.MinPrice == 0 && f.MaxPrice == 0
+				m.On("List", mock.Anything, 0, 11, mock.MatchedBy(func(f *models.ItemFilters) bool {
+					return f.Sort == models.ItemSortPriceAsc
 				})).Return(mockItems, nil)
 			},
 			wantErr:   false,
 			wantItems: 2,
 		},
+		{
+			name:      "unknown sort",
+			page:      1,
+			limit:     10,
+			filters:   &models.ItemFilters{Sort: "price; DROP TABLE items"},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "unknown sort order",
+		},
+		{
+			name:      "relevance sort without query",
+			page:      1,
+			limit:     10,
+			filters:   &models.ItemFilters{Sort: models.ItemSortRelevance},
+			setupMock: func(_ *MockItemRepo) {},
+			wantErr:   true,
+			wantMsg:   "relevance sort requires a search query",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockItemRepo)
 			tt.setupMock(mockRepo)
+			mockRepo.On("Count", mock.Anything, mock.AnythingOfType("*models.ItemFilters")).Return(25, nil).Maybe()
 
 			service := &ItemsService{
 				ItemRepo: mockRepo,
 			}
 
-			items, err := service.ListItems(context.Background(), tt.page, tt.limit, tt.filters)
+			result, err := service.ListItems(context.Background(), models.PageRequest{Page: tt.page, Limit: tt.limit}, tt.filters)
 
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.wantMsg)
-				assert.Nil(t, items)
+				assert.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, result)
+				assert.Len(t, result.Items, tt.wantItems)
+				assert.Empty(t, result.NextCursor)
+				assert.False(t, result.HasNext)
+				require.NotNil(t, result.Total)
+				assert.Equal(t, 25, *result.Total)
+				assert.Equal(t, (25+result.Limit-1)/result.Limit, *result.TotalPages)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsService_ListItems_Cursor(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 600000, time.UTC)
+	items := make([]*models.Item, 3)
+	for i := range items {
+		items[i] = &models.Item{ID: 10 - i, Title: "Item", CreatedAt: created.Add(-time.Duration(i) * time.Minute)}
+	}
+
+	mockRepo := new(MockItemRepo)
+	mockRepo.On("List", mock.Anything, 0, 3, mock.MatchedBy(func(f *models.ItemFilters) bool {
+		return f.After == nil
+	})).Return(items, nil).Once()
+
+	service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+	first, err := service.ListItems(context.Background(), models.PageRequest{Page: 1, Limit: 2, SkipTotal: true}, &models.ItemFilters{})
+	require.NoError(t, err)
+	assert.Len(t, first.Items, 2)
+	assert.Equal(t, 1, first.Page)
+	assert.True(t, first.HasNext)
+	assert.Nil(t, first.Total)
+	require.NotEmpty(t, first.NextCursor)
+
+	mockRepo.On("List", mock.Anything, 0, 3, mock.MatchedBy(func(f *models.ItemFilters) bool {
+		return f.After != nil && f.After.ID == 9 && f.After.CreatedAt.Equal(items[1].CreatedAt)
+	})).Return(items[2:], nil).Once()
+
+	mockRepo.On("Count", mock.Anything, mock.Anything).Return(3, nil).Once()
+
+	second, err := service.ListItems(context.Background(), models.PageRequest{Page: 5, Limit: 2, Cursor: first.NextCursor}, &models.ItemFilters{})
+	require.NoError(t, err)
+	assert.Len(t, second.Items, 1)
+	assert.Equal(t, 0, second.Page)
+	assert.False(t, second.HasNext)
+	assert.Empty(t, second.NextCursor)
+	assert.Equal(t, 3, *second.Total)
+	assert.Equal(t, 2, *second.TotalPages)
+
+	_, err = service.ListItems(context.Background(), models.PageRequest{Page: 1, Limit: 2, Cursor: "not-a-cursor"}, &models.ItemFilters{})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = service.ListItems(context.Background(), models.PageRequest{Page: 1, Limit: 2, Cursor: first.NextCursor}, &models.ItemFilters{Query: "bike"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = service.ListItems(context.Background(), models.PageRequest{Page: 1, Limit: 2, Cursor: first.NextCursor},
+		&models.ItemFilters{Sort: models.ItemSortPriceAsc})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestItemsService_ListItems_PriceSortCursor(t *testing.T) {
+	items := []*models.Item{
+		{ID: 4, Title: "Cheap", Price: money.MustParse("10.00"), BasePrice: "10.00", CreatedAt: time.Now()},
+		{ID: 2, Title: "Mid", Price: money.MustParse("20.00"), BasePrice: "20.00", CreatedAt: time.Now()},
+		{ID: 7, Title: "Pricey", Price: money.MustParse("30.00"), BasePrice: "30.00", CreatedAt: time.Now()},
+	}
+
+	mockRepo := new(MockItemRepo)
+	mockRepo.On("List", mock.Anything, 0, 3, mock.Anything).Return(items, nil).Once()
+
+	service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+	first, err := service.ListItems(context.Background(), models.PageRequest{Limit: 2, SkipTotal: true},
+		&models.ItemFilters{Query: "bike", Sort: models.ItemSortPriceAsc})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.NextCursor)
+
+	mockRepo.On("List", mock.Anything, 0, 3, mock.MatchedBy(func(f *models.ItemFilters) bool {
+		return f.After != nil && f.After.Sort == models.ItemSortPriceAsc && f.After.BasePrice == "20.00" && f.After.ID == 2
+	})).Return(items[2:], nil).Once()
+
+	second, err := service.ListItems(context.Background(), models.PageRequest{Limit: 2, Cursor: first.NextCursor, SkipTotal: true},
+		&models.ItemFilters{Query: "bike", Sort: models.ItemSortPriceAsc})
+	require.NoError(t, err)
+	assert.Len(t, second.Items, 1)
+	assert.False(t, second.HasNext)
+
+	// the price is bound as numeric, so a cursor carrying anything else is refused before the query
+	forged := encodeItemCursor(&models.Item{ID: 2, CreatedAt: time.Now(), BasePrice: "1e9"}, models.ItemSortPriceAsc)
+	_, err = service.ListItems(context.Background(), models.PageRequest{Limit: 2, Cursor: forged, SkipTotal: true},
+		&models.ItemFilters{Query: "bike", Sort: models.ItemSortPriceAsc})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestItemsService_GetItem(t *testing.T) {
+	item := &models.Item{ID: 1, Title: "Item", AuthorID: 7, AuthorLogin: "seller", Status: models.ItemStatusActive}
+	draft := &models.Item{ID: 1, Title: "Item", AuthorID: 7, AuthorLogin: "seller", Status: models.ItemStatusDraft}
+	images := []*models.ItemImage{{ID: 3, ItemID: 1, IsPrimary: true, URL: "/media/items/1/a.png"}}
+
+	tests := []struct {
+		name       string
+		viewerID   int
+		setupMock  func(*MockItemRepo, *MockUserRepo)
+		wantErr    error
+		wantAuthor *models.User
+	}{
+		{
+			name: "item with author",
+			setupMock: func(ir *MockItemRepo, ur *MockUserRepo) {
+				ir.On("GetByID", mock.Anything, 1).Return(item, nil)
+				ur.On("GetByID", mock.Anything, 7).Return(&models.User{ID: 7, Login: "seller", Hash: "secret"}, nil)
+			},
+			wantAuthor: &models.User{ID: 7, Login: "seller"},
+		},
+		{
+			name: "author missing falls back to item fields",
+			setupMock: func(ir *MockItemRepo, ur *MockUserRepo) {
+				ir.On("GetByID", mock.Anything, 1).Return(item, nil)
+				ur.On("GetByID", mock.Anything, 7).Return(nil, nil)
+			},
+			wantAuthor: &models.User{ID: 7, Login: "seller"},
+		},
+		{
+			name: "item not found",
+			setupMock: func(ir *MockItemRepo, _ *MockUserRepo) {
+				ir.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrItemNotFound,
+		},
+		{
+			name:     "draft hidden from other users",
+			viewerID: 8,
+			setupMock: func(ir *MockItemRepo, _ *MockUserRepo) {
+				ir.On("GetByID", mock.Anything, 1).Return(draft, nil)
+			},
+			wantErr: ErrItemNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockItemRepo := new(MockItemRepo)
+			mockUserRepo := new(MockUserRepo)
+			tt.setupMock(mockItemRepo, mockUserRepo)
+
+			mockImageRepo := new(MockItemImageRepo)
+			mockImageRepo.On("ListByItem", mock.Anything, 1).Return(images, nil).Maybe()
+
+			service := NewItemsService(mockItemRepo, mockUserRepo, new(MockCategoryRepo), mockImageRepo, new(MockRateRepo), "USD")
+			details, err := service.GetItem(context.Background(), tt.viewerID, 1)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, details)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, item, details.Item)
+				assert.Equal(t, tt.wantAuthor, details.Author)
+				assert.Equal(t, images, details.Images)
+			}
+
+			mockItemRepo.AssertExpectations(t)
+			mockUserRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsService_UpdateItem(t *testing.T) {
+	existing := &models.Item{ID: 1, Title: "Old", Description: "Desc", Price: money.MustParse("10.00"), Currency: "USD", AuthorID: 1, AuthorLogin: "user1"}
+	newTitle := "New"
+	emptyTitle := " "
+	badPrice := money.MustParse("-1")
+	precisePrice := money.MustParse("12.345")
+	yen := "JPY"
+
+	tests := []struct {
+		name      string
+		userID    int
+		upd       *models.ItemUpdate
+		setupMock func(*MockItemRepo)
+		wantErr   error
+		wantMsg   string
+	}{
+		{
+			name:   "successful update",
+			userID: 1,
+			upd:    &models.ItemUpdate{Title: &newTitle},
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+				m.On("Update", mock.Anything, 1, mock.MatchedBy(func(u *models.ItemUpdate) bool {
+					return u.Title != nil && *u.Title == "New" && u.Price == nil
+				})).Return(&models.Item{ID: 1, Title: "New", Description: "Desc", Price: money.MustParse("10.00"), Currency: "USD", AuthorID: 1}, nil)
+			},
+		},
+		{
+			name:   "item not found",
+			userID: 1,
+			upd:    &models.ItemUpdate{Title: &newTitle},
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrItemNotFound,
+		},
+		{
+			name:   "not the owner",
+			userID: 2,
+			upd:    &models.ItemUpdate{Title: &newTitle},
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:      "empty title",
+			userID:    1,
+			upd:       &models.ItemUpdate{Title: &emptyTitle},
+			setupMock: func(_ *MockItemRepo) {},
+			wantMsg:   "title cannot be empty",
+		},
+		{
+			name:      "negative price",
+			userID:    1,
+			upd:       &models.ItemUpdate{Price: &badPrice},
+			setupMock: func(_ *MockItemRepo) {},
+			wantMsg:   "price must be positive",
+		},
+		{
+			name:   "price checked against the item currency",
+			userID: 1,
+			upd:    &models.ItemUpdate{Price: &precisePrice},
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+			},
+			wantMsg: "more fraction digits than the currency allows",
+		},
+		{
+			name:   "currency change must fit the current price",
+			userID: 1,
+			upd:    &models.ItemUpdate{Currency: &yen},
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+				m.On("Update", mock.Anything, 1, mock.MatchedBy(func(u *models.ItemUpdate) bool {
+					return u.Currency != nil && *u.Currency == "JPY" && u.Price != nil && u.Price.String() == "10"
+				})).Return(&models.Item{ID: 1, Title: "New", Price: money.MustParse("10"), Currency: "JPY", AuthorID: 1}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockItemRepo)
+			tt.setupMock(mockRepo)
+
+			service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+			item, err := service.UpdateItem(context.Background(), tt.userID, 1, tt.upd)
+
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, item)
+			case tt.wantMsg != "":
+				require.ErrorIs(t, err, ErrInvalidItem)
+				assert.Contains(t, err.Error(), tt.wantMsg)
+				assert.Nil(t, item)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, "New", item.Title)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsService_DeleteItem(t *testing.T) {
+	existing := &models.Item{ID: 1, AuthorID: 1}
+
+	tests := []struct {
+		name      string
+		userID    int
+		setupMock func(*MockItemRepo)
+		wantErr   error
+	}{
+		{
+			name:   "successful delete",
+			userID: 1,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+				m.On("Delete", mock.Anything, 1).Return(nil)
+			},
+		},
+		{
+			name:   "item not found",
+			userID: 1,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(nil, nil)
+			},
+			wantErr: ErrItemNotFound,
+		},
+		{
+			name:   "not the owner",
+			userID: 2,
+			setupMock: func(m *MockItemRepo) {
+				m.On("GetByID", mock.Anything, 1).Return(existing, nil)
+			},
+			wantErr: ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockItemRepo)
+			tt.setupMock(mockRepo)
+
+			service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+			err := service.DeleteItem(context.Background(), tt.userID, 1)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsService_ChangeItemStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    models.ItemStatus
+		to      models.ItemStatus
+		userID  int
+		wantErr error
+	}{
+		{name: "draft to active", from: models.ItemStatusDraft, to: models.ItemStatusActive, userID: 1},
+		{name: "active to reserved", from: models.ItemStatusActive, to: models.ItemStatusReserved, userID: 1},
+		{name: "reserved to sold", from: models.ItemStatusReserved, to: models.ItemStatusSold, userID: 1},
+		{name: "sold to archived", from: models.ItemStatusSold, to: models.ItemStatusArchived, userID: 1},
+		{name: "draft to archived", from: models.ItemStatusDraft, to: models.ItemStatusArchived, userID: 1},
+		{name: "active to sold", from: models.ItemStatusActive, to: models.ItemStatusSold, userID: 1, wantErr: ErrInvalidTransition},
+		{name: "draft to reserved", from: models.ItemStatusDraft, to: models.ItemStatusReserved, userID: 1, wantErr: ErrInvalidTransition},
+		{name: "archived to active", from: models.ItemStatusArchived, to: models.ItemStatusActive, userID: 1, wantErr: ErrInvalidTransition},
+		{name: "archived to archived", from: models.ItemStatusArchived, to: models.ItemStatusArchived, userID: 1, wantErr: ErrInvalidTransition},
+		{name: "to draft", from: models.ItemStatusActive, to: models.ItemStatusDraft, userID: 1, wantErr: ErrInvalidTransition},
+		{name: "not the owner", from: models.ItemStatusActive, to: models.ItemStatusReserved, userID: 2, wantErr: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockItemRepo)
+			mockRepo.On("GetByID", mock.Anything, 1).Return(&models.Item{ID: 1, AuthorID: 1, Status: tt.from}, nil)
+			if tt.wantErr == nil {
+				mockRepo.On("UpdateStatus", mock.Anything, 1, tt.from, tt.to).
+					Return(&models.Item{ID: 1, AuthorID: 1, Status: tt.to}, nil)
+			}
+
+			service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+			item, err := service.ChangeItemStatus(context.Background(), tt.userID, 1, tt.to)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, item)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.to, item.Status)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestItemsService_ChangeItemStatus_ConcurrentChange(t *testing.T) {
+	mockRepo := new(MockItemRepo)
+	mockRepo.On("GetByID", mock.Anything, 1).Return(&models.Item{ID: 1, AuthorID: 1, Status: models.ItemStatusActive}, nil)
+	mockRepo.On("UpdateStatus", mock.Anything, 1, models.ItemStatusActive, models.ItemStatusReserved).Return(nil, nil)
+
+	service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), new(MockRateRepo), "USD")
+	item, err := service.ChangeItemStatus(context.Background(), 1, 1, models.ItemStatusReserved)
+
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	assert.Nil(t, item)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestItemsService_ListItems_Currencies(t *testing.T) {
+	listed := func() []*models.Item {
+		return []*models.Item{
+			{ID: 1, Title: "Dollar", Price: money.MustParse("10.00"), Currency: "USD"},
+			{ID: 2, Title: "Euro", Price: money.MustParse("8.00"), Currency: "EUR"},
+			{ID: 3, Title: "Franc", Price: money.MustParse("5.00"), Currency: "CHF"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		filters     *models.ItemFilters
+		loadsRates  bool
+		listFilters func(*models.ItemFilters) bool
+		wantDisplay map[int]string
+		wantMsg     string
+	}{
+		{
+			name:    "base currency bounds need no rates",
+			filters: &models.ItemFilters{MinPrice: money.MustParse("5")},
+			listFilters: func(f *models.ItemFilters) bool {
+				return f.Currency == "USD" && f.MinPrice.String() == "5"
+			},
+		},
+		{
+			name:       "bounds are converted to the base currency",
+			filters:    &models.ItemFilters{MinPrice: money.MustParse("8"), MaxPrice: money.MustParse("1500"), Currency: "eur"},
+			loadsRates: true,
+			listFilters: func(f *models.ItemFilters) bool {
+				return f.Currency == "USD" && f.MinPrice.String() == "10.000000" && f.MaxPrice.String() == "1875.000000"
+			},
+		},
+		{
+			name:       "display currency converts prices",
+			filters:    &models.ItemFilters{DisplayCurrency: "jpy"},
+			loadsRates: true,
+			listFilters: func(f *models.ItemFilters) bool {
+				return f.DisplayCurrency == "JPY" && f.Currency == "USD"
+			},
+			wantDisplay: map[int]string{1: "1500", 2: "1500"},
+		},
+		{
+			name:       "bounds default to the display currency",
+			filters:    &models.ItemFilters{MaxPrice: money.MustParse("1500"), DisplayCurrency: "JPY"},
+			loadsRates: true,
+			listFilters: func(f *models.ItemFilters) bool {
+				return f.MaxPrice.String() == "10.000000"
+			},
+			wantDisplay: map[int]string{1: "1500", 2: "1500"},
+		},
+		{
+			name:    "unknown currency",
+			filters: &models.ItemFilters{DisplayCurrency: "XYZ"},
+			wantMsg: "unknown currency XYZ",
+		},
+		{
+			name:       "display currency without a rate",
+			filters:    &models.ItemFilters{DisplayCurrency: "GBP"},
+			loadsRates: true,
+			wantMsg:    "no exchange rate for GBP",
+		},
+		{
+			name:       "bounds currency without a rate",
+			filters:    &models.ItemFilters{MinPrice: money.MustParse("1"), Currency: "CHF"},
+			loadsRates: true,
+			wantMsg:    "no exchange rate for currency CHF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockItemRepo)
+			mockRates := new(MockRateRepo)
+			if tt.loadsRates {
+				mockRates.On("List", mock.Anything).Return(ratesFixture(), nil).Once()
+			}
+			if tt.listFilters != nil {
+				mockRepo.On("List", mock.Anything, 0, 11, mock.MatchedBy(tt.listFilters)).Return(listed(), nil).Once()
+			}
+
+			service := NewItemsService(mockRepo, new(MockUserRepo), new(MockCategoryRepo), new(MockItemImageRepo), mockRates, "USD")
+			result, err := service.ListItems(context.Background(), models.PageRequest{SkipTotal: true}, tt.filters)
+
+			if tt.wantMsg != "" {
+				require.ErrorIs(t, err, ErrInvalidFilter)
+				assert.Contains(t, err.Error(), tt.wantMsg)
 			} else {
 				require.NoError(t, err)
-				assert.NotNil(t, items)
-				assert.Len(t, items, tt.wantItems)
+				for _, item := range result.Items {
+					want, ok := tt.wantDisplay[item.ID]
+					if !ok {
+						assert.Nil(t, item.DisplayPrice)
+						continue
+					}
+					require.NotNil(t, item.DisplayPrice)
+					assert.Equal(t, want, item.DisplayPrice.String())
+					assert.Equal(t, "JPY", item.DisplayCurrency)
+				}
 			}
 
 			mockRepo.AssertExpectations(t)
+			mockRates.AssertExpectations(t)
+		})
+	}
+}
+
+// fakeResolver resolves hosts from a fixed table
+type fakeResolver map[string]string
+
+func (f fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ip, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+}
+
+func TestItemsService_CreateItemImageURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		imageURL string
+		wantURL  string
+		wantErr  error
+	}{
+		{name: "no image", imageURL: "", wantURL: ""},
+		{name: "public host", imageURL: " https://cdn.example.com/a.png ", wantURL: "https://cdn.example.com/a.png"},
+		{name: "uploaded image", imageURL: "/media/items/1/0123456789abcdef0123456789abcdef.png", wantURL: "/media/items/1/0123456789abcdef0123456789abcdef.png"},
+		{name: "unknown media path", imageURL: "/media/../config.yaml", wantErr: safeurl.ErrInvalidURL},
+		{name: "javascript url", imageURL: "javascript:alert(document.cookie)", wantErr: safeurl.ErrInvalidURL},
+		{name: "loopback", imageURL: "http://127.0.0.1:8080/admin", wantErr: safeurl.ErrForbiddenHost},
+		{name: "host resolving to private network", imageURL: "https://intranet.example.com/a.png", wantErr: safeurl.ErrForbiddenHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockItemRepo)
+			if tt.wantErr == nil {
+				mockRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+			}
+
+			mockCategoryRepo := new(MockCategoryRepo)
+			mockCategoryRepo.On("GetByID", mock.Anything, 1).Return(&models.Category{ID: 1, Name: "Books"}, nil).Maybe()
+
+			service := NewItemsService(mockRepo, new(MockUserRepo), mockCategoryRepo, new(MockItemImageRepo), new(MockRateRepo), "USD")
+			service.Resolver = fakeResolver{"cdn.example.com": "93.184.216.34", "intranet.example.com": "192.168.10.4"}
+
+			item, err := service.CreateItem(context.Background(), &models.Item{
+				Title: "Item", Description: "Desc", Price: money.MustParse("10"), ImageURL: tt.imageURL, CategoryID: 1, AuthorID: 1,
+			})
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.True(t, strings.HasPrefix(err.Error(), "image_url: "))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantURL, item.ImageURL)
+			}
+			mockRepo.AssertExpectations(t)
 		})
 	}
 }
@@ -0,0 +1,127 @@
+// Package service contains business logic for throttling failed logins
+package service
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// loginGuardMaxEntries is the number of tracked keys, a failure of a new key beyond it drops the key whose last failure is the oldest
+const loginGuardMaxEntries = 10000
+
+// loginGuard counts failed logins per key, such as a login or an address, and locks a key out after
+// maxAttempts failures. Every further lockout of the key doubles its duration up to maxLockout, and the key
+// is forgotten once maxLockout passes after its last failure and lockout. State is kept in memory of the running instance
+type loginGuard struct {
+	mu          sync.Mutex
+	maxAttempts int
+	lockout     time.Duration
+	maxLockout  time.Duration
+	entries     map[string]*list.Element
+	// lru orders the entries by their last failure, the most recent at the front
+	lru *list.List
+}
+
+// loginGuardEntry is the failure history of a key
+type loginGuardEntry struct {
+	key         string
+	failures    int
+	lockouts    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// newLoginGuard creates a loginGuard
+func newLoginGuard(maxAttempts int, lockout, maxLockout time.Duration) *loginGuard {
+	return &loginGuard{
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
+		maxLockout:  maxLockout,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// retryAfter returns how long key stays locked out, zero when it is not locked
+func (g *loginGuard) retryAfter(key string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	el, ok := g.entries[key]
+	if !ok {
+		return 0
+	}
+	entry := el.Value.(*loginGuardEntry)
+	if !now.Before(entry.lockedUntil) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+// fail records a failed login of key, it returns the lockout duration when the failure locked key out
+func (g *loginGuard) fail(key string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entry := g.touch(key)
+	if g.stale(entry, now) {
+		*entry = loginGuardEntry{key: key}
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures < g.maxAttempts {
+		return 0
+	}
+
+	entry.failures = 0
+	entry.lockouts++
+	d := g.lockout
+	for i := 1; i < entry.lockouts && d < g.maxLockout; i++ {
+		d *= 2
+	}
+	d = min(d, g.maxLockout)
+	entry.lockedUntil = now.Add(d)
+	return d
+}
+
+// reset forgets the failures of key
+func (g *loginGuard) reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if el, ok := g.entries[key]; ok {
+		g.lru.Remove(el)
+		delete(g.entries, key)
+	}
+}
+
+// touch returns the entry of key moved to the front of the LRU list, a new key drops the least recently failed one at the cap
+func (g *loginGuard) touch(key string) *loginGuardEntry {
+	if el, ok := g.entries[key]; ok {
+		g.lru.MoveToFront(el)
+		return el.Value.(*loginGuardEntry)
+	}
+	if g.lru.Len() >= loginGuardMaxEntries {
+		oldest := g.lru.Back()
+		g.lru.Remove(oldest)
+		delete(g.entries, oldest.Value.(*loginGuardEntry).key)
+	}
+	entry := &loginGuardEntry{key: key}
+	g.entries[key] = g.lru.PushFront(entry)
+	return entry
+}
+
+// stale reports whether maxLockout passed since the last failure and the end of the last lockout of entry
+func (g *loginGuard) stale(entry *loginGuardEntry, now time.Time) bool {
+	return now.Sub(entry.lastActive()) >= g.maxLockout
+}
+
+// lastActive returns the later of the last failure and the end of the last lockout of entry
+func (e *loginGuardEntry) lastActive() time.Time {
+	if e.lockedUntil.After(e.lastFailure) {
+		return e.lockedUntil
+	}
+	return e.lastFailure
+}
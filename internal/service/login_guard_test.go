@@ -0,0 +1,66 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginGuard(t *testing.T) {
+	g := newLoginGuard(3, time.Minute, 5*time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Zero(t, g.fail("alice", now))
+	assert.Zero(t, g.fail("alice", now))
+	assert.Equal(t, time.Minute, g.fail("alice", now))
+	assert.Equal(t, time.Minute, g.retryAfter("alice", now))
+	assert.Equal(t, 30*time.Second, g.retryAfter("alice", now.Add(30*time.Second)))
+	assert.Zero(t, g.retryAfter("bob", now))
+
+	// every further lockout doubles up to the maximum
+	now = now.Add(time.Minute)
+	assert.Zero(t, g.retryAfter("alice", now))
+	g.fail("alice", now)
+	g.fail("alice", now)
+	assert.Equal(t, 2*time.Minute, g.fail("alice", now))
+
+	for _, want := range []time.Duration{4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		now = now.Add(5 * time.Minute)
+		g.fail("alice", now)
+		g.fail("alice", now)
+		assert.Equal(t, want, g.fail("alice", now))
+	}
+
+	// failures are forgotten once the maximum lockout passes after the last lockout
+	now = now.Add(10 * time.Minute)
+	g.fail("alice", now)
+	g.fail("alice", now)
+	assert.Equal(t, time.Minute, g.fail("alice", now))
+
+	g.reset("alice")
+	assert.Zero(t, g.retryAfter("alice", now))
+}
+
+func TestLoginGuard_MaxEntries(t *testing.T) {
+	g := newLoginGuard(3, time.Minute, 5*time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range loginGuardMaxEntries {
+		g.fail("key"+strconv.Itoa(i), now)
+	}
+	assert.Len(t, g.entries, loginGuardMaxEntries)
+
+	// a failure moves key0 to the front, so key1 is the least recently failed key and makes room
+	g.fail("key0", now)
+	g.fail("alice", now)
+	assert.Len(t, g.entries, loginGuardMaxEntries)
+	assert.Equal(t, loginGuardMaxEntries, g.lru.Len())
+	assert.Contains(t, g.entries, "key0")
+	assert.NotContains(t, g.entries, "key1")
+
+	g.reset("alice")
+	assert.Len(t, g.entries, loginGuardMaxEntries-1)
+	assert.Equal(t, loginGuardMaxEntries-1, g.lru.Len())
+}
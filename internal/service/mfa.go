@@ -0,0 +1,276 @@
+// Package service contains business logic for two-factor authentication
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/totp"
+)
+
+// mfaPurpose is the purpose of the token that connects the password step and the code step of a login
+const mfaPurpose = "mfa"
+
+// recoveryCodeBytes is the amount of randomness in a recovery code
+const recoveryCodeBytes = 10
+
+// totpSkew is the number of time steps before and after the current one whose codes are accepted
+const totpSkew = 1
+
+// Errors returned by AuthService during two-factor authentication
+var (
+	ErrMFARequired       = errors.New("two-factor code required")
+	ErrInvalidMFAToken   = errors.New("invalid or expired two-factor login, please log in again")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotSetUp       = errors.New("two-factor authentication was not set up")
+)
+
+// MFARequiredError is returned by Login when the password was right and the user has to send a second factor
+// with Token to VerifyMFA, it matches ErrMFARequired. ExpiresIn is the lifetime of Token in seconds
+type MFARequiredError struct {
+	Token     string
+	ExpiresIn int
+}
+
+// Error returns the message of ErrMFARequired
+func (e *MFARequiredError) Error() string { return ErrMFARequired.Error() }
+
+// Is reports whether target is ErrMFARequired
+func (e *MFARequiredError) Is(target error) bool { return target == ErrMFARequired }
+
+// requireMFA returns an *MFARequiredError when the user has TOTP enabled and nil otherwise
+func (s *AuthService) requireMFA(ctx context.Context, user *models.User) error {
+	cred, err := s.MFARepo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if cred == nil || cred.EnabledAt == nil {
+		return nil
+	}
+
+	ttl := s.cfg.MFA.PendingTTL
+	if ttl <= 0 {
+		ttl = constants.MFAPendingTTL
+	}
+	token, err := s.Keys.SignPurpose(mfaPurpose, user.ID, user.Login, ttl)
+	if err != nil {
+		return errors.New("failed to generate token")
+	}
+	return &MFARequiredError{Token: token, ExpiresIn: int(ttl / time.Second)}
+}
+
+// VerifyMFA finishes a login that returned an *MFARequiredError. code is a current TOTP code or an unused
+// recovery code, wrong codes count as failed logins of the user and of the client address. The tokens belong to
+// a new session from client
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code string, client models.ClientInfo) (*models.User, *models.AuthTokens, error) {
+	ip := client.IP
+	claims, err := s.Keys.ParsePurpose(mfaToken, mfaPurpose)
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	now := s.now()
+	if wait := s.lockedOut(claims.Login, ip, now); wait > 0 {
+		return nil, nil, &TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrAccountDisabled
+	}
+
+	cred, err := s.MFARepo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if cred == nil || cred.EnabledAt == nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	ok, err := s.checkSecondFactor(ctx, cred, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		if err := s.recordFailure(ctx, user, user.Login, ip, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidMFACode
+	}
+	s.accounts.reset(user.Login)
+
+	tokens, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, tokens, nil
+}
+
+// SetupTOTP generates a new TOTP secret for a user, it stays inactive until ConfirmTOTP accepts a code of it
+func (s *AuthService) SetupTOTP(ctx context.Context, userID int) (*models.TOTPSetup, error) {
+	user, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+	ok, err := s.MFARepo.SaveTOTP(ctx, user.ID, secret)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if !ok {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	issuer := s.cfg.MFA.Issuer
+	if issuer == "" {
+		issuer = constants.MFAIssuer
+	}
+	return &models.TOTPSetup{Secret: secret, URI: totp.URI(issuer, user.Login, secret)}, nil
+}
+
+// ConfirmTOTP enables the secret from SetupTOTP once code shows the authenticator app was set up, and returns
+// recovery codes that replace a TOTP code once each. Only hashes of the codes are stored, so they are shown only here
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	if _, err := s.activeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	cred, err := s.MFARepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if cred == nil {
+		return nil, ErrMFANotSetUp
+	}
+	if cred.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	counter, ok := totp.Validate(cred.Secret, code, s.now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, constants.RecoveryCodes)
+	hashes := make([]string, constants.RecoveryCodes)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, errors.New("failed to generate recovery codes")
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	ok, err = s.MFARepo.EnableTOTP(ctx, userID, counter, hashes)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if !ok {
+		// a concurrent request confirmed the secret first
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off, the user proves it is them with the password and a current
+// TOTP or recovery code
+func (s *AuthService) DisableTOTP(ctx context.Context, userID int, password, code string) error {
+	user, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !s.passwordMatches(user.Hash, password) {
+		return ErrWrongPassword
+	}
+
+	cred, err := s.MFARepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if cred == nil || cred.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	ok, err := s.checkSecondFactor(ctx, cred, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	if err := s.MFARepo.DeleteTOTP(ctx, userID); err != nil {
+		return errors.New("database error")
+	}
+	return nil
+}
+
+// checkSecondFactor reports whether code is a TOTP code of cred that was not used before or an unused recovery code,
+// the accepted code is used up
+func (s *AuthService) checkSecondFactor(ctx context.Context, cred *models.TOTPCredential, code string) (bool, error) {
+	if counter, ok := totp.Validate(cred.Secret, code, s.now(), totpSkew); ok {
+		ok, err := s.MFARepo.UseTOTPCounter(ctx, cred.UserID, counter)
+		if err != nil {
+			return false, errors.New("database error")
+		}
+		return ok, nil
+	}
+
+	ok, err := s.MFARepo.UseRecoveryCode(ctx, cred.UserID, hashRecoveryCode(code))
+	if err != nil {
+		return false, errors.New("database error")
+	}
+	return ok, nil
+}
+
+// activeUser returns the user with userID, ErrAccountDisabled when the user is gone or disabled
+func (s *AuthService) activeUser(ctx context.Context, userID int) (*models.User, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return user, nil
+}
+
+// newRecoveryCode returns a random recovery code in groups of four characters, such as abcd-efgh-ijkl-mnop
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+
+	groups := make([]string, 0, len(code)/4)
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// hashRecoveryCode returns the stored form of a recovery code, case, spaces and dashes do not matter
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashRefreshToken(code)
+}
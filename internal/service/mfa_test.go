@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/totp"
+)
+
+type MockMFARepo struct {
+	mock.Mock
+}
+
+func (m *MockMFARepo) GetTOTP(ctx context.Context, userID int) (*models.TOTPCredential, error) {
+	args := m.Called(ctx, userID)
+	cred, _ := args.Get(0).(*models.TOTPCredential)
+	return cred, args.Error(1)
+}
+
+func (m *MockMFARepo) SaveTOTP(ctx context.Context, userID int, secret string) (bool, error) {
+	args := m.Called(ctx, userID, secret)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) EnableTOTP(ctx context.Context, userID int, counter int64, codeHashes []string) (bool, error) {
+	args := m.Called(ctx, userID, counter, codeHashes)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	args := m.Called(ctx, userID, counter)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	args := m.Called(ctx, userID, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) DeleteTOTP(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// noMFA returns an MFA repository of users without two-factor authentication
+func noMFA() *MockMFARepo {
+	m := new(MockMFARepo)
+	m.On("GetTOTP", mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+	return m
+}
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestAuthService_LoginWithMFA(t *testing.T) {
+	hashed := hashPassword(t, "password123")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	enabledAt := now.Add(-time.Hour)
+	user := &models.User{ID: 1, Login: "testuser", Hash: hashed}
+	cred := &models.TOTPCredential{UserID: 1, Secret: testTOTPSecret, EnabledAt: &enabledAt}
+	counter := totp.Counter(now)
+	code, err := totp.Code(testTOTPSecret, counter)
+	require.NoError(t, err)
+
+	userRepo := new(MockUserRepo)
+	tokenRepo := new(MockRefreshTokenRepo)
+	mfaRepo := new(MockMFARepo)
+	cfg := &config.Config{Login: config.LoginConfig{MaxAttempts: 3}}
+	authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), mfaRepo, new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+	authService.now = func() time.Time { return now }
+
+	userRepo.On("GetByLogin", mock.Anything, "testuser").Return(user, nil)
+	userRepo.On("GetByID", mock.Anything, 1).Return(user, nil)
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(cred, nil)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+	// the password alone yields a pending token, not an access token
+	_, tokens, err := authService.Login(context.Background(), "testuser", "password123", models.ClientInfo{IP: "192.0.2.1"})
+	var pending *MFARequiredError
+	require.ErrorAs(t, err, &pending)
+	require.ErrorIs(t, err, ErrMFARequired)
+	assert.Nil(t, tokens)
+	assert.Equal(t, 300, pending.ExpiresIn)
+
+	_, err = authService.ParseToken(pending.Token)
+	require.Error(t, err, "a pending token must not authorize requests")
+
+	mfaRepo.On("UseTOTPCounter", mock.Anything, 1, counter).Return(true, nil).Once()
+	loggedIn, tokens, err := authService.VerifyMFA(context.Background(), pending.Token, code, models.ClientInfo{IP: "192.0.2.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", loggedIn.Login)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// a replayed code is refused
+	mfaRepo.On("UseTOTPCounter", mock.Anything, 1, counter).Return(false, nil).Once()
+	_, _, err = authService.VerifyMFA(context.Background(), pending.Token, code, models.ClientInfo{IP: "192.0.2.1"})
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+
+	// a recovery code is accepted in place of a TOTP code, in any case and grouping
+	mfaRepo.On("UseRecoveryCode", mock.Anything, 1, hashRecoveryCode("abcd-efgh-ijkl-mnop")).Return(true, nil).Once()
+	_, tokens, err = authService.VerifyMFA(context.Background(), pending.Token, "ABCD EFGH IJKL MNOP", models.ClientInfo{IP: "192.0.2.1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// an access token cannot stand in for the pending token
+	_, _, err = authService.VerifyMFA(context.Background(), tokens.AccessToken, code, models.ClientInfo{IP: "192.0.2.1"})
+	require.ErrorIs(t, err, ErrInvalidMFAToken)
+
+	// wrong codes count as failed logins
+	mfaRepo.On("UseRecoveryCode", mock.Anything, 1, mock.Anything).Return(false, nil)
+	audit := authService.Audit.(*MockAuditLog)
+	audit.On("Record", mock.Anything, mock.MatchedBy(func(e *models.AuditEntry) bool {
+		return e.Event == models.AuditAccountLocked && e.Login == "testuser"
+	})).Return(nil).Once()
+	for i := 0; i < 3; i++ {
+		_, _, err = authService.VerifyMFA(context.Background(), pending.Token, "000000", models.ClientInfo{IP: "192.0.2.1"})
+		require.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, _, err = authService.VerifyMFA(context.Background(), pending.Token, "000000", models.ClientInfo{IP: "192.0.2.1"})
+	require.ErrorIs(t, err, ErrTooManyAttempts)
+
+	audit.AssertExpectations(t)
+}
+
+func TestAuthService_TOTPEnrollment(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	counter := totp.Counter(now)
+
+	userRepo := new(MockUserRepo)
+	mfaRepo := new(MockMFARepo)
+	cfg := &config.Config{MFA: config.MFAConfig{Issuer: "Shop"}}
+	authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), mfaRepo, new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+	authService.now = func() time.Time { return now }
+
+	userRepo.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+
+	var secret string
+	mfaRepo.On("SaveTOTP", mock.Anything, 1, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) { secret = args.String(2) }).Return(true, nil).Once()
+	setup, err := authService.SetupTOTP(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, secret, setup.Secret)
+	assert.Contains(t, setup.URI, "otpauth://totp/Shop:testuser?")
+
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(&models.TOTPCredential{UserID: 1, Secret: secret}, nil).Once()
+	_, err = authService.ConfirmTOTP(context.Background(), 1, "000000")
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+
+	code, err := totp.Code(secret, counter)
+	require.NoError(t, err)
+	var hashes []string
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(&models.TOTPCredential{UserID: 1, Secret: secret}, nil).Once()
+	mfaRepo.On("EnableTOTP", mock.Anything, 1, counter, mock.Anything).
+		Run(func(args mock.Arguments) { hashes = args.Get(3).([]string) }).Return(true, nil).Once()
+	codes, err := authService.ConfirmTOTP(context.Background(), 1, code)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	require.Len(t, hashes, 10)
+	assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+	assert.Equal(t, hashRecoveryCode(codes[0]), hashes[0])
+	assert.NotContains(t, hashes, codes[0], "only hashes of recovery codes are stored")
+
+	mfaRepo.On("SaveTOTP", mock.Anything, 1, mock.AnythingOfType("string")).Return(false, nil).Once()
+	_, err = authService.SetupTOTP(context.Background(), 1)
+	require.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(nil, nil).Once()
+	_, err = authService.ConfirmTOTP(context.Background(), 1, code)
+	require.ErrorIs(t, err, ErrMFANotSetUp)
+
+	mfaRepo.AssertExpectations(t)
+}
+
+func TestAuthService_DisableTOTP(t *testing.T) {
+	hashed := hashPassword(t, "password123")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	enabledAt := now.Add(-time.Hour)
+	code, err := totp.Code(testTOTPSecret, totp.Counter(now))
+	require.NoError(t, err)
+
+	userRepo := new(MockUserRepo)
+	mfaRepo := new(MockMFARepo)
+	authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), mfaRepo, new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	authService.now = func() time.Time { return now }
+
+	userRepo.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser", Hash: hashed}, nil)
+
+	err = authService.DisableTOTP(context.Background(), 1, "wrong", code)
+	require.ErrorIs(t, err, ErrWrongPassword)
+
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(nil, nil).Once()
+	err = authService.DisableTOTP(context.Background(), 1, "password123", code)
+	require.ErrorIs(t, err, ErrMFANotEnabled)
+
+	mfaRepo.On("GetTOTP", mock.Anything, 1).Return(&models.TOTPCredential{UserID: 1, Secret: testTOTPSecret, EnabledAt: &enabledAt}, nil)
+	mfaRepo.On("UseTOTPCounter", mock.Anything, 1, totp.Counter(now)).Return(true, nil).Once()
+	mfaRepo.On("DeleteTOTP", mock.Anything, 1).Return(nil).Once()
+	err = authService.DisableTOTP(context.Background(), 1, "password123", code)
+	require.NoError(t, err)
+
+	mfaRepo.AssertExpectations(t)
+}
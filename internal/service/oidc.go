@@ -0,0 +1,306 @@
+// Package service contains business logic for OpenID Connect login
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/oidc"
+)
+
+// OIDCProvider is an OpenID provider users sign in at with the authorization code flow and PKCE
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error)
+	Exchange(ctx context.Context, code, verifier, nonce string) (*oidc.Identity, error)
+}
+
+// IdentityRepository is an interface that contains external identity repository methods
+type IdentityRepository interface {
+	GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	ListByUser(ctx context.Context, userID int) ([]*models.UserIdentity, error)
+	Create(ctx context.Context, identity *models.UserIdentity) (bool, error)
+	CreateWithUser(ctx context.Context, login string, identity *models.UserIdentity) (*models.User, error)
+	CountByUser(ctx context.Context, userID int) (int, error)
+	Delete(ctx context.Context, userID, id int) (bool, error)
+}
+
+// OIDCStateRepository is an interface that contains pending OpenID sign-in repository methods
+type OIDCStateRepository interface {
+	Create(ctx context.Context, state *models.OIDCState) error
+	Consume(ctx context.Context, hash string) (*models.OIDCState, error)
+}
+
+const (
+	// loginSuffixBytes is the amount of randomness appended to a login taken from an identity that is already in use
+	loginSuffixBytes = 3
+	// loginAttempts is how many suffixed logins are tried for a new user of an identity
+	loginAttempts = 4
+)
+
+// Errors returned by OIDCService
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired sign-in, please start again")
+	ErrOIDCLogin        = errors.New("sign-in with the identity provider failed")
+	ErrIdentityLinked   = errors.New("identity is linked to another account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastIdentity     = errors.New("cannot unlink the only sign-in method of an account without a password")
+)
+
+// invalidLoginChars matches the runs of characters that are not allowed in logins
+var invalidLoginChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// OIDCResult is the outcome of a finished sign-in, Tokens is nil when an identity was linked to a signed in user
+type OIDCResult struct {
+	User     *models.User
+	Tokens   *models.AuthTokens
+	Identity *models.UserIdentity
+}
+
+// OIDCService signs users in with external OpenID providers. A known subject logs its user in, an unknown one
+// creates a user without a password unless a signed in user started the flow to link it. Identities are never
+// matched to users by email, since providers do not prove that the email belongs to the marketplace user
+type OIDCService struct {
+	Auth       *AuthService
+	Identities IdentityRepository
+	States     OIDCStateRepository
+	Providers  map[string]OIDCProvider
+	stateTTL   time.Duration
+}
+
+// NewOIDCService creates a new instance of OIDCService, tokens are issued and second factors required by auth
+func NewOIDCService(
+	auth *AuthService, identities IdentityRepository, states OIDCStateRepository, providers map[string]OIDCProvider, stateTTL time.Duration,
+) *OIDCService {
+	if stateTTL <= 0 {
+		stateTTL = constants.OIDCStateTTL
+	}
+	return &OIDCService{Auth: auth, Identities: identities, States: states, Providers: providers, stateTTL: stateTTL}
+}
+
+// ProviderNames returns the names of the configured providers in order
+func (s *OIDCService) ProviderNames() []string {
+	names := make([]string, 0, len(s.Providers))
+	for name := range s.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start begins a sign-in at provider and returns the URL to send the user to with the state the provider
+// sends back. A non-zero userID links the identity to that user instead of logging in
+func (s *OIDCService) Start(ctx context.Context, provider string, userID int) (authURL, state string, err error) {
+	p, ok := s.Providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err = oidc.NewVerifier()
+	if err != nil {
+		return "", "", errors.New("failed to generate state")
+	}
+	nonce, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", errors.New("failed to generate state")
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", errors.New("failed to generate state")
+	}
+
+	authURL, err = p.AuthCodeURL(ctx, state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		return "", "", ErrOIDCLogin
+	}
+
+	pending := &models.OIDCState{
+		StateHash:    hashRefreshToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    s.Auth.now().Add(s.stateTTL),
+	}
+	if userID != 0 {
+		pending.UserID = &userID
+	}
+	if err := s.States.Create(ctx, pending); err != nil {
+		return "", "", errors.New("database error")
+	}
+
+	return authURL, state, nil
+}
+
+// Callback finishes a sign-in with the code and state the provider redirected back with, logins start a session
+// from client. Users with two-factor authentication get an *MFARequiredError like Login does
+func (s *OIDCService) Callback(ctx context.Context, code, state string, client models.ClientInfo) (*OIDCResult, error) {
+	pending, err := s.States.Consume(ctx, hashRefreshToken(state))
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if pending == nil || !s.Auth.now().Before(pending.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+	p, ok := s.Providers[pending.Provider]
+	if !ok {
+		return nil, ErrInvalidOIDCState
+	}
+
+	external, err := p.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return nil, ErrOIDCLogin
+	}
+
+	identity, err := s.Identities.GetBySubject(ctx, pending.Provider, external.Subject)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	if pending.UserID != nil {
+		return s.link(ctx, *pending.UserID, identity, pending.Provider, external)
+	}
+	if identity == nil {
+		return s.signUp(ctx, pending.Provider, external, client)
+	}
+
+	user, err := s.Auth.UserRepo.GetByID(ctx, identity.UserID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	if err := s.Auth.requireMFA(ctx, user); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.Auth.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCResult{User: &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, Tokens: tokens, Identity: identity}, nil
+}
+
+// link links the external identity to the user that started the sign-in, linking an identity twice is accepted
+func (s *OIDCService) link(
+	ctx context.Context, userID int, identity *models.UserIdentity, provider string, external *oidc.Identity,
+) (*OIDCResult, error) {
+	user, err := s.Auth.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &OIDCResult{User: &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, Identity: identity}
+
+	if identity != nil {
+		if identity.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return result, nil
+	}
+
+	result.Identity = &models.UserIdentity{UserID: userID, Provider: provider, Subject: external.Subject, Email: external.Email}
+	ok, err := s.Identities.Create(ctx, result.Identity)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if !ok {
+		return nil, ErrIdentityLinked
+	}
+	return result, nil
+}
+
+// signUp creates a user without a password for an unknown identity and logs it in,
+// its login is taken from the identity and made unique with a random suffix
+func (s *OIDCService) signUp(ctx context.Context, provider string, external *oidc.Identity, client models.ClientInfo) (*OIDCResult, error) {
+	base := loginFromIdentity(external)
+	login := base
+	for i := 0; ; i++ {
+		existing, err := s.Auth.UserRepo.GetByLogin(ctx, login)
+		if err != nil {
+			return nil, errors.New("database error")
+		}
+		if existing == nil {
+			break
+		}
+		if i == loginAttempts {
+			return nil, errors.New("failed to create user")
+		}
+		suffix := make([]byte, loginSuffixBytes)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, errors.New("failed to create user")
+		}
+		login = base[:min(len(base), constants.MaxLenLogin-2*loginSuffixBytes-1)] + "-" + hex.EncodeToString(suffix)
+	}
+
+	identity := &models.UserIdentity{Provider: provider, Subject: external.Subject, Email: external.Email}
+	user, err := s.Identities.CreateWithUser(ctx, login, identity)
+	if err != nil {
+		return nil, errors.New("failed to create user")
+	}
+
+	tokens, err := s.Auth.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCResult{User: &models.User{ID: user.ID, Login: user.Login, Role: user.Role}, Tokens: tokens, Identity: identity}, nil
+}
+
+// ListIdentities returns the identities linked to a user
+func (s *OIDCService) ListIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	identities, err := s.Identities.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes an identity of a user, the last identity of a user without a password is kept
+// so the user can still sign in
+func (s *OIDCService) UnlinkIdentity(ctx context.Context, userID, id int) error {
+	user, err := s.Auth.activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Hash == "" {
+		count, err := s.Identities.CountByUser(ctx, userID)
+		if err != nil {
+			return errors.New("database error")
+		}
+		if count <= 1 {
+			return ErrLastIdentity
+		}
+	}
+
+	ok, err := s.Identities.Delete(ctx, userID, id)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// loginFromIdentity derives a valid login from the preferred username or the email of an identity
+func loginFromIdentity(external *oidc.Identity) string {
+	login := external.PreferredUsername
+	if login == "" {
+		login, _, _ = strings.Cut(external.Email, "@")
+	}
+	login = strings.Trim(invalidLoginChars.ReplaceAllString(login, "_"), "_")
+	if len(login) > constants.MaxLenLogin {
+		login = login[:constants.MaxLenLogin]
+	}
+	if len(login) < constants.MinLenLogin {
+		login = "user_" + login
+	}
+	return login
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/oidc"
+	"github.com/artnikel/marketplace/pkg/oidc/oidctest"
+)
+
+type MockIdentityRepo struct {
+	mock.Mock
+}
+
+func (m *MockIdentityRepo) GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	args := m.Called(ctx, provider, subject)
+	identity, _ := args.Get(0).(*models.UserIdentity)
+	return identity, args.Error(1)
+}
+
+func (m *MockIdentityRepo) ListByUser(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	args := m.Called(ctx, userID)
+	identities, _ := args.Get(0).([]*models.UserIdentity)
+	return identities, args.Error(1)
+}
+
+func (m *MockIdentityRepo) Create(ctx context.Context, identity *models.UserIdentity) (bool, error) {
+	args := m.Called(ctx, identity)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdentityRepo) CreateWithUser(ctx context.Context, login string, identity *models.UserIdentity) (*models.User, error) {
+	args := m.Called(ctx, login, identity)
+	user, _ := args.Get(0).(*models.User)
+	return user, args.Error(1)
+}
+
+func (m *MockIdentityRepo) CountByUser(ctx context.Context, userID int) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockIdentityRepo) Delete(ctx context.Context, userID, id int) (bool, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockOIDCStateRepo struct {
+	mock.Mock
+}
+
+func (m *MockOIDCStateRepo) Create(ctx context.Context, state *models.OIDCState) error {
+	args := m.Called(ctx, state)
+	return args.Error(0)
+}
+
+func (m *MockOIDCStateRepo) Consume(ctx context.Context, hash string) (*models.OIDCState, error) {
+	args := m.Called(ctx, hash)
+	state, _ := args.Get(0).(*models.OIDCState)
+	return state, args.Error(1)
+}
+
+// newOIDCTest creates an OIDCService with the provider "mock" served by a local mock provider
+func newOIDCTest(t *testing.T, userRepo *MockUserRepo, mfaRepo *MockMFARepo, identities *MockIdentityRepo, states *MockOIDCStateRepo) (
+	*OIDCService, *oidctest.Provider,
+) {
+	mockProvider, srv, err := oidctest.NewServer("marketplace", "secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	tokenRepo := new(MockRefreshTokenRepo)
+	tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Maybe()
+	auth := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), mfaRepo, new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer: srv.URL, ClientID: "marketplace", ClientSecret: "secret", RedirectURL: "http://localhost:8080/",
+	}, srv.Client())
+	return NewOIDCService(auth, identities, states, map[string]OIDCProvider{"mock": provider}, 0), mockProvider
+}
+
+// signInAt starts a sign-in as userID, signs in at the mock provider and returns the code and state it redirected back with.
+// The pending sign-in is kept by states until it is consumed
+func signInAt(t *testing.T, svc *OIDCService, states *MockOIDCStateRepo, userID int) (code, state string) {
+	var pending *models.OIDCState
+	states.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		pending, _ = args.Get(1).(*models.OIDCState)
+	}).Return(nil).Once()
+
+	authURL, returnedState, err := svc.Start(context.Background(), "mock", userID)
+	require.NoError(t, err)
+
+	code, state, err = oidctest.Authorize(http.DefaultClient, authURL)
+	require.NoError(t, err)
+	require.Equal(t, returnedState, state)
+	require.NotNil(t, pending)
+	assert.Equal(t, hashRefreshToken(state), pending.StateHash)
+
+	states.On("Consume", mock.Anything, pending.StateHash).Return(pending, nil).Once()
+	return code, state
+}
+
+func TestOIDCService_Callback(t *testing.T) {
+	linked := &models.UserIdentity{ID: 3, UserID: 1, Provider: "mock", Subject: "sub-1"}
+	tests := []struct {
+		name      string
+		userID    int
+		setupMock func(*MockUserRepo, *MockMFARepo, *MockIdentityRepo)
+		wantLogin string
+		wantToken bool
+		wantErr   error
+	}{
+		{
+			name: "linked subject logs in",
+			setupMock: func(u *MockUserRepo, m *MockMFARepo, i *MockIdentityRepo) {
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(linked, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller", Role: models.RoleUser}, nil)
+				m.On("GetTOTP", mock.Anything, 1).Return(nil, nil)
+			},
+			wantLogin: "seller",
+			wantToken: true,
+		},
+		{
+			name: "unknown subject signs up",
+			setupMock: func(u *MockUserRepo, _ *MockMFARepo, i *MockIdentityRepo) {
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(nil, nil)
+				u.On("GetByLogin", mock.Anything, "jane_doe").Return(nil, nil)
+				i.On("CreateWithUser", mock.Anything, "jane_doe", mock.MatchedBy(func(identity *models.UserIdentity) bool {
+					return identity.Provider == "mock" && identity.Subject == "sub-1" && identity.Email == "jane@example.com"
+				})).Return(&models.User{ID: 7, Login: "jane_doe", Role: models.RoleUser}, nil)
+			},
+			wantLogin: "jane_doe",
+			wantToken: true,
+		},
+		{
+			name: "unknown subject with a taken login",
+			setupMock: func(u *MockUserRepo, _ *MockMFARepo, i *MockIdentityRepo) {
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(nil, nil)
+				u.On("GetByLogin", mock.Anything, "jane_doe").Return(&models.User{ID: 2, Login: "jane_doe"}, nil)
+				u.On("GetByLogin", mock.Anything, mock.Anything).Return(nil, nil)
+				i.On("CreateWithUser", mock.Anything, mock.MatchedBy(func(login string) bool {
+					return strings.HasPrefix(login, "jane_doe-") && len(login) == len("jane_doe-")+6
+				}), mock.Anything).Return(&models.User{ID: 7, Login: "jane_doe-a1b2c3", Role: models.RoleUser}, nil)
+			},
+			wantLogin: "jane_doe-a1b2c3",
+			wantToken: true,
+		},
+		{
+			name:   "signed in user links a new subject",
+			userID: 1,
+			setupMock: func(u *MockUserRepo, _ *MockMFARepo, i *MockIdentityRepo) {
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(nil, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller", Role: models.RoleUser}, nil)
+				i.On("Create", mock.Anything, mock.MatchedBy(func(identity *models.UserIdentity) bool {
+					return identity.UserID == 1 && identity.Subject == "sub-1"
+				})).Return(true, nil)
+			},
+			wantLogin: "seller",
+		},
+		{
+			name:   "subject linked to another user",
+			userID: 2,
+			setupMock: func(u *MockUserRepo, _ *MockMFARepo, i *MockIdentityRepo) {
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(linked, nil)
+				u.On("GetByID", mock.Anything, 2).Return(&models.User{ID: 2, Login: "other"}, nil)
+			},
+			wantErr: ErrIdentityLinked,
+		},
+		{
+			name: "disabled user",
+			setupMock: func(u *MockUserRepo, _ *MockMFARepo, i *MockIdentityRepo) {
+				disabled := time.Now()
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(linked, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller", DisabledAt: &disabled}, nil)
+			},
+			wantErr: ErrAccountDisabled,
+		},
+		{
+			name: "user with two-factor authentication",
+			setupMock: func(u *MockUserRepo, m *MockMFARepo, i *MockIdentityRepo) {
+				enabled := time.Now()
+				i.On("GetBySubject", mock.Anything, "mock", "sub-1").Return(linked, nil)
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller"}, nil)
+				m.On("GetTOTP", mock.Anything, 1).Return(&models.TOTPCredential{UserID: 1, EnabledAt: &enabled}, nil)
+			},
+			wantErr: ErrMFARequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo, mfaRepo, identities, states := new(MockUserRepo), new(MockMFARepo), new(MockIdentityRepo), new(MockOIDCStateRepo)
+			tt.setupMock(userRepo, mfaRepo, identities)
+			svc, provider := newOIDCTest(t, userRepo, mfaRepo, identities, states)
+			provider.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@example.com", PreferredUsername: "jane.doe"})
+
+			code, state := signInAt(t, svc, states, tt.userID)
+			result, err := svc.Callback(context.Background(), code, state, models.ClientInfo{})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLogin, result.User.Login)
+			assert.Equal(t, tt.wantToken, result.Tokens != nil)
+			assert.Equal(t, "sub-1", result.Identity.Subject)
+			identities.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOIDCService_CallbackInvalidState(t *testing.T) {
+	states := new(MockOIDCStateRepo)
+	svc, _ := newOIDCTest(t, new(MockUserRepo), noMFA(), new(MockIdentityRepo), states)
+
+	// the state is consumed, so a replayed callback finds nothing
+	states.On("Consume", mock.Anything, hashRefreshToken("used")).Return(nil, nil)
+	_, err := svc.Callback(context.Background(), "code", "used", models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+
+	expired := &models.OIDCState{Provider: "mock", ExpiresAt: time.Now().Add(-time.Second)}
+	states.On("Consume", mock.Anything, hashRefreshToken("expired")).Return(expired, nil)
+	_, err = svc.Callback(context.Background(), "code", "expired", models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+}
+
+func TestOIDCService_CallbackWrongCode(t *testing.T) {
+	states := new(MockOIDCStateRepo)
+	svc, _ := newOIDCTest(t, new(MockUserRepo), noMFA(), new(MockIdentityRepo), states)
+
+	_, state := signInAt(t, svc, states, 0)
+	_, err := svc.Callback(context.Background(), "forged-code", state, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrOIDCLogin)
+}
+
+func TestOIDCService_Start(t *testing.T) {
+	states := new(MockOIDCStateRepo)
+	svc, _ := newOIDCTest(t, new(MockUserRepo), noMFA(), new(MockIdentityRepo), states)
+
+	_, _, err := svc.Start(context.Background(), "unknown", 0)
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	states.On("Create", mock.Anything, mock.MatchedBy(func(s *models.OIDCState) bool {
+		return s.Provider == "mock" && *s.UserID == 5 && s.Nonce != "" && s.CodeVerifier != "" && time.Until(s.ExpiresAt) > 9*time.Minute
+	})).Return(nil)
+	authURL, state, err := svc.Start(context.Background(), "mock", 5)
+	require.NoError(t, err)
+	assert.Contains(t, authURL, "state="+state)
+	assert.Contains(t, authURL, "code_challenge_method=S256")
+	assert.Equal(t, []string{"mock"}, svc.ProviderNames())
+}
+
+func TestOIDCService_UnlinkIdentity(t *testing.T) {
+	tests := []struct {
+		name      string
+		setupMock func(*MockUserRepo, *MockIdentityRepo)
+		wantErr   error
+	}{
+		{
+			name: "user with a password",
+			setupMock: func(u *MockUserRepo, i *MockIdentityRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller", Hash: "hash"}, nil)
+				i.On("Delete", mock.Anything, 1, 3).Return(true, nil)
+			},
+		},
+		{
+			name: "last identity of a user without a password",
+			setupMock: func(u *MockUserRepo, i *MockIdentityRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller"}, nil)
+				i.On("CountByUser", mock.Anything, 1).Return(1, nil)
+			},
+			wantErr: ErrLastIdentity,
+		},
+		{
+			name: "one of two identities of a user without a password",
+			setupMock: func(u *MockUserRepo, i *MockIdentityRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller"}, nil)
+				i.On("CountByUser", mock.Anything, 1).Return(2, nil)
+				i.On("Delete", mock.Anything, 1, 3).Return(true, nil)
+			},
+		},
+		{
+			name: "identity of another user",
+			setupMock: func(u *MockUserRepo, i *MockIdentityRepo) {
+				u.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "seller", Hash: "hash"}, nil)
+				i.On("Delete", mock.Anything, 1, 3).Return(false, nil)
+			},
+			wantErr: ErrIdentityNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo, identities := new(MockUserRepo), new(MockIdentityRepo)
+			tt.setupMock(userRepo, identities)
+			svc, _ := newOIDCTest(t, userRepo, noMFA(), identities, new(MockOIDCStateRepo))
+
+			err := svc.UnlinkIdentity(context.Background(), 1, 3)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			identities.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLoginFromIdentity(t *testing.T) {
+	tests := []struct {
+		identity oidc.Identity
+		want     string
+	}{
+		{identity: oidc.Identity{PreferredUsername: "jane"}, want: "jane"},
+		{identity: oidc.Identity{PreferredUsername: "Jane Doe!"}, want: "Jane_Doe"},
+		{identity: oidc.Identity{Email: "john.smith@example.com"}, want: "john_smith"},
+		{identity: oidc.Identity{PreferredUsername: "al"}, want: "user_al"},
+		{identity: oidc.Identity{}, want: "user_"},
+		{identity: oidc.Identity{PreferredUsername: strings.Repeat("a", 60)}, want: strings.Repeat("a", 50)},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, loginFromIdentity(&tt.identity))
+	}
+}
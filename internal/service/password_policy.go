@@ -0,0 +1,143 @@
+// Package service contains business logic for the password policy
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/artnikel/marketplace/internal/constants"
+)
+
+// Password rules reported in PasswordViolation.Rule
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleMaxRepeated      = "max_repeated"
+	RuleLogin            = "login"
+	RuleBreached         = "breached"
+)
+
+// PasswordViolation is a password rule a new password breaks, Message is shown to the user
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a new password breaks, it matches ErrPasswordPolicy
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+// Error returns the messages of the violated rules
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is reports whether target is ErrPasswordPolicy
+func (e *PasswordPolicyError) Is(target error) bool { return target == ErrPasswordPolicy }
+
+// validatePassword checks a new password of login against every rule of the password policy and returns
+// a *PasswordPolicyError listing all rules it breaks. Passwords are looked up in the breached list when one is set
+func (s *AuthService) validatePassword(login, password string) error {
+	policy := s.cfg.Password.Policy
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = constants.MinLenPassword
+	}
+
+	var violations []PasswordViolation
+	add := func(rule, message string) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		add(RuleMinLength, fmt.Sprintf("password must be at least %d characters", minLength))
+	}
+	if length > constants.MaxLenPassword {
+		add(RuleMaxLength, fmt.Sprintf("password too long (max %d characters)", constants.MaxLenPassword))
+	}
+	if policy.CharacterClasses > 0 && characterClasses(password) < policy.CharacterClasses {
+		add(RuleCharacterClasses, fmt.Sprintf(
+			"password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", policy.CharacterClasses))
+	}
+	if policy.MaxRepeated > 0 && longestRun(password) > policy.MaxRepeated {
+		add(RuleMaxRepeated, fmt.Sprintf("password may not repeat a character more than %d times in a row", policy.MaxRepeated))
+	}
+	if policy.RejectLogin && similarToLogin(login, password) {
+		add(RuleLogin, "password may not contain the login")
+	}
+
+	if s.Breached != nil && length <= constants.MaxLenPassword {
+		count, err := s.Breached.Count(password)
+		if err != nil {
+			return errors.New("failed to check password")
+		}
+		if count > 0 {
+			add(RuleBreached, "password appears in known data breaches")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// characterClasses returns how many of lowercase letters, uppercase letters, digits and other characters password has
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// longestRun returns the length of the longest run of one character in password
+func longestRun(password string) int {
+	longest, run := 0, 0
+	var prev rune
+	for i, r := range []rune(password) {
+		if i > 0 && r == prev {
+			run++
+		} else {
+			run = 1
+		}
+		prev = r
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// similarToLogin reports whether password contains login forwards or backwards, or is a part of login,
+// ignoring case
+func similarToLogin(login, password string) bool {
+	login = strings.ToLower(strings.TrimSpace(login))
+	password = strings.ToLower(password)
+	if login == "" || password == "" {
+		return false
+	}
+
+	runes := []rune(login)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return strings.Contains(password, login) || strings.Contains(password, string(runes)) || strings.Contains(login, password)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+type MockBreachedPasswords struct {
+	mock.Mock
+}
+
+func (m *MockBreachedPasswords) Count(password string) (int, error) {
+	args := m.Called(password)
+	return args.Int(0), args.Error(1)
+}
+
+func TestAuthService_PasswordPolicy(t *testing.T) {
+	cfg := &config.Config{Password: config.PasswordConfig{Policy: config.PasswordPolicyConfig{
+		MinLength: 8, CharacterClasses: 3, MaxRepeated: 3, RejectLogin: true,
+	}}}
+
+	tests := []struct {
+		name      string
+		password  string
+		wantRules []string
+	}{
+		{name: "meets every rule", password: "Tr0ub4dor&3"},
+		{name: "non-ASCII characters count once", password: "Zürich-Straße9"},
+		{name: "too short", password: "Ab1!", wantRules: []string{RuleMinLength}},
+		{name: "too few character classes", password: "lowercase123", wantRules: []string{RuleCharacterClasses}},
+		{name: "repeated characters", password: "Paaaass1word", wantRules: []string{RuleMaxRepeated}},
+		{name: "contains the login", password: "Xx-SellerBob-1", wantRules: []string{RuleLogin}},
+		{name: "contains the reversed login", password: "boBreLLes#2024", wantRules: []string{RuleLogin}},
+		{name: "part of the login", password: "sellerbob", wantRules: []string{RuleCharacterClasses, RuleLogin}},
+		{name: "every rule at once", password: "bbbb", wantRules: []string{RuleMinLength, RuleCharacterClasses, RuleMaxRepeated}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+
+			err := authService.validatePassword("SellerBob", tt.password)
+			if len(tt.wantRules) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrPasswordPolicy)
+			var policyErr *PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			rules := make([]string, len(policyErr.Violations))
+			for i, v := range policyErr.Violations {
+				rules[i] = v.Rule
+				assert.NotEmpty(t, v.Message)
+			}
+			assert.Equal(t, tt.wantRules, rules)
+		})
+	}
+}
+
+func TestAuthService_BreachedPasswords(t *testing.T) {
+	breached := new(MockBreachedPasswords)
+	authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	authService.Breached = breached
+
+	breached.On("Count", "password1").Return(2413945, nil).Once()
+	err := authService.validatePassword("testuser", "password1")
+	var policyErr *PasswordPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, []PasswordViolation{{Rule: RuleBreached, Message: "password appears in known data breaches"}}, policyErr.Violations)
+
+	breached.On("Count", "unlisted passphrase").Return(0, nil).Once()
+	require.NoError(t, authService.validatePassword("testuser", "unlisted passphrase"))
+
+	breached.On("Count", "unreadable").Return(0, errors.New("read error")).Once()
+	require.EqualError(t, authService.validatePassword("testuser", "unreadable"), "failed to check password")
+
+	breached.AssertExpectations(t)
+}
+
+func TestAuthService_RegisterReportsEveryViolation(t *testing.T) {
+	cfg := &config.Config{Password: config.PasswordConfig{Policy: config.PasswordPolicyConfig{MinLength: 10, CharacterClasses: 2}}}
+	userRepo := new(MockUserRepo)
+	authService := NewAuthService(userRepo, new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), cfg)
+
+	_, _, err := authService.Register(context.Background(), "newuser", "short", models.ClientInfo{})
+	require.ErrorIs(t, err, ErrPasswordPolicy)
+	assert.EqualError(t, err, "password must be at least 10 characters; "+
+		"password must mix at least 2 of lowercase letters, uppercase letters, digits and symbols")
+	userRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+}
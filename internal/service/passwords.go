@@ -0,0 +1,48 @@
+// Package service contains business logic for hashing passwords
+package service
+
+import (
+	"context"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/passhash"
+)
+
+// newPasswordHasher creates the Argon2id hasher of new passwords, zero cost parameters use the defaults from constants
+func newPasswordHasher(cfg config.PasswordHashConfig) *passhash.Hasher {
+	params := passhash.Params{Memory: cfg.Memory, Iterations: cfg.Iterations, Parallelism: cfg.Parallelism}
+	if params.Memory == 0 {
+		params.Memory = constants.PasswordHashMemory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = constants.PasswordHashIterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = constants.PasswordHashParallelism
+	}
+	return passhash.NewHasher(params)
+}
+
+// passwordMatches reports whether password matches hash, hashes that cannot be checked match no password
+func (s *AuthService) passwordMatches(hash, password string) bool {
+	ok, err := s.Hasher.Verify(hash, password)
+	return err == nil && ok
+}
+
+// upgradePasswordHash replaces the hash of a user who just proved their password when it was made by an older
+// algorithm or with older cost parameters. The hash is only replaced while it is unchanged, and a failure keeps
+// the old hash, which still works and is upgraded at a later login
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !s.Hasher.NeedsRehash(user.Hash) {
+		return
+	}
+	hash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return
+	}
+	if ok, err := s.UserRepo.ReplacePasswordHash(ctx, user.ID, user.Hash, hash); err == nil && ok {
+		user.Hash = hash
+	}
+}
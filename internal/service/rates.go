@@ -0,0 +1,223 @@
+// Package service contains business logic for handling exchange rates
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
+)
+
+// Supported exchange rates file formats
+const (
+	RatesFormatCSV  = "csv"
+	RatesFormatJSON = "json"
+)
+
+// maxRates limits the number of currencies in one exchange rates file
+const maxRates = 500
+
+// Errors returned by RatesService and by price conversions
+var (
+	ErrInvalidRates   = errors.New("invalid exchange rates")
+	ErrNoExchangeRate = errors.New("no exchange rate for currency")
+)
+
+// RateRepository is an interface that contains exchange rate repository methods
+type RateRepository interface {
+	Replace(ctx context.Context, rates []*models.ExchangeRate) error
+	List(ctx context.Context) ([]*models.ExchangeRate, error)
+}
+
+// RatesService provides methods for managing exchange rates against the base currency
+type RatesService struct {
+	RateRepo     RateRepository
+	baseCurrency string
+}
+
+// NewRatesService creates a new instance of RatesService
+func NewRatesService(repo RateRepository, baseCurrency string) *RatesService {
+	return &RatesService{RateRepo: repo, baseCurrency: money.NormalizeCurrency(baseCurrency)}
+}
+
+// BaseCurrency returns the currency all rates are quoted against
+func (s *RatesService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// ListRates returns the stored exchange rates
+func (s *RatesService) ListRates(ctx context.Context) ([]*models.ExchangeRate, error) {
+	rates, err := s.RateRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rates == nil {
+		rates = []*models.ExchangeRate{}
+	}
+	return rates, nil
+}
+
+// ImportRates parses an exchange rates file and replaces all stored rates with it.
+// CSV files hold "currency,rate" records with an optional header,
+// JSON files hold {"base": "USD", "rates": {"EUR": 0.92}} where base is optional
+func (s *RatesService) ImportRates(ctx context.Context, format string, r io.Reader) ([]*models.ExchangeRate, error) {
+	var (
+		rates []*models.ExchangeRate
+		err   error
+	)
+	switch format {
+	case RatesFormatCSV:
+		rates, err = parseRatesCSV(r)
+	case RatesFormatJSON:
+		rates, err = s.parseRatesJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format, use csv or json", ErrInvalidRates)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err = s.validateRates(rates)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.RateRepo.Replace(ctx, rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// validateRates checks currency codes and rates, the base currency may only be listed with rate 1 and is not stored
+func (s *RatesService) validateRates(rates []*models.ExchangeRate) ([]*models.ExchangeRate, error) {
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: no rates in file", ErrInvalidRates)
+	}
+	if len(rates) > maxRates {
+		return nil, fmt.Errorf("%w: too many rates (max %d)", ErrInvalidRates, maxRates)
+	}
+
+	seen := make(map[string]bool, len(rates))
+	valid := make([]*models.ExchangeRate, 0, len(rates))
+	for _, rate := range rates {
+		rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+		if _, ok := money.Exponent(rate.Currency); !ok {
+			return nil, fmt.Errorf("%w: unknown currency %s", ErrInvalidRates, rate.Currency)
+		}
+		if seen[rate.Currency] {
+			return nil, fmt.Errorf("%w: duplicate currency %s", ErrInvalidRates, rate.Currency)
+		}
+		seen[rate.Currency] = true
+
+		if rate.Rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: rate for %s must be positive", ErrInvalidRates, rate.Currency)
+		}
+		if rate.Currency == s.baseCurrency {
+			if rate.Rate.Cmp(money.New(1, 0)) != 0 {
+				return nil, fmt.Errorf("%w: base currency %s must have rate 1", ErrInvalidRates, rate.Currency)
+			}
+			continue
+		}
+		valid = append(valid, rate)
+	}
+	return valid, nil
+}
+
+// parseRatesCSV reads "currency,rate" records, a first record with a "currency" column is treated as a header
+func parseRatesCSV(r io.Reader) ([]*models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var rates []*models.ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed csv on line %d", ErrInvalidRates, line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "currency") {
+			continue
+		}
+
+		rate, err := money.Parse(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad rate on line %d", ErrInvalidRates, line)
+		}
+		rates = append(rates, &models.ExchangeRate{Currency: record[0], Rate: rate})
+	}
+	return rates, nil
+}
+
+// parseRatesJSON reads a {"base", "rates"} document, base must match the configured base currency when present
+func (s *RatesService) parseRatesJSON(r io.Reader) ([]*models.ExchangeRate, error) {
+	var doc struct {
+		Base  string                  `json:"base"`
+		Rates map[string]money.Amount `json:"rates"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRates, err)
+	}
+	if doc.Base != "" && !strings.EqualFold(doc.Base, s.baseCurrency) {
+		return nil, fmt.Errorf("%w: rates are quoted against %s, expected %s", ErrInvalidRates, doc.Base, s.baseCurrency)
+	}
+
+	rates := make([]*models.ExchangeRate, 0, len(doc.Rates))
+	for currency, rate := range doc.Rates {
+		rates = append(rates, &models.ExchangeRate{Currency: currency, Rate: rate})
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Currency < rates[j].Currency })
+	return rates, nil
+}
+
+// rateTable holds how many units of each currency one unit of the base currency buys
+type rateTable struct {
+	base  string
+	rates map[string]money.Amount
+}
+
+// loadRateTable reads all stored exchange rates for conversions against base
+func loadRateTable(ctx context.Context, repo RateRepository, base string) (*rateTable, error) {
+	rates, err := repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &rateTable{base: base, rates: make(map[string]money.Amount, len(rates))}
+	for _, rate := range rates {
+		t.rates[rate.Currency] = rate.Rate
+	}
+	return t, nil
+}
+
+// rate returns the exchange rate of a currency, the base currency always has rate 1
+func (t *rateTable) rate(currency string) (money.Amount, bool) {
+	if currency == t.base {
+		return money.New(1, 0), true
+	}
+	rate, ok := t.rates[currency]
+	return rate, ok
+}
+
+// convert changes the currency of an amount rounding the result to scale fraction digits
+func (t *rateTable) convert(amount money.Amount, from, to string, scale int) (money.Amount, error) {
+	fromRate, ok := t.rate(from)
+	if !ok {
+		return money.Amount{}, fmt.Errorf("%w %s", ErrNoExchangeRate, from)
+	}
+	toRate, ok := t.rate(to)
+	if !ok {
+		return money.Amount{}, fmt.Errorf("%w %s", ErrNoExchangeRate, to)
+	}
+	return amount.MulDiv(toRate, fromRate, scale)
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/models"
+	"github.com/artnikel/marketplace/pkg/money"
+)
+
+// MockRateRepo is a mock implementation of RateRepo
+type MockRateRepo struct {
+	mock.Mock
+}
+
+func (m *MockRateRepo) Replace(ctx context.Context, rates []*models.ExchangeRate) error {
+	args := m.Called(ctx, rates)
+	return args.Error(0)
+}
+
+func (m *MockRateRepo) List(ctx context.Context) ([]*models.ExchangeRate, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ExchangeRate), args.Error(1)
+}
+
+// ratesFixture returns EUR and JPY rates against USD
+func ratesFixture() []*models.ExchangeRate {
+	return []*models.ExchangeRate{
+		{Currency: "EUR", Rate: money.MustParse("0.8")},
+		{Currency: "JPY", Rate: money.MustParse("150")},
+	}
+}
+
+func TestRatesService_ImportRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		body      string
+		wantRates map[string]string
+		wantMsg   string
+	}{
+		{
+			name:      "csv with header",
+			format:    RatesFormatCSV,
+			body:      "currency,rate\nEUR,0.92\n# yen\njpy, 151.30\n",
+			wantRates: map[string]string{"EUR": "0.92", "JPY": "151.30"},
+		},
+		{
+			name:      "csv without header skips base currency",
+			format:    RatesFormatCSV,
+			body:      "USD,1\nGBP,0.79\n",
+			wantRates: map[string]string{"GBP": "0.79"},
+		},
+		{
+			name:      "json",
+			format:    RatesFormatJSON,
+			body:      `{"base":"usd","rates":{"EUR":0.92,"JPY":"151.3"}}`,
+			wantRates: map[string]string{"EUR": "0.92", "JPY": "151.3"},
+		},
+		{
+			name:    "json quoted against another base",
+			format:  RatesFormatJSON,
+			body:    `{"base":"EUR","rates":{"USD":1.08}}`,
+			wantMsg: "rates are quoted against EUR, expected USD",
+		},
+		{
+			name:    "base currency with another rate",
+			format:  RatesFormatCSV,
+			body:    "USD,2\n",
+			wantMsg: "base currency USD must have rate 1",
+		},
+		{
+			name:    "unknown currency",
+			format:  RatesFormatCSV,
+			body:    "ABC,1.5\n",
+			wantMsg: "unknown currency ABC",
+		},
+		{
+			name:    "duplicate currency",
+			format:  RatesFormatCSV,
+			body:    "EUR,0.9\neur,0.91\n",
+			wantMsg: "duplicate currency EUR",
+		},
+		{
+			name:    "non-positive rate",
+			format:  RatesFormatCSV,
+			body:    "EUR,0\n",
+			wantMsg: "rate for EUR must be positive",
+		},
+		{
+			name:    "malformed rate",
+			format:  RatesFormatCSV,
+			body:    "EUR,0.9x\n",
+			wantMsg: "bad rate on line 1",
+		},
+		{
+			name:    "wrong number of columns",
+			format:  RatesFormatCSV,
+			body:    "EUR,0.9,extra\n",
+			wantMsg: "malformed csv on line 1",
+		},
+		{
+			name:    "empty file",
+			format:  RatesFormatJSON,
+			body:    `{"rates":{}}`,
+			wantMsg: "no rates in file",
+		},
+		{
+			name:    "unsupported format",
+			format:  "xml",
+			body:    "<rates/>",
+			wantMsg: "unsupported format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockRateRepo)
+			if tt.wantRates != nil {
+				mockRepo.On("Replace", mock.Anything, mock.Anything).Return(nil).Once()
+			}
+
+			service := NewRatesService(mockRepo, "USD")
+			rates, err := service.ImportRates(context.Background(), tt.format, strings.NewReader(tt.body))
+
+			if tt.wantMsg != "" {
+				require.ErrorIs(t, err, ErrInvalidRates)
+				assert.Contains(t, err.Error(), tt.wantMsg)
+			} else {
+				require.NoError(t, err)
+				got := make(map[string]string, len(rates))
+				for _, rate := range rates {
+					got[rate.Currency] = rate.Rate.String()
+				}
+				assert.Equal(t, tt.wantRates, got)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRatesService_ListRates(t *testing.T) {
+	mockRepo := new(MockRateRepo)
+	mockRepo.On("List", mock.Anything).Return(nil, nil).Once()
+
+	service := NewRatesService(mockRepo, "")
+	rates, err := service.ListRates(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, rates)
+	assert.NotNil(t, rates)
+	assert.Equal(t, "USD", service.BaseCurrency())
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,98 @@
+// Package service contains business logic for caching session state
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionCacheMaxEntries is the number of cached sessions above which expired entries are dropped
+const sessionCacheMaxEntries = 10000
+
+// sessionCache remembers for ttl whether sessions are active, so authenticated requests do not read the database
+// every time. Sessions ended through the instance are forgotten at once, others are noticed once their entry expires.
+// It also collects the last uses of sessions until they are written in one batch
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int]sessionCacheEntry
+	seen    map[int]time.Time
+}
+
+// sessionCacheEntry is the cached state of a session
+type sessionCacheEntry struct {
+	userID  int
+	active  bool
+	expires time.Time
+}
+
+// newSessionCache creates a sessionCache
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{ttl: ttl, entries: make(map[int]sessionCacheEntry), seen: make(map[int]time.Time)}
+}
+
+// get returns whether the session id is active, ok is false when it is not cached
+func (c *sessionCache) get(id int, now time.Time) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || !now.Before(entry.expires) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+// put caches the state of the session id of userID
+func (c *sessionCache) put(id, userID int, active bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= sessionCacheMaxEntries {
+		c.prune(now)
+	}
+	c.entries[id] = sessionCacheEntry{userID: userID, active: active, expires: now.Add(c.ttl)}
+}
+
+// markSeen records that the session id was used at, uses beyond sessionCacheMaxEntries unwritten sessions are
+// dropped and recorded again by a later request
+func (c *sessionCache) markSeen(id int, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[id]; !ok && len(c.seen) >= sessionCacheMaxEntries {
+		return
+	}
+	c.seen[id] = at
+}
+
+// takeSeen returns the recorded uses of sessions and forgets them
+func (c *sessionCache) takeSeen() map[int]time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := c.seen
+	c.seen = make(map[int]time.Time)
+	return seen
+}
+
+// forgetUser drops the cached sessions of userID
+func (c *sessionCache) forgetUser(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// prune drops expired entries
+func (c *sessionCache) prune(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package service contains business logic for listing and revoking sessions
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+// sessionTouchInterval limits how often the last use of a session is recorded by authenticated requests
+const sessionTouchInterval = time.Minute
+
+// ErrSessionNotFound is returned when a user has no such active session
+var ErrSessionNotFound = errors.New("session not found")
+
+// startSession records a new login of user from client and issues the first tokens of its refresh token family
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client models.ClientInfo) (*models.AuthTokens, error) {
+	familyID, err := randomToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	userAgent := client.UserAgent
+	if len(userAgent) > constants.MaxLenUserAgent {
+		userAgent = userAgent[:constants.MaxLenUserAgent]
+	}
+	session := &models.Session{UserID: user.ID, FamilyID: familyID, UserAgent: userAgent, IP: client.IP}
+	if err := s.SessionRepo.Create(ctx, session); err != nil {
+		return nil, errors.New("failed to store session")
+	}
+
+	return s.issueTokens(ctx, user, familyID, session.ID)
+}
+
+// SessionActive reports whether the session id was not ended, the answer is cached for a short time.
+// Access tokens of ended sessions are refused even before they expire. Access tokens signed before sessions
+// were recorded carry no session, id 0 is accepted until the access token lifetime passed since the service started
+// and refused afterwards. The last use of a session is recorded in memory and written by FlushSessionsSeen
+func (s *AuthService) SessionActive(ctx context.Context, id int) (bool, error) {
+	now := s.now()
+	if id == 0 {
+		return now.Before(s.sessionlessUntil), nil
+	}
+	if active, ok := s.sessions.get(id, now); ok {
+		return active, nil
+	}
+
+	session, err := s.SessionRepo.GetByID(ctx, id)
+	if err != nil {
+		return false, errors.New("database error")
+	}
+	if session == nil {
+		return false, nil
+	}
+
+	active := session.RevokedAt == nil
+	if active && now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		s.sessions.markSeen(id, now)
+	}
+	s.sessions.put(id, session.UserID, active, now)
+	return active, nil
+}
+
+// FlushSessionsSeen writes the last uses of sessions recorded by SessionActive in one batch
+func (s *AuthService) FlushSessionsSeen(ctx context.Context) error {
+	seen := s.sessions.takeSeen()
+	if len(seen) == 0 {
+		return nil
+	}
+	if err := s.SessionRepo.TouchMany(ctx, seen); err != nil {
+		return errors.New("database error")
+	}
+	return nil
+}
+
+// RunSessionsSeen calls FlushSessionsSeen every interval until ctx is done and flushes once more then
+func (s *AuthService) RunSessionsSeen(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.FlushSessionsSeen(context.WithoutCancel(ctx)); err != nil {
+				log.Printf("failed to record session use: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.FlushSessionsSeen(ctx); err != nil {
+				log.Printf("failed to record session use: %v", err)
+			}
+		}
+	}
+}
+
+// ListSessions returns the sessions of a user that can still be used, the session currentID is marked as current
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentID int) ([]*models.Session, error) {
+	sessions, err := s.SessionRepo.ListActive(ctx, userID, s.now().Add(-s.refreshTTL()))
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends a session of a user, its refresh tokens stop working at once and its access tokens
+// as soon as every instance notices the session was ended
+func (s *AuthService) RevokeSession(ctx context.Context, userID, id int) error {
+	ok, err := s.SessionRepo.Revoke(ctx, userID, id)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.sessions.forgetUser(userID)
+	return nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/internal/config"
+	"github.com/artnikel/marketplace/internal/constants"
+	"github.com/artnikel/marketplace/internal/models"
+)
+
+type MockSessionRepo struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepo) Create(ctx context.Context, session *models.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) GetByID(ctx context.Context, id int) (*models.Session, error) {
+	args := m.Called(ctx, id)
+	session, _ := args.Get(0).(*models.Session)
+	return session, args.Error(1)
+}
+
+func (m *MockSessionRepo) GetByFamily(ctx context.Context, familyID string) (*models.Session, error) {
+	args := m.Called(ctx, familyID)
+	session, _ := args.Get(0).(*models.Session)
+	return session, args.Error(1)
+}
+
+func (m *MockSessionRepo) ListActive(ctx context.Context, userID int, since time.Time) ([]*models.Session, error) {
+	args := m.Called(ctx, userID, since)
+	sessions, _ := args.Get(0).([]*models.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *MockSessionRepo) Touch(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) TouchMany(ctx context.Context, seen map[int]time.Time) error {
+	args := m.Called(ctx, seen)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+// noSessions records every new session as session 1 and knows no earlier ones
+func noSessions() *MockSessionRepo {
+	m := new(MockSessionRepo)
+	m.On("Create", mock.Anything, mock.AnythingOfType("*models.Session")).
+		Run(func(args mock.Arguments) { args.Get(1).(*models.Session).ID = 1 }).Return(nil).Maybe()
+	m.On("GetByFamily", mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+	return m
+}
+
+func TestAuthService_LoginStartsSession(t *testing.T) {
+	hashed := hashPassword(t, "password123")
+
+	userRepo := new(MockUserRepo)
+	userRepo.On("GetByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser", Hash: hashed}, nil)
+	tokenRepo := new(MockRefreshTokenRepo)
+	var stored *models.RefreshToken
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*models.RefreshToken) }).Return(nil)
+	sessionRepo := new(MockSessionRepo)
+	var session *models.Session
+	sessionRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Session")).Run(func(args mock.Arguments) {
+		session = args.Get(1).(*models.Session)
+		session.ID = 9
+	}).Return(nil)
+
+	authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), sessionRepo, new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	client := models.ClientInfo{IP: "192.0.2.1", UserAgent: strings.Repeat("a", constants.MaxLenUserAgent+10)}
+	_, tokens, err := authService.Login(context.Background(), "testuser", "password123", client)
+	require.NoError(t, err)
+
+	assert.Equal(t, "192.0.2.1", session.IP)
+	assert.Len(t, session.UserAgent, constants.MaxLenUserAgent)
+	assert.Equal(t, session.FamilyID, stored.FamilyID)
+
+	claims, err := authService.ParseToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 9, claims.SessionID)
+}
+
+func TestAuthService_RefreshEndedSession(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	revokedAt := now.Add(-time.Minute)
+
+	tokenRepo := new(MockRefreshTokenRepo)
+	tokenRepo.On("GetByHash", mock.Anything, hashRefreshToken("refresh123")).
+		Return(&models.RefreshToken{ID: 7, UserID: 1, FamilyID: "family-1", ExpiresAt: now.Add(time.Hour)}, nil)
+	tokenRepo.On("MarkUsed", mock.Anything, 7).Return(true, nil)
+	userRepo := new(MockUserRepo)
+	userRepo.On("GetByID", mock.Anything, 1).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+	sessionRepo := new(MockSessionRepo)
+	sessionRepo.On("GetByFamily", mock.Anything, "family-1").Return(&models.Session{ID: 3, UserID: 1, RevokedAt: &revokedAt}, nil)
+
+	authService := NewAuthService(userRepo, tokenRepo, new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), sessionRepo, new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	authService.now = func() time.Time { return now }
+
+	_, tokens, err := authService.Refresh(context.Background(), "refresh123")
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	assert.Nil(t, tokens)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestAuthService_SessionActive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	revokedAt := now.Add(-time.Minute)
+
+	sessionRepo := new(MockSessionRepo)
+	authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), sessionRepo, new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	authService.now = func() time.Time { return now }
+
+	// a stale session is recorded as seen once and then answered from the cache, the use is written in a batch
+	sessionRepo.On("GetByID", mock.Anything, 3).Return(&models.Session{ID: 3, UserID: 1, LastSeenAt: now.Add(-time.Hour)}, nil).Once()
+	for range 3 {
+		active, err := authService.SessionActive(context.Background(), 3)
+		require.NoError(t, err)
+		assert.True(t, active)
+	}
+	sessionRepo.On("TouchMany", mock.Anything, map[int]time.Time{3: now}).Return(nil).Once()
+	require.NoError(t, authService.FlushSessionsSeen(context.Background()))
+	require.NoError(t, authService.FlushSessionsSeen(context.Background()))
+
+	sessionRepo.On("GetByID", mock.Anything, 4).Return(&models.Session{ID: 4, UserID: 1, RevokedAt: &revokedAt}, nil).Once()
+	active, err := authService.SessionActive(context.Background(), 4)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessionRepo.On("GetByID", mock.Anything, 5).Return(nil, nil).Once()
+	active, err = authService.SessionActive(context.Background(), 5)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessionRepo.On("GetByID", mock.Anything, 6).Return(nil, errors.New("connection lost")).Once()
+	_, err = authService.SessionActive(context.Background(), 6)
+	require.EqualError(t, err, "database error")
+
+	// ending a session is noticed at once instead of after the cache expires
+	sessionRepo.On("Revoke", mock.Anything, 1, 3).Return(true, nil).Once()
+	require.NoError(t, authService.RevokeSession(context.Background(), 1, 3))
+	sessionRepo.On("GetByID", mock.Anything, 3).Return(&models.Session{ID: 3, UserID: 1, LastSeenAt: now, RevokedAt: &now}, nil).Once()
+	active, err = authService.SessionActive(context.Background(), 3)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// the cache expires, so sessions ended on another instance are noticed too
+	sessionRepo.On("GetByID", mock.Anything, 7).Return(&models.Session{ID: 7, UserID: 2, LastSeenAt: now}, nil).Once()
+	active, err = authService.SessionActive(context.Background(), 7)
+	require.NoError(t, err)
+	assert.True(t, active)
+	now = now.Add(constants.SessionCacheTTL)
+	sessionRepo.On("GetByID", mock.Anything, 7).Return(&models.Session{ID: 7, UserID: 2, RevokedAt: &now}, nil).Once()
+	active, err = authService.SessionActive(context.Background(), 7)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestAuthService_SessionActiveWithoutSession(t *testing.T) {
+	authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), noSessions(), new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	start := time.Now()
+
+	// tokens signed before sessions were recorded work until they have all expired
+	authService.now = func() time.Time { return start }
+	active, err := authService.SessionActive(context.Background(), 0)
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	authService.now = func() time.Time { return start.Add(constants.AccessTokenTTL + constants.TokenLeeway) }
+	active, err = authService.SessionActive(context.Background(), 0)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestAuthService_ListAndRevokeSessions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sessionRepo := new(MockSessionRepo)
+	authService := NewAuthService(new(MockUserRepo), new(MockRefreshTokenRepo), new(MockPasswordResetRepo), noMFA(), new(MockAPIKeyRepo), sessionRepo, new(MockMailer), new(MockAuditLog), testKeySet(t), &config.Config{})
+	authService.now = func() time.Time { return now }
+
+	sessionRepo.On("ListActive", mock.Anything, 1, now.Add(-constants.RefreshTokenTTL)).
+		Return([]*models.Session{{ID: 3, UserID: 1}, {ID: 4, UserID: 1}}, nil).Once()
+	sessions, err := authService.ListSessions(context.Background(), 1, 4)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+
+	sessionRepo.On("Revoke", mock.Anything, 1, 8).Return(false, nil).Once()
+	require.ErrorIs(t, authService.RevokeSession(context.Background(), 1, 8), ErrSessionNotFound)
+
+	sessionRepo.On("Revoke", mock.Anything, 1, 9).Return(false, errors.New("connection lost")).Once()
+	require.EqualError(t, authService.RevokeSession(context.Background(), 1, 9), "database error")
+
+	sessionRepo.AssertExpectations(t)
+}
@@ -0,0 +1,98 @@
+// Package storage provides object stores for uploaded files
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/artnikel/marketplace/internal/constants"
+)
+
+// LocalStore keeps objects as files under a root directory, the content type is derived from the key extension
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a LocalStore rooted at dir, creating the directory when needed
+func NewLocalStore(dir string) (*LocalStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, constants.DirPerm); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put writes an object, replacing any object with the same key
+func (s *LocalStore) Put(_ context.Context, key, _ string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), constants.DirPerm); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partially written object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), constants.FilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens an object for reading, a missing object yields an error wrapping fs.ErrNotExist
+func (s *LocalStore) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// #nosec G304 -- path is confined to the store root by s.path
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, mime.TypeByExtension(filepath.Ext(path)), nil
+}
+
+// Delete removes an object, deleting a missing object is not an error
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path maps a key to a file path and rejects keys escaping the store root
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, `\`) || !fs.ValidPath(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
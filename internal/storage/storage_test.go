@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objectStore is the behaviour shared by LocalStore and S3Store
+type objectStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// fakeS3 is an in-memory stand-in for an S3-compatible server
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testStore(t *testing.T, store objectStore) {
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "items/1/a.png", "image/png", []byte("png data")))
+
+	rc, contentType, err := store.Get(ctx, "items/1/a.png")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "png data", string(data))
+	assert.Equal(t, "image/png", contentType)
+
+	require.NoError(t, store.Put(ctx, "items/1/a.png", "image/png", []byte("replaced")))
+	rc, _, err = store.Get(ctx, "items/1/a.png")
+	require.NoError(t, err)
+	data, _ = io.ReadAll(rc)
+	_ = rc.Close()
+	assert.Equal(t, "replaced", string(data))
+
+	require.NoError(t, store.Delete(ctx, "items/1/a.png"))
+	require.NoError(t, store.Delete(ctx, "items/1/a.png"))
+
+	_, _, err = store.Get(ctx, "items/1/a.png")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	for _, key := range []string{"", "../secret", "items/../../secret", "/abs"} {
+		require.Error(t, store.Put(ctx, key, "image/png", []byte("x")), key)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	testStore(t, store)
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}, types: map[string]string{}})
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL + "/",
+		Bucket:    "media",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, server.Client())
+	require.NoError(t, err)
+	testStore(t, store)
+
+	_, err = NewS3Store(S3Config{Endpoint: server.URL}, nil)
+	require.Error(t, err)
+}
+
+func TestS3Store_Sign(t *testing.T) {
+	// signing key vector from the AWS Signature Version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+
+	store, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000", Bucket: "media", AccessKey: "access"}, nil)
+	require.NoError(t, err)
+	store.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	req, err := store.newRequest(context.Background(), http.MethodGet, "items/1/a b.png", nil)
+	require.NoError(t, err)
+	store.sign(req, nil)
+
+	assert.Equal(t, "/media/items/1/a%20b.png", req.URL.EscapedPath())
+	assert.Equal(t, "20240501T120000Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, sha256Hex(nil), req.Header.Get("X-Amz-Content-Sha256"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=access/20240501/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+}
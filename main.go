@@ -3,7 +3,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -15,9 +18,16 @@ import (
 	"github.com/artnikel/marketplace/internal/constants"
 	"github.com/artnikel/marketplace/internal/handlers"
 	"github.com/artnikel/marketplace/internal/logging"
+	"github.com/artnikel/marketplace/internal/mail"
 	"github.com/artnikel/marketplace/internal/middleware"
+	"github.com/artnikel/marketplace/internal/models"
 	"github.com/artnikel/marketplace/internal/repository"
 	"github.com/artnikel/marketplace/internal/service"
+	"github.com/artnikel/marketplace/internal/storage"
+	"github.com/artnikel/marketplace/pkg/breached"
+	mjwt "github.com/artnikel/marketplace/pkg/jwt"
+	"github.com/artnikel/marketplace/pkg/oidc"
+	"github.com/artnikel/marketplace/pkg/safeurl"
 )
 
 func main() {
@@ -48,16 +58,83 @@ func main() {
 
 	userRepo := repository.NewUserRepo(pool)
 	itemRepo := repository.NewItemRepo(pool)
+	categoryRepo := repository.NewCategoryRepo(pool)
+	rateRepo := repository.NewRateRepo(pool)
+	imageRepo := repository.NewItemImageRepo(pool)
+	refreshTokenRepo := repository.NewRefreshTokenRepo(pool)
+	resetTokenRepo := repository.NewPasswordResetTokenRepo(pool)
+	auditRepo := repository.NewAuditRepo(pool)
+	mfaRepo := repository.NewMFARepo(pool)
+	apiKeyRepo := repository.NewAPIKeyRepo(pool)
+	identityRepo := repository.NewIdentityRepo(pool)
+	oidcStateRepo := repository.NewOIDCStateRepo(pool)
+	sessionRepo := repository.NewSessionRepo(pool)
 
-	authSvc := service.NewAuthService(userRepo, cfg)
-	itemsSvc := service.NewItemsService(itemRepo, userRepo)
+	// logins from the config keep the admin role they had before roles were stored
+	for _, login := range cfg.Admin.Logins {
+		ok, err := userRepo.SetRoleByLogin(ctx, login, models.RoleAdmin)
+		if err != nil {
+			log.Fatalf("failed to grant admin role: %v", err)
+		}
+		if !ok {
+			log.Printf("admin login %s is not registered", login)
+		}
+	}
+
+	imageStore, err := newImageStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("failed to init image storage: %v", err)
+	}
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("failed to init mailer: %v", err)
+	}
+
+	keys, err := newKeySet(cfg.JWT)
+	if err != nil {
+		log.Fatalf("failed to load jwt keys: %v", err)
+	}
+
+	oidcProviders, err := newOIDCProviders(cfg.OIDC)
+	if err != nil {
+		log.Fatalf("failed to configure oidc providers: %v", err)
+	}
+
+	authSvc := service.NewAuthService(
+		userRepo, refreshTokenRepo, resetTokenRepo, mfaRepo, apiKeyRepo, sessionRepo, mailer, auditRepo, keys, cfg,
+	)
+	if dir := cfg.Password.Policy.BreachedDir; dir != "" {
+		list, err := breached.Open(dir)
+		if err != nil {
+			log.Fatalf("failed to open breached password list: %v", err)
+		}
+		authSvc.Breached = list
+	}
+	// last uses of sessions are written in batches instead of by every request
+	go authSvc.RunSessionsSeen(ctx, constants.SessionSeenFlushInterval)
+	oidcSvc := service.NewOIDCService(authSvc, identityRepo, oidcStateRepo, oidcProviders, cfg.OIDC.StateTTL)
+	itemsSvc := service.NewItemsService(itemRepo, userRepo, categoryRepo, imageRepo, rateRepo, cfg.Currency.Base)
+	categoriesSvc := service.NewCategoriesService(categoryRepo)
+	adminSvc := service.NewAdminService(userRepo, itemRepo, refreshTokenRepo)
+	ratesSvc := service.NewRatesService(rateRepo, cfg.Currency.Base)
+	imagesSvc := service.NewImagesService(itemRepo, imageRepo, imageStore, cfg.Storage.MaxImageSize)
+	proxySvc := service.NewImageProxyService(itemRepo, safeurl.NewClient(constants.ImageProxyTimeout), net.DefaultResolver, cfg.Storage.MaxImageSize)
 
 	authH := handlers.NewAuthHandler(authSvc, logger)
+	oidcH := handlers.NewOIDCHandler(oidcSvc, logger)
+	jwksH := handlers.NewJWKSHandler(authSvc)
 	itemsH := handlers.NewItemsHandler(itemsSvc, logger)
+	categoriesH := handlers.NewCategoriesHandler(categoriesSvc, logger)
+	adminH := handlers.NewAdminHandler(adminSvc, logger)
+	ratesH := handlers.NewRatesHandler(ratesSvc, logger)
+	imagesH := handlers.NewImagesHandler(imagesSvc, logger)
+	proxyH := handlers.NewImageProxyHandler(proxySvc, logger)
 
 	r := mux.NewRouter()
 	r.Use(middleware.CORSMiddleware)
 	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.ClientIPMiddleware(cfg.Server.TrustProxy))
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -67,22 +144,79 @@ func main() {
 		}
 	}).Methods("GET")
 
+	// Keys verifying access tokens, for other services
+	r.HandleFunc("/.well-known/jwks.json", jwksH.GetJWKS).Methods("GET")
+
+	// Uploaded images
+	r.HandleFunc(service.MediaURLPrefix+"{key:.+}", imagesH.ServeImage).Methods("GET")
+
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Public routes
 	api.HandleFunc("/auth/register", authH.Register).Methods("POST", "OPTIONS")
 	api.HandleFunc("/auth/login", authH.Login).Methods("POST", "OPTIONS")
-	api.HandleFunc("/items", itemsH.GetItems).Methods("GET", "OPTIONS")
+	api.HandleFunc("/auth/refresh", authH.Refresh).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/logout", authH.Logout).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/password/reset-request", authH.RequestPasswordReset).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/password/reset", authH.ResetPassword).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/mfa/verify", authH.VerifyMFA).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/oidc/providers", oidcH.GetProviders).Methods("GET", "OPTIONS")
+	api.Handle("/auth/oidc/{provider}/start", middleware.OptionalAuthMiddleware(authSvc)(http.HandlerFunc(oidcH.Start))).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/oidc/callback", oidcH.Callback).Methods("POST", "OPTIONS")
+	api.Handle("/items", middleware.OptionalAuthMiddleware(authSvc, models.ScopeItemsRead)(http.HandlerFunc(itemsH.GetItems))).Methods("GET", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}", middleware.OptionalAuthMiddleware(authSvc, models.ScopeItemsRead)(http.HandlerFunc(itemsH.GetItem))).Methods("GET", "OPTIONS")
+	api.HandleFunc("/categories", categoriesH.GetCategories).Methods("GET", "OPTIONS")
+	api.HandleFunc("/exchange-rates", ratesH.GetRates).Methods("GET", "OPTIONS")
+	api.HandleFunc("/image-proxy", proxyH.GetImage).Methods("GET", "OPTIONS")
+
+	// Protected routes, item routes also accept API keys with the matching scope
+	api.Handle("/auth/password/change", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.ChangePassword))).Methods("POST", "OPTIONS")
+	api.Handle("/auth/email", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.ChangeEmail))).Methods("PUT", "OPTIONS")
+	api.Handle("/auth/mfa/totp/setup", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.SetupTOTP))).Methods("POST", "OPTIONS")
+	api.Handle("/auth/mfa/totp/confirm", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.ConfirmTOTP))).Methods("POST", "OPTIONS")
+	api.Handle("/auth/mfa/totp/disable", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.DisableTOTP))).Methods("POST", "OPTIONS")
+	api.Handle("/auth/api-keys", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.ListAPIKeys))).Methods("GET", "OPTIONS")
+	api.Handle("/auth/api-keys", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.CreateAPIKey))).Methods("POST", "OPTIONS")
+	api.Handle("/auth/api-keys/{id:[0-9]+}", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.RevokeAPIKey))).Methods("DELETE", "OPTIONS")
+	api.Handle("/auth/sessions", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.ListSessions))).Methods("GET", "OPTIONS")
+	api.Handle("/auth/sessions/{id:[0-9]+}", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(authH.RevokeSession))).Methods("DELETE", "OPTIONS")
+	api.Handle("/auth/oidc/identities", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(oidcH.ListIdentities))).Methods("GET", "OPTIONS")
+	api.Handle("/auth/oidc/identities/{id:[0-9]+}", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(oidcH.UnlinkIdentity))).Methods("DELETE", "OPTIONS")
+	api.Handle("/items", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(itemsH.CreateItem))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(itemsH.UpdateItem))).Methods("PUT", "PATCH", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(itemsH.DeleteItem))).Methods("DELETE", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/images", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(imagesH.UploadItemImage))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/images/order", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(imagesH.ReorderItemImages))).Methods("PUT", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/images/{imageID:[0-9]+}", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(imagesH.DeleteItemImage))).Methods("DELETE", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/images/{imageID:[0-9]+}/primary", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(imagesH.SetPrimaryItemImage))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/publish", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(itemsH.ChangeItemStatus(models.ItemStatusActive))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/reserve", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(itemsH.ChangeItemStatus(models.ItemStatusReserved))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/sell", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(itemsH.ChangeItemStatus(models.ItemStatusSold))).Methods("POST", "OPTIONS")
+	api.Handle("/items/{id:[0-9]+}/archive", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(itemsH.ChangeItemStatus(models.ItemStatusArchived))).Methods("POST", "OPTIONS")
 
-	// Protected routes
-	api.Handle("/items", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(itemsH.CreateItem))).Methods("POST", "OPTIONS")
+	// Admin routes
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware(authSvc), middleware.RequireRole(models.RoleAdmin))
+	admin.HandleFunc("/categories", categoriesH.CreateCategory).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/categories/{id:[0-9]+}", categoriesH.UpdateCategory).Methods("PUT", "OPTIONS")
+	admin.HandleFunc("/categories/{id:[0-9]+}", categoriesH.DeleteCategory).Methods("DELETE", "OPTIONS")
+	admin.HandleFunc("/exchange-rates", ratesH.ImportRates).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/users", adminH.ListUsers).Methods("GET", "OPTIONS")
+	admin.HandleFunc("/users/{id:[0-9]+}/role", adminH.SetUserRole).Methods("PUT", "OPTIONS")
+	admin.HandleFunc("/users/{id:[0-9]+}/disable", adminH.SetUserDisabled(true)).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/users/{id:[0-9]+}/enable", adminH.SetUserDisabled(false)).Methods("POST", "OPTIONS")
+
+	// Moderator routes
+	moderation := api.PathPrefix("/moderation").Subrouter()
+	moderation.Use(middleware.AuthMiddleware(authSvc), middleware.RequireRole(models.RoleModerator))
+	moderation.HandleFunc("/items/{id:[0-9]+}", adminH.RemoveItem).Methods("DELETE", "OPTIONS")
 
 	// Fallback for old API paths (без /api prefix)
 	r.HandleFunc("/auth/register", authH.Register).Methods("POST", "OPTIONS")
 	r.HandleFunc("/auth/login", authH.Login).Methods("POST", "OPTIONS")
-	r.HandleFunc("/items", itemsH.GetItems).Methods("GET", "OPTIONS")
-	r.Handle("/items", middleware.AuthMiddleware(authSvc)(http.HandlerFunc(itemsH.CreateItem))).Methods("POST", "OPTIONS")
+	r.Handle("/items", middleware.OptionalAuthMiddleware(authSvc, models.ScopeItemsRead)(http.HandlerFunc(itemsH.GetItems))).Methods("GET", "OPTIONS")
+	r.Handle("/items", middleware.AuthMiddleware(authSvc, models.ScopeItemsWrite)(http.HandlerFunc(itemsH.CreateItem))).Methods("POST", "OPTIONS")
 
 	// Serve frontend
 	r.PathPrefix("/").Handler(http.StripPrefix("/", http.FileServer(http.Dir("web"))))
@@ -104,3 +238,138 @@ func main() {
 	log.Printf("Server running on 0.0.0.0:%d", port)
 	log.Fatal(srv.ListenAndServe())
 }
+
+// newImageStore creates the image storage selected by the config
+func newImageStore(cfg config.StorageConfig) (service.ImageStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		path := cfg.LocalPath
+		if path == "" {
+			path = "uploads"
+		}
+		return storage.NewLocalStore(path)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		}, &http.Client{Timeout: constants.ServerTimeout})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// newMailer creates the mailer selected by the config, both drivers write messages for local use instead of sending them
+func newMailer(cfg config.MailConfig) (service.Mailer, error) {
+	switch cfg.Driver {
+	case "", "stdout":
+		return mail.NewWriterMailer(os.Stdout), nil
+	case "file":
+		path := cfg.Path
+		if path == "" {
+			path = "logs/mail.txt"
+		}
+		return mail.NewFileMailer(path)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// newOIDCProviders creates the OpenID providers users sign in with, keyed by name. Providers are discovered
+// on first use, so an unreachable provider does not stop the server
+func newOIDCProviders(cfg config.OIDCConfig) (map[string]service.OIDCProvider, error) {
+	if len(cfg.Providers) > 0 && cfg.RedirectURL == "" {
+		return nil, errors.New("oidc.redirect_url is required")
+	}
+
+	providers := make(map[string]service.OIDCProvider, len(cfg.Providers))
+	for _, pc := range cfg.Providers {
+		if pc.Name == "" || pc.Issuer == "" || pc.ClientID == "" {
+			return nil, errors.New("name, issuer and client_id are required")
+		}
+		if _, ok := providers[pc.Name]; ok {
+			return nil, fmt.Errorf("duplicate provider %s", pc.Name)
+		}
+		providers[pc.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       pc.Issuer,
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       pc.Scopes,
+		}, &http.Client{Timeout: constants.OIDCTimeout})
+	}
+	return providers, nil
+}
+
+// newKeySet loads the keys signing and verifying access tokens, without keys tokens are signed with the HS256 secret
+func newKeySet(cfg config.JWTConfig) (*mjwt.KeySet, error) {
+	var (
+		keySet *mjwt.KeySet
+		err    error
+	)
+	if len(cfg.Keys) == 0 {
+		if cfg.Secret == "" {
+			return nil, errors.New("jwt.secret or jwt.keys is required")
+		}
+		keySet, err = mjwt.NewKeySet("", mjwt.NewHMACKey("", []byte(cfg.Secret)))
+	} else {
+		keys := make([]*mjwt.Key, 0, len(cfg.Keys))
+		for _, kc := range cfg.Keys {
+			key, err := loadKey(kc)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", kc.ID, err)
+			}
+			keys = append(keys, key)
+		}
+		keySet, err = mjwt.NewKeySet(cfg.SigningKey, keys...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leeway := cfg.Leeway
+	if leeway <= 0 {
+		leeway = constants.TokenLeeway
+	}
+	keySet.Policy = mjwt.Policy{Issuer: cfg.Issuer, Audience: cfg.Audience, Leeway: leeway}
+	if cfg.PurposeSecret != "" {
+		keySet.SetPurposeSecret([]byte(cfg.PurposeSecret))
+	}
+	return keySet, nil
+}
+
+// loadKey reads a key from its PEM file, a private key file takes precedence over a public one
+func loadKey(cfg config.JWTKeyConfig) (*mjwt.Key, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("id is required")
+	}
+
+	switch {
+	case cfg.PrivateKeyFile != "":
+		// #nosec G304 -- key path is trusted and not user-controlled
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, err := mjwt.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return mjwt.NewSigningKey(cfg.ID, private)
+	case cfg.PublicKeyFile != "":
+		// #nosec G304 -- key path is trusted and not user-controlled
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := mjwt.ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return mjwt.NewVerificationKey(cfg.ID, public)
+	default:
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+}
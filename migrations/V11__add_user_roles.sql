@@ -0,0 +1,4 @@
+-- users get a role deciding what they may manage, disabled users cannot log in
+ALTER TABLE users
+	ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+	ADD COLUMN disabled_at TIMESTAMP;
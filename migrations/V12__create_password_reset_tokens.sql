@@ -0,0 +1,14 @@
+-- password_reset_tokens holds hashes of single-use password reset tokens
+CREATE TABLE password_reset_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT UNIQUE NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	used_at TIMESTAMP
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+-- email is where password reset links are mailed, empty when the user gave none
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
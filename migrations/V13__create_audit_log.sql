@@ -0,0 +1,12 @@
+-- audit_log records security events such as account lockouts
+CREATE TABLE audit_log (
+	id SERIAL PRIMARY KEY,
+	event TEXT NOT NULL,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	login TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	details TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
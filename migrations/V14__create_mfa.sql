@@ -0,0 +1,18 @@
+-- totp_credentials holds the TOTP secret of a user, enabled_at is set once the user confirmed a first code
+-- and last_counter is the last accepted time step, so a code is never accepted twice
+CREATE TABLE totp_credentials (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	enabled_at TIMESTAMP,
+	last_counter BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- recovery_codes holds hashes of single-use codes that replace a TOTP code when the authenticator is lost
+CREATE TABLE recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMP,
+	UNIQUE (user_id, code_hash)
+);
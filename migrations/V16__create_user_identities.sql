@@ -0,0 +1,26 @@
+-- user_identities links users to subjects of external OpenID providers, a subject belongs to one user
+CREATE TABLE user_identities (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+-- oidc_states holds pending sign-ins at OpenID providers until the provider redirects back,
+-- user_id is set when a signed in user links an identity
+CREATE TABLE oidc_states (
+	state_hash TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_oidc_states_expires_at ON oidc_states (expires_at);
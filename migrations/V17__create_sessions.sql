@@ -0,0 +1,13 @@
+-- sessions records where users are logged in, family_id is shared with the refresh tokens rotated from the login
+CREATE TABLE sessions (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id TEXT UNIQUE NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
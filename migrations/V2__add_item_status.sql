@@ -0,0 +1,11 @@
+ALTER TABLE items
+	ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+		CHECK (status IN ('draft', 'active', 'reserved', 'sold', 'archived')),
+	ADD COLUMN published_at TIMESTAMP,
+	ADD COLUMN reserved_at TIMESTAMP,
+	ADD COLUMN sold_at TIMESTAMP,
+	ADD COLUMN archived_at TIMESTAMP;
+
+UPDATE items SET published_at = created_at;
+
+CREATE INDEX idx_items_status_created_at ON items (status, created_at DESC);
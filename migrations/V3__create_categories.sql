@@ -0,0 +1,14 @@
+CREATE TABLE categories (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	parent_id INTEGER REFERENCES categories (id) ON DELETE RESTRICT,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_categories_parent_name ON categories (COALESCE(parent_id, 0), lower(name));
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+
+ALTER TABLE items
+	ADD COLUMN category_id INTEGER REFERENCES categories (id) ON DELETE RESTRICT;
+
+CREATE INDEX idx_items_category_id ON items (category_id);
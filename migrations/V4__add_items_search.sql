@@ -0,0 +1,7 @@
+ALTER TABLE items
+	ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(description, '')), 'B')
+	) STORED;
+
+CREATE INDEX idx_items_search_vector ON items USING GIN (search_vector);
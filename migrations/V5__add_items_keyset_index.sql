@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_items_status_created_at;
+
+CREATE INDEX idx_items_status_created_at_id ON items (status, created_at DESC, id DESC);
@@ -0,0 +1,5 @@
+-- prices keep exactly the fraction digits of their currency, e.g. 1500 JPY or 1.125 BHD
+ALTER TABLE items
+	ALTER COLUMN price TYPE NUMERIC,
+	ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD'
+		CHECK (currency ~ '^[A-Z]{3}$');
@@ -0,0 +1,12 @@
+-- rate is how many units of currency one unit of the base currency buys, the base currency itself needs no row
+CREATE TABLE exchange_rates (
+	currency TEXT PRIMARY KEY CHECK (currency ~ '^[A-Z]{3}$'),
+	rate NUMERIC NOT NULL CHECK (rate > 0),
+	updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- base_price converts an amount to the base currency passed by the caller, amounts in currencies without a rate
+-- have no base price, so items priced in them are left out of price filters and sorts instead of being compared at face value
+CREATE FUNCTION base_price(amount NUMERIC, cur TEXT, base TEXT) RETURNS NUMERIC
+	LANGUAGE SQL STABLE
+	AS $$ SELECT CASE WHEN cur = base THEN amount ELSE amount / (SELECT rate FROM exchange_rates WHERE currency = cur) END $$;
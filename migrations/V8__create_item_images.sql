@@ -0,0 +1,22 @@
+-- item_images holds the uploaded photos of an item ordered by position, at most one per item is primary
+CREATE TABLE item_images (
+	id SERIAL PRIMARY KEY,
+	item_id INTEGER NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL CHECK (position >= 0),
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	url TEXT NOT NULL,
+	medium_url TEXT NOT NULL,
+	thumbnail_url TEXT NOT NULL,
+	width INTEGER NOT NULL DEFAULT 0,
+	height INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_item_images_item_id_position ON item_images (item_id, position);
+CREATE UNIQUE INDEX idx_item_images_primary ON item_images (item_id) WHERE is_primary;
+
+-- single images uploaded before variants existed serve as their own variants
+INSERT INTO item_images (item_id, position, is_primary, url, medium_url, thumbnail_url)
+SELECT id, 0, TRUE, image_url, image_url, image_url
+FROM items
+WHERE image_url LIKE '/media/%';
@@ -0,0 +1,2 @@
+-- the image proxy only fetches URLs that are the image of an item, a hash index keeps that lookup cheap for long URLs
+CREATE INDEX idx_items_image_url ON items USING hash (image_url);
@@ -0,0 +1,76 @@
+// Package breached looks up passwords in a local copy of a breached password list split by hash prefix,
+// the layout of the k-anonymity range files of Have I Been Pwned. The directory holds one file per
+// 5 hex digit prefix of the uppercase SHA-1 of passwords, such as 5BAA6.txt, with a SUFFIX:COUNT line
+// for every breached password whose hash starts with the prefix
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1" // #nosec G505 -- the list is keyed by SHA-1, it is not used to protect passwords
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLen is the number of hex digits of a hash that select its range file
+const prefixLen = 5
+
+// ErrNotDirectory is returned when the list path is not a directory
+var ErrNotDirectory = errors.New("breached password list is not a directory")
+
+// List is a breached password list in a directory of range files
+type List struct {
+	dir string
+}
+
+// Open returns the list in dir, range files are read when passwords are looked up
+func Open(dir string) (*List, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrNotDirectory
+	}
+	return &List{dir: dir}, nil
+}
+
+// Hash returns the uppercase hex SHA-1 of password that the list is keyed by
+func Hash(password string) string {
+	sum := sha1.Sum([]byte(password)) // #nosec G401 -- see the import
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Count returns how often password appears in breaches, zero when it is not listed. Only the range file
+// of its hash prefix is read
+func (l *List) Count(password string) (int, error) {
+	hash := Hash(password)
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("range file %s: invalid count %q", prefix, count)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
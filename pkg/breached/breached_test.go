@@ -0,0 +1,56 @@
+package breached
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	// the SHA-1 of "password" used in the Have I Been Pwned range API examples
+	assert.Equal(t, "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", Hash("password"))
+}
+
+func TestList_Count(t *testing.T) {
+	dir := t.TempDir()
+	ranges := "003D68EB55068C33ACE09247EE4C639306B:3\r\n" +
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n" +
+		"\n" +
+		"1e4c9b93f3f0682250b6cf8331b7ee68fd9:2\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(ranges), 0o600))
+
+	list, err := Open(dir)
+	require.NoError(t, err)
+
+	count, err := list.Count("password")
+	require.NoError(t, err)
+	assert.Equal(t, 9545824, count)
+
+	// a prefix without a range file has no breached passwords
+	count, err = list.Count("a password nobody used")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestList_InvalidCount(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:many\n"), 0o600))
+
+	list, err := Open(dir)
+	require.NoError(t, err)
+	_, err = list.Count("password")
+	require.Error(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	file := filepath.Join(t.TempDir(), "list.txt")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = Open(file)
+	require.ErrorIs(t, err, ErrNotDirectory)
+}
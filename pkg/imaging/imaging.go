@@ -0,0 +1,85 @@
+// Package imaging provides image resizing on top of the standard library codecs
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales src down to fit within maxWidth x maxHeight keeping its aspect ratio,
+// images that already fit are returned unchanged. Pixels are averaged over the source area
+// each destination pixel covers, which avoids the aliasing of nearest-neighbour sampling
+func Fit(src image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw <= maxWidth && sh <= maxHeight || sw == 0 || sh == 0 {
+		return src
+	}
+
+	dw, dh := maxWidth, sh*maxWidth/sw
+	if dh > maxHeight {
+		dw, dh = sw*maxHeight/sh, maxHeight
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	return resize(toRGBA(src), dw, dh)
+}
+
+// toRGBA converts an image to premultiplied RGBA with its origin at 0,0
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	if rgba, ok := src.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// resize box-filters src to dw x dh, it only shrinks images
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := range dh {
+		y0, y1 := span(dy, dh, sh)
+		for dx := range dw {
+			x0, x1 := span(dx, dw, sw)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			p := dst.Pix[dy*dst.Stride+dx*4 : dy*dst.Stride+dx*4+4]
+			p[0] = uint8((r + n/2) / n) //nolint:gosec // an average of bytes fits in a byte
+			p[1] = uint8((g + n/2) / n) //nolint:gosec // an average of bytes fits in a byte
+			p[2] = uint8((b + n/2) / n) //nolint:gosec // an average of bytes fits in a byte
+			p[3] = uint8((a + n/2) / n) //nolint:gosec // an average of bytes fits in a byte
+		}
+	}
+	return dst
+}
+
+// span returns the source pixel range [from, to) covered by destination pixel i, it is never empty
+func span(i, dstSize, srcSize int) (from, to int) {
+	from = i * srcSize / dstSize
+	to = max((i+1)*srcSize/dstSize, from+1)
+	return from, to
+}
+
+// IsOpaque reports whether an image has no transparent pixels
+func IsOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
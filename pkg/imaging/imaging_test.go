@@ -0,0 +1,58 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name       string
+		w, h       int
+		maxW, maxH int
+		wantW      int
+		wantH      int
+	}{
+		{name: "landscape", w: 400, h: 200, maxW: 100, maxH: 100, wantW: 100, wantH: 50},
+		{name: "portrait", w: 200, h: 400, maxW: 100, maxH: 100, wantW: 50, wantH: 100},
+		{name: "already fits", w: 80, h: 60, maxW: 100, maxH: 100, wantW: 80, wantH: 60},
+		{name: "very thin", w: 1000, h: 2, maxW: 100, maxH: 100, wantW: 100, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(10, 10, 10+tt.w, 10+tt.h))
+			got := Fit(src, tt.maxW, tt.maxH)
+			assert.Equal(t, tt.wantW, got.Bounds().Dx())
+			assert.Equal(t, tt.wantH, got.Bounds().Dy())
+		})
+	}
+}
+
+func TestFit_AveragesPixels(t *testing.T) {
+	// a 4x2 image with a black left half and a white right half
+	src := image.NewGray(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			if x >= 2 {
+				src.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	got := Fit(src, 1, 1)
+	r, g, b, a := got.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0x8080, 0x8080, 0x8080, 0xffff}, []uint32{r, g, b, a})
+
+	got = Fit(src, 2, 2)
+	assert.Equal(t, color.RGBA{A: 255}, got.At(0, 0))
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, got.At(1, 0))
+}
+
+func TestIsOpaque(t *testing.T) {
+	assert.True(t, IsOpaque(image.NewGray(image.Rect(0, 0, 1, 1))))
+	assert.False(t, IsOpaque(image.NewNRGBA(image.Rect(0, 0, 1, 1))))
+}
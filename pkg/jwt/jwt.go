@@ -5,48 +5,51 @@ import (
 	"errors"
 	"time"
 
-	"github.com/artnikel/marketplace/internal/constants"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims represents the JWT claims used for authentication
+// Errors returned by ParseToken and KeySet.Parse, each wraps ErrInvalidToken
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("token issuer is not accepted")
+	ErrInvalidAudience  = errors.New("token audience is not accepted")
+	ErrMissingTokenID   = errors.New("token has no id")
+	ErrWrongPurpose     = errors.New("token is not meant for this use")
+)
+
+// Policy holds the registered claims set on signed tokens and required from parsed ones,
+// an empty Issuer or Audience is neither set nor checked. Leeway tolerates clock skew between servers
+type Policy struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Claims represents the JWT claims used for authentication, Purpose is empty for access tokens
+// and names the single step a token is good for otherwise. SessionID is the login session an access token belongs to
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Login  string `json:"login"`
+	UserID    int    `json:"user_id"`
+	Login     string `json:"login"`
+	Role      string `json:"role,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	SessionID int    `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a signed JWT token for a given user
-func GenerateJWT(userID int, login, secret string) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		Login:  login,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(constants.OneDayTimeout)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// GenerateJWT creates a token for a given user signed with an HS256 secret that expires after ttl
+func GenerateJWT(userID int, login, secret string, ttl time.Duration) (string, error) {
+	return hmacKeySet(secret).Sign(userID, login, "", ttl)
 }
 
-// ParseToken parses and validates a JWT token
+// ParseToken parses and validates a token signed with an HS256 secret
 func ParseToken(tokenStr, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-
-	return claims, nil
+	return hmacKeySet(secret).Parse(tokenStr)
+}
+
+// hmacKeySet returns a key set of a single secret without a key ID
+func hmacKeySet(secret string) *KeySet {
+	key := NewHMACKey("", []byte(secret))
+	return &KeySet{active: key, keys: map[string]*Key{key.ID: key}}
 }
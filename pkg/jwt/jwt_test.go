@@ -42,7 +42,7 @@ func TestGenerateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateJWT(tt.userID, tt.login, tt.secret)
+			token, err := GenerateJWT(tt.userID, tt.login, tt.secret, time.Hour)
 
 			if tt.want {
 				require.NoError(t, err)
@@ -64,7 +64,7 @@ func TestParseToken(t *testing.T) {
 	userID := 123
 	login := "testuser"
 
-	validToken, err := GenerateJWT(userID, login, secret)
+	validToken, err := GenerateJWT(userID, login, secret, time.Hour)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -0,0 +1,356 @@
+// Package jwt provides rotatable signing keys for JWT tokens and publishes them as a JWKS
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// minRSABits is the smallest accepted RSA modulus
+	minRSABits = 2048
+	// tokenIDBytes is the amount of randomness in a token ID
+	tokenIDBytes = 16
+	// purposeKeyBytes is the size of a generated purpose key
+	purposeKeyBytes = 32
+	// accessTokenType is the typ header of access tokens
+	accessTokenType = "JWT"
+	// purposeTokenType is the typ header of purpose tokens, Parse refuses tokens carrying it
+	purposeTokenType = "purpose+jwt"
+)
+
+// Errors returned when loading keys and verifying tokens
+var (
+	ErrUnsupportedKey = errors.New("unsupported key, use RSA or Ed25519")
+	ErrUnknownKey     = errors.New("token is signed with an unknown key")
+)
+
+// Key signs or verifies tokens under a key ID, the ID is sent as the kid header of signed tokens.
+// RSA keys sign with RS256, Ed25519 keys with EdDSA and secrets with HS256
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// NewSigningKey creates a key that signs with private and verifies with its public part
+func NewSigningKey(id string, private crypto.Signer) (*Key, error) {
+	key, err := NewVerificationKey(id, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.sign = private
+	return key, nil
+}
+
+// NewVerificationKey creates a key that only verifies tokens, such as a retired signing key
+func NewVerificationKey(id string, public crypto.PublicKey) (*Key, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: RSA keys must have at least %d bits", ErrUnsupportedKey, minRSABits)
+		}
+		return &Key{ID: id, method: jwt.SigningMethodRS256, verify: pub}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, method: jwt.SigningMethodEdDSA, verify: pub}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// NewHMACKey creates a key that signs and verifies with a shared secret, it is never published in a JWKS
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// Algorithm returns the JWS algorithm of the key
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// ParsePrivateKeyPEM parses a PKCS #8 or PKCS #1 RSA private key in PEM form
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return signer, nil
+}
+
+// ParsePublicKeyPEM parses a PKIX or PKCS #1 RSA public key in PEM form
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// KeySet signs tokens with its active key and verifies tokens with any of its keys, chosen by the kid header.
+// Keeping the previous key for verification lets tokens signed before a rotation stay valid until they expire.
+// Purpose tokens are signed with a separate HMAC key that is never published, so a holder of the public keys
+// cannot tell them apart from access tokens by signature alone and no access token verifier accepts them
+type KeySet struct {
+	Policy  Policy
+	active  *Key
+	keys    map[string]*Key
+	purpose *Key
+}
+
+// NewKeySet creates a key set that signs with the key activeID, which must be able to sign. Purpose tokens are
+// signed with a random key until SetPurposeSecret is called, so they only work on the instance that signed them
+func NewKeySet(activeID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not configured", activeID)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", activeID)
+	}
+	ks.active = active
+
+	secret := make([]byte, purposeKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	ks.SetPurposeSecret(secret)
+	return ks, nil
+}
+
+// SetPurposeSecret sets the HS256 secret signing and verifying purpose tokens, instances sharing the
+// secret accept the purpose tokens of each other
+func (ks *KeySet) SetPurposeSecret(secret []byte) {
+	ks.purpose = NewHMACKey("", secret)
+}
+
+// Sign creates a signed access token with a unique ID for a given user and role that expires after ttl
+func (ks *KeySet) Sign(userID int, login, role string, ttl time.Duration) (string, error) {
+	return ks.sign(&Claims{UserID: userID, Login: login, Role: role}, ttl)
+}
+
+// SignSession creates a signed access token like Sign that belongs to the login session sessionID,
+// so it can be refused once the session is ended
+func (ks *KeySet) SignSession(userID int, login, role string, sessionID int, ttl time.Duration) (string, error) {
+	return ks.sign(&Claims{UserID: userID, Login: login, Role: role, SessionID: sessionID}, ttl)
+}
+
+// SignPurpose creates a token that is only accepted by ParsePurpose with the same purpose, such as a token
+// proving the password step of a two-step login. It is signed with the purpose key, has its own typ header
+// and an audience naming the purpose, so Parse refuses it
+func (ks *KeySet) SignPurpose(purpose string, userID int, login string, ttl time.Duration) (string, error) {
+	if ks.purpose == nil {
+		return "", errors.New("key set has no purpose key")
+	}
+	claims := &Claims{UserID: userID, Login: login, Purpose: purpose}
+	if err := ks.register(claims, ks.purposeAudience(purpose), ttl); err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ks.purpose.method, claims)
+	token.Header["typ"] = purposeTokenType
+	return token.SignedString(ks.purpose.sign)
+}
+
+// sign sets the registered claims of claims and signs them with the active key
+func (ks *KeySet) sign(claims *Claims, ttl time.Duration) (string, error) {
+	if err := ks.register(claims, ks.Policy.Audience, ttl); err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.ID != "" {
+		token.Header["kid"] = ks.active.ID
+	}
+	return token.SignedString(ks.active.sign)
+}
+
+// register sets the registered claims of claims with a unique ID, an empty audience is left out
+func (ks *KeySet) register(claims *Claims, audience string, ttl time.Duration) error {
+	id := make([]byte, tokenIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    ks.Policy.Issuer,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	return nil
+}
+
+// purposeAudience returns the audience of purpose tokens for purpose, it never equals the audience of access tokens
+func (ks *KeySet) purposeAudience(purpose string) string {
+	if ks.Policy.Audience == "" {
+		return purpose
+	}
+	return ks.Policy.Audience + "/" + purpose
+}
+
+// Parse parses an access token signed by a key of the set and validates its claims against the policy,
+// the token algorithm must match the key so a public key is never used as an HMAC secret
+func (ks *KeySet) Parse(tokenStr string) (*Claims, error) {
+	return ks.parse(tokenStr, "", ks.Policy.Audience, func(t *jwt.Token) (*Key, error) {
+		if typ, _ := t.Header["typ"].(string); typ != accessTokenType && typ != "" {
+			return nil, ErrWrongPurpose
+		}
+		kid, _ := t.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		return key, nil
+	})
+}
+
+// ParsePurpose parses a token signed by SignPurpose and requires it to be signed for purpose
+func (ks *KeySet) ParsePurpose(tokenStr, purpose string) (*Claims, error) {
+	return ks.parse(tokenStr, purpose, ks.purposeAudience(purpose), func(t *jwt.Token) (*Key, error) {
+		if typ, _ := t.Header["typ"].(string); typ != purposeTokenType || ks.purpose == nil {
+			return nil, ErrWrongPurpose
+		}
+		return ks.purpose, nil
+	})
+}
+
+// parse parses a token verified with the key chosen by keyFor and validates its claims against the policy,
+// the audience and purpose
+func (ks *KeySet) parse(tokenStr, purpose, audience string, keyFor func(*jwt.Token) (*Key, error)) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(ks.Policy.Leeway)}
+	if ks.Policy.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ks.Policy.Issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
+		key, err := keyFor(t)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verify, nil
+	}, opts...)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrMissingTokenID)
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrWrongPurpose)
+	}
+
+	return claims, nil
+}
+
+// parseError maps a parser error to the package errors
+func parseError(err error) error {
+	var reason error
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		reason = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		reason = ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		reason = ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		reason = ErrInvalidAudience
+	case errors.Is(err, ErrUnknownKey):
+		reason = ErrUnknownKey
+	case errors.Is(err, ErrWrongPurpose):
+		reason = ErrWrongPurpose
+	default:
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidToken, reason)
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set ordered by key ID, HMAC keys are left out
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.method.Alg()}
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
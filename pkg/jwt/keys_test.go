@@ -0,0 +1,366 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSAKey(t *testing.T, id string) (*Key, *rsa.PrivateKey) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key, private
+}
+
+func newEd25519Key(t *testing.T, id string) (*Key, ed25519.PrivateKey) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key, private
+}
+
+func TestKeySet_SignAndParse(t *testing.T) {
+	rsaKey, _ := newRSAKey(t, "rsa-1")
+	edKey, _ := newEd25519Key(t, "ed-1")
+
+	tests := []struct {
+		name    string
+		key     *Key
+		wantAlg string
+	}{
+		{name: "RS256", key: rsaKey, wantAlg: "RS256"},
+		{name: "EdDSA", key: edKey, wantAlg: "EdDSA"},
+		{name: "HS256", key: NewHMACKey("hmac-1", []byte("secret")), wantAlg: "HS256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeySet(tt.key.ID, tt.key)
+			require.NoError(t, err)
+
+			token, err := keys.Sign(42, "testuser", "admin", time.Minute)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAlg, parsed.Method.Alg())
+			assert.Equal(t, tt.key.ID, parsed.Header["kid"])
+
+			claims, err := keys.Parse(token)
+			require.NoError(t, err)
+			assert.Equal(t, 42, claims.UserID)
+			assert.Equal(t, "testuser", claims.Login)
+			assert.Equal(t, "admin", claims.Role)
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey, oldPrivate := newRSAKey(t, "2024-01")
+	newKey, _ := newEd25519Key(t, "2024-05")
+
+	before, err := NewKeySet("2024-01", oldKey)
+	require.NoError(t, err)
+	oldToken, err := before.Sign(1, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+
+	// after the rotation the old key only verifies
+	retired, err := NewVerificationKey("2024-01", &oldPrivate.PublicKey)
+	require.NoError(t, err)
+	after, err := NewKeySet("2024-05", newKey, retired)
+	require.NoError(t, err)
+
+	_, err = after.Parse(oldToken)
+	require.NoError(t, err)
+
+	newToken, err := after.Sign(1, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+	_, err = before.Parse(newToken)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewKeySet("2024-01", newKey, retired)
+	require.Error(t, err)
+	_, err = NewKeySet("missing", newKey)
+	require.Error(t, err)
+	_, err = NewKeySet("2024-05", newKey, newKey)
+	require.Error(t, err)
+}
+
+func TestKeySet_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, private := newRSAKey(t, "rsa-1")
+	keys, err := NewKeySet("rsa-1", rsaKey)
+	require.NoError(t, err)
+
+	// an HS256 token keyed with the published public key must not verify
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           1,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	forged.Header["kid"] = "rsa-1"
+	token, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	require.NoError(t, err)
+
+	claims, err := keys.Parse(token)
+	require.Error(t, err)
+	assert.Nil(t, claims)
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	_, rsaPrivate := newRSAKey(t, "rsa-1")
+	_, edPrivate := newEd25519Key(t, "ed-1")
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	require.NoError(t, err)
+	signer, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	require.NoError(t, err)
+	assert.Equal(t, edPrivate.Public(), signer.Public())
+
+	pkcs1 := x509.MarshalPKCS1PrivateKey(rsaPrivate)
+	signer, err = ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1}))
+	require.NoError(t, err)
+	assert.True(t, rsaPrivate.PublicKey.Equal(signer.Public()))
+
+	pkix, err := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	require.NoError(t, err)
+	public, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))
+	require.NoError(t, err)
+	assert.True(t, rsaPrivate.PublicKey.Equal(public))
+
+	_, err = ParsePrivateKeyPEM([]byte("not a key"))
+	require.Error(t, err)
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewSigningKey("small", small)
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	rsaKey, rsaPrivate := newRSAKey(t, "b-rsa")
+	edKey, edPrivate := newEd25519Key(t, "a-ed")
+	keys, err := NewKeySet("b-rsa", rsaKey, edKey, NewHMACKey("c-hmac", []byte("secret")))
+	require.NoError(t, err)
+
+	set := keys.JWKS()
+	require.Len(t, set.Keys, 2)
+
+	assert.Equal(t, JWK{
+		KeyType:   "OKP",
+		KeyID:     "a-ed",
+		Use:       "sig",
+		Algorithm: "EdDSA",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(edPrivate.Public().(ed25519.PublicKey)),
+	}, set.Keys[0])
+
+	assert.Equal(t, "RSA", set.Keys[1].KeyType)
+	assert.Equal(t, "RS256", set.Keys[1].Algorithm)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(rsaPrivate.N.Bytes()), set.Keys[1].N)
+}
+
+func TestKeySet_Policy(t *testing.T) {
+	key := NewHMACKey("k1", []byte("secret"))
+	policy := Policy{Issuer: "marketplace", Audience: "marketplace-api", Leeway: 30 * time.Second}
+	keys, err := NewKeySet("k1", key)
+	require.NoError(t, err)
+	keys.Policy = policy
+
+	sign := func(claims jwt.RegisteredClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: 1, RegisteredClaims: claims})
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString([]byte("secret"))
+		require.NoError(t, err)
+		return s
+	}
+	now := time.Now()
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    "marketplace",
+			Audience:  jwt.ClaimStrings{"marketplace-api"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "token-1",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *jwt.RegisteredClaims)
+		wantErr error
+	}{
+		{name: "valid", modify: func(_ *jwt.RegisteredClaims) {}},
+		{
+			name:   "expired within leeway",
+			modify: func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) },
+		},
+		{
+			name:    "expired",
+			modify:  func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "no expiry",
+			modify:  func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "not valid yet",
+			modify:  func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) },
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name:    "issued in the future",
+			modify:  func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) },
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name:    "other issuer",
+			modify:  func(c *jwt.RegisteredClaims) { c.Issuer = "staging" },
+			wantErr: ErrInvalidIssuer,
+		},
+		{
+			name:    "other audience",
+			modify:  func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"billing"} },
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name:    "missing token id",
+			modify:  func(c *jwt.RegisteredClaims) { c.ID = "" },
+			wantErr: ErrMissingTokenID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(&claims)
+
+			parsed, err := keys.Parse(sign(claims))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.ErrorIs(t, err, ErrInvalidToken)
+				assert.Nil(t, parsed)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, parsed.UserID)
+		})
+	}
+}
+
+func TestKeySet_SignSetsPolicyClaims(t *testing.T) {
+	keys, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+	keys.Policy = Policy{Issuer: "marketplace", Audience: "marketplace-api"}
+
+	first, err := keys.Sign(1, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+	second, err := keys.Sign(1, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+
+	claims, err := keys.Parse(first)
+	require.NoError(t, err)
+	assert.Equal(t, "marketplace", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"marketplace-api"}, claims.Audience)
+	assert.NotNil(t, claims.NotBefore)
+	other, err := keys.Parse(second)
+	require.NoError(t, err)
+	assert.NotEqual(t, claims.ID, other.ID)
+
+	// tokens of another environment sharing the secret are refused
+	staging, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+	staging.Policy = Policy{Issuer: "marketplace-staging", Audience: "marketplace-api"}
+	_, err = staging.Parse(first)
+	require.ErrorIs(t, err, ErrInvalidIssuer)
+}
+
+func TestKeySet_Purpose(t *testing.T) {
+	keys, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+
+	pending, err := keys.SignPurpose("mfa", 7, "testuser", time.Minute)
+	require.NoError(t, err)
+	access, err := keys.Sign(7, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+
+	claims, err := keys.ParsePurpose(pending, "mfa")
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+	assert.Equal(t, "mfa", claims.Purpose)
+
+	// a purpose token is not an access token and the other way round
+	_, err = keys.Parse(pending)
+	require.ErrorIs(t, err, ErrWrongPurpose)
+	_, err = keys.ParsePurpose(access, "mfa")
+	require.ErrorIs(t, err, ErrWrongPurpose)
+	_, err = keys.ParsePurpose(pending, "reset")
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeySet_PurposeKey(t *testing.T) {
+	keys, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+	keys.Policy = Policy{Issuer: "marketplace", Audience: "marketplace-api"}
+
+	pending, err := keys.SignPurpose("mfa", 7, "testuser", time.Minute)
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(pending, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "purpose+jwt", token.Header["typ"])
+	assert.Nil(t, token.Header["kid"])
+	aud, err := token.Claims.GetAudience()
+	require.NoError(t, err)
+	assert.Equal(t, jwt.ClaimStrings{"marketplace-api/mfa"}, aud)
+
+	// purpose tokens are not signed with the access token keys
+	_, err = keys.ParsePurpose(pending, "mfa")
+	require.NoError(t, err)
+	other, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+	other.Policy = keys.Policy
+	_, err = other.ParsePurpose(pending, "mfa")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// instances sharing the purpose secret accept each other's tokens
+	keys.SetPurposeSecret([]byte("purpose-secret"))
+	other.SetPurposeSecret([]byte("purpose-secret"))
+	pending, err = keys.SignPurpose("mfa", 7, "testuser", time.Minute)
+	require.NoError(t, err)
+	claims, err := other.ParsePurpose(pending, "mfa")
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+}
+
+func TestKeySet_SignSession(t *testing.T) {
+	keys, err := NewKeySet("k1", NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+
+	token, err := keys.SignSession(7, "testuser", "user", 12, time.Minute)
+	require.NoError(t, err)
+	claims, err := keys.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, 12, claims.SessionID)
+
+	token, err = keys.Sign(7, "testuser", "user", time.Minute)
+	require.NoError(t, err)
+	claims, err = keys.Parse(token)
+	require.NoError(t, err)
+	assert.Zero(t, claims.SessionID)
+}
@@ -0,0 +1,279 @@
+// Package money provides exact decimal amounts and ISO 4217 currency rules for prices
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for prices sent without a currency
+const DefaultCurrency = "USD"
+
+// maxDigits keeps the unscaled value of an amount within int64
+const maxDigits = 18
+
+// Errors returned when parsing or validating amounts
+var (
+	ErrInvalidAmount   = errors.New("invalid amount")
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrTooPrecise      = errors.New("more fraction digits than the currency allows")
+)
+
+// Amount is an exact decimal number kept as an integer count of 10^-scale units, so 12.50 is {1250, 2}.
+// The zero value is 0
+type Amount struct {
+	units int64
+	scale int
+}
+
+// New creates an amount of units * 10^-scale
+func New(units int64, scale int) Amount {
+	return Amount{units: units, scale: scale}
+}
+
+// Parse reads a plain decimal such as "12", "-0.5" or "1999.99", exponents are not accepted
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	intPart, frac, hasDot := strings.Cut(s, ".")
+	if intPart == "" && frac == "" || hasDot && frac == "" {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	digits := intPart + frac
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Amount{}, ErrInvalidAmount
+		}
+	}
+	if len(strings.TrimLeft(digits, "0")) > maxDigits || len(frac) > maxDigits {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Amount{}, ErrInvalidAmount
+	}
+	if neg {
+		units = -units
+	}
+	return Amount{units: units, scale: len(frac)}, nil
+}
+
+// MustParse is like Parse but panics on malformed input, it is meant for constants and tests
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(fmt.Sprintf("money: cannot parse %q: %v", s, err))
+	}
+	return a
+}
+
+// String formats the amount with all of its fraction digits, e.g. "12.50"
+func (a Amount) String() string {
+	units := a.units
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+
+	s := strconv.FormatInt(units, 10)
+	if a.scale == 0 {
+		return sign + s
+	}
+	if len(s) <= a.scale {
+		s = strings.Repeat("0", a.scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-a.scale] + "." + s[len(s)-a.scale:]
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of the amount
+func (a Amount) Sign() int {
+	switch {
+	case a.units < 0:
+		return -1
+	case a.units > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsZero reports whether the amount is 0
+func (a Amount) IsZero() bool {
+	return a.units == 0
+}
+
+// Cmp compares two amounts regardless of their scales and returns -1, 0 or 1
+func (a Amount) Cmp(b Amount) int {
+	return a.rat().Cmp(b.rat())
+}
+
+// Rescale returns the same value with exactly scale fraction digits,
+// failing with ErrTooPrecise when that would drop non-zero digits
+func (a Amount) Rescale(scale int) (Amount, error) {
+	if scale < 0 {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	units := a.units
+	for s := a.scale; s > scale; s-- {
+		if units%10 != 0 {
+			return Amount{}, ErrTooPrecise
+		}
+		units /= 10
+	}
+	for s := a.scale; s < scale; s++ {
+		if units > (1<<63-1)/10 || units < -(1<<63-1)/10 {
+			return Amount{}, ErrInvalidAmount
+		}
+		units *= 10
+	}
+	return Amount{units: units, scale: scale}, nil
+}
+
+// ForCurrency validates the amount against the currency minor unit and returns it
+// with exactly as many fraction digits as the currency uses
+func (a Amount) ForCurrency(currency string) (Amount, error) {
+	exp, ok := Exponent(currency)
+	if !ok {
+		return Amount{}, ErrUnknownCurrency
+	}
+	return a.Rescale(exp)
+}
+
+// MulDiv returns a * mul / div rounded half away from zero to scale fraction digits,
+// it is used to convert amounts with exchange rates
+func (a Amount) MulDiv(mul, div Amount, scale int) (Amount, error) {
+	if div.IsZero() || scale < 0 || scale > maxDigits {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	num := new(big.Int).Mul(big.NewInt(a.units), big.NewInt(mul.units))
+	num.Mul(num, pow10(scale+div.scale))
+	den := new(big.Int).Mul(big.NewInt(div.units), pow10(a.scale+mul.scale))
+	if den.Sign() < 0 {
+		num.Neg(num)
+		den.Neg(den)
+	}
+
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Abs(m).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if len(new(big.Int).Abs(q).String()) > maxDigits {
+		return Amount{}, ErrInvalidAmount
+	}
+	return Amount{units: q.Int64(), scale: scale}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// rat returns the amount as an exact rational number
+func (a Amount) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(a.units), pow10(a.scale))
+}
+
+// MarshalJSON encodes the amount as a decimal string so clients never see a rounded float
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts both a JSON number and a decimal string, keeping every digit as sent
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*a = Amount{}
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns selected as text
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Amount{}
+		return nil
+	case string:
+		return a.scanString(v)
+	case []byte:
+		return a.scanString(string(v))
+	default:
+		return fmt.Errorf("money: cannot scan %T into Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, amounts are sent to the database as decimal text
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// NormalizeCurrency upper-cases a currency code and falls back to DefaultCurrency when it is empty
+func NormalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency
+	}
+	return code
+}
+
+// Exponent returns the number of fraction digits of an ISO 4217 currency minor unit,
+// it reports false for unknown codes and for funds and metals without a minor unit
+func Exponent(currency string) (int, bool) {
+	switch currency {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF",
+		"UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0, true
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3, true
+	case "CLF", "UYW":
+		return 4, true
+	case "AED", "AFN", "ALL", "AMD", "ANG", "AOA", "ARS", "AUD", "AWG", "AZN",
+		"BAM", "BBD", "BDT", "BGN", "BMD", "BND", "BOB", "BOV", "BRL", "BSD",
+		"BTN", "BWP", "BYN", "BZD", "CAD", "CDF", "CHE", "CHF", "CHW", "CNY",
+		"COP", "COU", "CRC", "CUP", "CVE", "CZK", "DKK", "DOP", "DZD", "EGP",
+		"ERN", "ETB", "EUR", "FJD", "FKP", "GBP", "GEL", "GHS", "GIP", "GMD",
+		"GTQ", "GYD", "HKD", "HNL", "HTG", "HUF", "IDR", "ILS", "INR", "IRR",
+		"JMD", "KES", "KGS", "KHR", "KPW", "KYD", "KZT", "LAK", "LBP", "LKR",
+		"LRD", "LSL", "MAD", "MDL", "MGA", "MKD", "MMK", "MNT", "MOP", "MRU",
+		"MUR", "MVR", "MWK", "MXN", "MXV", "MYR", "MZN", "NAD", "NGN", "NIO",
+		"NOK", "NPR", "NZD", "PAB", "PEN", "PGK", "PHP", "PKR", "PLN", "QAR",
+		"RON", "RSD", "RUB", "SAR", "SBD", "SCR", "SDG", "SEK", "SGD", "SHP",
+		"SLE", "SOS", "SRD", "SSP", "STN", "SVC", "SYP", "SZL", "THB", "TJS",
+		"TMT", "TOP", "TRY", "TTD", "TWD", "TZS", "UAH", "USD", "USN", "UYU",
+		"UZS", "VED", "VES", "WST", "XCD", "XCG", "YER", "ZAR", "ZMW", "ZWG":
+		return 2, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,143 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "integer", input: "12", want: "12"},
+		{name: "fraction digits are kept", input: "12.50", want: "12.50"},
+		{name: "leading dot", input: ".5", want: "0.5"},
+		{name: "negative", input: "-0.05", want: "-0.05"},
+		{name: "surrounding spaces", input: " 7.1 ", want: "7.1"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "trailing dot", input: "12.", wantErr: true},
+		{name: "exponent", input: "1e2", wantErr: true},
+		{name: "letters", input: "12.5abc", wantErr: true},
+		{name: "too many digits", input: "1234567890123456789", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestAmount_ForCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     string
+		wantErr  error
+	}{
+		{name: "pads to minor unit", amount: "10.5", currency: "USD", want: "10.50"},
+		{name: "trailing zeros are dropped", amount: "10.500", currency: "EUR", want: "10.50"},
+		{name: "zero-decimal currency", amount: "1500", currency: "JPY", want: "1500"},
+		{name: "three-decimal currency", amount: "1.125", currency: "BHD", want: "1.125"},
+		{name: "too precise for USD", amount: "0.001", currency: "USD", wantErr: ErrTooPrecise},
+		{name: "fractional yen", amount: "10.5", currency: "JPY", wantErr: ErrTooPrecise},
+		{name: "less common currency", amount: "25.1", currency: "MAD", want: "25.10"},
+		{name: "four-decimal currency", amount: "1.5", currency: "CLF", want: "1.5000"},
+		{name: "unknown currency", amount: "10", currency: "XYZ", wantErr: ErrUnknownCurrency},
+		{name: "metal without minor unit", amount: "1", currency: "XAU", wantErr: ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MustParse(tt.amount).ForCurrency(tt.currency)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestAmount_Cmp(t *testing.T) {
+	assert.Equal(t, 0, MustParse("0.30").Cmp(MustParse("0.3")))
+	assert.Equal(t, -1, MustParse("0.1").Cmp(MustParse("0.11")))
+	assert.Equal(t, 1, MustParse("2").Cmp(MustParse("-3")))
+	assert.Equal(t, 0, New(1, 1).Cmp(MustParse("0.1")))
+}
+
+func TestAmount_MulDiv(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		mul     string
+		div     string
+		scale   int
+		want    string
+		wantErr bool
+	}{
+		{name: "usd to eur", amount: "10.00", mul: "0.92", div: "1", scale: 2, want: "9.20"},
+		{name: "eur to jpy through usd", amount: "9.99", mul: "151.3", div: "0.92", scale: 0, want: "1643"},
+		{name: "rounds half away from zero", amount: "0.05", mul: "1", div: "2", scale: 2, want: "0.03"},
+		{name: "negative rounds away from zero", amount: "-0.05", mul: "1", div: "2", scale: 2, want: "-0.03"},
+		{name: "division by zero", amount: "1", mul: "1", div: "0", scale: 2, wantErr: true},
+		{name: "overflow", amount: "999999999999999999", mul: "1000", div: "1", scale: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MustParse(tt.amount).MulDiv(MustParse(tt.mul), MustParse(tt.div), tt.scale)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestAmount_JSON(t *testing.T) {
+	var in struct {
+		Number Amount `json:"number"`
+		Text   Amount `json:"text"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"number": 0.30000000000000004, "text": "19.99"}`), &in))
+	assert.Equal(t, "0.30000000000000004", in.Number.String())
+	assert.Equal(t, "19.99", in.Text.String())
+
+	_, err := in.Number.ForCurrency("USD")
+	require.ErrorIs(t, err, ErrTooPrecise)
+
+	out, err := json.Marshal(map[string]Amount{"price": New(1250, 2)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price":"12.50"}`, string(out))
+
+	require.Error(t, json.Unmarshal([]byte(`{"number": "abc"}`), &in))
+}
+
+func TestAmount_Scan(t *testing.T) {
+	var a Amount
+	require.NoError(t, a.Scan("123.45"))
+	assert.Equal(t, "123.45", a.String())
+
+	v, err := a.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "123.45", v)
+
+	require.Error(t, a.Scan(12.5))
+}
@@ -0,0 +1,10 @@
+package oidc
+
+import "time"
+
+// ExpireKeys lets the next unknown key ID fetch the key set again without waiting keyRefreshInterval
+func (p *Provider) ExpireKeys() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keysFetched = time.Time{}
+}
@@ -0,0 +1,123 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/artnikel/marketplace/pkg/oidc"
+	"github.com/artnikel/marketplace/pkg/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/login/callback"
+
+// signIn runs the authorization of the flow and returns the code and the verifier it was requested with
+func signIn(t *testing.T, p *oidc.Provider, nonce string) (code, verifier string) {
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", nonce, oidc.Challenge(verifier))
+	require.NoError(t, err)
+
+	code, state, err := oidctest.Authorize(http.DefaultClient, authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", state)
+	return code, verifier
+}
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	mock, srv, err := oidctest.NewServer("marketplace", "secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	p := oidc.NewProvider(oidc.Config{
+		Issuer: srv.URL, ClientID: "marketplace", ClientSecret: "secret", RedirectURL: redirectURL,
+	}, srv.Client())
+	return mock, p
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	mock, p := newProvider(t)
+	mock.SetUser(oidctest.User{Subject: "abc", Email: "jane@example.com", PreferredUsername: "jane", Name: "Jane"})
+
+	code, verifier := signIn(t, p, "nonce-1")
+	identity, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, &oidc.Identity{
+		Issuer: mock.Issuer, Subject: "abc", Email: "jane@example.com", EmailVerified: true, Name: "Jane", PreferredUsername: "jane",
+	}, identity)
+
+	// codes work once
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestProvider_ExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier func(verifier string) string
+		nonce    string
+		wantErr  error
+	}{
+		{name: "wrong verifier", verifier: func(string) string { return "other-verifier" }, nonce: "nonce-1", wantErr: oidc.ErrExchange},
+		{name: "wrong nonce", verifier: func(v string) string { return v }, nonce: "nonce-2", wantErr: oidc.ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, p := newProvider(t)
+			code, verifier := signIn(t, p, "nonce-1")
+
+			_, err := p.Exchange(context.Background(), code, tt.verifier(verifier), tt.nonce)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProvider_WrongClientSecret(t *testing.T) {
+	_, srv, err := oidctest.NewServer("marketplace", "secret")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	p := oidc.NewProvider(oidc.Config{
+		Issuer: srv.URL, ClientID: "marketplace", ClientSecret: "wrong", RedirectURL: redirectURL,
+	}, srv.Client())
+	code, verifier := signIn(t, p, "nonce-1")
+
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	mock, p := newProvider(t)
+
+	code, verifier := signIn(t, p, "nonce-1")
+	_, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+
+	require.NoError(t, mock.RotateKey("rotated"))
+
+	// the key set was just fetched, so the new key ID is not looked up yet
+	code, verifier = signIn(t, p, "nonce-2")
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-2")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+
+	p.ExpireKeys()
+	code, verifier = signIn(t, p, "nonce-3")
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-3")
+	assert.NoError(t, err)
+}
+
+func TestProvider_DiscoveryIssuerMismatch(t *testing.T) {
+	mock, srv, err := oidctest.NewServer("marketplace", "secret")
+	require.NoError(t, err)
+	defer srv.Close()
+	mock.Issuer = "https://other.example.com"
+
+	p := oidc.NewProvider(oidc.Config{Issuer: srv.URL, ClientID: "marketplace", RedirectURL: redirectURL}, srv.Client())
+	_, err = p.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	assert.ErrorIs(t, err, oidc.ErrDiscovery)
+}
@@ -0,0 +1,140 @@
+// Package passhash hashes passwords with Argon2id (RFC 9106) in the PHC string format and verifies
+// Argon2id and bcrypt hashes, so hashes of both algorithms can be stored side by side
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// saltBytes is the size of a generated salt
+	saltBytes = 16
+	// keyBytes is the size of a derived key
+	keyBytes = 32
+	// argon2idPrefix starts every Argon2id hash
+	argon2idPrefix = "$argon2id$"
+	// argon2idFields is the number of $-separated parts of an Argon2id hash, the first one is empty
+	argon2idFields = 6
+
+	// maxMemory, maxIterations and maxParallelism bound the cost parameters of hashes that are verified,
+	// so a planted hash cannot make a single login take gigabytes of memory or minutes of work
+	maxMemory      = 1024 * 1024
+	maxIterations  = 16
+	maxParallelism = 16
+	// maxSaltBytes and maxKeyBytes bound the salt and key of hashes that are verified
+	maxSaltBytes = 64
+	maxKeyBytes  = 64
+)
+
+// ErrUnsupportedHash is returned for a hash that is neither Argon2id nor bcrypt, or that cannot be parsed
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+// Params holds the Argon2id cost parameters, Memory is in KiB
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hasher hashes passwords with Argon2id and the cost parameters it was created with
+type Hasher struct {
+	params Params
+}
+
+// NewHasher creates a new Hasher, cost parameters above the ones Verify accepts are lowered to them
+func NewHasher(params Params) *Hasher {
+	params.Memory = min(params.Memory, maxMemory)
+	params.Iterations = min(params.Iterations, maxIterations)
+	params.Parallelism = min(params.Parallelism, maxParallelism)
+	return &Hasher{params: params}
+}
+
+// Hash returns the PHC string of password, such as $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, keyBytes)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches hash, an Argon2id hash with any cost parameters or a bcrypt hash
+func (h *Hasher) Verify(hash, password string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrUnsupportedHash, err)
+		}
+		return true, nil
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	// #nosec G115 -- the key length was decoded from a hash this package wrote
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// NeedsRehash reports whether hash should be replaced by a new hash of the same password, because it was made
+// by another algorithm or with other cost parameters
+func (h *Hasher) NeedsRehash(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	return err != nil || params != h.params
+}
+
+// isBcrypt reports whether hash is in the modular crypt format of bcrypt
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// parseArgon2id splits an Argon2id PHC string into its cost parameters, salt and key. Hashes with cost
+// parameters, salts or keys above the package maxima are refused
+func parseArgon2id(hash string) (Params, []byte, []byte, error) {
+	var params Params
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	parts := strings.Split(hash, "$")
+	if len(parts) != argon2idFields {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	if params.Memory > maxMemory || params.Iterations > maxIterations || params.Parallelism > maxParallelism {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) > maxSaltBytes {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > maxKeyBytes {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,112 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keeps hashing fast in tests
+func testParams() Params {
+	return Params{Memory: 64, Iterations: 1, Parallelism: 1}
+}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	h := NewHasher(testParams())
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	ok, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify(hash, "correct horse battery")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// salts differ, so equal passwords get different hashes
+	again, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+}
+
+func TestHasher_LongPasswords(t *testing.T) {
+	h := NewHasher(testParams())
+	prefix := strings.Repeat("a", 72)
+
+	hash, err := h.Hash(prefix + "1")
+	require.NoError(t, err)
+
+	// unlike bcrypt, bytes after the 72nd still count
+	ok, err := h.Verify(hash, prefix+"2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHasher_VerifyOtherParamsAndBcrypt(t *testing.T) {
+	h := NewHasher(testParams())
+
+	old, err := NewHasher(Params{Memory: 32, Iterations: 2, Parallelism: 2}).Hash("password123")
+	require.NoError(t, err)
+	ok, err := h.Verify(old, "password123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	ok, err = h.Verify(string(legacy), "password123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = h.Verify(string(legacy), "wrong")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	h := NewHasher(testParams())
+
+	current, err := h.Hash("password123")
+	require.NoError(t, err)
+	assert.False(t, h.NeedsRehash(current))
+
+	old, err := NewHasher(Params{Memory: 32, Iterations: 1, Parallelism: 1}).Hash("password123")
+	require.NoError(t, err)
+	assert.True(t, h.NeedsRehash(old))
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	assert.True(t, h.NeedsRehash(string(legacy)))
+}
+
+func TestHasher_UnsupportedHashes(t *testing.T) {
+	h := NewHasher(testParams())
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$a2V5",
+		"$argon2id$v=19$m=4194304,t=1,p=1$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1000,p=1$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=255$c29tZXNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$" + strings.Repeat("a2V5", 30),
+		"$2a$10$short",
+	} {
+		ok, err := h.Verify(hash, "password123")
+		require.ErrorIs(t, err, ErrUnsupportedHash, "hash %q", hash)
+		assert.False(t, ok)
+	}
+}
+
+func TestNewHasher_LimitsParams(t *testing.T) {
+	h := NewHasher(Params{Memory: 4 * maxMemory, Iterations: 100, Parallelism: 200})
+	assert.Equal(t, Params{Memory: maxMemory, Iterations: maxIterations, Parallelism: maxParallelism}, h.params)
+}
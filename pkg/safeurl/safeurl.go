@@ -0,0 +1,164 @@
+// Package safeurl validates and fetches user supplied URLs without reaching internal network addresses
+package safeurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxLength is the longest accepted URL
+const MaxLength = 2048
+
+// maxRedirects limits the redirects followed by a client from NewClient
+const maxRedirects = 3
+
+// Errors returned for rejected URLs
+var (
+	ErrInvalidURL    = errors.New("invalid url")
+	ErrForbiddenHost = errors.New("url host is not allowed")
+)
+
+// Resolver looks up the addresses of a host, *net.Resolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Validate parses an absolute http or https URL and checks that every address its host resolves to is public,
+// error messages never quote the URL. The check alone does not stop a host from resolving differently later, fetch URLs with a client from NewClient
+func Validate(ctx context.Context, resolver Resolver, raw string) (*url.URL, error) {
+	u, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckHost(ctx, resolver, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Parse checks the form of an absolute http or https URL without resolving its host,
+// u.String() of the result is the normalized URL Validate returns for the same input
+func Parse(raw string) (*url.URL, error) {
+	if len(raw) > MaxLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, MaxLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot be parsed", ErrInvalidURL)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: host is required", ErrInvalidURL)
+	}
+	return u, nil
+}
+
+// CheckHost checks that the host of a parsed URL is public, hostnames are looked up with resolver
+func CheckHost(ctx context.Context, resolver Resolver, u *url.URL) error {
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%w: %s is not a public address", ErrForbiddenHost, host)
+		}
+		return nil
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: local hosts are not allowed", ErrForbiddenHost)
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: host cannot be resolved", ErrInvalidURL)
+	}
+	for _, a := range addrs {
+		addr, ok := netip.AddrFromSlice(a.IP)
+		if !ok || !IsPublic(addr) {
+			return fmt.Errorf("%w: host resolves to a non-public address", ErrForbiddenHost)
+		}
+	}
+	return nil
+}
+
+// IsPublic reports whether an address is globally routable, loopback, private, link-local,
+// shared (CGNAT), multicast and unspecified addresses are not
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes() {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonPublicPrefixes lists special purpose ranges the netip predicates do not cover
+func nonPublicPrefixes() []netip.Prefix {
+	return []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+		netip.MustParsePrefix("64:ff9b::/96"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+}
+
+// NewClient returns an HTTP client that refuses to connect to non-public addresses.
+// The check runs on the address actually dialled, so DNS answers changing after Validate do not help an attacker
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !IsPublic(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenHost, address)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect limits the number of redirects and keeps them on http and https
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("%w: too many redirects", ErrInvalidURL)
+	}
+	return checkScheme(req.URL)
+}
+
+// checkScheme rejects URLs that are not plain http or https, so no other protocol handler is ever reached
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https are allowed", ErrInvalidURL)
+	}
+	return nil
+}
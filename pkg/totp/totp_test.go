@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFCVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		// the RFC lists 8 digit codes, the last 6 digits are the 6 digit codes
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, code, "time %d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Counter(now)
+
+	counter, ok := Validate(rfcSecret, "050471", now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, step, counter)
+
+	// a code of the previous step is accepted within the skew
+	previous, err := Code(rfcSecret, step-1)
+	require.NoError(t, err)
+	counter, ok = Validate(rfcSecret, previous[:3]+" "+previous[3:], now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, counter)
+
+	old, err := Code(rfcSecret, step-2)
+	require.NoError(t, err)
+	_, ok = Validate(rfcSecret, old, now, 1)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "12345", now, 1)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", "050471", now, 1)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	_, err = Code(secret, 1)
+	require.NoError(t, err)
+
+	uri := URI("Marketplace", "alice", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Marketplace:alice?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Marketplace")
+	assert.Contains(t, uri, "digits=6")
+}